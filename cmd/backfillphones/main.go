@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"sinibeli/internal/app/customer"
+	"sinibeli/internal/config"
+	"sinibeli/internal/infrastructure/database"
+	"sinibeli/internal/pkg/fieldcrypt"
+	logger "sinibeli/internal/pkg/logging"
+	"sinibeli/internal/pkg/redact"
+	"sinibeli/pkg/validator"
+)
+
+// backfillphones normalizes existing customer phone numbers to E.164 and
+// rebuilds their blind indexes. Numbers that do not parse are left as they
+// are and listed at the end, masked, so they can be fixed by hand.
+func main() {
+	batchSize := flag.Int("batch", 500, "customers read per batch")
+	dryRun := flag.Bool("dry-run", false, "report what would change without writing")
+	envPath := flag.String("env", ".env", "path to the env file")
+	flag.Parse()
+
+	cfg, err := config.LoadConfig(*envPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	if err := logger.Init(cfg.Logger); err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+
+	if *batchSize <= 0 {
+		log.Fatal("-batch must be positive")
+	}
+
+	keyring, err := fieldcrypt.LoadKeyring(cfg.Encryption)
+	if err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+
+	db, err := database.NewDB(&cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	repo := customer.NewCustomerRepo(db.DB, fieldcrypt.NewCipher(keyring), nil)
+
+	type failure struct {
+		id     int64
+		phone  string
+		reason error
+	}
+	var failures []failure
+
+	start := time.Now()
+	var afterID int64
+	scanned, updated := 0, 0
+	for {
+		batch, err := repo.ListPhones(ctx, afterID, *batchSize)
+		if err != nil {
+			log.Fatalf("Backfill failed after %d customers: %v", scanned, err)
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		for i := range batch {
+			c := &batch[i]
+			afterID = c.ID
+			scanned++
+
+			// An unparseable number clears any stale E.164 value, which also
+			// moves its blind index back to the digits.
+			e164, err := validator.Phone(c.PhoneNumber)
+			if err != nil {
+				failures = append(failures, failure{id: c.ID, phone: redact.Phone(c.PhoneNumber), reason: err})
+				e164 = ""
+			}
+
+			if e164 == c.PhoneE164 {
+				continue
+			}
+			updated++
+			if *dryRun {
+				continue
+			}
+			c.PhoneE164 = e164
+			if err := repo.UpdatePhoneE164(ctx, c); err != nil {
+				log.Fatalf("Backfill failed at customer %d: %v", c.ID, err)
+			}
+		}
+		logger.Info("Customer phone batch processed", "customers", len(batch), "total", scanned)
+	}
+
+	if len(failures) > 0 {
+		fmt.Printf("\n%d phone numbers could not be normalized:\n\n", len(failures))
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "CUSTOMER\tPHONE\tREASON")
+		for _, f := range failures {
+			fmt.Fprintf(w, "%d\t%s\t%v\n", f.id, f.phone, f.reason)
+		}
+		w.Flush()
+		fmt.Println()
+	}
+
+	mode := ""
+	if *dryRun {
+		mode = " (dry run)"
+	}
+	log.Printf("Scanned %d customers, updated %d, %d unparseable in %s%s",
+		scanned, updated, len(failures), time.Since(start).Round(time.Millisecond), mode)
+}
@@ -1,20 +1,45 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+	_ "time/tzdata"
 
+	"sinibeli/internal/app/admin"
+	"sinibeli/internal/app/analytics"
+	"sinibeli/internal/app/apidoc"
+	"sinibeli/internal/app/attachment"
+	"sinibeli/internal/app/audit"
 	"sinibeli/internal/app/company"
 	"sinibeli/internal/app/customer"
+	"sinibeli/internal/app/health"
 	"sinibeli/internal/app/product"
+	"sinibeli/internal/app/rollup"
 	"sinibeli/internal/app/transaction"
 	"sinibeli/internal/config"
 	"sinibeli/internal/infrastructure/cache"
 	"sinibeli/internal/infrastructure/database"
+	"sinibeli/internal/infrastructure/storage"
+	"sinibeli/internal/middleware"
+	"sinibeli/internal/pkg/fieldcrypt"
+	"sinibeli/internal/pkg/i18n"
+	"sinibeli/internal/pkg/jwt"
 	logger "sinibeli/internal/pkg/logging"
+	"sinibeli/internal/pkg/metrics"
+	"sinibeli/internal/pkg/openapi"
+	"sinibeli/internal/pkg/redact"
+	"sinibeli/internal/pkg/tracing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 func main() {
@@ -24,7 +49,18 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	logger.Init()
+	if err := logger.Init(cfg.Logger); err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+
+	if err := i18n.Init(cfg.I18N); err != nil {
+		log.Fatalf("Failed to load translations: %v", err)
+	}
+
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
 
 	db, err := database.NewDB(&cfg.Database)
 	if err != nil {
@@ -32,72 +68,197 @@ func main() {
 	}
 	defer db.Close()
 
-	redisCache := cache.NewRedisCache(cfg.Cache)
-	defer redisCache.Close()
+	appCache := cache.New(cfg.Cache)
+	defer appCache.Close()
+
+	metrics.RegisterDB(db.DB, "postgres")
+	metrics.RegisterCache(appCache)
 
-	router := gin.Default()
+	router := gin.New()
+	router.Use(middleware.RequestIDMiddleware())
+	router.Use(otelgin.Middleware(cfg.Tracing.ServiceName, otelgin.WithGinFilter(tracedRoute)))
+	router.Use(middleware.MetricsMiddleware())
+	router.Use(middleware.AccessLogMiddleware())
+	router.Use(middleware.ErrorMiddleware())
+	router.Use(middleware.RecoveryMiddleware())
+	router.NoRoute(middleware.NoRoute)
 
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	healthHandler := health.NewHealthHandler(db.DB, appCache, cfg.Server.ReadinessTimeout)
+	router.GET("/livez", healthHandler.Livez)
+	router.GET("/readyz", healthHandler.Readyz)
+	router.GET("/health", healthHandler.Readyz)
+
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	if err := openapi.Register(router, apidoc.Spec()); err != nil {
+		log.Fatalf("Failed to build the API document: %v", err)
+	}
+
+	router.GET("/cache/stats", func(c *gin.Context) {
+		c.JSON(http.StatusOK, appCache.Stats())
 	})
 
-	v1 := router.Group("/api/v1")
+	jwtService := jwt.NewJWTService(cfg.JWT.SecretKey, cfg.JWT.Issuer)
+
+	adminHandler := admin.NewAdminHandler()
+	adm := router.Group("/admin", middleware.AuthMiddleware(jwtService), middleware.RequireRole(cfg.Admin.Roles))
+	{
+		adm.GET("/log-level", adminHandler.GetLogLevel)
+		adm.PUT("/log-level", adminHandler.SetLogLevel)
+	}
+
+	invalidator := cache.NewInvalidator(appCache)
+
+	v1 := router.Group("/api/v1", middleware.OptionalAuthMiddleware(jwtService))
+
+	reportLocation, err := time.LoadLocation(cfg.Report.TimeZone)
+	if err != nil {
+		log.Fatalf("Failed to load report time zone %q: %v", cfg.Report.TimeZone, err)
+	}
+
+	rollupRepo := rollup.NewRollupRepo(db.DB, reportLocation)
+	rollupService := rollup.NewRollupService(rollupRepo)
+
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var workers sync.WaitGroup
 
-	txRepo := transaction.NewTransactionRepo(db.DB)
-	customerRepo := customer.NewCustomerRepo(db.DB)
-	productRepo := product.NewProductRepo(db.DB)
+	refresher := rollup.NewRefresher(rollupService, cfg.Report.RollupRefreshInterval, cfg.Report.RollupLookbackDays)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		refresher.Run(workerCtx)
+	}()
+
+	auditRepo := audit.NewAuditRepo(db.DB)
+	recorder := audit.NewRecorder(auditRepo)
+
+	txRepo := transaction.NewTransactionRepo(db.DB, rollupRepo)
+	keyring, err := fieldcrypt.LoadKeyring(cfg.Encryption)
+	if err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+	blobStore, err := storage.New(cfg.Storage)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	customerRepo := customer.NewCustomerRepo(db.DB, fieldcrypt.NewCipher(keyring), rollupRepo)
+	unindexed, err := customerRepo.CountUnindexedEmails(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to check customer email indexes: %v", err)
+	}
+	if unindexed > 0 {
+		log.Fatalf("%d customers have no email blind index yet; run go run ./cmd/rotatekeys first", unindexed)
+	}
+	productRepo := product.NewProductRepo(db.DB, rollupRepo)
 	companyRepo := company.NewCompanyRepo(db.DB)
 
-	txService := transaction.NewTransactionService(txRepo, customerRepo, productRepo)
+	txService := transaction.NewTransactionService(txRepo, customerRepo, productRepo, appCache, invalidator, recorder)
 	transactionHandler := transaction.NewTransactionHandler(txService)
-	trx := v1.Group("/transactions")
-	{
-		trx.POST("", transactionHandler.Create)
-		trx.GET("", transactionHandler.GetAll)
-		trx.GET("/:id", transactionHandler.GetByID)
-		trx.GET("/summary", transactionHandler.GetTransactionSummaryFiltered)
-		trx.GET("/reports", transactionHandler.GetCustomerActivity)
-	}
 
-	companyService := company.NewCompanyService(companyRepo)
+	attachmentRepo := attachment.NewAttachmentRepo(db.DB)
+	attachmentService := attachment.NewAttachmentService(attachmentRepo, blobStore, attachment.NoopScanner{},
+		appCache, invalidator, recorder, cfg.Storage.AttachmentMaxBytes)
+	attachmentHandler := attachment.NewAttachmentHandler(attachmentService)
+	requireAuth := middleware.AuthMiddleware(jwtService)
+
+	companyService := company.NewCompanyService(companyRepo, appCache, invalidator, recorder)
 	companyHandler := company.NewCompanyHandler(companyService)
-	comp := v1.Group("/companies")
-	{
-		comp.POST("", companyHandler.Create)
-		comp.GET("", companyHandler.GetAll)
-		comp.GET("/:id", companyHandler.GetByID)
-		comp.PUT("/:id", companyHandler.Update)
-		comp.DELETE("/:id", companyHandler.Delete)
+
+	photoService := customer.NewPhotoService(customerRepo, blobStore, invalidator, recorder, cfg.Storage)
+	customerService := customer.NewCustomerService(customerRepo, photoService, appCache, invalidator, recorder)
+	mergeService := customer.NewMergeService(customer.NewMergeRepo(db.DB, rollupRepo), customerRepo, appCache, invalidator, recorder)
+	customerHandler := customer.NewCustomerHandler(customerService, photoService, mergeService, redact.NewPolicy(cfg.PII.PrivilegedRoles))
+
+	productService := product.NewProductService(productRepo, appCache, invalidator, recorder)
+	productHandler := product.NewProductHandler(productService)
+
+	analyticsRepo := analytics.NewAnalyticsRepo(db.DB)
+	analyticsService := analytics.NewAnalyticsService(analyticsRepo, appCache, reportLocation)
+	analyticsHandler := analytics.NewAnalyticsHandler(analyticsService)
+
+	auditHandler := audit.NewAuditHandler(audit.NewAuditService(auditRepo))
+
+	registerAPI(v1, apiHandlers{
+		transaction: transactionHandler,
+		attachment:  attachmentHandler,
+		company:     companyHandler,
+		customer:    customerHandler,
+		product:     productHandler,
+		analytics:   analyticsHandler,
+		audit:       auditHandler,
+	}, routeGuards{
+		auth:  requireAuth,
+		admin: middleware.RequireRole(cfg.Admin.Roles),
+		pii:   middleware.RequireRole(cfg.PII.PrivilegedRoles),
+	})
+
+	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
 	}
 
-	customerService := customer.NewCustomerService(customerRepo)
-	customerHandler := customer.NewCustomerHandler(customerService)
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
 
-	cust := v1.Group("/customers")
-	{
-		cust.POST("", customerHandler.Create)
-		cust.GET("", customerHandler.GetAll)
-		cust.GET("/:id", customerHandler.GetByID)
-		cust.PUT("/:id", customerHandler.Update)
-		cust.DELETE("/:id", customerHandler.Delete)
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("Starting server", "addr", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+		close(serverErr)
+	}()
+
+	select {
+	case err := <-serverErr:
+		if err != nil {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	case <-signalCtx.Done():
+		logger.Info("Shutdown signal received, draining",
+			"delay", cfg.Server.DrainDelay.String(), "timeout", cfg.Server.ShutdownTimeout.String())
 	}
 
-	productService := product.NewProductService(productRepo)
-	productHandler := product.NewProductHandler(productService)
+	// Keep serving while /readyz reports draining, so load balancers stop
+	// routing here before the listener closes.
+	healthHandler.SetDraining()
+	time.Sleep(cfg.Server.DrainDelay)
 
-	prod := v1.Group("/products")
-	{
-		prod.POST("", productHandler.Create)
-		prod.GET("", productHandler.GetAll)
-		prod.GET("/:id", productHandler.GetByID)
-		prod.PUT("/:id", productHandler.Update)
-		prod.DELETE("/:id", productHandler.Delete)
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancelShutdown()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("Server did not drain cleanly", "error", err)
 	}
 
-	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
-	log.Printf("Starting server on %s", addr)
+	stopWorkers()
+	workersDone := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(workersDone)
+	}()
+
+	select {
+	case <-workersDone:
+	case <-shutdownCtx.Done():
+		logger.Warn("Background workers did not stop before the shutdown deadline")
+	}
+
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Warn("Failed to flush traces", "error", err)
+	}
+
+	logger.Info("Server stopped")
+}
 
-	if err := http.ListenAndServe(addr, router); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+// tracedRoute keeps probes and scrapes out of the traces.
+func tracedRoute(c *gin.Context) bool {
+	switch c.FullPath() {
+	case "/livez", "/readyz", "/health", "/metrics", "/openapi.json", "/docs":
+		return false
 	}
+	return true
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"sinibeli/internal/app/audit"
+	"sinibeli/internal/app/customer"
+	"sinibeli/internal/config"
+	"sinibeli/internal/infrastructure/cache"
+	"sinibeli/internal/infrastructure/database"
+	"sinibeli/internal/infrastructure/storage"
+	"sinibeli/internal/pkg/fieldcrypt"
+	logger "sinibeli/internal/pkg/logging"
+)
+
+// migratephotos moves customer photos stored inline as data URIs into blob
+// storage and generates their thumbnails. Photos that fail (not a data URI,
+// not a supported image) are logged and left in place; the run can be
+// repeated safely.
+func main() {
+	batchSize := flag.Int("batch", 100, "customers read per batch")
+	envPath := flag.String("env", ".env", "path to the env file")
+	flag.Parse()
+
+	cfg, err := config.LoadConfig(*envPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	if err := logger.Init(cfg.Logger); err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+
+	if *batchSize <= 0 {
+		log.Fatal("-batch must be positive")
+	}
+
+	keyring, err := fieldcrypt.LoadKeyring(cfg.Encryption)
+	if err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+
+	store, err := storage.New(cfg.Storage)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	db, err := database.NewDB(&cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	appCache := cache.New(cfg.Cache)
+	defer appCache.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx = audit.WithSystemActor(ctx, "migratephotos")
+
+	repo := customer.NewCustomerRepo(db.DB, fieldcrypt.NewCipher(keyring), nil)
+	recorder := audit.NewRecorder(audit.NewAuditRepo(db.DB))
+	photos := customer.NewPhotoService(repo, store, cache.NewInvalidator(appCache), recorder, cfg.Storage)
+
+	start := time.Now()
+	failed := 0
+	migrated, err := photos.MigrateLegacy(ctx, *batchSize, func(id int64, err error) {
+		failed++
+		logger.Warn("Customer photo not migrated", "customer_id", id, "error", err)
+	})
+	if err != nil {
+		log.Fatalf("Photo migration failed after %d customers: %v", migrated, err)
+	}
+
+	log.Printf("Migrated %d customer photos (%d failed) in %s",
+		migrated, failed, time.Since(start).Round(time.Millisecond))
+}
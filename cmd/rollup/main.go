@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+	_ "time/tzdata"
+
+	"sinibeli/internal/app/rollup"
+	"sinibeli/internal/config"
+	"sinibeli/internal/infrastructure/database"
+	logger "sinibeli/internal/pkg/logging"
+)
+
+func main() {
+	fromStr := flag.String("from", "", "first day to rebuild (YYYY-MM-DD, required)")
+	toStr := flag.String("to", "", "last day to rebuild (YYYY-MM-DD, defaults to today)")
+	envPath := flag.String("env", ".env", "path to the env file")
+	flag.Parse()
+
+	cfg, err := config.LoadConfig(*envPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	if err := logger.Init(cfg.Logger); err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+
+	loc, err := time.LoadLocation(cfg.Report.TimeZone)
+	if err != nil {
+		log.Fatalf("Failed to load report time zone %q: %v", cfg.Report.TimeZone, err)
+	}
+
+	if *fromStr == "" {
+		log.Fatal("-from is required")
+	}
+	from, err := time.ParseInLocation("2006-01-02", *fromStr, loc)
+	if err != nil {
+		log.Fatalf("Invalid -from date: %v", err)
+	}
+
+	to := time.Now().In(loc)
+	if *toStr != "" {
+		to, err = time.ParseInLocation("2006-01-02", *toStr, loc)
+		if err != nil {
+			log.Fatalf("Invalid -to date: %v", err)
+		}
+	}
+
+	db, err := database.NewDB(&cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	service := rollup.NewRollupService(rollup.NewRollupRepo(db.DB, loc))
+
+	start := time.Now()
+	total, err := service.Rebuild(context.Background(), from, to)
+	if err != nil {
+		log.Fatalf("Rollup rebuild failed after %d buckets: %v", total, err)
+	}
+
+	log.Printf("Rebuilt %d rollup buckets from %s to %s in %s",
+		total, from.Format("2006-01-02"), to.Format("2006-01-02"), time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"sinibeli/internal/app/customer"
+	"sinibeli/internal/config"
+	"sinibeli/internal/infrastructure/database"
+	"sinibeli/internal/pkg/fieldcrypt"
+	logger "sinibeli/internal/pkg/logging"
+)
+
+// rotatekeys re-encrypts customer PII with the active key. Run it after adding
+// a new key and making it active, keeping the old key in the keyring until it
+// finishes; it also encrypts rows that still hold legacy plaintext and fills
+// the blind indexes they lack, which the API waits for before it starts.
+func main() {
+	batchSize := flag.Int("batch", 500, "customers re-encrypted per transaction")
+	envPath := flag.String("env", ".env", "path to the env file")
+	flag.Parse()
+
+	cfg, err := config.LoadConfig(*envPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	if err := logger.Init(cfg.Logger); err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+
+	if *batchSize <= 0 {
+		log.Fatal("-batch must be positive")
+	}
+
+	keyring, err := fieldcrypt.LoadKeyring(cfg.Encryption)
+	if err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+
+	db, err := database.NewDB(&cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	repo := customer.NewCustomerRepo(db.DB, fieldcrypt.NewCipher(keyring), nil)
+
+	start := time.Now()
+	total := 0
+	for {
+		n, err := repo.ReencryptBatch(ctx, *batchSize)
+		if err != nil {
+			log.Fatalf("Re-encryption failed after %d customers: %v", total, err)
+		}
+		if n == 0 {
+			break
+		}
+		total += n
+		logger.Info("Customer batch re-encrypted", "customers", n, "total", total)
+	}
+
+	log.Printf("Re-encrypted %d customers with key %q in %s",
+		total, keyring.ActiveKeyID(), time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"sinibeli/internal/app/analytics"
+	"sinibeli/internal/app/attachment"
+	"sinibeli/internal/app/audit"
+	"sinibeli/internal/app/company"
+	"sinibeli/internal/app/customer"
+	"sinibeli/internal/app/product"
+	"sinibeli/internal/app/transaction"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiHandlers are the handlers behind the /api/v1 routes.
+type apiHandlers struct {
+	transaction *transaction.TransactionHandler
+	attachment  *attachment.AttachmentHandler
+	company     *company.CompanyHandler
+	customer    *customer.CustomerHandler
+	product     *product.ProductHandler
+	analytics   *analytics.AnalyticsHandler
+	audit       *audit.AuditHandler
+}
+
+// routeGuards are the middlewares routes add on top of optional auth. admin
+// and pii check the caller's role, so they only go after auth.
+type routeGuards struct {
+	auth  gin.HandlerFunc
+	admin gin.HandlerFunc // ADMIN_ROLES
+	pii   gin.HandlerFunc // PII_PRIVILEGED_ROLES
+}
+
+// registerAPI adds the /api/v1 routes. Routes in the company, customer,
+// product and transaction groups must be described in apidoc, which
+// routes_test checks.
+func registerAPI(v1 *gin.RouterGroup, h apiHandlers, g routeGuards) {
+	trx := v1.Group("/transactions")
+	{
+		trx.POST("", h.transaction.Create)
+		trx.GET("", h.transaction.GetAll)
+		trx.GET("/:id", h.transaction.GetByID)
+		trx.GET("/summary", h.transaction.GetTransactionSummaryFiltered)
+		trx.GET("/reports", h.transaction.GetCustomerActivity)
+		trx.POST("/:id/attachments", g.auth, h.attachment.Create)
+		trx.GET("/:id/attachments", g.auth, h.attachment.ListByTransaction)
+	}
+
+	att := v1.Group("/attachments", g.auth)
+	{
+		att.GET("/:id", h.attachment.GetByID)
+		att.GET("/:id/download", h.attachment.Download)
+		att.DELETE("/:id", h.attachment.Delete)
+	}
+
+	comp := v1.Group("/companies")
+	{
+		comp.POST("", h.company.Create)
+		comp.GET("", h.company.GetAll)
+		comp.GET("/:id", h.company.GetByID)
+		comp.PUT("/:id", h.company.Update)
+		comp.PATCH("/:id", h.company.Patch)
+		comp.DELETE("/:id", h.company.Delete)
+		comp.POST("/:id/restore", h.company.Restore)
+	}
+
+	cust := v1.Group("/customers")
+	{
+		cust.POST("", h.customer.Create)
+		cust.GET("", h.customer.GetAll)
+		cust.GET("/search", h.customer.Search)
+		cust.GET("/duplicates", h.customer.Duplicates)
+		cust.POST("/merges/:mergeId/undo", g.auth, h.customer.UndoMerge)
+		cust.GET("/:id", h.customer.GetByID)
+		cust.PUT("/:id", h.customer.Update)
+		cust.PATCH("/:id", h.customer.Patch)
+		cust.DELETE("/:id", h.customer.Delete)
+		cust.POST("/:id/restore", h.customer.Restore)
+		cust.PUT("/:id/photo", g.auth, g.pii, h.customer.PutPhoto)
+		cust.GET("/:id/photo", h.customer.GetPhoto)
+		cust.DELETE("/:id/photo", g.auth, g.pii, h.customer.DeletePhoto)
+		cust.POST("/:id/merge", g.auth, h.customer.Merge)
+		cust.GET("/:id/merges", h.customer.MergeHistory)
+	}
+
+	prod := v1.Group("/products")
+	{
+		prod.POST("", h.product.Create)
+		prod.GET("", h.product.GetAll)
+		prod.GET("/:id", h.product.GetByID)
+		prod.PUT("/:id", h.product.Update)
+		prod.PATCH("/:id", h.product.Patch)
+		prod.DELETE("/:id", h.product.Delete)
+		prod.POST("/:id/restore", h.product.Restore)
+	}
+
+	anl := v1.Group("/analytics")
+	{
+		anl.GET("/timeseries", h.analytics.GetTimeSeries)
+	}
+
+	aud := v1.Group("/audit", g.auth, g.admin)
+	{
+		aud.GET("", h.audit.List)
+		aud.GET("/verify", h.audit.Verify)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"sinibeli/internal/app/apidoc"
+	"sinibeli/internal/pkg/openapi"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// documentedGroups are the route groups apidoc must describe in full.
+var documentedGroups = []string{"/api/v1/companies", "/api/v1/customers", "/api/v1/products", "/api/v1/transactions"}
+
+func documented(path string) bool {
+	for _, g := range documentedGroups {
+		if path == g || strings.HasPrefix(path, g+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAPIRoutesAreDocumented(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	pass := func(c *gin.Context) {}
+	registerAPI(router.Group("/api/v1"), apiHandlers{}, routeGuards{auth: pass, admin: pass, pii: pass})
+	spec := apidoc.Spec()
+
+	registered := make(map[string]bool)
+	for _, r := range router.Routes() {
+		if !documented(r.Path) {
+			continue
+		}
+		registered[strings.ToLower(r.Method)+" "+openapi.Path(r.Path)] = true
+		assert.True(t, spec.Has(r.Method, r.Path), "%s %s is registered but missing from the API document", r.Method, r.Path)
+	}
+	assert.NotEmpty(t, registered)
+
+	for path, item := range spec.Paths {
+		for method := range item {
+			assert.True(t, registered[method+" "+path], "%s %s is documented but not registered", strings.ToUpper(method), path)
+		}
+	}
+}
+
+func TestGuardedRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	var guarded []string
+	guard := func(name string, status int) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			guarded = append(guarded, name)
+			if status != 0 {
+				c.AbortWithStatus(status)
+			}
+		}
+	}
+	registerAPI(router.Group("/api/v1"), apiHandlers{}, routeGuards{
+		auth:  guard("auth", 0),
+		admin: guard("admin", http.StatusForbidden),
+		pii:   guard("pii", http.StatusForbidden),
+	})
+
+	cases := []struct {
+		method, path string
+		want         []string
+	}{
+		{http.MethodGet, "/api/v1/audit", []string{"auth", "admin"}},
+		{http.MethodGet, "/api/v1/audit/verify", []string{"auth", "admin"}},
+		{http.MethodPut, "/api/v1/customers/7/photo", []string{"auth", "pii"}},
+		{http.MethodDelete, "/api/v1/customers/7/photo", []string{"auth", "pii"}},
+	}
+	for _, tc := range cases {
+		guarded = nil
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		assert.Equal(t, http.StatusForbidden, w.Code, "%s %s", tc.method, tc.path)
+		assert.Equal(t, tc.want, guarded, "%s %s", tc.method, tc.path)
+	}
+}
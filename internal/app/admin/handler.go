@@ -0,0 +1,50 @@
+package admin
+
+import (
+	"net/http"
+
+	"sinibeli/internal/pkg/apperr"
+	logger "sinibeli/internal/pkg/logging"
+	"sinibeli/internal/pkg/request"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminHandler struct{}
+
+func NewAdminHandler() *AdminHandler {
+	return &AdminHandler{}
+}
+
+type setLogLevelReq struct {
+	Level   string `json:"level"`
+	Package string `json:"package"`
+}
+
+func (h *AdminHandler) GetLogLevel(c *gin.Context) {
+	c.JSON(http.StatusOK, logger.Levels())
+}
+
+// SetLogLevel changes the global level, or one package's override when
+// "package" is given. An empty level with a package clears that override.
+func (h *AdminHandler) SetLogLevel(c *gin.Context) {
+	req, ok := request.BindJSON[setLogLevelReq](c)
+	if !ok {
+		return
+	}
+
+	var err error
+	if req.Package != "" {
+		err = logger.SetPackageLevel(req.Package, req.Level)
+	} else {
+		err = logger.SetLevel(req.Level)
+	}
+	if err != nil {
+		c.Error(apperr.Wrap(apperr.Invalid, "invalid_log_level", err))
+		return
+	}
+
+	logger.InfoCtx(c.Request.Context(), "Log level changed",
+		"level", req.Level, "package", req.Package, "user_id", c.GetString("user_id"))
+	c.JSON(http.StatusOK, logger.Levels())
+}
@@ -0,0 +1,76 @@
+package admin_test
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"sinibeli/internal/app/admin"
+	"sinibeli/internal/middleware"
+	"sinibeli/internal/pkg/jwt"
+	logger "sinibeli/internal/pkg/logging"
+
+	"github.com/gin-gonic/gin"
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const secret = "test-secret"
+
+func token(t *testing.T, role string) string {
+	claims := jwt.JWTClaims{
+		UserID: "u-1",
+		Role:   role,
+		RegisteredClaims: gojwt.RegisteredClaims{
+			ExpiresAt: gojwt.NewNumericDate(time.Now().Add(time.Hour)),
+			Issuer:    "test",
+		},
+	}
+	signed, err := gojwt.NewWithClaims(gojwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	require.NoError(t, err)
+	return "Bearer " + signed
+}
+
+func TestLogLevelRequiresAdminRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	h := admin.NewAdminHandler()
+	router := gin.New()
+	router.Use(middleware.ErrorMiddleware())
+	adm := router.Group("/admin",
+		middleware.AuthMiddleware(jwt.NewJWTService(secret, "test")),
+		middleware.RequireRole([]string{"admin"}))
+	adm.GET("/log-level", h.GetLogLevel)
+	adm.PUT("/log-level", h.SetLogLevel)
+
+	tests := []struct {
+		name   string
+		method string
+		auth   string
+		want   int
+	}{
+		{"no token", http.MethodPut, "", http.StatusUnauthorized},
+		{"token without role", http.MethodPut, token(t, ""), http.StatusForbidden},
+		{"other role", http.MethodPut, token(t, "support"), http.StatusForbidden},
+		{"other role reading", http.MethodGet, token(t, "support"), http.StatusForbidden},
+		{"admin", http.MethodGet, token(t, "admin"), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/admin/log-level", bytes.NewBufferString(`{"level":"debug"}`))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			assert.Equal(t, tt.want, rec.Code, rec.Body.String())
+		})
+	}
+}
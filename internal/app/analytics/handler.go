@@ -0,0 +1,106 @@
+package analytics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"sinibeli/internal/pkg/apperr"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errInvalidTimeZoneParam  = apperr.InvalidParam("tz", ErrInvalidTimeZone.Message).With("example", "Asia/Jakarta")
+	errInvalidFromParam      = apperr.InvalidParam("from", "from must be YYYY-MM-DD or RFC3339").With("example", "2023-01-01")
+	errInvalidToParam        = apperr.InvalidParam("to", "to must be YYYY-MM-DD or RFC3339").With("example", "2023-12-31")
+	errInvalidCompanyIDParam = apperr.InvalidParam("company_id", "company_id must be a positive integer")
+	errInvalidProductIDParam = apperr.InvalidParam("product_id", "product_id must be a positive integer")
+)
+
+type AnalyticsHandler struct {
+	service *AnalyticsService
+}
+
+func NewAnalyticsHandler(service *AnalyticsService) *AnalyticsHandler {
+	return &AnalyticsHandler{service: service}
+}
+
+func (h *AnalyticsHandler) GetTimeSeries(c *gin.Context) {
+	filter := TimeSeriesFilter{
+		Bucket:  c.DefaultQuery("bucket", BucketDay),
+		GroupBy: c.Query("group_by"),
+	}
+
+	filter.Location = h.service.DefaultLocation()
+	if tz := c.Query("tz"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			c.Error(errInvalidTimeZoneParam)
+			return
+		}
+		filter.Location = loc
+	}
+
+	filter.From, filter.To = defaultRange(time.Now(), filter.Location)
+
+	if fromStr := c.Query("from"); fromStr != "" {
+		from, _, err := parseBound(fromStr, filter.Location)
+		if err != nil {
+			c.Error(errInvalidFromParam)
+			return
+		}
+		filter.From = from
+	}
+
+	if toStr := c.Query("to"); toStr != "" {
+		to, dateOnly, err := parseBound(toStr, filter.Location)
+		if err != nil {
+			c.Error(errInvalidToParam)
+			return
+		}
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		filter.To = to
+	}
+
+	if cidStr := c.Query("company_id"); cidStr != "" {
+		cid, err := strconv.ParseInt(cidStr, 10, 64)
+		if err != nil || cid <= 0 {
+			c.Error(errInvalidCompanyIDParam)
+			return
+		}
+		filter.CompanyID = &cid
+	}
+
+	if pidStr := c.Query("product_id"); pidStr != "" {
+		pid, err := strconv.ParseInt(pidStr, 10, 64)
+		if err != nil || pid <= 0 {
+			c.Error(errInvalidProductIDParam)
+			return
+		}
+		filter.ProductID = &pid
+	}
+
+	resp, err := h.service.GetTimeSeries(c.Request.Context(), filter)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// parseBound accepts either a calendar date in the requested zone or a full
+// RFC3339 timestamp, and reports which one it was.
+func parseBound(value string, loc *time.Location) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, loc); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return t, false, nil
+}
@@ -0,0 +1,152 @@
+package analytics
+
+import (
+	"time"
+
+	"sinibeli/internal/pkg/apperr"
+)
+
+const (
+	BucketHour  = "hour"
+	BucketDay   = "day"
+	BucketWeek  = "week"
+	BucketMonth = "month"
+)
+
+const (
+	GroupByNone          = ""
+	GroupByCompany       = "company"
+	GroupByProduct       = "product"
+	GroupByPaymentMethod = "payment_method"
+	GroupByStatus        = "status"
+)
+
+const MaxBuckets = 2000
+
+var (
+	ValidBuckets = []string{BucketHour, BucketDay, BucketWeek, BucketMonth}
+	ValidGroupBy = []string{GroupByCompany, GroupByProduct, GroupByPaymentMethod, GroupByStatus}
+)
+
+var (
+	ErrInvalidBucket    = apperr.New(apperr.Invalid, "invalid_bucket", "bucket must be one of: hour, day, week, month").With("valid_buckets", ValidBuckets)
+	ErrInvalidGroupBy   = apperr.New(apperr.Invalid, "invalid_group_by", "group_by must be one of: company, product, payment_method, status").With("valid_group_by", ValidGroupBy)
+	ErrInvalidTimeZone  = apperr.New(apperr.Invalid, "invalid_time_zone", "tz must be a valid IANA time zone")
+	ErrInvalidTimeRange = apperr.New(apperr.Invalid, "invalid_time_range", "from must be before to")
+	ErrTooManyBuckets   = apperr.New(apperr.Invalid, "too_many_buckets", "requested range produces too many buckets, narrow the range or use a larger bucket")
+	ErrInvalidCompanyID = apperr.New(apperr.Invalid, "invalid_company_id", "company_id must be greater than 0")
+	ErrInvalidProductID = apperr.New(apperr.Invalid, "invalid_product_id", "product_id must be greater than 0")
+)
+
+type TimeSeriesFilter struct {
+	From      time.Time
+	To        time.Time
+	Bucket    string
+	Location  *time.Location
+	GroupBy   string
+	CompanyID *int64
+	ProductID *int64
+}
+
+type BucketRow struct {
+	BucketStart time.Time
+	GroupKey    string
+	GroupLabel  string
+	Count       int64
+	GrossAmount float64
+	TaxAmount   float64
+	FeeAmount   float64
+}
+
+type Point struct {
+	BucketStart time.Time `json:"bucket_start"`
+	Count       int64     `json:"count"`
+	GrossAmount float64   `json:"gross_amount"`
+	TaxAmount   float64   `json:"tax_amount"`
+	FeeAmount   float64   `json:"fee_amount"`
+}
+
+type Series struct {
+	Key    string  `json:"key"`
+	Label  string  `json:"label"`
+	Points []Point `json:"points"`
+}
+
+type TimeSeriesResponse struct {
+	Bucket   string    `json:"bucket"`
+	TimeZone string    `json:"time_zone"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	GroupBy  string    `json:"group_by,omitempty"`
+	Series   []Series  `json:"series"`
+}
+
+func (f *TimeSeriesFilter) Validate() error {
+	if !contains(ValidBuckets, f.Bucket) {
+		return ErrInvalidBucket
+	}
+	if f.GroupBy != GroupByNone && !contains(ValidGroupBy, f.GroupBy) {
+		return ErrInvalidGroupBy
+	}
+	if f.Location == nil {
+		return ErrInvalidTimeZone
+	}
+	if !f.From.Before(f.To) {
+		return ErrInvalidTimeRange
+	}
+	if f.CompanyID != nil && *f.CompanyID <= 0 {
+		return ErrInvalidCompanyID
+	}
+	if f.ProductID != nil && *f.ProductID <= 0 {
+		return ErrInvalidProductID
+	}
+	return nil
+}
+
+// TruncateBucket mirrors Postgres date_trunc in the given location, so Go-side
+// bucket generation lines up with the buckets returned by the database.
+func TruncateBucket(t time.Time, bucket string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	switch bucket {
+	case BucketHour:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+	case BucketWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case BucketMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	}
+}
+
+// defaultRange is the window served when a request names none: the last 30
+// days in loc, today included. Its bounds only move at midnight, so default
+// requests share a cache entry and can be answered from the rollup.
+func defaultRange(now time.Time, loc *time.Location) (from, to time.Time) {
+	to = TruncateBucket(now, BucketDay, loc).AddDate(0, 0, 1)
+	return to.AddDate(0, 0, -30), to
+}
+
+func NextBucket(t time.Time, bucket string) time.Time {
+	switch bucket {
+	case BucketHour:
+		return t.Add(time.Hour)
+	case BucketWeek:
+		return t.AddDate(0, 0, 7)
+	case BucketMonth:
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+func contains(values []string, v string) bool {
+	for _, valid := range values {
+		if v == valid {
+			return true
+		}
+	}
+	return false
+}
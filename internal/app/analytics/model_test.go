@@ -0,0 +1,85 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func jakarta(t *testing.T) *time.Location {
+	loc, err := time.LoadLocation("Asia/Jakarta")
+	require.NoError(t, err)
+	return loc
+}
+
+func TestTruncateBucket(t *testing.T) {
+	loc := jakarta(t)
+	utc := func(s string) time.Time {
+		v, err := time.Parse(time.RFC3339, s)
+		require.NoError(t, err)
+		return v
+	}
+	wib := func(s string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04", s, loc)
+		require.NoError(t, err)
+		return v
+	}
+
+	// Jakarta is UTC+7 all year, so 17:00 UTC is midnight there.
+	cases := []struct {
+		name   string
+		at     string
+		bucket string
+		want   time.Time
+	}{
+		{"hour", "2024-03-01T16:59:59Z", BucketHour, wib("2024-03-01 23:00")},
+		{"hour on the hour", "2024-03-01T17:00:00Z", BucketHour, wib("2024-03-02 00:00")},
+		{"day before midnight", "2024-03-01T16:59:59Z", BucketDay, wib("2024-03-01 00:00")},
+		{"day at midnight", "2024-03-01T17:00:00Z", BucketDay, wib("2024-03-02 00:00")},
+		{"day is the Jakarta day, not the UTC one", "2024-03-01T20:00:00Z", BucketDay, wib("2024-03-02 00:00")},
+		{"week from Monday", "2024-03-04T03:00:00Z", BucketWeek, wib("2024-03-04 00:00")},
+		{"week from Sunday night", "2024-03-03T16:59:59Z", BucketWeek, wib("2024-02-26 00:00")},
+		{"week from Monday 00:00 WIB", "2024-03-03T17:00:00Z", BucketWeek, wib("2024-03-04 00:00")},
+		{"week across the year", "2025-01-01T05:00:00Z", BucketWeek, wib("2024-12-30 00:00")},
+		{"week across a month", "2024-03-01T05:00:00Z", BucketWeek, wib("2024-02-26 00:00")},
+		{"month last moment", "2024-02-29T16:59:59Z", BucketMonth, wib("2024-02-01 00:00")},
+		{"month first moment", "2024-02-29T17:00:00Z", BucketMonth, wib("2024-03-01 00:00")},
+		{"month across the year", "2024-12-31T17:00:00Z", BucketMonth, wib("2025-01-01 00:00")},
+		{"unknown bucket is a day", "2024-03-01T20:00:00Z", "fortnight", wib("2024-03-02 00:00")},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := TruncateBucket(utc(tc.at), tc.bucket, loc)
+			assert.True(t, tc.want.Equal(got), "got %s, want %s", got, tc.want)
+			assert.Equal(t, loc, got.Location())
+			assert.True(t, got.Equal(TruncateBucket(got, tc.bucket, loc)), "a bucket start truncates to itself")
+		})
+	}
+}
+
+func TestNextBucket(t *testing.T) {
+	loc := jakarta(t)
+	cases := []struct {
+		bucket string
+		start  time.Time
+		want   []time.Time
+	}{
+		{BucketHour, time.Date(2024, 3, 1, 23, 0, 0, 0, loc), []time.Time{
+			time.Date(2024, 3, 2, 0, 0, 0, 0, loc), time.Date(2024, 3, 2, 1, 0, 0, 0, loc)}},
+		{BucketDay, time.Date(2024, 2, 28, 0, 0, 0, 0, loc), []time.Time{
+			time.Date(2024, 2, 29, 0, 0, 0, 0, loc), time.Date(2024, 3, 1, 0, 0, 0, 0, loc)}},
+		{BucketWeek, time.Date(2024, 12, 23, 0, 0, 0, 0, loc), []time.Time{
+			time.Date(2024, 12, 30, 0, 0, 0, 0, loc), time.Date(2025, 1, 6, 0, 0, 0, 0, loc)}},
+		{BucketMonth, time.Date(2024, 12, 1, 0, 0, 0, 0, loc), []time.Time{
+			time.Date(2025, 1, 1, 0, 0, 0, 0, loc), time.Date(2025, 2, 1, 0, 0, 0, 0, loc), time.Date(2025, 3, 1, 0, 0, 0, 0, loc)}},
+	}
+	for _, tc := range cases {
+		b := tc.start
+		for _, want := range tc.want {
+			b = NextBucket(b, tc.bucket)
+			assert.True(t, want.Equal(b), "%s: got %s, want %s", tc.bucket, b, want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const sqlTimestampLayout = "2006-01-02 15:04:05"
+
+type AnalyticsRepo struct {
+	DB *sql.DB
+}
+
+func NewAnalyticsRepo(db *sql.DB) *AnalyticsRepo {
+	return &AnalyticsRepo{DB: db}
+}
+
+// transaction_datetime is a TIMESTAMP without time zone holding UTC wall time,
+// so it is shifted into the requested zone before truncating to a bucket.
+func (r *AnalyticsRepo) GetTimeSeries(ctx context.Context, filter TimeSeriesFilter) ([]BucketRow, error) {
+	groupKey, groupLabel := groupExpressions(filter.GroupBy, "t")
+
+	query := fmt.Sprintf(`
+		SELECT
+			date_trunc($1, (t.transaction_datetime AT TIME ZONE 'UTC') AT TIME ZONE $2) AS bucket_start,
+			%s AS group_key,
+			%s AS group_label,
+			COUNT(t.id) AS count,
+			COALESCE(SUM(t.amount), 0) AS gross_amount,
+			COALESCE(SUM(t.tax_amount), 0) AS tax_amount,
+			COALESCE(SUM(
+				CASE WHEN p.service_fee_percentage
+					THEN t.amount * p.service_fee / 100
+					ELSE p.service_fee
+				END
+			), 0) AS fee_amount
+		FROM transaction t
+			INNER JOIN customer cu ON cu.id = t.customer_id
+			INNER JOIN company c ON c.id = cu.company
+			INNER JOIN product p ON p.id = t.product_id
+		WHERE t.transaction_datetime >= $3::timestamp
+			AND t.transaction_datetime < $4::timestamp`, groupKey, groupLabel)
+
+	args := []interface{}{
+		filter.Bucket,
+		filter.Location.String(),
+		filter.From.UTC().Format(sqlTimestampLayout),
+		filter.To.UTC().Format(sqlTimestampLayout),
+	}
+	argPos := 5
+
+	if filter.CompanyID != nil {
+		query += fmt.Sprintf(" AND c.id = $%d", argPos)
+		args = append(args, *filter.CompanyID)
+		argPos++
+	}
+
+	if filter.ProductID != nil {
+		query += fmt.Sprintf(" AND p.id = $%d", argPos)
+		args = append(args, *filter.ProductID)
+		argPos++
+	}
+
+	query += `
+		GROUP BY 1, 2, 3
+		ORDER BY 1, 2`
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transaction time series: %w", err)
+	}
+	defer rows.Close()
+
+	return scanBucketRows(rows, filter.Location)
+}
+
+// GetTimeSeriesFromRollup answers day, week and month buckets from the daily
+// rollup. The caller must make sure the rollup days are in filter.Location and
+// that From and To fall on day boundaries.
+func (r *AnalyticsRepo) GetTimeSeriesFromRollup(ctx context.Context, filter TimeSeriesFilter) ([]BucketRow, error) {
+	groupKey, groupLabel := groupExpressions(filter.GroupBy, "r")
+
+	query := fmt.Sprintf(`
+		SELECT
+			date_trunc($1, r.day::timestamp) AS bucket_start,
+			%s AS group_key,
+			%s AS group_label,
+			SUM(r.trx_count) AS count,
+			SUM(r.amount) AS gross_amount,
+			SUM(r.tax_amount) AS tax_amount,
+			SUM(r.fee_amount) AS fee_amount
+		FROM transaction_daily_rollup r
+			INNER JOIN company c ON c.id = r.company_id
+			INNER JOIN product p ON p.id = r.product_id
+		WHERE r.day >= $2::date
+			AND r.day < $3::date`, groupKey, groupLabel)
+
+	args := []interface{}{
+		filter.Bucket,
+		filter.From.In(filter.Location).Format("2006-01-02"),
+		filter.To.In(filter.Location).Format("2006-01-02"),
+	}
+	argPos := 4
+
+	if filter.CompanyID != nil {
+		query += fmt.Sprintf(" AND r.company_id = $%d", argPos)
+		args = append(args, *filter.CompanyID)
+		argPos++
+	}
+
+	if filter.ProductID != nil {
+		query += fmt.Sprintf(" AND r.product_id = $%d", argPos)
+		args = append(args, *filter.ProductID)
+		argPos++
+	}
+
+	query += `
+		GROUP BY 1, 2, 3
+		ORDER BY 1, 2`
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rollup time series: %w", err)
+	}
+	defer rows.Close()
+
+	return scanBucketRows(rows, filter.Location)
+}
+
+func scanBucketRows(rows *sql.Rows, loc *time.Location) ([]BucketRow, error) {
+	var result []BucketRow
+	for rows.Next() {
+		var row BucketRow
+		var bucketStart time.Time
+		err := rows.Scan(
+			&bucketStart,
+			&row.GroupKey,
+			&row.GroupLabel,
+			&row.Count,
+			&row.GrossAmount,
+			&row.TaxAmount,
+			&row.FeeAmount,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan time series row: %w", err)
+		}
+		row.BucketStart = time.Date(
+			bucketStart.Year(), bucketStart.Month(), bucketStart.Day(),
+			bucketStart.Hour(), 0, 0, 0, loc,
+		)
+		result = append(result, row)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return result, nil
+}
+
+func groupExpressions(groupBy, alias string) (string, string) {
+	switch groupBy {
+	case GroupByCompany:
+		return "c.id::text", "c.name"
+	case GroupByProduct:
+		return "p.id::text", "p.product_name"
+	case GroupByPaymentMethod:
+		return alias + ".transaction_type", alias + ".transaction_type"
+	case GroupByStatus:
+		return alias + ".payment_status", alias + ".payment_status"
+	default:
+		return "'total'", "'total'"
+	}
+}
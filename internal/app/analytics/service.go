@@ -0,0 +1,148 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"sinibeli/internal/infrastructure/cache"
+	"sinibeli/internal/pkg/tracing"
+)
+
+type AnalyticsService struct {
+	repo            *AnalyticsRepo
+	cache           cache.Cache
+	defaultLocation *time.Location
+}
+
+func NewAnalyticsService(repo *AnalyticsRepo, appCache cache.Cache, defaultLocation *time.Location) *AnalyticsService {
+	return &AnalyticsService{repo: repo, cache: appCache, defaultLocation: defaultLocation}
+}
+
+func (s *AnalyticsService) DefaultLocation() *time.Location {
+	return s.defaultLocation
+}
+
+func (s *AnalyticsService) GetTimeSeries(ctx context.Context, filter TimeSeriesFilter) (TimeSeriesResponse, error) {
+	ctx, span := tracing.Start(ctx, "AnalyticsService.GetTimeSeries")
+	defer span.End()
+
+	if filter.Location == nil {
+		filter.Location = s.defaultLocation
+	}
+	if err := filter.Validate(); err != nil {
+		return TimeSeriesResponse{}, err
+	}
+
+	buckets := bucketStarts(filter.From, filter.To, filter.Bucket, filter.Location)
+	if len(buckets) > MaxBuckets {
+		return TimeSeriesResponse{}, ErrTooManyBuckets
+	}
+
+	var resp TimeSeriesResponse
+	err := s.cache.GetOrSet(ctx, fmt.Sprintf(cache.TimeSeriesKey, cacheKey(filter)), &resp, cache.ReportTTL, func(ctx context.Context) (interface{}, error) {
+		var rows []BucketRow
+		var err error
+		if s.canUseRollup(filter) {
+			rows, err = s.repo.GetTimeSeriesFromRollup(ctx, filter)
+		} else {
+			rows, err = s.repo.GetTimeSeries(ctx, filter)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return TimeSeriesResponse{
+			Bucket:   filter.Bucket,
+			TimeZone: filter.Location.String(),
+			From:     filter.From.In(filter.Location),
+			To:       filter.To.In(filter.Location),
+			GroupBy:  filter.GroupBy,
+			Series:   fillSeries(buckets, rows, filter.GroupBy),
+		}, nil
+	})
+	if err != nil {
+		return TimeSeriesResponse{}, err
+	}
+
+	return resp, nil
+}
+
+// cacheKey spells the location out by name because *time.Location has no
+// exported fields and would otherwise hash the same for every zone.
+func cacheKey(filter TimeSeriesFilter) string {
+	return cache.HashKey(struct {
+		TimeSeriesFilter
+		TimeZone string
+	}{filter, filter.Location.String()})
+}
+
+// canUseRollup reports whether the daily rollup, whose days are calendar days
+// in the default location, can answer the filter without losing precision.
+func (s *AnalyticsService) canUseRollup(filter TimeSeriesFilter) bool {
+	if filter.Bucket == BucketHour || filter.Location.String() != s.defaultLocation.String() {
+		return false
+	}
+	return filter.From.Equal(TruncateBucket(filter.From, BucketDay, filter.Location)) &&
+		filter.To.Equal(TruncateBucket(filter.To, BucketDay, filter.Location))
+}
+
+func bucketStarts(from, to time.Time, bucket string, loc *time.Location) []time.Time {
+	var buckets []time.Time
+	for b := TruncateBucket(from, bucket, loc); b.Before(to); b = NextBucket(b, bucket) {
+		buckets = append(buckets, b)
+		if len(buckets) > MaxBuckets {
+			break
+		}
+	}
+	return buckets
+}
+
+// fillSeries spreads the sparse database rows over every bucket in the range
+// so that charts get an explicit zero for periods without transactions.
+func fillSeries(buckets []time.Time, rows []BucketRow, groupBy string) []Series {
+	type group struct {
+		label  string
+		points map[int64]BucketRow
+	}
+
+	groups := make(map[string]*group)
+	var keys []string
+
+	if groupBy == GroupByNone {
+		groups["total"] = &group{label: "total", points: make(map[int64]BucketRow)}
+		keys = append(keys, "total")
+	}
+
+	for _, row := range rows {
+		g, ok := groups[row.GroupKey]
+		if !ok {
+			g = &group{label: row.GroupLabel, points: make(map[int64]BucketRow)}
+			groups[row.GroupKey] = g
+			keys = append(keys, row.GroupKey)
+		}
+		g.points[row.BucketStart.Unix()] = row
+	}
+
+	sort.Strings(keys)
+
+	series := make([]Series, 0, len(keys))
+	for _, key := range keys {
+		g := groups[key]
+		points := make([]Point, len(buckets))
+		for i, b := range buckets {
+			row := g.points[b.Unix()]
+			points[i] = Point{
+				BucketStart: b,
+				Count:       row.Count,
+				GrossAmount: row.GrossAmount,
+				TaxAmount:   row.TaxAmount,
+				FeeAmount:   row.FeeAmount,
+			}
+		}
+		series = append(series, Series{Key: key, Label: g.label, Points: points})
+	}
+
+	return series
+}
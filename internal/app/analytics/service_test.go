@@ -0,0 +1,125 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBucketStarts(t *testing.T) {
+	loc := jakarta(t)
+	at := func(y int, m time.Month, d, h int) time.Time { return time.Date(y, m, d, h, 0, 0, 0, loc) }
+
+	cases := []struct {
+		name     string
+		from, to time.Time
+		bucket   string
+		want     []time.Time
+	}{
+		{"empty range", at(2024, 3, 1, 0), at(2024, 3, 1, 0), BucketDay, nil},
+		{"reversed range", at(2024, 3, 2, 0), at(2024, 3, 1, 0), BucketDay, nil},
+		{"end is exclusive", at(2024, 3, 1, 0), at(2024, 3, 3, 0), BucketDay,
+			[]time.Time{at(2024, 3, 1, 0), at(2024, 3, 2, 0)}},
+		{"partial first bucket is included", at(2024, 3, 1, 10), at(2024, 3, 2, 1), BucketDay,
+			[]time.Time{at(2024, 3, 1, 0), at(2024, 3, 2, 0)}},
+		{"less than a bucket", at(2024, 3, 1, 10), at(2024, 3, 1, 11), BucketDay,
+			[]time.Time{at(2024, 3, 1, 0)}},
+		{"hours across midnight", at(2024, 3, 1, 22), at(2024, 3, 2, 1), BucketHour,
+			[]time.Time{at(2024, 3, 1, 22), at(2024, 3, 1, 23), at(2024, 3, 2, 0)}},
+		{"weeks across the year", at(2024, 12, 25, 0), at(2025, 1, 7, 0), BucketWeek,
+			[]time.Time{at(2024, 12, 23, 0), at(2024, 12, 30, 0), at(2025, 1, 6, 0)}},
+		{"months across a leap February", at(2024, 1, 31, 0), at(2024, 3, 1, 0), BucketMonth,
+			[]time.Time{at(2024, 1, 1, 0), at(2024, 2, 1, 0)}},
+		{"UTC bounds land on Jakarta days", time.Date(2024, 2, 29, 17, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 17, 0, 0, 0, time.UTC), BucketDay,
+			[]time.Time{at(2024, 3, 1, 0)}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := bucketStarts(tc.from, tc.to, tc.bucket, loc)
+			require.Len(t, got, len(tc.want))
+			for i := range tc.want {
+				assert.True(t, tc.want[i].Equal(got[i]), "bucket %d: got %s, want %s", i, got[i], tc.want[i])
+			}
+		})
+	}
+
+	// Generation stops one past the limit so the caller can reject the range.
+	huge := bucketStarts(at(2000, 1, 1, 0), at(2024, 1, 1, 0), BucketHour, loc)
+	assert.Len(t, huge, MaxBuckets+1)
+}
+
+func TestFillSeries(t *testing.T) {
+	loc := jakarta(t)
+	days := bucketStarts(time.Date(2024, 3, 1, 0, 0, 0, 0, loc), time.Date(2024, 3, 4, 0, 0, 0, 0, loc), BucketDay, loc)
+	require.Len(t, days, 3)
+
+	t.Run("no rows gives a zero total", func(t *testing.T) {
+		series := fillSeries(days, nil, GroupByNone)
+		require.Len(t, series, 1)
+		assert.Equal(t, "total", series[0].Key)
+		require.Len(t, series[0].Points, 3)
+		for i, p := range series[0].Points {
+			assert.Equal(t, Point{BucketStart: days[i]}, p)
+		}
+	})
+
+	t.Run("no buckets", func(t *testing.T) {
+		series := fillSeries(nil, nil, GroupByNone)
+		require.Len(t, series, 1)
+		assert.Empty(t, series[0].Points)
+		assert.NotNil(t, series[0].Points, "points encode as [] rather than null")
+	})
+
+	t.Run("no rows grouped", func(t *testing.T) {
+		series := fillSeries(days, nil, GroupByCompany)
+		assert.NotNil(t, series)
+		assert.Empty(t, series)
+	})
+
+	t.Run("gaps are zero and rows match by instant", func(t *testing.T) {
+		rows := []BucketRow{
+			// Rows may come back in UTC; the instant is what matters.
+			{BucketStart: days[2].UTC(), GroupKey: "2", GroupLabel: "Beta", Count: 1, GrossAmount: 10},
+			{BucketStart: days[0], GroupKey: "1", GroupLabel: "Acme", Count: 2, GrossAmount: 20, TaxAmount: 2, FeeAmount: 1},
+			{BucketStart: days[2], GroupKey: "1", GroupLabel: "Acme", Count: 3, GrossAmount: 30},
+			// Outside the range: ignored.
+			{BucketStart: days[2].AddDate(0, 0, 1), GroupKey: "1", GroupLabel: "Acme", Count: 99},
+		}
+		series := fillSeries(days, rows, GroupByCompany)
+		require.Len(t, series, 2)
+
+		assert.Equal(t, "1", series[0].Key, "series are sorted by key")
+		assert.Equal(t, "Acme", series[0].Label)
+		assert.Equal(t, []Point{
+			{BucketStart: days[0], Count: 2, GrossAmount: 20, TaxAmount: 2, FeeAmount: 1},
+			{BucketStart: days[1]},
+			{BucketStart: days[2], Count: 3, GrossAmount: 30},
+		}, series[0].Points)
+
+		assert.Equal(t, "Beta", series[1].Label)
+		assert.Equal(t, []int64{0, 0, 1}, []int64{series[1].Points[0].Count, series[1].Points[1].Count, series[1].Points[2].Count})
+		assert.Equal(t, loc, series[1].Points[2].BucketStart.Location(), "points use the requested zone")
+	})
+}
+
+func TestDefaultRangeUsesRollup(t *testing.T) {
+	loc := jakarta(t)
+	s := NewAnalyticsService(nil, nil, loc)
+	filter := func(now time.Time) TimeSeriesFilter {
+		f := TimeSeriesFilter{Bucket: BucketDay, Location: loc}
+		f.From, f.To = defaultRange(now, loc)
+		return f
+	}
+
+	morning := filter(time.Date(2024, 3, 15, 0, 30, 0, 0, loc))
+	evening := filter(time.Date(2024, 3, 15, 23, 59, 59, 999, loc))
+	assert.Equal(t, time.Date(2024, 2, 15, 0, 0, 0, 0, loc), morning.From)
+	assert.Equal(t, time.Date(2024, 3, 16, 0, 0, 0, 0, loc), morning.To)
+	assert.True(t, s.canUseRollup(morning))
+	assert.Equal(t, cacheKey(morning), cacheKey(evening), "requests on the same day share a cache entry")
+
+	nextDay := filter(time.Date(2024, 3, 16, 0, 0, 1, 0, loc))
+	assert.NotEqual(t, cacheKey(morning), cacheKey(nextDay))
+}
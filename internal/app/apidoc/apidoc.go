@@ -0,0 +1,426 @@
+// Package apidoc describes the public API as an OpenAPI document. Paths are
+// written as they are registered with gin, and request and response schemas
+// come from the structs the handlers bind and return.
+package apidoc
+
+import (
+	"net/http"
+	"strconv"
+
+	"sinibeli/internal/app/attachment"
+	"sinibeli/internal/app/company"
+	"sinibeli/internal/app/customer"
+	"sinibeli/internal/app/product"
+	"sinibeli/internal/app/transaction"
+	"sinibeli/internal/pkg/openapi"
+	"sinibeli/internal/pkg/patch"
+)
+
+const prefix = "/api/v1"
+
+var (
+	// optionalAuth is how the v1 group authenticates: anonymous callers are
+	// served, a token raises what they may see.
+	optionalAuth = []map[string][]string{{}, {"bearerAuth": {}}}
+	requireAuth  = []map[string][]string{{"bearerAuth": {}}}
+)
+
+// Spec returns the document for the company, customer, product and
+// transaction routes.
+func Spec() *openapi.Document {
+	d := openapi.New(openapi.Info{
+		Title:   "Sinibeli API",
+		Version: "1.0.0",
+		Description: "Errors are sent as application/problem+json (RFC 7807) with a stable code, " +
+			"and translated into Indonesian or English by Accept-Language. Companies, customers and " +
+			"products are versioned: reads return an ETag, and writes must send it back in If-Match.",
+	})
+	d.Components.SecuritySchemes["bearerAuth"] = openapi.SecurityScheme{
+		Type:         "http",
+		Scheme:       "bearer",
+		BearerFormat: "JWT",
+		Description:  "The token's role decides whether customer PII is shown or masked.",
+	}
+	d.Tags = []openapi.Tag{
+		{Name: "Companies"},
+		{Name: "Customers", Description: "Callers without PII access get customers with masked email and phone and without birth date, address or photo."},
+		{Name: "Products"},
+		{Name: "Transactions"},
+	}
+
+	companies(d)
+	customers(d)
+	products(d)
+	transactions(d)
+	return d
+}
+
+// resource describes the versioned CRUD routes companies, customers and
+// products share.
+type resource struct {
+	tag, singular, path string
+	model, create       interface{}
+	update, fields      interface{}
+}
+
+func crud(d *openapi.Document, r resource) {
+	base := prefix + r.path
+	item := base + "/:id"
+	id := idParam(r.singular + " ID")
+	ok := func(desc string) openapi.Response {
+		return withETag(openapi.Response{Description: desc, Content: d.JSON(r.model)})
+	}
+
+	d.Add(http.MethodPost, base, &openapi.Operation{
+		Tags:        []string{r.tag},
+		Summary:     "Create a " + r.singular,
+		OperationID: "create" + r.singular,
+		RequestBody: &openapi.RequestBody{Required: true, Content: d.JSON(r.create)},
+		Responses:   responses(d, http.StatusCreated, ok("Created"), 400, 409, 422),
+		Security:    optionalAuth,
+	})
+	d.Add(http.MethodGet, base, &openapi.Operation{
+		Tags:        []string{r.tag},
+		Summary:     "List " + r.tag,
+		OperationID: "list" + r.tag,
+		Parameters:  []openapi.Parameter{includeDeleted},
+		Responses:   responses(d, http.StatusOK, openapi.Response{Description: "OK", Content: list(d, r.model)}),
+		Security:    optionalAuth,
+	})
+	d.Add(http.MethodGet, item, &openapi.Operation{
+		Tags:        []string{r.tag},
+		Summary:     "Get a " + r.singular,
+		OperationID: "get" + r.singular,
+		Parameters:  []openapi.Parameter{id, includeDeleted, ifNoneMatch},
+		Responses: merge(responses(d, http.StatusOK, ok("OK"), 400, 404),
+			map[string]openapi.Response{"304": withETag(openapi.Response{Description: "Not Modified: the If-None-Match tag is current"})}),
+		Security: optionalAuth,
+	})
+	d.Add(http.MethodPut, item, &openapi.Operation{
+		Tags:        []string{r.tag},
+		Summary:     "Replace a " + r.singular,
+		OperationID: "update" + r.singular,
+		Parameters:  []openapi.Parameter{id, ifMatch},
+		RequestBody: &openapi.RequestBody{Required: true, Content: d.JSON(r.update)},
+		Responses:   responses(d, http.StatusOK, ok("OK"), 400, 404, 409, 412, 422, 428),
+		Security:    optionalAuth,
+	})
+	d.Add(http.MethodPatch, item, &openapi.Operation{
+		Tags:        []string{r.tag},
+		Summary:     "Update part of a " + r.singular,
+		Description: "Takes a JSON Merge Patch (RFC 7396; plain application/json is read as one) or a JSON Patch (RFC 6902). The result is validated like a full update.",
+		OperationID: "patch" + r.singular,
+		Parameters:  []openapi.Parameter{id, ifMatch},
+		RequestBody: &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{
+			patch.MergePatchType: {Schema: d.Partial(r.fields)},
+			"application/json":   {Schema: d.Partial(r.fields)},
+			patch.JSONPatchType:  {Schema: openapi.JSONPatch()},
+		}},
+		Responses: responses(d, http.StatusOK, ok("OK"), 400, 404, 409, 412, 415, 422, 428),
+		Security:  optionalAuth,
+	})
+	d.Add(http.MethodDelete, item, &openapi.Operation{
+		Tags:        []string{r.tag},
+		Summary:     "Delete a " + r.singular,
+		Description: "Soft-deletes; purge=true removes the record for good, which is refused with the reference counts while anything still points at it.",
+		OperationID: "delete" + r.singular,
+		Parameters: []openapi.Parameter{id, ifMatch,
+			query("purge", "remove the record for good", &openapi.Schema{Type: "boolean"})},
+		Responses: responses(d, http.StatusNoContent, openapi.Response{Description: "No Content"}, 400, 404, 409, 412, 428),
+		Security:  optionalAuth,
+	})
+	d.Add(http.MethodPost, item+"/restore", &openapi.Operation{
+		Tags:        []string{r.tag},
+		Summary:     "Restore a deleted " + r.singular,
+		OperationID: "restore" + r.singular,
+		Parameters:  []openapi.Parameter{id},
+		Responses:   responses(d, http.StatusOK, ok("OK"), 400, 404, 409),
+		Security:    optionalAuth,
+	})
+}
+
+func companies(d *openapi.Document) {
+	crud(d, resource{
+		tag: "Companies", singular: "Company", path: "/companies",
+		model: company.Company{}, create: company.CreateCompanyReq{},
+		update: company.UpdateCompanyReq{}, fields: company.UpdateCompanyReq{},
+	})
+}
+
+func products(d *openapi.Document) {
+	crud(d, resource{
+		tag: "Products", singular: "Product", path: "/products",
+		model: product.Product{}, create: product.CreateProductReq{},
+		update: product.UpdateProductReq{}, fields: product.ProductFields{},
+	})
+}
+
+func customers(d *openapi.Document) {
+	crud(d, resource{
+		tag: "Customers", singular: "Customer", path: "/customers",
+		model: customer.Customer{}, create: customer.CreateCustomerReq{},
+		update: customer.UpdateCustomerReq{}, fields: customer.CustomerFields{},
+	})
+
+	base := prefix + "/customers"
+	tags := []string{"Customers"}
+	id := idParam("customer ID")
+	companyID := query("company_id", "only customers of this company", int64Schema())
+	page := query("page", "page number, from 1", int64Schema())
+	pageSize := query("page_size", "results per page, 1 to 100", int64Schema())
+
+	listOp := d.Paths[openapi.Path(base)]["get"]
+	listOp.Parameters = append(listOp.Parameters, query("email", "find the customer with this email; the result has at most one element", &openapi.Schema{Type: "string", Format: "email"}))
+
+	d.Add(http.MethodGet, base+"/search", &openapi.Operation{
+		Tags:        tags,
+		Summary:     "Search customers by name, email or phone",
+		OperationID: "searchCustomers",
+		Parameters: []openapi.Parameter{
+			{Name: "q", In: "query", Required: true, Description: "at least 2 characters", Schema: &openapi.Schema{Type: "string"}},
+			companyID, page, pageSize,
+		},
+		Responses: responses(d, http.StatusOK, openapi.Response{Description: "OK", Content: d.JSON(customer.SearchResponse{})}, 400),
+		Security:  optionalAuth,
+	})
+	d.Add(http.MethodGet, base+"/duplicates", &openapi.Operation{
+		Tags:        tags,
+		Summary:     "List likely duplicate customers, best match first",
+		OperationID: "listDuplicateCustomers",
+		Parameters: []openapi.Parameter{
+			companyID,
+			query("min_score", "lowest score to report, 0 to 1", &openapi.Schema{Type: "number", Format: "double"}),
+			page, pageSize,
+		},
+		Responses: responses(d, http.StatusOK, openapi.Response{Description: "OK", Content: d.JSON(customer.DuplicateResponse{})}, 400),
+		Security:  optionalAuth,
+	})
+	d.Add(http.MethodPost, base+"/merges/:mergeId/undo", &openapi.Operation{
+		Tags:        tags,
+		Summary:     "Undo a merge",
+		OperationID: "undoCustomerMerge",
+		Parameters:  []openapi.Parameter{pathParam("mergeId", "merge ID", int64Schema())},
+		Responses:   responses(d, http.StatusOK, openapi.Response{Description: "OK", Content: d.JSON(customer.MergeRecord{})}, 400, 401, 404, 409),
+		Security:    requireAuth,
+	})
+
+	images := map[string]openapi.MediaType{"image/*": {Schema: &openapi.Schema{Type: "string", Format: "binary"}}}
+	d.Add(http.MethodPut, base+"/:id/photo", &openapi.Operation{
+		Tags:        tags,
+		Summary:     "Set the customer's photo",
+		Description: "Requires PII access. The image is the raw body or the \"photo\" field of a multipart form. Its type is sniffed from the bytes; PNG, JPEG, GIF and WebP are accepted.",
+		OperationID: "putCustomerPhoto",
+		Parameters:  []openapi.Parameter{id, ifMatch},
+		RequestBody: &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{
+			"image/*": images["image/*"],
+			"multipart/form-data": {Schema: &openapi.Schema{
+				Type:       "object",
+				Properties: map[string]*openapi.Schema{"photo": {Type: "string", Format: "binary"}},
+				Required:   []string{"photo"},
+			}},
+		}},
+		Responses: responses(d, http.StatusOK, withETag(openapi.Response{Description: "OK", Content: d.JSON(customer.Customer{})}), 400, 401, 403, 404, 412, 413, 415, 428),
+		Security:  requireAuth,
+	})
+	d.Add(http.MethodGet, base+"/:id/photo", &openapi.Operation{
+		Tags:        tags,
+		Summary:     "Download the customer's photo",
+		Description: "Requires PII access.",
+		OperationID: "getCustomerPhoto",
+		Parameters: []openapi.Parameter{id,
+			query("size", "thumbnail for the thumbnail instead of the full image", &openapi.Schema{Type: "string", Enum: []interface{}{"thumbnail"}})},
+		Responses: responses(d, http.StatusOK, openapi.Response{Description: "OK", Content: images}, 400, 403, 404),
+		Security:  optionalAuth,
+	})
+	d.Add(http.MethodDelete, base+"/:id/photo", &openapi.Operation{
+		Tags:        tags,
+		Summary:     "Remove the customer's photo",
+		Description: "Requires PII access.",
+		OperationID: "deleteCustomerPhoto",
+		Parameters:  []openapi.Parameter{id, ifMatch},
+		Responses:   responses(d, http.StatusNoContent, withETag(openapi.Response{Description: "No Content"}), 400, 401, 403, 404, 412, 428),
+		Security:    requireAuth,
+	})
+	d.Add(http.MethodPost, base+"/:id/merge", &openapi.Operation{
+		Tags:        tags,
+		Summary:     "Merge a duplicate into this customer",
+		Description: "The duplicate's transactions move to the customer in the path, and the duplicate is marked as merged into it.",
+		OperationID: "mergeCustomer",
+		Parameters:  []openapi.Parameter{id},
+		RequestBody: &openapi.RequestBody{Required: true, Content: d.JSON(customer.MergeCustomerReq{})},
+		Responses:   responses(d, http.StatusCreated, openapi.Response{Description: "Created", Content: d.JSON(customer.MergeRecord{})}, 400, 401, 404, 409),
+		Security:    requireAuth,
+	})
+	d.Add(http.MethodGet, base+"/:id/merges", &openapi.Operation{
+		Tags:        tags,
+		Summary:     "List the merges of a customer",
+		OperationID: "listCustomerMerges",
+		Parameters:  []openapi.Parameter{id},
+		Responses:   responses(d, http.StatusOK, openapi.Response{Description: "OK", Content: d.JSON([]customer.MergeRecord{})}, 400, 404),
+		Security:    optionalAuth,
+	})
+}
+
+func transactions(d *openapi.Document) {
+	base := prefix + "/transactions"
+	tags := []string{"Transactions"}
+	id := idParam("transaction ID")
+	page := query("page", "page number, from 1", int64Schema())
+	pageSize := query("page_size", "results per page, 1 to 100", int64Schema())
+	companyID := query("company_id", "only this company", int64Schema())
+	date := &openapi.Schema{Type: "string", Format: "date"}
+	amount := &openapi.Schema{Type: "number", Format: "double", Minimum: new(float64)}
+
+	d.Add(http.MethodPost, base, &openapi.Operation{
+		Tags:        tags,
+		Summary:     "Record a transaction",
+		Description: "amount and tax_amount are decimal strings. transaction_datetime is RFC 3339 and defaults to now.",
+		OperationID: "createTransaction",
+		RequestBody: &openapi.RequestBody{Required: true, Content: d.JSON(transaction.CreateTxReq{})},
+		Responses:   responses(d, http.StatusCreated, openapi.Response{Description: "Created", Content: d.JSON(transaction.Transaction{})}, 400, 409, 422),
+		Security:    optionalAuth,
+	})
+	d.Add(http.MethodGet, base, &openapi.Operation{
+		Tags:        tags,
+		Summary:     "List transactions",
+		OperationID: "listTransactions",
+		Responses:   responses(d, http.StatusOK, openapi.Response{Description: "OK", Content: d.JSON([]transaction.Transaction{})}),
+		Security:    optionalAuth,
+	})
+	d.Add(http.MethodGet, base+"/:id", &openapi.Operation{
+		Tags:        tags,
+		Summary:     "Get a transaction",
+		OperationID: "getTransaction",
+		Parameters:  []openapi.Parameter{id},
+		Responses:   responses(d, http.StatusOK, openapi.Response{Description: "OK", Content: d.JSON(transaction.Transaction{})}, 400, 404),
+		Security:    optionalAuth,
+	})
+
+	summary := &openapi.Schema{AllOf: []*openapi.Schema{
+		d.SchemaOf(transaction.TransactionSummaryResponse{}),
+		{Type: "object", Properties: map[string]*openapi.Schema{
+			"applied_filters": {Type: "object", Description: "the filters the summary was computed with; absent ones are null"},
+		}},
+	}}
+	d.Add(http.MethodGet, base+"/summary", &openapi.Operation{
+		Tags:        tags,
+		Summary:     "Summarize transactions per product",
+		OperationID: "summarizeTransactions",
+		Parameters: []openapi.Parameter{
+			page, pageSize, companyID,
+			query("product_id", "only this product", int64Schema()),
+			query("start_date", "first day, YYYY-MM-DD", date),
+			query("end_date", "last day, YYYY-MM-DD", date),
+			query("min_amount", "smallest amount", amount),
+			query("max_amount", "largest amount", amount),
+		},
+		Responses: responses(d, http.StatusOK, openapi.Response{Description: "OK", Content: map[string]openapi.MediaType{"application/json": {Schema: summary}}}, 400),
+		Security:  optionalAuth,
+	})
+	d.Add(http.MethodGet, base+"/reports", &openapi.Operation{
+		Tags:        tags,
+		Summary:     "Rank customers by number of transactions",
+		OperationID: "reportCustomerActivity",
+		Parameters: []openapi.Parameter{
+			companyID,
+			query("min_trx", "fewest transactions to be listed", &openapi.Schema{Type: "integer", Format: "int64", Minimum: new(float64)}),
+			page, pageSize,
+		},
+		Responses: responses(d, http.StatusOK, openapi.Response{Description: "OK", Content: d.JSON(transaction.CustomerActivityResponse{})}, 400),
+		Security:  optionalAuth,
+	})
+
+	kinds := make([]interface{}, len(attachment.ValidKinds))
+	for i, k := range attachment.ValidKinds {
+		kinds[i] = k
+	}
+	d.Add(http.MethodPost, base+"/:id/attachments", &openapi.Operation{
+		Tags:        tags,
+		Summary:     "Attach a file to a transaction",
+		Description: "The file's type is sniffed from its bytes; PNG, JPEG, WebP and PDF are accepted. The token must be bound to the transaction's company.",
+		OperationID: "createTransactionAttachment",
+		Parameters:  []openapi.Parameter{id},
+		RequestBody: &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{
+			"multipart/form-data": {Schema: &openapi.Schema{
+				Type: "object",
+				Properties: map[string]*openapi.Schema{
+					"file": {Type: "string", Format: "binary"},
+					"kind": {Type: "string", Enum: kinds},
+				},
+				Required: []string{"file", "kind"},
+			}},
+		}},
+		Responses: responses(d, http.StatusCreated, openapi.Response{Description: "Created", Content: d.JSON(attachment.Attachment{})}, 400, 401, 403, 404, 409, 413, 415, 422),
+		Security:  requireAuth,
+	})
+	d.Add(http.MethodGet, base+"/:id/attachments", &openapi.Operation{
+		Tags:        tags,
+		Summary:     "List a transaction's attachments",
+		OperationID: "listTransactionAttachments",
+		Parameters:  []openapi.Parameter{id},
+		Responses:   responses(d, http.StatusOK, openapi.Response{Description: "OK", Content: d.JSON([]attachment.Attachment{})}, 400, 401, 403, 404),
+		Security:    requireAuth,
+	})
+}
+
+// responses pairs the success response with the problems an operation can
+// answer with. Every operation can fail with a 500.
+func responses(d *openapi.Document, status int, ok openapi.Response, problems ...int) map[string]openapi.Response {
+	out := map[string]openapi.Response{
+		strconv.Itoa(status): ok,
+		"default":            d.Problem(http.StatusInternalServerError),
+	}
+	for _, p := range problems {
+		out[strconv.Itoa(p)] = d.Problem(p)
+	}
+	return out
+}
+
+// list is the content of a JSON array of v's type.
+func list(d *openapi.Document, v interface{}) map[string]openapi.MediaType {
+	return map[string]openapi.MediaType{"application/json": {Schema: &openapi.Schema{Type: "array", Items: d.SchemaOf(v)}}}
+}
+
+func merge(a, b map[string]openapi.Response) map[string]openapi.Response {
+	for k, v := range b {
+		a[k] = v
+	}
+	return a
+}
+
+func withETag(r openapi.Response) openapi.Response {
+	r.Headers = map[string]openapi.Header{
+		"ETag": {Description: "the record's version, to send back in If-Match", Schema: &openapi.Schema{Type: "string"}},
+	}
+	return r
+}
+
+var (
+	includeDeleted = query("include_deleted", "include soft-deleted records", &openapi.Schema{Type: "boolean"})
+	ifMatch        = openapi.Parameter{
+		Name: "If-Match", In: "header", Required: true,
+		Description: "ETag of the version being changed, or *; a stale tag fails with 412",
+		Schema:      &openapi.Schema{Type: "string"},
+	}
+	ifNoneMatch = openapi.Parameter{
+		Name: "If-None-Match", In: "header",
+		Description: "answer 304 when the record still has this ETag",
+		Schema:      &openapi.Schema{Type: "string"},
+	}
+)
+
+func int64Schema() *openapi.Schema {
+	return &openapi.Schema{Type: "integer", Format: "int64"}
+}
+
+func idParam(desc string) openapi.Parameter {
+	return pathParam("id", desc, int64Schema())
+}
+
+func pathParam(name, desc string, schema *openapi.Schema) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "path", Required: true, Description: desc, Schema: schema}
+}
+
+func query(name, desc string, schema *openapi.Schema) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: desc, Schema: schema}
+}
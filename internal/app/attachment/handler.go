@@ -0,0 +1,165 @@
+package attachment
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"sinibeli/internal/pkg/apperr"
+	"sinibeli/internal/pkg/request"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errInvalidTransactionID = apperr.InvalidParam("id", "invalid transaction ID")
+	errNoCompany            = apperr.New(apperr.Forbidden, "token_without_company", "token is not bound to a company")
+	errMissingFileField     = apperr.New(apperr.Invalid, "missing_file_field", "multipart field \"file\" is required")
+)
+
+type AttachmentHandler struct {
+	service *AttachmentService
+}
+
+func NewAttachmentHandler(service *AttachmentService) *AttachmentHandler {
+	return &AttachmentHandler{service: service}
+}
+
+// companyID is the caller's company from the token. Attachments are scoped by
+// company, so a token without one cannot use them.
+func companyID(c *gin.Context) (int64, bool) {
+	id := c.GetInt64("company_id")
+	if id == 0 {
+		c.Error(errNoCompany)
+		return 0, false
+	}
+	return id, true
+}
+
+func isTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
+
+// Create takes a multipart form with the file in "file" and its purpose in
+// "kind".
+func (h *AttachmentHandler) Create(c *gin.Context) {
+	company, ok := companyID(c)
+	if !ok {
+		return
+	}
+
+	transactionID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errInvalidTransactionID)
+		return
+	}
+
+	// Leave room for the multipart framing and the other form fields.
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.service.MaxBytes()+64<<10)
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		if isTooLarge(err) {
+			c.Error(ErrTooLarge)
+			return
+		}
+		c.Error(errMissingFileField.WithCause(err))
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, h.service.MaxBytes()+1))
+	if err != nil {
+		if isTooLarge(err) {
+			c.Error(ErrTooLarge)
+			return
+		}
+		c.Error(request.ErrUnreadableBody.WithCause(err))
+		return
+	}
+
+	a, err := h.service.Create(c.Request.Context(), company, Upload{
+		TransactionID: transactionID,
+		Kind:          c.Request.FormValue("kind"),
+		FileName:      header.Filename,
+		UploadedBy:    c.GetString("user_id"),
+		Data:          data,
+	})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, a)
+}
+
+func (h *AttachmentHandler) ListByTransaction(c *gin.Context) {
+	company, ok := companyID(c)
+	if !ok {
+		return
+	}
+
+	transactionID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errInvalidTransactionID)
+		return
+	}
+
+	attachments, err := h.service.ListByTransaction(c.Request.Context(), company, transactionID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, attachments)
+}
+
+func (h *AttachmentHandler) GetByID(c *gin.Context) {
+	company, ok := companyID(c)
+	if !ok {
+		return
+	}
+
+	a, err := h.service.GetByID(c.Request.Context(), company, c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, a)
+}
+
+func (h *AttachmentHandler) Download(c *gin.Context) {
+	company, ok := companyID(c)
+	if !ok {
+		return
+	}
+
+	a, body, err := h.service.Open(c.Request.Context(), company, c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	defer body.Close()
+
+	c.DataFromReader(http.StatusOK, a.Size, a.ContentType, body, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType("attachment", map[string]string{"filename": a.FileName}),
+		"X-Content-Type-Options": "nosniff",
+		"Cache-Control":          "private, no-store",
+		"ETag":                   `"` + a.SHA256 + `"`,
+	})
+}
+
+func (h *AttachmentHandler) Delete(c *gin.Context) {
+	company, ok := companyID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Delete(c.Request.Context(), company, c.Param("id")); err != nil {
+		c.Error(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,61 @@
+package attachment
+
+import (
+	"fmt"
+	"time"
+
+	"sinibeli/internal/pkg/apperr"
+)
+
+const (
+	KindReceipt         = "receipt"
+	KindPaymentProof    = "payment_proof"
+	KindDisputeEvidence = "dispute_evidence"
+)
+
+var ValidKinds = []string{KindReceipt, KindPaymentProof, KindDisputeEvidence}
+
+// AllowedContentTypes are the sniffed types accepted for upload: photos and
+// screenshots of receipts and QRIS payments, and PDF statements.
+var AllowedContentTypes = []string{"image/png", "image/jpeg", "image/webp", "application/pdf"}
+
+type Attachment struct {
+	ID            string    `json:"id"`
+	TransactionID int64     `json:"transaction_id"`
+	CompanyID     int64     `json:"company_id"`
+	Kind          string    `json:"kind"`
+	FileName      string    `json:"file_name"`
+	ContentType   string    `json:"content_type"`
+	Size          int64     `json:"size"`
+	SHA256        string    `json:"sha256"`
+	UploadedBy    string    `json:"uploaded_by"`
+	ScanStatus    string    `json:"scan_status"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// StorageKey is derived rather than stored so cached metadata is enough to
+// locate the blob.
+func (a Attachment) StorageKey() string {
+	return fmt.Sprintf("transactions/%d/attachments/%s", a.TransactionID, a.ID)
+}
+
+var (
+	ErrNotFound            = apperr.New(apperr.NotFound, "attachment_not_found", "attachment not found")
+	ErrTransactionNotFound = apperr.New(apperr.NotFound, "transaction_not_found", "transaction not found")
+	ErrForbidden           = apperr.New(apperr.Forbidden, "attachment_forbidden", "attachment belongs to another company")
+	ErrInvalidKind         = apperr.New(apperr.Invalid, "invalid_attachment_kind", "kind must be one of: receipt, payment_proof, dispute_evidence").With("valid_kinds", ValidKinds)
+	ErrTooLarge            = apperr.New(apperr.TooLarge, "attachment_too_large", "attachment exceeds the size limit")
+	ErrEmpty               = apperr.New(apperr.Invalid, "attachment_empty", "attachment is empty")
+	ErrUnsupportedType     = apperr.New(apperr.UnsupportedMediaType, "attachment_type_not_allowed", "attachment type is not allowed").With("allowed_types", AllowedContentTypes)
+	ErrDuplicate           = apperr.New(apperr.Conflict, "duplicate_attachment", "the same file is already attached to this transaction")
+	ErrInfected            = apperr.New(apperr.Unprocessable, "attachment_infected", "attachment was rejected by the virus scanner")
+)
+
+func isValidKind(kind string) bool {
+	for _, valid := range ValidKinds {
+		if kind == valid {
+			return true
+		}
+	}
+	return false
+}
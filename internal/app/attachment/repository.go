@@ -0,0 +1,159 @@
+package attachment
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type AttachmentRepo struct {
+	DB *sql.DB
+}
+
+func NewAttachmentRepo(db *sql.DB) *AttachmentRepo {
+	return &AttachmentRepo{DB: db}
+}
+
+const attachmentColumns = `id, transaction_id, company_id, kind, file_name,
+		       content_type, size_bytes, sha256, uploaded_by, scan_status, created_at`
+
+// TransactionCompany returns the company that owns a transaction through its
+// customer, or 0 if the transaction does not exist.
+func (r *AttachmentRepo) TransactionCompany(ctx context.Context, transactionID int64) (int64, error) {
+	query := `
+		SELECT c.company
+		FROM transaction t
+		JOIN customer c ON c.id = t.customer_id
+		WHERE t.id = $1`
+
+	var companyID int64
+	err := r.DB.QueryRowContext(ctx, query, transactionID).Scan(&companyID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to query transaction company: %w", err)
+	}
+	return companyID, nil
+}
+
+func (r *AttachmentRepo) Create(ctx context.Context, a *Attachment) error {
+	query := `
+		INSERT INTO transaction_attachment (
+			id, transaction_id, company_id, kind, file_name,
+			content_type, size_bytes, sha256, uploaded_by, scan_status
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING created_at`
+
+	err := r.DB.QueryRowContext(ctx,
+		query,
+		a.ID,
+		a.TransactionID,
+		a.CompanyID,
+		a.Kind,
+		a.FileName,
+		a.ContentType,
+		a.Size,
+		a.SHA256,
+		a.UploadedBy,
+		a.ScanStatus,
+	).Scan(&a.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create attachment: %w", err)
+	}
+	return nil
+}
+
+func (r *AttachmentRepo) GetByID(ctx context.Context, id string) (*Attachment, error) {
+	query := `SELECT ` + attachmentColumns + ` FROM transaction_attachment WHERE id = $1`
+
+	var a Attachment
+	err := scanAttachment(r.DB.QueryRowContext(ctx, query, id), &a)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to scan attachment: %w", err)
+	}
+	return &a, nil
+}
+
+func (r *AttachmentRepo) ListByTransaction(ctx context.Context, transactionID int64) ([]Attachment, error) {
+	query := `SELECT ` + attachmentColumns + `
+		FROM transaction_attachment
+		WHERE transaction_id = $1
+		ORDER BY created_at, id`
+
+	rows, err := r.DB.QueryContext(ctx, query, transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query attachments: %w", err)
+	}
+	defer rows.Close()
+
+	attachments := make([]Attachment, 0)
+	for rows.Next() {
+		var a Attachment
+		if err := scanAttachment(rows, &a); err != nil {
+			return nil, fmt.Errorf("failed to scan attachment row: %w", err)
+		}
+		attachments = append(attachments, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+	return attachments, nil
+}
+
+// ExistsByChecksum reports whether a file with this SHA-256 is already
+// attached to the transaction.
+func (r *AttachmentRepo) ExistsByChecksum(ctx context.Context, transactionID int64, sha256 string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM transaction_attachment
+			WHERE transaction_id = $1 AND sha256 = $2
+		)`
+
+	var exists bool
+	if err := r.DB.QueryRowContext(ctx, query, transactionID, sha256).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check attachment checksum: %w", err)
+	}
+	return exists, nil
+}
+
+func (r *AttachmentRepo) Delete(ctx context.Context, id string) error {
+	res, err := r.DB.ExecContext(ctx, `DELETE FROM transaction_attachment WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete attachment: %w", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("no attachment found with id %s", id)
+	}
+
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAttachment(row rowScanner, a *Attachment) error {
+	return row.Scan(
+		&a.ID,
+		&a.TransactionID,
+		&a.CompanyID,
+		&a.Kind,
+		&a.FileName,
+		&a.ContentType,
+		&a.Size,
+		&a.SHA256,
+		&a.UploadedBy,
+		&a.ScanStatus,
+		&a.CreatedAt,
+	)
+}
@@ -0,0 +1,27 @@
+package attachment
+
+import (
+	"context"
+)
+
+const (
+	ScanClean     = "clean"
+	ScanInfected  = "infected"
+	ScanUnscanned = "unscanned"
+)
+
+// Scanner is the hook for malware scanning. Scan is called with the complete
+// upload before anything is stored and returns one of the Scan* statuses;
+// an infected file is rejected, anything else is recorded on the attachment.
+// An error fails the upload rather than letting an unscanned file through.
+type Scanner interface {
+	Scan(ctx context.Context, fileName string, data []byte) (string, error)
+}
+
+// NoopScanner accepts everything and marks it unscanned, so attachments
+// uploaded before a real scanner is configured can be found and rescanned.
+type NoopScanner struct{}
+
+func (NoopScanner) Scan(ctx context.Context, fileName string, data []byte) (string, error) {
+	return ScanUnscanned, nil
+}
@@ -0,0 +1,296 @@
+package attachment
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"unicode"
+
+	"sinibeli/internal/app/audit"
+	"sinibeli/internal/infrastructure/cache"
+	"sinibeli/internal/infrastructure/storage"
+	logger "sinibeli/internal/pkg/logging"
+	"sinibeli/internal/pkg/tracing"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/google/uuid"
+)
+
+const maxFileNameLength = 255
+
+type AttachmentService struct {
+	repo        *AttachmentRepo
+	store       storage.Storage
+	scanner     Scanner
+	cache       cache.Cache
+	invalidator *cache.Invalidator
+	audit       *audit.Recorder
+	maxBytes    int64
+}
+
+func NewAttachmentService(
+	repo *AttachmentRepo,
+	store storage.Storage,
+	scanner Scanner,
+	appCache cache.Cache,
+	invalidator *cache.Invalidator,
+	recorder *audit.Recorder,
+	maxBytes int64,
+) *AttachmentService {
+	return &AttachmentService{
+		repo:        repo,
+		store:       store,
+		scanner:     scanner,
+		cache:       appCache,
+		invalidator: invalidator,
+		audit:       recorder,
+		maxBytes:    maxBytes,
+	}
+}
+
+func (s *AttachmentService) MaxBytes() int64 {
+	return s.maxBytes
+}
+
+type Upload struct {
+	TransactionID int64
+	Kind          string
+	FileName      string
+	UploadedBy    string
+	Data          []byte
+}
+
+// Create validates, scans and stores an upload for a transaction owned by
+// companyID. Transactions of other companies are reported as not found.
+func (s *AttachmentService) Create(ctx context.Context, companyID int64, u Upload) (Attachment, error) {
+	ctx, span := tracing.Start(ctx, "AttachmentService.Create")
+	defer span.End()
+
+	if !isValidKind(u.Kind) {
+		return Attachment{}, ErrInvalidKind
+	}
+	if len(u.Data) == 0 {
+		return Attachment{}, ErrEmpty
+	}
+	if int64(len(u.Data)) > s.maxBytes {
+		return Attachment{}, ErrTooLarge
+	}
+
+	owner, err := s.repo.TransactionCompany(ctx, u.TransactionID)
+	if err != nil {
+		return Attachment{}, err
+	}
+	if owner == 0 || owner != companyID {
+		return Attachment{}, ErrTransactionNotFound
+	}
+
+	contentType, err := sniff(u.Data)
+	if err != nil {
+		return Attachment{}, err
+	}
+
+	sum := sha256.Sum256(u.Data)
+	checksum := hex.EncodeToString(sum[:])
+	exists, err := s.exists(ctx, u.TransactionID, checksum)
+	if err != nil {
+		return Attachment{}, err
+	}
+	if exists {
+		return Attachment{}, ErrDuplicate
+	}
+
+	status, err := s.scanner.Scan(ctx, u.FileName, u.Data)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("failed to scan attachment: %w", err)
+	}
+	if status == ScanInfected {
+		logger.WarnCtx(ctx, "Infected attachment rejected",
+			"transaction_id", u.TransactionID, "sha256", checksum, "uploaded_by", u.UploadedBy)
+		return Attachment{}, ErrInfected
+	}
+
+	a := Attachment{
+		ID:            uuid.NewString(),
+		TransactionID: u.TransactionID,
+		CompanyID:     owner,
+		Kind:          u.Kind,
+		FileName:      cleanFileName(u.FileName),
+		ContentType:   contentType,
+		Size:          int64(len(u.Data)),
+		SHA256:        checksum,
+		UploadedBy:    u.UploadedBy,
+		ScanStatus:    status,
+	}
+
+	if err := s.store.Put(ctx, a.StorageKey(), bytes.NewReader(u.Data), a.Size, a.ContentType); err != nil {
+		return Attachment{}, fmt.Errorf("failed to store attachment: %w", err)
+	}
+	if err := s.repo.Create(ctx, &a); err != nil {
+		s.removeObject(ctx, a.StorageKey())
+		return Attachment{}, err
+	}
+	s.invalidator.Publish(ctx, cache.EventAttachmentChanged, a.TransactionID)
+	if err := s.audit.Record(ctx, audit.Change{Entity: "attachment", EntityID: a.ID, Action: audit.ActionCreate, After: a}); err != nil {
+		return Attachment{}, err
+	}
+
+	return a, nil
+}
+
+func (s *AttachmentService) GetByID(ctx context.Context, companyID int64, id string) (Attachment, error) {
+	ctx, span := tracing.Start(ctx, "AttachmentService.GetByID")
+	defer span.End()
+
+	if _, err := uuid.Parse(id); err != nil {
+		return Attachment{}, ErrNotFound
+	}
+
+	var a Attachment
+	err := s.cache.GetOrSet(ctx, fmt.Sprintf(cache.FileMetadataKey, id), &a, cache.FileMetadataTTL, func(ctx context.Context) (interface{}, error) {
+		a, err := s.repo.GetByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if a == nil {
+			return nil, ErrNotFound
+		}
+		return a, nil
+	})
+	if err != nil {
+		return Attachment{}, err
+	}
+	if a.CompanyID != companyID {
+		return Attachment{}, ErrNotFound
+	}
+	return a, nil
+}
+
+// attachmentList is the cached form of a transaction's attachments. It
+// carries the owning company so an empty list can still be scoped.
+type attachmentList struct {
+	CompanyID   int64        `json:"company_id"`
+	Attachments []Attachment `json:"attachments"`
+}
+
+func (s *AttachmentService) ListByTransaction(ctx context.Context, companyID, transactionID int64) ([]Attachment, error) {
+	ctx, span := tracing.Start(ctx, "AttachmentService.ListByTransaction")
+	defer span.End()
+
+	var list attachmentList
+	key := fmt.Sprintf(cache.UserFileListKey, fmt.Sprint(transactionID))
+	err := s.cache.GetOrSet(ctx, key, &list, cache.FileListTTL, func(ctx context.Context) (interface{}, error) {
+		owner, err := s.repo.TransactionCompany(ctx, transactionID)
+		if err != nil {
+			return nil, err
+		}
+		if owner == 0 {
+			return nil, ErrTransactionNotFound
+		}
+		attachments, err := s.repo.ListByTransaction(ctx, transactionID)
+		if err != nil {
+			return nil, err
+		}
+		return attachmentList{CompanyID: owner, Attachments: attachments}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if list.CompanyID != companyID {
+		return nil, ErrTransactionNotFound
+	}
+	return list.Attachments, nil
+}
+
+// Open returns the attachment's metadata and content. The caller must close
+// the reader.
+func (s *AttachmentService) Open(ctx context.Context, companyID int64, id string) (Attachment, io.ReadCloser, error) {
+	ctx, span := tracing.Start(ctx, "AttachmentService.Open")
+	defer span.End()
+
+	a, err := s.GetByID(ctx, companyID, id)
+	if err != nil {
+		return Attachment{}, nil, err
+	}
+
+	body, _, err := s.store.Get(ctx, a.StorageKey())
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return Attachment{}, nil, ErrNotFound
+		}
+		return Attachment{}, nil, err
+	}
+	return a, body, nil
+}
+
+func (s *AttachmentService) Delete(ctx context.Context, companyID int64, id string) error {
+	ctx, span := tracing.Start(ctx, "AttachmentService.Delete")
+	defer span.End()
+
+	a, err := s.GetByID(ctx, companyID, id)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	if err := s.cache.Delete(ctx, fmt.Sprintf(cache.FileMetadataKey, id)); err != nil {
+		logger.WarnCtx(ctx, "Cache invalidation failed", "key", fmt.Sprintf(cache.FileMetadataKey, id), "error", err)
+	}
+	s.invalidator.Publish(ctx, cache.EventAttachmentChanged, a.TransactionID)
+	s.removeObject(ctx, a.StorageKey())
+	return s.audit.Record(ctx, audit.Change{Entity: "attachment", EntityID: a.ID, Action: audit.ActionDelete, Before: a})
+}
+
+func (s *AttachmentService) exists(ctx context.Context, transactionID int64, checksum string) (bool, error) {
+	var exists bool
+	key := fmt.Sprintf(cache.FileExistsKey, fmt.Sprintf("%d:%s", transactionID, checksum))
+	err := s.cache.GetOrSet(ctx, key, &exists, cache.FileExistsTTL, func(ctx context.Context) (interface{}, error) {
+		return s.repo.ExistsByChecksum(ctx, transactionID, checksum)
+	})
+	return exists, err
+}
+
+// removeObject deletes a blob no row refers to anymore. A failure only leaves
+// an orphan behind, so it is logged rather than returned.
+func (s *AttachmentService) removeObject(ctx context.Context, key string) {
+	if err := s.store.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		logger.WarnCtx(ctx, "Failed to delete attachment object", "key", key, "error", err)
+	}
+}
+
+// sniff detects the type from the content, ignoring what the client declared.
+func sniff(data []byte) (string, error) {
+	mtype := mimetype.Detect(data)
+	for _, allowed := range AllowedContentTypes {
+		if mtype.Is(allowed) {
+			return allowed, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnsupportedType, mtype.String())
+}
+
+// cleanFileName keeps the client's file name for display and downloads, minus
+// any directory part and control characters.
+func cleanFileName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == "/" || name == "" {
+		name = "attachment"
+	}
+	if len(name) > maxFileNameLength {
+		name = strings.ToValidUTF8(name[:maxFileNameLength], "")
+	}
+	return name
+}
@@ -0,0 +1,114 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// genesisHash is the PrevHash of the first entry in the log.
+var genesisHash = strings.Repeat("0", 64)
+
+const redacted = "[REDACTED]"
+
+// diff compares the JSON forms of before and after and returns the changed
+// fields, keyed by their JSON name, as a JSON object with sorted keys.
+func diff(before, after interface{}, redact []string) (json.RawMessage, error) {
+	b, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	hidden := make(map[string]bool, len(redact))
+	for _, name := range redact {
+		hidden[name] = true
+	}
+
+	changes := make(map[string]FieldChange)
+	for name, bv := range b {
+		av, ok := a[name]
+		if !ok || !reflect.DeepEqual(bv, av) {
+			changes[name] = FieldChange{Before: bv, After: av}
+		}
+	}
+	for name, av := range a {
+		if _, ok := b[name]; !ok {
+			changes[name] = FieldChange{Before: nil, After: av}
+		}
+	}
+
+	for name, ch := range changes {
+		if hidden[name] {
+			changes[name] = FieldChange{Before: redactValue(ch.Before), After: redactValue(ch.After)}
+		}
+	}
+
+	// encoding/json sorts map keys, which keeps the stored bytes, and so the
+	// hash, independent of map iteration order.
+	return json.Marshal(changes)
+}
+
+// fields flattens a record to its top-level JSON fields. A nil record has
+// none.
+func fields(v interface{}) (map[string]interface{}, error) {
+	if v == nil {
+		return map[string]interface{}{}, nil
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return map[string]interface{}{}, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal audit record: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var out map[string]interface{}
+	if err := dec.Decode(&out); err != nil {
+		return nil, fmt.Errorf("audit record is not a JSON object: %w", err)
+	}
+	return out, nil
+}
+
+func redactValue(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return redacted
+}
+
+// computeHash hashes every stored column of the entry except the ID, each
+// length-prefixed so that no two different entries share an input.
+func computeHash(e *Entry) string {
+	h := sha256.New()
+	parts := []string{
+		e.PrevHash,
+		e.Entity,
+		e.EntityID,
+		e.Action,
+		e.Actor,
+		e.ActorRole,
+		e.RequestID,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		string(e.Diff),
+	}
+	var size [8]byte
+	for _, part := range parts {
+		binary.BigEndian.PutUint64(size[:], uint64(len(part)))
+		h.Write(size[:])
+		h.Write([]byte(part))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,274 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	logger "sinibeli/internal/pkg/logging"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type record struct {
+	Name  string  `json:"name"`
+	Email string  `json:"email,omitempty"`
+	Price float64 `json:"price"`
+}
+
+func TestDiff(t *testing.T) {
+	cases := []struct {
+		name          string
+		before, after interface{}
+		redact        []string
+		want          string
+	}{
+		{"unchanged", record{Name: "a", Price: 1}, record{Name: "a", Price: 1}, nil, `{}`},
+		{"changed field only", record{Name: "a", Price: 1}, record{Name: "b", Price: 1}, nil,
+			`{"name":{"before":"a","after":"b"}}`},
+		{"numbers keep their form", record{Price: 0.1}, record{Price: 1e21}, nil,
+			`{"price":{"before":0.1,"after":1e+21}}`},
+		{"create", nil, record{Name: "a"}, nil,
+			`{"name":{"before":null,"after":"a"},"price":{"before":null,"after":0}}`},
+		{"delete of a nil pointer", (*record)(nil), (*record)(nil), nil, `{}`},
+		{"added field", record{Name: "a"}, record{Name: "a", Email: "a@example.com"}, nil,
+			`{"email":{"before":null,"after":"a@example.com"}}`},
+		{"redacted change", record{Name: "a", Email: "a@example.com"}, record{Name: "a", Email: "b@example.com"}, []string{"email"},
+			`{"email":{"before":"[REDACTED]","after":"[REDACTED]"}}`},
+		{"redacted field appearing", record{Name: "a"}, record{Name: "a", Email: "a@example.com"}, []string{"email"},
+			`{"email":{"before":null,"after":"[REDACTED]"}}`},
+		{"unchanged redacted field is left out", record{Name: "a", Email: "a@example.com"}, record{Name: "b", Email: "a@example.com"}, []string{"email"},
+			`{"name":{"before":"a","after":"b"}}`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := diff(tc.before, tc.after, tc.redact)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.want, string(got))
+			if len(tc.redact) > 0 {
+				assert.NotContains(t, string(got), "@example.com")
+			}
+		})
+	}
+
+	_, err := diff("not an object", nil, nil)
+	assert.Error(t, err)
+}
+
+func TestDiffIsStable(t *testing.T) {
+	before := map[string]interface{}{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5}
+	after := map[string]interface{}{"a": 2, "b": 3, "c": 4, "d": 5, "e": 6}
+	first, err := diff(before, after, nil)
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		again, err := diff(before, after, nil)
+		require.NoError(t, err)
+		assert.Equal(t, string(first), string(again), "the hashed bytes must not depend on map order")
+	}
+}
+
+func entry(id int64) *Entry {
+	return &Entry{
+		ID:        id,
+		Entity:    "customer",
+		EntityID:  "7",
+		Action:    ActionUpdate,
+		Actor:     "u-1",
+		ActorRole: "admin",
+		RequestID: "req-1",
+		Diff:      json.RawMessage(`{"name":{"before":"a","after":"b"}}`),
+		CreatedAt: time.Date(2024, 3, 1, 10, 0, 0, 123456000, time.UTC),
+		PrevHash:  genesisHash,
+	}
+}
+
+func TestComputeHash(t *testing.T) {
+	base := entry(1)
+	h := computeHash(base)
+	assert.Len(t, h, 64)
+	assert.Equal(t, h, computeHash(entry(1)))
+
+	other := entry(2)
+	assert.Equal(t, h, computeHash(other), "the ID is assigned after hashing and is not part of it")
+
+	jakarta := time.FixedZone("WIB", 7*3600)
+	shifted := entry(1)
+	shifted.CreatedAt = shifted.CreatedAt.In(jakarta)
+	assert.Equal(t, h, computeHash(shifted), "the same instant hashes the same in any zone")
+
+	changes := map[string]func(e *Entry){
+		"prev hash":  func(e *Entry) { e.PrevHash = strings.Repeat("1", 64) },
+		"entity":     func(e *Entry) { e.Entity = "company" },
+		"entity id":  func(e *Entry) { e.EntityID = "8" },
+		"action":     func(e *Entry) { e.Action = ActionDelete },
+		"actor":      func(e *Entry) { e.Actor = "u-2" },
+		"actor role": func(e *Entry) { e.ActorRole = "" },
+		"request id": func(e *Entry) { e.RequestID = "req-2" },
+		"created at": func(e *Entry) { e.CreatedAt = e.CreatedAt.Add(time.Microsecond) },
+		"diff":       func(e *Entry) { e.Diff = json.RawMessage(`{"name":{"before":"a","after":"c"}}`) },
+		// Without length prefixes these two would hash the same input.
+		"moved boundary": func(e *Entry) { e.Actor, e.ActorRole = "u-1a", "dmin" },
+	}
+	for name, change := range changes {
+		e := entry(1)
+		change(e)
+		assert.NotEqual(t, h, computeHash(e), name)
+	}
+}
+
+// chain links n entries the way AuditRepo.Append does.
+func chain(n int) []*Entry {
+	var entries []*Entry
+	prev := genesisHash
+	for i := 1; i <= n; i++ {
+		e := entry(int64(i))
+		e.EntityID = strconv.Itoa(i)
+		e.PrevHash = prev
+		e.Hash = computeHash(e)
+		prev = e.Hash
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestVerify(t *testing.T) {
+	ptr := func(id int64) *int64 { return &id }
+
+	cases := []struct {
+		name   string
+		tamper func([]*Entry) []*Entry
+		want   VerifyResult
+	}{
+		{"intact", func(es []*Entry) []*Entry { return es },
+			VerifyResult{Valid: true, Checked: 4}},
+		{"empty log", func([]*Entry) []*Entry { return nil },
+			VerifyResult{Valid: true}},
+		{"tampered diff", func(es []*Entry) []*Entry {
+			es[1].Diff = json.RawMessage(`{"name":{"before":"a","after":"z"}}`)
+			return es
+		}, VerifyResult{Checked: 1, BrokenAt: ptr(2), Reason: "entry content does not match its hash"}},
+		{"tampered diff with its hash recomputed", func(es []*Entry) []*Entry {
+			es[1].Diff = json.RawMessage(`{"name":{"before":"a","after":"z"}}`)
+			es[1].Hash = computeHash(es[1])
+			return es
+		}, VerifyResult{Checked: 2, BrokenAt: ptr(3), Reason: "entry does not link to the previous entry"}},
+		{"removed middle entry", func(es []*Entry) []*Entry {
+			return append(es[:1], es[2:]...)
+		}, VerifyResult{Checked: 1, BrokenAt: ptr(3), Reason: "entry does not link to the previous entry"}},
+		{"removed first entry", func(es []*Entry) []*Entry {
+			return es[1:]
+		}, VerifyResult{BrokenAt: ptr(2), Reason: "entry does not link to the previous entry"}},
+		{"removed last entry goes unnoticed", func(es []*Entry) []*Entry {
+			return es[:3]
+		}, VerifyResult{Valid: true, Checked: 3}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newFakeDB(t, tc.tamper(chain(4)))
+			got, err := NewAuditService(NewAuditRepo(db)).Verify(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestRedactedFieldsStayVerifiable(t *testing.T) {
+	d, err := diff(record{Name: "a", Email: "a@example.com"}, record{Name: "a", Email: "b@example.com"}, []string{"email"})
+	require.NoError(t, err)
+	assert.NotContains(t, string(d), "example.com")
+
+	es := chain(2)
+	es[1].Diff = d
+	es[1].Hash = computeHash(es[1])
+
+	db := newFakeDB(t, es)
+	got, err := NewAuditService(NewAuditRepo(db)).Verify(context.Background())
+	require.NoError(t, err)
+	assert.True(t, got.Valid)
+}
+
+func TestRecordOutlivesRequest(t *testing.T) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// The fake refuses to begin a transaction, so getting that far shows a
+	// cancelled request does not stop the append, and the failure comes back.
+	err := NewRecorder(NewAuditRepo(newFakeDB(t, nil))).Record(ctx, Change{Entity: "product", EntityID: 1, Action: ActionCreate, After: record{Name: "a"}})
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, context.Canceled)
+	assert.Contains(t, err.Error(), "transactions are not supported")
+}
+
+// The fake driver serves the audit_log rows of the test that opened it, for
+// Walk; nothing else is queried.
+var (
+	registerFake sync.Once
+	fakeLogs     sync.Map
+)
+
+func newFakeDB(t *testing.T, entries []*Entry) *sql.DB {
+	registerFake.Do(func() { sql.Register("audit-fake", fakeDriver{}) })
+	fakeLogs.Store(t.Name(), entries)
+
+	db, err := sql.Open("audit-fake", t.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	entries, ok := fakeLogs.Load(name)
+	if !ok {
+		return nil, errors.New("no fake audit log " + name)
+	}
+	return &fakeConn{entries: entries.([]*Entry)}, nil
+}
+
+type fakeConn struct{ entries []*Entry }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	if !strings.Contains(query, "FROM audit_log ORDER BY id") {
+		return nil, errors.New("unexpected query: " + query)
+	}
+	return &fakeRows{entries: c.entries}, nil
+}
+
+type fakeRows struct {
+	entries []*Entry
+	next    int
+}
+
+func (r *fakeRows) Columns() []string { return make([]string, 11) }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.entries) {
+		return io.EOF
+	}
+	e := r.entries[r.next]
+	r.next++
+	copy(dest, []driver.Value{e.ID, e.Entity, e.EntityID, e.Action, e.Actor, nullString(e.ActorRole),
+		nullString(e.RequestID), []byte(e.Diff), e.CreatedAt, e.PrevHash, e.Hash})
+	return nil
+}
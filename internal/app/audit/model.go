@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"encoding/json"
+	"time"
+
+	"sinibeli/internal/pkg/apperr"
+)
+
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionPurge   = "purge"
+	ActionMerge   = "merge"
+	ActionUnmerge = "unmerge"
+)
+
+// Entry is one row of the audit log. Diff maps each changed field to its
+// before and after value. Hash covers the entry and PrevHash, the hash of the
+// entry before it, so editing or removing any row breaks the chain.
+type Entry struct {
+	ID        int64           `json:"id"`
+	Entity    string          `json:"entity"`
+	EntityID  string          `json:"entity_id"`
+	Action    string          `json:"action"`
+	Actor     string          `json:"actor"`
+	ActorRole string          `json:"actor_role,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	Diff      json.RawMessage `json:"diff"`
+	CreatedAt time.Time       `json:"created_at"`
+	PrevHash  string          `json:"prev_hash"`
+	Hash      string          `json:"hash"`
+}
+
+// FieldChange is the value of a field before and after a write; nil on one
+// side means the record did not exist.
+type FieldChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Change describes a write for Recorder.Record. Before and After are the
+// record as it was and as it is, nil for a create or a purge; any value that
+// marshals to a JSON object will do. Fields listed in Redact are reported as
+// changed without their values.
+type Change struct {
+	Entity   string
+	EntityID interface{}
+	Action   string
+	Before   interface{}
+	After    interface{}
+	Redact   []string
+}
+
+type Filter struct {
+	Entity   string
+	EntityID string
+	Actor    string
+	From     *time.Time
+	To       *time.Time
+	Page     int64
+	PageSize int64
+}
+
+type Pagination struct {
+	Page       int64 `json:"page"`
+	PageSize   int64 `json:"page_size"`
+	TotalItems int64 `json:"total_items"`
+	TotalPages int64 `json:"total_pages"`
+}
+
+type ListResponse struct {
+	Data       []Entry    `json:"data"`
+	Pagination Pagination `json:"pagination"`
+}
+
+// VerifyResult reports the outcome of walking the hash chain. BrokenAt is
+// the first entry whose hash or link does not match.
+type VerifyResult struct {
+	Valid    bool   `json:"valid"`
+	Checked  int64  `json:"checked"`
+	BrokenAt *int64 `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+var (
+	ErrInvalidPage      = apperr.New(apperr.Invalid, "invalid_page", "page must be >= 1")
+	ErrInvalidPageSize  = apperr.New(apperr.Invalid, "invalid_page_size", "page_size must be between 1 and 100")
+	ErrInvalidDateRange = apperr.New(apperr.Invalid, "invalid_date_range", "from must be before to")
+	ErrIDWithoutEntity  = apperr.New(apperr.Invalid, "id_without_entity", "id requires entity")
+)
+
+func (f *Filter) Validate() error {
+	if f.Page < 1 {
+		return ErrInvalidPage
+	}
+	if f.PageSize < 1 || f.PageSize > 100 {
+		return ErrInvalidPageSize
+	}
+	if f.From != nil && f.To != nil && f.From.After(*f.To) {
+		return ErrInvalidDateRange
+	}
+	if f.EntityID != "" && f.Entity == "" {
+		return ErrIDWithoutEntity
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// chainLockKey is the advisory lock that serializes appends, so each entry
+// links to the one committed right before it.
+const chainLockKey = 0x61756469746c6f67
+
+type AuditRepo struct {
+	DB *sql.DB
+}
+
+func NewAuditRepo(db *sql.DB) *AuditRepo {
+	return &AuditRepo{DB: db}
+}
+
+const entryColumns = `id, entity, entity_id, action, actor, actor_role,
+		       request_id, diff, created_at, prev_hash, hash`
+
+// Append links e to the end of the chain, filling in PrevHash, Hash and ID.
+func (r *AuditRepo) Append(ctx context.Context, e *Entry) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin audit append: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, int64(chainLockKey)); err != nil {
+		return fmt.Errorf("failed to lock audit chain: %w", err)
+	}
+
+	err = tx.QueryRowContext(ctx, `SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1`).Scan(&e.PrevHash)
+	if err == sql.ErrNoRows {
+		e.PrevHash = genesisHash
+	} else if err != nil {
+		return fmt.Errorf("failed to read audit chain head: %w", err)
+	}
+	e.Hash = computeHash(e)
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO audit_log (entity, entity_id, action, actor, actor_role,
+		                       request_id, diff, created_at, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id`,
+		e.Entity, e.EntityID, e.Action, e.Actor, nullString(e.ActorRole),
+		nullString(e.RequestID), string(e.Diff), e.CreatedAt, e.PrevHash, e.Hash,
+	).Scan(&e.ID)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit entry: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit audit entry: %w", err)
+	}
+	return nil
+}
+
+func (r *AuditRepo) List(ctx context.Context, filter Filter) ([]Entry, int64, error) {
+	var conditions []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(cond, len(args)))
+	}
+
+	if filter.Entity != "" {
+		add("entity = $%d", filter.Entity)
+	}
+	if filter.EntityID != "" {
+		add("entity_id = $%d", filter.EntityID)
+	}
+	if filter.Actor != "" {
+		add("actor = $%d", filter.Actor)
+	}
+	if filter.From != nil {
+		add("created_at >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		add("created_at <= $%d", *filter.To)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	args = append(args, filter.PageSize, (filter.Page-1)*filter.PageSize)
+	query := fmt.Sprintf(`
+		SELECT %s, COUNT(*) OVER () AS total
+		FROM audit_log
+		%s
+		ORDER BY id DESC
+		LIMIT $%d OFFSET $%d`, entryColumns, where, len(args)-1, len(args))
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]Entry, 0)
+	var total int64
+	for rows.Next() {
+		var e Entry
+		if err := scanEntry(rows, &e, &total); err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("row iteration error: %w", err)
+	}
+	return entries, total, nil
+}
+
+// Walk calls fn for every entry in chain order, stopping early when fn
+// returns false.
+func (r *AuditRepo) Walk(ctx context.Context, fn func(e *Entry) bool) error {
+	rows, err := r.DB.QueryContext(ctx, `SELECT `+entryColumns+` FROM audit_log ORDER BY id`)
+	if err != nil {
+		return fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e Entry
+		if err := scanEntry(rows, &e); err != nil {
+			return err
+		}
+		if !fn(&e) {
+			return nil
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("row iteration error: %w", err)
+	}
+	return nil
+}
+
+func scanEntry(rows *sql.Rows, e *Entry, extra ...interface{}) error {
+	var actorRole, requestID sql.NullString
+	var diff []byte
+
+	dest := []interface{}{&e.ID, &e.Entity, &e.EntityID, &e.Action, &e.Actor, &actorRole,
+		&requestID, &diff, &e.CreatedAt, &e.PrevHash, &e.Hash}
+	if err := rows.Scan(append(dest, extra...)...); err != nil {
+		return fmt.Errorf("failed to scan audit entry: %w", err)
+	}
+
+	e.ActorRole = actorRole.String
+	e.RequestID = requestID.String
+	e.Diff = diff
+	e.CreatedAt = e.CreatedAt.UTC()
+	return nil
+}
+
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -4,9 +4,16 @@ import (
 	"net/http"
 	"strconv"
 
+	"sinibeli/internal/pkg/apperr"
+	"sinibeli/internal/pkg/etag"
+	"sinibeli/internal/pkg/patch"
+	"sinibeli/internal/pkg/request"
+
 	"github.com/gin-gonic/gin"
 )
 
+var errInvalidID = apperr.InvalidParam("id", "invalid company ID")
+
 type CompanyHandler struct {
 	service *CompanyService
 }
@@ -17,24 +24,25 @@ func NewCompanyHandler(service *CompanyService) *CompanyHandler {
 
 func (h *CompanyHandler) Create(c *gin.Context) {
 
-	if err := c.ShouldBindJSON(&CreateCompanyReq); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	req, ok := request.BindJSON[CreateCompanyReq](c)
+	if !ok {
 		return
 	}
 
 	company := &Company{
-		ID:      CreateCompanyReq.ID,
-		Name:    CreateCompanyReq.Name,
-		Type:    CreateCompanyReq.Type,
-		Address: CreateCompanyReq.Address,
-		City:    CreateCompanyReq.City,
+		ID:      req.ID,
+		Name:    req.Name,
+		Type:    req.Type,
+		Address: req.Address,
+		City:    req.City,
 	}
 
-	if err := h.service.Create(company); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.service.Create(c.Request.Context(), company); err != nil {
+		c.Error(err)
 		return
 	}
 
+	c.Header("ETag", etag.Format(company.Version))
 	c.JSON(http.StatusCreated, company)
 }
 
@@ -42,27 +50,28 @@ func (h *CompanyHandler) GetByID(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid company ID"})
+		c.Error(errInvalidID)
 		return
 	}
 
-	company, err := h.service.GetByID(id)
+	company, err := h.service.GetByID(c.Request.Context(), id, c.Query("include_deleted") == "true")
 	if err != nil {
-		if err == ErrNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "company not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
+	c.Header("ETag", etag.Format(company.Version))
+	if etag.NoneMatch(c.GetHeader("If-None-Match"), company.Version) {
+		c.Status(http.StatusNotModified)
+		return
+	}
 	c.JSON(http.StatusOK, company)
 }
 
 func (h *CompanyHandler) GetAll(c *gin.Context) {
-	companies, err := h.service.GetAll()
+	companies, err := h.service.GetAll(c.Request.Context(), c.Query("include_deleted") == "true")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, companies)
@@ -72,51 +81,128 @@ func (h *CompanyHandler) Update(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid company ID"})
+		c.Error(errInvalidID)
 		return
 	}
 
-	if err := c.ShouldBindJSON(&UpdateCompanyReq); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	ifMatch, err := etag.ParseIfMatch(c.GetHeader("If-Match"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	req, ok := request.BindJSON[UpdateCompanyReq](c)
+	if !ok {
 		return
 	}
 
 	company := &Company{
 		ID:      id,
-		Name:    UpdateCompanyReq.Name,
-		Type:    UpdateCompanyReq.Type,
-		Address: UpdateCompanyReq.Address,
-		City:    UpdateCompanyReq.City,
+		Name:    req.Name,
+		Type:    req.Type,
+		Address: req.Address,
+		City:    req.City,
+	}
+
+	if err := h.service.Update(c.Request.Context(), company, ifMatch); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Header("ETag", etag.Format(company.Version))
+	c.JSON(http.StatusOK, company)
+}
+
+// Patch applies a JSON Merge Patch or JSON Patch to the company. Members the
+// patch leaves out keep their values, and the result must pass the same
+// validation as a full update.
+func (h *CompanyHandler) Patch(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errInvalidID)
+		return
+	}
+
+	ifMatch, err := etag.ParseIfMatch(c.GetHeader("If-Match"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		c.Error(request.ErrUnreadableBody.WithCause(err))
+		return
+	}
+	doc, err := patch.Parse(c.ContentType(), body)
+	if err != nil {
+		c.Error(err)
+		return
 	}
 
-	if err := h.service.Update(company); err != nil {
-		if err == ErrNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "company not found"})
-			return
+	company, err := h.service.Patch(c.Request.Context(), id, ifMatch, func(company *Company) error {
+		fields := UpdateCompanyReq{Name: company.Name, Type: company.Type, Address: company.Address, City: company.City}
+		if err := doc.ApplyTo(&fields); err != nil {
+			return err
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := request.Validate(&fields); err != nil {
+			return err
+		}
+		company.Name, company.Type, company.Address, company.City = fields.Name, fields.Type, fields.Address, fields.City
+		return nil
+	})
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
+	c.Header("ETag", etag.Format(company.Version))
 	c.JSON(http.StatusOK, company)
 }
 
+// Delete soft-deletes the company; ?purge=true removes it for good, which is
+// refused with the reference counts while anything still points at it.
 func (h *CompanyHandler) Delete(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid company ID"})
+		c.Error(errInvalidID)
 		return
 	}
 
-	if err := h.service.Delete(id); err != nil {
-		if err == ErrNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "company not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	ifMatch, err := etag.ParseIfMatch(c.GetHeader("If-Match"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if c.Query("purge") == "true" {
+		err = h.service.Purge(c.Request.Context(), id, ifMatch)
+	} else {
+		err = h.service.Delete(c.Request.Context(), id, ifMatch)
+	}
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusNoContent, nil)
 }
+
+func (h *CompanyHandler) Restore(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.Error(errInvalidID)
+		return
+	}
+
+	company, err := h.service.Restore(c.Request.Context(), id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Header("ETag", etag.Format(company.Version))
+	c.JSON(http.StatusOK, company)
+}
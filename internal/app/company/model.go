@@ -1,14 +1,18 @@
 package company
 
+import "time"
+
 type Company struct {
-	ID      int64  `json:"id"`
-	Name    string `json:"name"`
-	Type    string `json:"type"`
-	Address string `json:"address"`
-	City    string `json:"city"`
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	Type      string     `json:"type"`
+	Address   string     `json:"address"`
+	City      string     `json:"city"`
+	Version   int64      `json:"version"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
-var CreateCompanyReq struct {
+type CreateCompanyReq struct {
 	ID      int64  `json:"id" binding:"required"`
 	Name    string `json:"name" binding:"required,max=25"`
 	Type    string `json:"type" binding:"required,max=25"`
@@ -16,7 +20,9 @@ var CreateCompanyReq struct {
 	City    string `json:"city" binding:"required,max=100"`
 }
 
-var UpdateCompanyReq struct {
+// UpdateCompanyReq is also what a PATCH can change; the patched result is
+// validated with the same rules as a full update.
+type UpdateCompanyReq struct {
 	Name    string `json:"name" binding:"required,max=25"`
 	Type    string `json:"type" binding:"required,max=25"`
 	Address string `json:"address" binding:"required,max=255"`
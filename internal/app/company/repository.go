@@ -1,8 +1,13 @@
 package company
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
+
+	"sinibeli/internal/pkg/etag"
 )
 
 type CompanyRepo struct {
@@ -13,33 +18,47 @@ func NewCompanyRepo(db *sql.DB) *CompanyRepo {
 	return &CompanyRepo{DB: db}
 }
 
-func (r *CompanyRepo) Create(company *Company) error {
-	query := `INSERT INTO company (id, name, type, address, city) VALUES ($1, $2, $3, $4, $5)`
-	_, err := r.DB.Exec(query, company.ID, company.Name, company.Type, company.Address, company.City)
-	if err != nil {
+func (r *CompanyRepo) Create(ctx context.Context, company *Company) error {
+	query := `INSERT INTO company (id, name, type, address, city) VALUES ($1, $2, $3, $4, $5) RETURNING version`
+	row := r.DB.QueryRowContext(ctx, query, company.ID, company.Name, company.Type, company.Address, company.City)
+	if err := row.Scan(&company.Version); err != nil {
 		return fmt.Errorf("failed to create company: %w", err)
 	}
 	return nil
 }
 
-func (r *CompanyRepo) GetByID(id int64) (*Company, error) {
-	query := `SELECT id, name, type, address, city FROM company WHERE id = $1`
-	row := r.DB.QueryRow(query, id)
+// GetByID only finds companies that are not soft-deleted; use
+// GetByIDWithDeleted where a deleted company must be visible too.
+func (r *CompanyRepo) GetByID(ctx context.Context, id int64) (*Company, error) {
+	return r.getByID(ctx, id, false)
+}
+
+func (r *CompanyRepo) GetByIDWithDeleted(ctx context.Context, id int64) (*Company, error) {
+	return r.getByID(ctx, id, true)
+}
+
+func (r *CompanyRepo) getByID(ctx context.Context, id int64, includeDeleted bool) (*Company, error) {
+	query := `SELECT id, name, type, address, city, version, deleted_at FROM company WHERE id = $1 AND ($2 OR deleted_at IS NULL)`
+	row := r.DB.QueryRowContext(ctx, query, id, includeDeleted)
 
 	var c Company
-	err := row.Scan(&c.ID, &c.Name, &c.Type, &c.Address, &c.City)
+	var deletedAt sql.NullTime
+	err := row.Scan(&c.ID, &c.Name, &c.Type, &c.Address, &c.City, &c.Version, &deletedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
 		return nil, fmt.Errorf("failed to get company by id: %w", err)
 	}
+	if deletedAt.Valid {
+		c.DeletedAt = &deletedAt.Time
+	}
 	return &c, nil
 }
 
-func (r *CompanyRepo) GetAll() ([]*Company, error) {
-	query := `SELECT id, name, type, address, city FROM company`
-	rows, err := r.DB.Query(query)
+func (r *CompanyRepo) GetAll(ctx context.Context, includeDeleted bool) ([]*Company, error) {
+	query := `SELECT id, name, type, address, city, version, deleted_at FROM company WHERE $1 OR deleted_at IS NULL`
+	rows, err := r.DB.QueryContext(ctx, query, includeDeleted)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all companies: %w", err)
 	}
@@ -48,10 +67,14 @@ func (r *CompanyRepo) GetAll() ([]*Company, error) {
 	companies := make([]*Company, 0)
 	for rows.Next() {
 		var c Company
-		err := rows.Scan(&c.ID, &c.Name, &c.Type, &c.Address, &c.City)
+		var deletedAt sql.NullTime
+		err := rows.Scan(&c.ID, &c.Name, &c.Type, &c.Address, &c.City, &c.Version, &deletedAt)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan company row: %w", err)
 		}
+		if deletedAt.Valid {
+			c.DeletedAt = &deletedAt.Time
+		}
 		companies = append(companies, &c)
 	}
 
@@ -62,29 +85,120 @@ func (r *CompanyRepo) GetAll() ([]*Company, error) {
 	return companies, nil
 }
 
-func (r *CompanyRepo) Update(company *Company) error {
-	query := `UPDATE company SET name = $1, type = $2, address = $3, city = $4 WHERE id = $5`
-	res, err := r.DB.Exec(query, company.Name, company.Type, company.Address, company.City, company.ID)
-	if err != nil {
+// Update only applies while the company is still at version, and sets the
+// version it moved to on company. etag.ErrPreconditionFailed means another
+// write got there first.
+func (r *CompanyRepo) Update(ctx context.Context, company *Company, version int64) error {
+	query := `UPDATE company SET name = $1, type = $2, address = $3, city = $4 WHERE id = $5 AND version = $6 AND deleted_at IS NULL RETURNING version`
+	row := r.DB.QueryRowContext(ctx, query, company.Name, company.Type, company.Address, company.City, company.ID, version)
+	if err := row.Scan(&company.Version); err != nil {
+		if err == sql.ErrNoRows {
+			return etag.ErrPreconditionFailed
+		}
 		return fmt.Errorf("failed to update company: %w", err)
 	}
+	return nil
+}
 
-	rowsAffected, err := res.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+// Patch writes only the given columns of company, under the same version
+// check as Update.
+func (r *CompanyRepo) Patch(ctx context.Context, company *Company, columns []string, version int64) error {
+	values := map[string]interface{}{
+		"name":    company.Name,
+		"type":    company.Type,
+		"address": company.Address,
+		"city":    company.City,
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("no company found with id %d", company.ID)
+
+	set := make([]string, len(columns))
+	args := make([]interface{}, 0, len(columns)+2)
+	for i, column := range columns {
+		args = append(args, values[column])
+		set[i] = fmt.Sprintf("%s = $%d", column, len(args))
 	}
+	args = append(args, company.ID, version)
 
+	query := fmt.Sprintf(`UPDATE company SET %s WHERE id = $%d AND version = $%d AND deleted_at IS NULL RETURNING version`,
+		strings.Join(set, ", "), len(args)-1, len(args))
+	if err := r.DB.QueryRowContext(ctx, query, args...).Scan(&company.Version); err != nil {
+		if err == sql.ErrNoRows {
+			return etag.ErrPreconditionFailed
+		}
+		return fmt.Errorf("failed to patch company: %w", err)
+	}
 	return nil
 }
 
-func (r *CompanyRepo) Delete(id int64) error {
-	query := `DELETE FROM company WHERE id = $1`
-	res, err := r.DB.Exec(query, id)
+// changedColumns lists the columns whose values differ between two states of
+// a company.
+func changedColumns(before, after *Company) []string {
+	var columns []string
+	if before.Name != after.Name {
+		columns = append(columns, "name")
+	}
+	if before.Type != after.Type {
+		columns = append(columns, "type")
+	}
+	if before.Address != after.Address {
+		columns = append(columns, "address")
+	}
+	if before.City != after.City {
+		columns = append(columns, "city")
+	}
+	return columns
+}
+
+// SoftDelete stamps deleted_at on the company at version and returns it.
+func (r *CompanyRepo) SoftDelete(ctx context.Context, id, version int64) (time.Time, error) {
+	query := `UPDATE company SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND version = $2 AND deleted_at IS NULL RETURNING deleted_at`
+
+	var deletedAt time.Time
+	if err := r.DB.QueryRowContext(ctx, query, id, version).Scan(&deletedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return time.Time{}, etag.ErrPreconditionFailed
+		}
+		return time.Time{}, fmt.Errorf("failed to delete company: %w", err)
+	}
+	return deletedAt, nil
+}
+
+// Restore clears deleted_at and returns the version it moved the company to;
+// restored is false when the company was not deleted.
+func (r *CompanyRepo) Restore(ctx context.Context, id int64) (version int64, restored bool, err error) {
+	query := `UPDATE company SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL RETURNING version`
+	if err := r.DB.QueryRowContext(ctx, query, id).Scan(&version); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("failed to restore company: %w", err)
+	}
+	return version, true, nil
+}
+
+// References counts the rows that keep the company from being purged.
+func (r *CompanyRepo) References(ctx context.Context, id int64) (map[string]int64, error) {
+	query := `
+		SELECT (SELECT COUNT(*) FROM customer WHERE company = $1),
+		       (SELECT COUNT(*) FROM transaction_daily_rollup WHERE company_id = $1),
+		       (SELECT COUNT(*) FROM transaction_attachment WHERE company_id = $1)`
+
+	var customers, rollups, attachments int64
+	if err := r.DB.QueryRowContext(ctx, query, id).Scan(&customers, &rollups, &attachments); err != nil {
+		return nil, fmt.Errorf("failed to count company references: %w", err)
+	}
+	return map[string]int64{
+		"customers":   customers,
+		"rollup_rows": rollups,
+		"attachments": attachments,
+	}, nil
+}
+
+// Purge removes the company row at version for good, deleted or not.
+func (r *CompanyRepo) Purge(ctx context.Context, id, version int64) error {
+	query := `DELETE FROM company WHERE id = $1 AND version = $2`
+	res, err := r.DB.ExecContext(ctx, query, id, version)
 	if err != nil {
-		return fmt.Errorf("failed to delete company: %w", err)
+		return fmt.Errorf("failed to purge company: %w", err)
 	}
 
 	rowsAffected, err := res.RowsAffected()
@@ -92,7 +206,7 @@ func (r *CompanyRepo) Delete(id int64) error {
 		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
 	if rowsAffected == 0 {
-		return fmt.Errorf("no company found with id %d", id)
+		return etag.ErrPreconditionFailed
 	}
 
 	return nil
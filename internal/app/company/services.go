@@ -1,69 +1,254 @@
 package company
 
 import (
-	"errors"
+	"context"
+	"fmt"
+
+	"sinibeli/internal/app/audit"
+	"sinibeli/internal/infrastructure/cache"
+	"sinibeli/internal/pkg/apperr"
+	"sinibeli/internal/pkg/etag"
+	"sinibeli/internal/pkg/softdelete"
+	"sinibeli/internal/pkg/tracing"
 )
 
 var (
-	ErrNotFound = errors.New("company not found")
+	ErrNotFound = apperr.New(apperr.NotFound, "company_not_found", "company not found")
 )
 
 type CompanyService struct {
-	repo *CompanyRepo
+	repo        *CompanyRepo
+	cache       cache.Cache
+	invalidator *cache.Invalidator
+	audit       *audit.Recorder
 }
 
-func NewCompanyService(repo *CompanyRepo) *CompanyService {
-	return &CompanyService{repo: repo}
+func NewCompanyService(repo *CompanyRepo, appCache cache.Cache, invalidator *cache.Invalidator, recorder *audit.Recorder) *CompanyService {
+	return &CompanyService{repo: repo, cache: appCache, invalidator: invalidator, audit: recorder}
 }
 
-func (s *CompanyService) Create(company *Company) error {
-	return s.repo.Create(company)
+func (s *CompanyService) Create(ctx context.Context, company *Company) error {
+	ctx, span := tracing.Start(ctx, "CompanyService.Create")
+	defer span.End()
+
+	if err := s.repo.Create(ctx, company); err != nil {
+		return err
+	}
+	s.invalidator.Publish(ctx, cache.EventCompanyChanged, company.ID)
+	return s.audit.Record(ctx, audit.Change{Entity: "company", EntityID: company.ID, Action: audit.ActionCreate, After: company})
 }
 
-func (s *CompanyService) GetByID(id int64) (Company, error) {
-	company, err := s.repo.GetByID(id)
+// GetByID returns the company unless it is soft-deleted. Including deleted
+// companies skips the cache, which only ever holds live ones.
+func (s *CompanyService) GetByID(ctx context.Context, id int64, includeDeleted bool) (Company, error) {
+	ctx, span := tracing.Start(ctx, "CompanyService.GetByID")
+	defer span.End()
+
+	if includeDeleted {
+		company, err := s.repo.GetByIDWithDeleted(ctx, id)
+		if err != nil {
+			return Company{}, err
+		}
+		if company == nil {
+			return Company{}, ErrNotFound
+		}
+		return *company, nil
+	}
+
+	var company Company
+	err := s.cache.GetOrSet(ctx, fmt.Sprintf(cache.CompanyKey, fmt.Sprint(id)), &company, cache.CompanyTTL, func(ctx context.Context) (interface{}, error) {
+		company, err := s.repo.GetByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if company == nil {
+			return nil, ErrNotFound
+		}
+		return company, nil
+	})
 	if err != nil {
 		return Company{}, err
 	}
-	if company == nil {
-		return Company{}, ErrNotFound
-	}
-	return *company, nil
+	return company, nil
 }
 
-func (s *CompanyService) GetAll() ([]Company, error) {
-	companies, err := s.repo.GetAll()
-	if err != nil {
-		return []Company{}, err
+func (s *CompanyService) GetAll(ctx context.Context, includeDeleted bool) ([]Company, error) {
+	ctx, span := tracing.Start(ctx, "CompanyService.GetAll")
+	defer span.End()
+
+	listKey := "all"
+	if includeDeleted {
+		listKey = "with-deleted"
 	}
-	
-	result := make([]Company, len(companies))
-	for i, c := range companies {
-		if c != nil {
-			result[i] = *c
+
+	var result []Company
+	err := s.cache.GetOrSet(ctx, fmt.Sprintf(cache.CompanyListKey, listKey), &result, cache.CompanyListTTL, func(ctx context.Context) (interface{}, error) {
+		companies, err := s.repo.GetAll(ctx, includeDeleted)
+		if err != nil {
+			return nil, err
 		}
+
+		result := make([]Company, len(companies))
+		for i, c := range companies {
+			if c != nil {
+				result[i] = *c
+			}
+		}
+		return result, nil
+	})
+	if err != nil {
+		return []Company{}, err
 	}
 	return result, nil
 }
 
-func (s *CompanyService) Update(company *Company) error {
-	existing, err := s.repo.GetByID(company.ID)
+// Update overwrites the company when ifMatch holds for its current version,
+// and fails with etag.ErrPreconditionFailed otherwise.
+func (s *CompanyService) Update(ctx context.Context, company *Company, ifMatch etag.Precondition) error {
+	ctx, span := tracing.Start(ctx, "CompanyService.Update")
+	defer span.End()
+
+	existing, err := s.repo.GetByID(ctx, company.ID)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return ErrNotFound
+	}
+	if !ifMatch.Matches(existing.Version) {
+		return etag.ErrPreconditionFailed
+	}
+	if err := s.repo.Update(ctx, company, existing.Version); err != nil {
+		return err
+	}
+	s.invalidator.Publish(ctx, cache.EventCompanyChanged, company.ID)
+	return s.audit.Record(ctx, audit.Change{Entity: "company", EntityID: company.ID, Action: audit.ActionUpdate, Before: existing, After: company})
+}
+
+// Patch applies edit to the company's current state when ifMatch holds for
+// its version, and writes only the columns edit changed.
+func (s *CompanyService) Patch(ctx context.Context, id int64, ifMatch etag.Precondition, edit func(*Company) error) (Company, error) {
+	ctx, span := tracing.Start(ctx, "CompanyService.Patch")
+	defer span.End()
+
+	existing, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return Company{}, err
+	}
+	if existing == nil {
+		return Company{}, ErrNotFound
+	}
+	if !ifMatch.Matches(existing.Version) {
+		return Company{}, etag.ErrPreconditionFailed
+	}
+
+	company := *existing
+	if err := edit(&company); err != nil {
+		return Company{}, err
+	}
+	columns := changedColumns(existing, &company)
+	if len(columns) == 0 {
+		return company, nil
+	}
+	if err := s.repo.Patch(ctx, &company, columns, existing.Version); err != nil {
+		return Company{}, err
+	}
+	s.invalidator.Publish(ctx, cache.EventCompanyChanged, id)
+	if err := s.audit.Record(ctx, audit.Change{Entity: "company", EntityID: id, Action: audit.ActionUpdate, Before: existing, After: company}); err != nil {
+		return Company{}, err
+	}
+	return company, nil
+}
+
+func (s *CompanyService) Delete(ctx context.Context, id int64, ifMatch etag.Precondition) error {
+	ctx, span := tracing.Start(ctx, "CompanyService.Delete")
+	defer span.End()
+
+	existing, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return err
 	}
 	if existing == nil {
 		return ErrNotFound
 	}
-	return s.repo.Update(company)
+	if !ifMatch.Matches(existing.Version) {
+		return etag.ErrPreconditionFailed
+	}
+	deletedAt, err := s.repo.SoftDelete(ctx, id, existing.Version)
+	if err != nil {
+		return err
+	}
+	s.invalidator.Publish(ctx, cache.EventCompanyChanged, id)
+
+	deleted := *existing
+	deleted.DeletedAt = &deletedAt
+	return s.audit.Record(ctx, audit.Change{Entity: "company", EntityID: id, Action: audit.ActionDelete, Before: existing, After: deleted})
 }
 
-func (s *CompanyService) Delete(id int64) error {
-	existing, err := s.repo.GetByID(id)
+func (s *CompanyService) Restore(ctx context.Context, id int64) (Company, error) {
+	ctx, span := tracing.Start(ctx, "CompanyService.Restore")
+	defer span.End()
+
+	existing, err := s.repo.GetByIDWithDeleted(ctx, id)
+	if err != nil {
+		return Company{}, err
+	}
+	if existing == nil {
+		return Company{}, ErrNotFound
+	}
+
+	version, restored, err := s.repo.Restore(ctx, id)
+	if err != nil {
+		return Company{}, err
+	}
+	if !restored {
+		return Company{}, softdelete.ErrNotDeleted
+	}
+	s.invalidator.Publish(ctx, cache.EventCompanyChanged, id)
+
+	company := *existing
+	company.DeletedAt = nil
+	company.Version = version
+	if err := s.audit.Record(ctx, audit.Change{Entity: "company", EntityID: id, Action: audit.ActionRestore, Before: existing, After: company}); err != nil {
+		return Company{}, err
+	}
+	return company, nil
+}
+
+// Purge hard-deletes the company. It is refused with a
+// *softdelete.ReferencedError while anything still points at the company.
+func (s *CompanyService) Purge(ctx context.Context, id int64, ifMatch etag.Precondition) error {
+	ctx, span := tracing.Start(ctx, "CompanyService.Purge")
+	defer span.End()
+
+	existing, err := s.repo.GetByIDWithDeleted(ctx, id)
 	if err != nil {
 		return err
 	}
 	if existing == nil {
 		return ErrNotFound
 	}
-	return s.repo.Delete(id)
+	if !ifMatch.Matches(existing.Version) {
+		return etag.ErrPreconditionFailed
+	}
+
+	refs, err := s.repo.References(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := softdelete.Check("company", refs); err != nil {
+		return err
+	}
+
+	if err := s.repo.Purge(ctx, id, existing.Version); err != nil {
+		if !softdelete.IsForeignKeyViolation(err) {
+			return err
+		}
+		if refs, err = s.repo.References(ctx, id); err != nil {
+			return err
+		}
+		return &softdelete.ReferencedError{Entity: "company", References: refs}
+	}
+	s.invalidator.Publish(ctx, cache.EventCompanyChanged, id)
+	return s.audit.Record(ctx, audit.Change{Entity: "company", EntityID: id, Action: audit.ActionPurge, Before: existing})
 }
@@ -1,19 +1,80 @@
 package customer
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"slices"
 	"strconv"
 	"time"
 
+	"sinibeli/internal/pkg/apperr"
+	"sinibeli/internal/pkg/etag"
+	"sinibeli/internal/pkg/imaging"
+	"sinibeli/internal/pkg/patch"
+	"sinibeli/internal/pkg/redact"
+	"sinibeli/internal/pkg/request"
+
 	"github.com/gin-gonic/gin"
 )
 
+const photoPath = "/api/v1/customers/%d/photo"
+
+var (
+	errInvalidID         = apperr.InvalidParam("id", "invalid customer ID")
+	errInvalidMergeID    = apperr.InvalidParam("mergeId", "invalid merge ID")
+	errInvalidCompanyID  = apperr.InvalidParam("company_id", "company_id must be a positive integer")
+	errInvalidBirthDate  = apperr.InvalidParam("birth_date", "invalid birth_date format, expected YYYY-MM-DD")
+	errMissingPhotoField = apperr.New(apperr.Invalid, "missing_photo_field", "multipart field \"photo\" is required")
+	errPatchReadsPII     = apperr.New(apperr.Forbidden, "pii_access_required", "patch reads fields that require PII access")
+	errPhotoForbidden    = apperr.New(apperr.Forbidden, "pii_access_required", "not allowed to view customer photos")
+)
+
 type CustomerHandler struct {
 	service *CustomerService
+	photos  *PhotoService
+	merges  *MergeService
+	pii     *redact.Policy
 }
 
-func NewCustomerHandler(service *CustomerService) *CustomerHandler {
-	return &CustomerHandler{service: service}
+func NewCustomerHandler(service *CustomerService, photos *PhotoService, merges *MergeService, pii *redact.Policy) *CustomerHandler {
+	return &CustomerHandler{service: service, photos: photos, merges: merges, pii: pii}
+}
+
+// present applies the PII policy for the caller's role to a response and
+// links the photo endpoints in place of the image itself.
+func (h *CustomerHandler) present(c *gin.Context, cust Customer) Customer {
+	if cust.HasPhoto() {
+		cust.PhotoURL = fmt.Sprintf(photoPath, cust.ID)
+		cust.ThumbnailURL = cust.PhotoURL + "?size=thumbnail"
+	}
+	if h.pii.CanViewPII(c.GetString("role")) {
+		return cust
+	}
+	return cust.Masked()
+}
+
+// decodePhoto turns the optional data URI accepted by create and update into
+// image bytes, checking it up front so a bad photo fails the whole request.
+func (h *CustomerHandler) decodePhoto(c *gin.Context, uri string) ([]byte, bool) {
+	if uri == "" {
+		return nil, true
+	}
+	data, err := DecodeDataURI(uri)
+	if err != nil {
+		c.Error(err)
+		return nil, false
+	}
+	if int64(len(data)) > h.photos.MaxBytes() {
+		c.Error(ErrPhotoTooLarge)
+		return nil, false
+	}
+	if _, err := imaging.Sniff(data); err != nil {
+		c.Error(fmt.Errorf("%w: %v", ErrInvalidPhoto, err))
+		return nil, false
+	}
+	return data, true
 }
 
 func parseDate(dateStr string) (time.Time, error) {
@@ -29,125 +90,554 @@ func parseDate(dateStr string) (time.Time, error) {
 
 func (h *CustomerHandler) Create(c *gin.Context) {
 
-	if err := c.ShouldBindJSON(&CreateCustomerReq); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	req, ok := request.BindJSON[CreateCustomerReq](c)
+	if !ok {
 		return
 	}
 
-	birthDate, err := parseDate(CreateCustomerReq.BirthDate)
+	birthDate, err := parseDate(req.BirthDate)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid birth_date format, expected YYYY-MM-DD"})
+		c.Error(errInvalidBirthDate)
+		return
+	}
+
+	photo, ok := h.decodePhoto(c, req.Photo)
+	if !ok {
 		return
 	}
 
 	cust := &Customer{
-		ID:          CreateCustomerReq.ID,
-		FirstName:   CreateCustomerReq.FirstName,
-		LastName:    CreateCustomerReq.LastName,
+		ID:          req.ID,
+		FirstName:   req.FirstName,
+		LastName:    req.LastName,
 		BirthDate:   birthDate,
-		CompanyID:   CreateCustomerReq.CompanyID,
-		Email:       CreateCustomerReq.Email,
-		PhoneNumber: CreateCustomerReq.PhoneNumber,
-		Address:     CreateCustomerReq.Address,
-		Gender:      CreateCustomerReq.Gender,
-		Photo:       CreateCustomerReq.Photo,
+		CompanyID:   req.CompanyID,
+		Email:       req.Email,
+		PhoneNumber: req.PhoneNumber,
+		Address:     req.Address,
+		Gender:      req.Gender,
 	}
 
-	if err := h.service.Create(cust); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.service.Create(c.Request.Context(), cust); err != nil {
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, cust)
+	if photo != nil {
+		updated, err := h.photos.Set(c.Request.Context(), cust.ID, etag.Version(cust.Version), photo)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		cust = &updated
+	}
+
+	c.Header("ETag", etag.Format(cust.Version))
+	c.JSON(http.StatusCreated, h.present(c, *cust))
 }
 
 func (h *CustomerHandler) GetByID(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid customer ID"})
+		c.Error(errInvalidID)
 		return
 	}
 
-	cust, err := h.service.GetByID(id)
+	cust, err := h.service.GetByID(c.Request.Context(), id, c.Query("include_deleted") == "true")
 	if err != nil {
-		if err == ErrNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "customer not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, cust)
+	c.Header("ETag", etag.Format(cust.Version))
+	if etag.NoneMatch(c.GetHeader("If-None-Match"), cust.Version) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.JSON(http.StatusOK, h.present(c, cust))
 }
 
 func (h *CustomerHandler) GetAll(c *gin.Context) {
-	customers, err := h.service.GetAll()
+	if email := c.Query("email"); email != "" {
+		h.getByEmail(c, email)
+		return
+	}
+
+	customers, err := h.service.GetAll(c.Request.Context(), c.Query("include_deleted") == "true")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
+	for i := range customers {
+		customers[i] = h.present(c, customers[i])
+	}
 	c.JSON(http.StatusOK, customers)
 }
 
+// getByEmail answers GET /customers?email= with a list of zero or one
+// customers, so the response shape matches the unfiltered listing.
+func (h *CustomerHandler) getByEmail(c *gin.Context, email string) {
+	cust, err := h.service.GetByEmail(c.Request.Context(), email)
+	if err != nil {
+		if err == ErrNotFound {
+			c.JSON(http.StatusOK, []Customer{})
+			return
+		}
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, []Customer{h.present(c, cust)})
+}
+
+// Search answers GET /customers/search?q=&company_id=&page=&page_size=.
+// Results go through the same PII policy as every other customer response;
+// the highlight only ever covers the name.
+func (h *CustomerHandler) Search(c *gin.Context) {
+	filter := SearchFilter{Query: c.Query("q"), Page: 1, PageSize: 20}
+
+	if s := c.Query("company_id"); s != "" {
+		companyID, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || companyID <= 0 {
+			c.Error(errInvalidCompanyID)
+			return
+		}
+		filter.CompanyID = &companyID
+	}
+	if s := c.Query("page"); s != "" {
+		page, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			c.Error(ErrInvalidPage)
+			return
+		}
+		filter.Page = page
+	}
+	if s := c.Query("page_size"); s != "" {
+		pageSize, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			c.Error(ErrInvalidPageSize)
+			return
+		}
+		filter.PageSize = pageSize
+	}
+
+	resp, err := h.service.Search(c.Request.Context(), filter)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	for i := range resp.Data {
+		resp.Data[i].Customer = h.present(c, resp.Data[i].Customer)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
 func (h *CustomerHandler) Update(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid customer ID"})
+		c.Error(errInvalidID)
 		return
 	}
 
-	if err := c.ShouldBindJSON(&UpdateCustomerReq); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	ifMatch, err := etag.ParseIfMatch(c.GetHeader("If-Match"))
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
-	birthDate, err := parseDate(UpdateCustomerReq.BirthDate)
+	req, ok := request.BindJSON[UpdateCustomerReq](c)
+	if !ok {
+		return
+	}
+
+	birthDate, err := parseDate(req.BirthDate)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid birth_date format, expected YYYY-MM-DD"})
+		c.Error(errInvalidBirthDate)
+		return
+	}
+
+	photo, ok := h.decodePhoto(c, req.Photo)
+	if !ok {
 		return
 	}
 
 	cust := &Customer{
 		ID:          id,
-		FirstName:   UpdateCustomerReq.FirstName,
-		LastName:    UpdateCustomerReq.LastName,
+		FirstName:   req.FirstName,
+		LastName:    req.LastName,
 		BirthDate:   birthDate,
-		CompanyID:   UpdateCustomerReq.CompanyID,
-		Email:       UpdateCustomerReq.Email,
-		PhoneNumber: UpdateCustomerReq.PhoneNumber,
-		Address:     UpdateCustomerReq.Address,
-		Gender:      UpdateCustomerReq.Gender,
-		Photo:       UpdateCustomerReq.Photo,
+		CompanyID:   req.CompanyID,
+		Email:       req.Email,
+		PhoneNumber: req.PhoneNumber,
+		Address:     req.Address,
+		Gender:      req.Gender,
 	}
 
-	if err := h.service.Update(cust); err != nil {
-		if err == ErrNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "customer not found"})
-			return
+	if err := h.service.Update(c.Request.Context(), cust, ifMatch); err != nil {
+		c.Error(err)
+		return
+	}
+
+	// The update leaves the photo columns alone, so reload to report the
+	// photo the customer actually has.
+	var updated Customer
+	if photo != nil {
+		updated, err = h.photos.Set(c.Request.Context(), id, etag.Version(cust.Version), photo)
+	} else {
+		updated, err = h.service.GetByID(c.Request.Context(), id, false)
+	}
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Header("ETag", etag.Format(updated.Version))
+	c.JSON(http.StatusOK, h.present(c, updated))
+}
+
+// Patch applies a JSON Merge Patch or JSON Patch to the customer. Members
+// the patch leaves out keep their values, a null clears an optional one, and
+// the result must pass the same validation as a full update. Callers without
+// PII access may overwrite PII but not read it through test, copy or move.
+func (h *CustomerHandler) Patch(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errInvalidID)
+		return
+	}
+
+	ifMatch, err := etag.ParseIfMatch(c.GetHeader("If-Match"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		c.Error(request.ErrUnreadableBody.WithCause(err))
+		return
+	}
+	doc, err := patch.Parse(c.ContentType(), body)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if !h.pii.CanViewPII(c.GetString("role")) {
+		for _, member := range doc.Reads() {
+			if member == "" || slices.Contains(piiFields, member) {
+				c.Error(errPatchReadsPII)
+				return
+			}
+		}
+	}
+
+	cust, err := h.service.Patch(c.Request.Context(), id, ifMatch, func(cust *Customer) error {
+		fields := CustomerFields{
+			FirstName:   cust.FirstName,
+			LastName:    cust.LastName,
+			Email:       cust.Email,
+			PhoneNumber: cust.PhoneNumber,
+			Address:     cust.Address,
+			Gender:      cust.Gender,
+			CompanyID:   cust.CompanyID,
+		}
+		if !cust.BirthDate.IsZero() {
+			fields.BirthDate = cust.BirthDate.Format("2006-01-02")
+		}
+		if err := doc.ApplyTo(&fields); err != nil {
+			return err
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := request.Validate(&fields); err != nil {
+			return err
+		}
+		birthDate, err := parseDate(fields.BirthDate)
+		if err != nil {
+			return errInvalidBirthDate
+		}
+
+		cust.FirstName = fields.FirstName
+		cust.LastName = fields.LastName
+		cust.BirthDate = birthDate
+		cust.Email = fields.Email
+		cust.PhoneNumber = fields.PhoneNumber
+		cust.Address = fields.Address
+		cust.Gender = fields.Gender
+		cust.CompanyID = fields.CompanyID
+		return nil
+	})
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, cust)
+	c.Header("ETag", etag.Format(cust.Version))
+	c.JSON(http.StatusOK, h.present(c, cust))
 }
 
+// Delete soft-deletes the customer; ?purge=true removes it for good, which is
+// refused with the reference counts while anything still points at it.
 func (h *CustomerHandler) Delete(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid customer ID"})
+		c.Error(errInvalidID)
 		return
 	}
 
-	if err := h.service.Delete(id); err != nil {
-		if err == ErrNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "customer not found"})
+	ifMatch, err := etag.ParseIfMatch(c.GetHeader("If-Match"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if c.Query("purge") == "true" {
+		err = h.service.Purge(c.Request.Context(), id, ifMatch)
+	} else {
+		err = h.service.Delete(c.Request.Context(), id, ifMatch)
+	}
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+func (h *CustomerHandler) Restore(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errInvalidID)
+		return
+	}
+
+	cust, err := h.service.Restore(c.Request.Context(), id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Header("ETag", etag.Format(cust.Version))
+	c.JSON(http.StatusOK, h.present(c, cust))
+}
+
+// PutPhoto accepts the image either as the raw request body or as the
+// "photo" field of a multipart form. The declared content type is ignored;
+// the bytes are sniffed.
+func (h *CustomerHandler) PutPhoto(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errInvalidID)
+		return
+	}
+
+	ifMatch, err := etag.ParseIfMatch(c.GetHeader("If-Match"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	data, err := h.readPhoto(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	cust, err := h.photos.Set(c.Request.Context(), id, ifMatch, data)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Header("ETag", etag.Format(cust.Version))
+	c.JSON(http.StatusOK, h.present(c, cust))
+}
+
+func (h *CustomerHandler) readPhoto(c *gin.Context) ([]byte, error) {
+	// Leave room for multipart framing; the image itself is checked below.
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.photos.MaxBytes()+64<<10)
+
+	var body io.Reader = c.Request.Body
+	if c.ContentType() == "multipart/form-data" {
+		file, _, err := c.Request.FormFile("photo")
+		if err != nil {
+			if isTooLarge(err) {
+				return nil, ErrPhotoTooLarge
+			}
+			return nil, errMissingPhotoField.WithCause(err)
+		}
+		defer file.Close()
+		body = file
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, h.photos.MaxBytes()+1))
+	if err != nil {
+		if isTooLarge(err) {
+			return nil, ErrPhotoTooLarge
+		}
+		return nil, request.ErrUnreadableBody.WithCause(err)
+	}
+	if len(data) == 0 {
+		return nil, ErrEmptyPhoto
+	}
+	if int64(len(data)) > h.photos.MaxBytes() {
+		return nil, ErrPhotoTooLarge
+	}
+	return data, nil
+}
+
+func isTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
+
+// GetPhoto serves the photo, or its thumbnail with ?size=thumbnail. The image
+// is PII, so callers who only get masked customers cannot fetch it.
+func (h *CustomerHandler) GetPhoto(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errInvalidID)
+		return
+	}
+	if !h.pii.CanViewPII(c.GetString("role")) {
+		c.Error(errPhotoForbidden)
+		return
+	}
+
+	body, info, err := h.photos.Open(c.Request.Context(), id, c.Query("size") == "thumbnail")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	defer body.Close()
+
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.DataFromReader(http.StatusOK, info.Size, info.ContentType, body, nil)
+}
+
+func (h *CustomerHandler) DeletePhoto(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errInvalidID)
+		return
+	}
+
+	ifMatch, err := etag.ParseIfMatch(c.GetHeader("If-Match"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	version, err := h.photos.Delete(c.Request.Context(), id, ifMatch)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Header("ETag", etag.Format(version))
+	c.Status(http.StatusNoContent)
+}
+
+// Duplicates answers GET /customers/duplicates?company_id=&min_score=&page=&page_size=
+// with candidate pairs, best match first.
+func (h *CustomerHandler) Duplicates(c *gin.Context) {
+	filter := DuplicateFilter{MinScore: 0.5, Page: 1, PageSize: 20}
+
+	if s := c.Query("company_id"); s != "" {
+		companyID, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || companyID <= 0 {
+			c.Error(errInvalidCompanyID)
+			return
+		}
+		filter.CompanyID = &companyID
+	}
+	if s := c.Query("min_score"); s != "" {
+		minScore, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			c.Error(ErrInvalidMinScore)
+			return
+		}
+		filter.MinScore = minScore
+	}
+	if s := c.Query("page"); s != "" {
+		page, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			c.Error(ErrInvalidPage)
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		filter.Page = page
+	}
+	if s := c.Query("page_size"); s != "" {
+		pageSize, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			c.Error(ErrInvalidPageSize)
+			return
+		}
+		filter.PageSize = pageSize
+	}
+
+	resp, err := h.merges.Duplicates(c.Request.Context(), filter)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusNoContent, nil)
+	for i := range resp.Data {
+		resp.Data[i].Customer = h.present(c, resp.Data[i].Customer)
+		resp.Data[i].Duplicate = h.present(c, resp.Data[i].Duplicate)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Merge folds the customer named in the body into the one in the path.
+func (h *CustomerHandler) Merge(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errInvalidID)
+		return
+	}
+
+	req, ok := request.BindJSON[MergeCustomerReq](c)
+	if !ok {
+		return
+	}
+
+	rec, err := h.merges.Merge(c.Request.Context(), id, req.DuplicateID, c.GetString("user_id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, rec)
+}
+
+func (h *CustomerHandler) MergeHistory(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errInvalidID)
+		return
+	}
+
+	merges, err := h.merges.History(c.Request.Context(), id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, merges)
+}
+
+func (h *CustomerHandler) UndoMerge(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("mergeId"), 10, 64)
+	if err != nil {
+		c.Error(errInvalidMergeID)
+		return
+	}
+
+	rec, err := h.merges.Undo(c.Request.Context(), id, c.GetString("user_id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, rec)
 }
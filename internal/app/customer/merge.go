@@ -0,0 +1,239 @@
+package customer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"sinibeli/internal/app/audit"
+	"sinibeli/internal/infrastructure/cache"
+	"sinibeli/internal/pkg/apperr"
+	logger "sinibeli/internal/pkg/logging"
+	"sinibeli/internal/pkg/tracing"
+)
+
+// similarNameThreshold is the trigram similarity from which a name counts as
+// a reason on its own when explaining a duplicate candidate.
+const similarNameThreshold = 0.5
+
+var (
+	ErrMergeSelf        = apperr.New(apperr.Invalid, "merge_self", "a customer cannot be merged into itself")
+	ErrAlreadyMerged    = apperr.New(apperr.Conflict, "already_merged", "customer has already been merged")
+	ErrMergeNotFound    = apperr.New(apperr.NotFound, "merge_not_found", "merge not found")
+	ErrMergeUndone      = apperr.New(apperr.Conflict, "merge_undone", "merge has already been undone")
+	ErrMergeNotUndoable = apperr.New(apperr.Conflict, "merge_not_undoable", "merge can no longer be undone: the survivor has since been merged")
+	ErrInvalidMinScore  = apperr.New(apperr.Invalid, "invalid_min_score", "min_score must be between 0 and 1")
+)
+
+type DuplicateFilter struct {
+	CompanyID *int64
+	MinScore  float64
+	Page      int64
+	PageSize  int64
+}
+
+func (f *DuplicateFilter) Validate() error {
+	if f.MinScore < 0 || f.MinScore > 1 {
+		return ErrInvalidMinScore
+	}
+	if f.Page < 1 {
+		return ErrInvalidPage
+	}
+	if f.PageSize < 1 || f.PageSize > 100 {
+		return ErrInvalidPageSize
+	}
+	return nil
+}
+
+// DuplicateCandidate is a pair of customers that look like the same person.
+// Customer is the older record and the suggested survivor.
+type DuplicateCandidate struct {
+	Customer  Customer `json:"customer"`
+	Duplicate Customer `json:"duplicate"`
+	Score     float64  `json:"score"`
+	Reasons   []string `json:"reasons"`
+}
+
+type DuplicateResponse struct {
+	Data       []DuplicateCandidate `json:"data"`
+	Pagination Pagination           `json:"pagination"`
+}
+
+// MergeRecord is the audit trail of one merge. TransactionIDs are the
+// transactions moved to the survivor, which is what an undo moves back.
+type MergeRecord struct {
+	ID             int64      `json:"id"`
+	SurvivorID     int64      `json:"survivor_id"`
+	DuplicateID    int64      `json:"duplicate_id"`
+	TransactionIDs []int64    `json:"transaction_ids"`
+	MergedBy       string     `json:"merged_by"`
+	MergedAt       time.Time  `json:"merged_at"`
+	UndoneBy       string     `json:"undone_by,omitempty"`
+	UndoneAt       *time.Time `json:"undone_at,omitempty"`
+}
+
+type MergeCustomerReq struct {
+	DuplicateID int64 `json:"duplicate_id" binding:"required,min=1"`
+}
+
+type MergeService struct {
+	repo        *MergeRepo
+	customers   *CustomerRepo
+	cache       cache.Cache
+	invalidator *cache.Invalidator
+	audit       *audit.Recorder
+}
+
+func NewMergeService(repo *MergeRepo, customers *CustomerRepo, appCache cache.Cache, invalidator *cache.Invalidator, recorder *audit.Recorder) *MergeService {
+	return &MergeService{repo: repo, customers: customers, cache: appCache, invalidator: invalidator, audit: recorder}
+}
+
+func (s *MergeService) Duplicates(ctx context.Context, filter DuplicateFilter) (DuplicateResponse, error) {
+	ctx, span := tracing.Start(ctx, "MergeService.Duplicates")
+	defer span.End()
+
+	if err := filter.Validate(); err != nil {
+		return DuplicateResponse{}, err
+	}
+
+	candidates, total, err := s.repo.DuplicateCandidates(ctx, filter)
+	if err != nil {
+		return DuplicateResponse{}, err
+	}
+
+	for i := range candidates {
+		if err := s.load(ctx, &candidates[i].Customer); err != nil {
+			return DuplicateResponse{}, err
+		}
+		if err := s.load(ctx, &candidates[i].Duplicate); err != nil {
+			return DuplicateResponse{}, err
+		}
+	}
+
+	totalPages := total / filter.PageSize
+	if total%filter.PageSize > 0 {
+		totalPages++
+	}
+
+	return DuplicateResponse{
+		Data: candidates,
+		Pagination: Pagination{
+			Page:       filter.Page,
+			PageSize:   filter.PageSize,
+			TotalItems: total,
+			TotalPages: totalPages,
+		},
+	}, nil
+}
+
+// load replaces a customer that only carries its ID with the full record.
+func (s *MergeService) load(ctx context.Context, c *Customer) error {
+	full, err := s.customers.GetByID(ctx, c.ID)
+	if err != nil {
+		return err
+	}
+	if full == nil {
+		return fmt.Errorf("duplicate candidate %d disappeared", c.ID)
+	}
+	*c = *full
+	return nil
+}
+
+func (s *MergeService) Merge(ctx context.Context, survivorID, duplicateID int64, mergedBy string) (MergeRecord, error) {
+	ctx, span := tracing.Start(ctx, "MergeService.Merge")
+	defer span.End()
+
+	if survivorID == duplicateID {
+		return MergeRecord{}, ErrMergeSelf
+	}
+
+	rec, attachments, err := s.repo.Merge(ctx, survivorID, duplicateID, mergedBy)
+	if err != nil {
+		return MergeRecord{}, err
+	}
+
+	logger.InfoCtx(ctx, "Customers merged", "merge_id", rec.ID, "survivor_id", survivorID,
+		"duplicate_id", duplicateID, "transactions", len(rec.TransactionIDs), "merged_by", mergedBy)
+	s.invalidate(ctx, rec, attachments)
+	if err := s.audit.Record(ctx, audit.Change{
+		Entity:   "customer",
+		EntityID: duplicateID,
+		Action:   audit.ActionMerge,
+		Before:   mergeState{},
+		After:    mergeState{MergedInto: &rec.SurvivorID, MergeID: rec.ID, Transactions: rec.TransactionIDs},
+	}); err != nil {
+		return MergeRecord{}, err
+	}
+	return *rec, nil
+}
+
+// mergeState is what the audit log records of a merge or its undo, on the
+// duplicate's side.
+type mergeState struct {
+	MergedInto   *int64  `json:"merged_into"`
+	MergeID      int64   `json:"merge_id,omitempty"`
+	Transactions []int64 `json:"transactions,omitempty"`
+}
+
+func (s *MergeService) Undo(ctx context.Context, mergeID int64, undoneBy string) (MergeRecord, error) {
+	ctx, span := tracing.Start(ctx, "MergeService.Undo")
+	defer span.End()
+
+	rec, attachments, err := s.repo.Undo(ctx, mergeID, undoneBy)
+	if err != nil {
+		return MergeRecord{}, err
+	}
+
+	logger.InfoCtx(ctx, "Customer merge undone", "merge_id", rec.ID, "survivor_id", rec.SurvivorID,
+		"duplicate_id", rec.DuplicateID, "undone_by", undoneBy)
+	s.invalidate(ctx, rec, attachments)
+	if err := s.audit.Record(ctx, audit.Change{
+		Entity:   "customer",
+		EntityID: rec.DuplicateID,
+		Action:   audit.ActionUnmerge,
+		Before:   mergeState{MergedInto: &rec.SurvivorID, MergeID: rec.ID},
+		After:    mergeState{MergeID: rec.ID},
+	}); err != nil {
+		return MergeRecord{}, err
+	}
+	return *rec, nil
+}
+
+func (s *MergeService) History(ctx context.Context, customerID int64) ([]MergeRecord, error) {
+	ctx, span := tracing.Start(ctx, "MergeService.History")
+	defer span.End()
+
+	c, err := s.customers.GetByID(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, ErrNotFound
+	}
+	return s.repo.ListByCustomer(ctx, customerID)
+}
+
+// invalidate drops what a merge or its undo made stale: both customers and
+// the reports, plus the cached metadata of attachments whose company moved.
+func (s *MergeService) invalidate(ctx context.Context, rec *MergeRecord, attachments []movedAttachment) {
+	s.invalidator.Publish(ctx, cache.EventCustomerChanged, rec.SurvivorID)
+	s.invalidator.Publish(ctx, cache.EventCustomerChanged, rec.DuplicateID)
+	s.invalidator.Publish(ctx, cache.EventTransactionChanged, rec.SurvivorID)
+	invalidateAttachments(ctx, s.cache, s.invalidator, attachments)
+}
+
+// invalidateAttachments drops the cached metadata of attachments that moved
+// to another company, so downloads are checked against the new one.
+func invalidateAttachments(ctx context.Context, c cache.Cache, invalidator *cache.Invalidator, attachments []movedAttachment) {
+	transactions := make(map[int64]bool)
+	for _, a := range attachments {
+		key := fmt.Sprintf(cache.FileMetadataKey, a.ID)
+		if err := c.Delete(ctx, key); err != nil {
+			logger.WarnCtx(ctx, "Cache invalidation failed", "key", key, "error", err)
+		}
+		transactions[a.TransactionID] = true
+	}
+	for id := range transactions {
+		invalidator.Publish(ctx, cache.EventAttachmentChanged, id)
+	}
+}
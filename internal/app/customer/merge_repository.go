@@ -0,0 +1,367 @@
+package customer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"sinibeli/internal/app/rollup"
+
+	"github.com/lib/pq"
+)
+
+type MergeRepo struct {
+	DB     *sql.DB
+	Rollup *rollup.RollupRepo
+}
+
+func NewMergeRepo(db *sql.DB, rollupRepo *rollup.RollupRepo) *MergeRepo {
+	return &MergeRepo{DB: db, Rollup: rollupRepo}
+}
+
+// movedAttachment identifies an attachment whose company changed because its
+// transaction moved, so its cached metadata can be dropped.
+type movedAttachment struct {
+	ID            string
+	TransactionID int64
+}
+
+const mergeColumns = `id, survivor_id, duplicate_id, transaction_ids,
+		       merged_by, merged_at, undone_by, undone_at`
+
+// DuplicateCandidates pairs up active customers that share a phone number,
+// or a birth date and a similar name. Email is not a signal here: its blind
+// index is unique, so two customers can never share one.
+func (r *MergeRepo) DuplicateCandidates(ctx context.Context, filter DuplicateFilter) ([]DuplicateCandidate, int64, error) {
+	query := `
+		SELECT a.id, b.id, s.score, m.same_phone, m.same_birth, m.name_sim,
+		       COUNT(*) OVER () AS total
+		FROM customer a
+		JOIN customer b ON b.id > a.id
+		CROSS JOIN LATERAL (
+			SELECT COALESCE(a.phone_bidx = b.phone_bidx, false) AS same_phone,
+			       COALESCE(a.birth_date = b.birth_date, false) AS same_birth,
+			       similarity(a.search_name, b.search_name)::float8 AS name_sim
+		) m
+		CROSS JOIN LATERAL (
+			SELECT LEAST(1.0, CASE WHEN m.same_phone THEN 0.6 ELSE 0 END
+			                + CASE WHEN m.same_birth THEN 0.2 ELSE 0 END
+			                + 0.4 * m.name_sim)::float8 AS score
+		) s
+		WHERE a.merged_into IS NULL AND b.merged_into IS NULL
+		  AND a.deleted_at IS NULL AND b.deleted_at IS NULL
+		  AND (a.phone_bidx = b.phone_bidx
+		       OR (a.birth_date = b.birth_date AND a.search_name % b.search_name))
+		  AND ($1::bigint IS NULL OR a.company = $1 OR b.company = $1)
+		  AND s.score >= $2
+		ORDER BY s.score DESC, a.id, b.id
+		LIMIT $3 OFFSET $4`
+
+	var companyID interface{}
+	if filter.CompanyID != nil {
+		companyID = *filter.CompanyID
+	}
+
+	rows, err := r.DB.QueryContext(ctx, query, companyID, filter.MinScore, filter.PageSize, (filter.Page-1)*filter.PageSize)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query duplicate candidates: %w", err)
+	}
+	defer rows.Close()
+
+	candidates := make([]DuplicateCandidate, 0)
+	var total int64
+	for rows.Next() {
+		var d DuplicateCandidate
+		var samePhone, sameBirth bool
+		var nameSim float64
+		if err := rows.Scan(&d.Customer.ID, &d.Duplicate.ID, &d.Score, &samePhone, &sameBirth, &nameSim, &total); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan duplicate candidate: %w", err)
+		}
+
+		d.Reasons = make([]string, 0, 3)
+		if samePhone {
+			d.Reasons = append(d.Reasons, "phone")
+		}
+		if sameBirth {
+			d.Reasons = append(d.Reasons, "birth_date")
+		}
+		if nameSim >= similarNameThreshold {
+			d.Reasons = append(d.Reasons, "name")
+		}
+		candidates = append(candidates, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("row iteration error: %w", err)
+	}
+	return candidates, total, nil
+}
+
+// Merge re-points every transaction of the duplicate to the survivor and
+// marks the duplicate as merged, all in one database transaction together
+// with the rollup and attachment updates and the merge record.
+func (r *MergeRepo) Merge(ctx context.Context, survivorID, duplicateID int64, mergedBy string) (*MergeRecord, []movedAttachment, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin merge: %w", err)
+	}
+	defer tx.Rollback()
+
+	locked, err := lockCustomers(ctx, tx, survivorID, duplicateID)
+	if err != nil {
+		return nil, nil, err
+	}
+	survivor, duplicate := locked[survivorID], locked[duplicateID]
+	if survivor == nil || duplicate == nil || survivor.deleted || duplicate.deleted {
+		return nil, nil, ErrNotFound
+	}
+	if survivor.mergedInto.Valid || duplicate.mergedInto.Valid {
+		return nil, nil, ErrAlreadyMerged
+	}
+
+	moved, err := moveTransactions(ctx, tx, `
+		UPDATE transaction SET customer_id = $1
+		WHERE customer_id = $2
+		RETURNING id`, survivorID, duplicateID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE customer SET merged_into = $1, merged_at = CURRENT_TIMESTAMP
+		WHERE id = $2`, survivorID, duplicateID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to mark customer merged: %w", err)
+	}
+
+	attachments, err := repointTransactions(ctx, tx, r.Rollup, moved, survivor.companyID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rec := MergeRecord{SurvivorID: survivorID, DuplicateID: duplicateID, TransactionIDs: moved, MergedBy: mergedBy}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO customer_merge (survivor_id, duplicate_id, transaction_ids, merged_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, merged_at`,
+		survivorID, duplicateID, pq.Array(moved), mergedBy,
+	).Scan(&rec.ID, &rec.MergedAt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to record merge: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit merge: %w", err)
+	}
+	return &rec, attachments, nil
+}
+
+// Undo moves the transactions recorded by a merge back to the duplicate and
+// reactivates it. Transactions created for the survivor after the merge stay
+// where they are.
+func (r *MergeRepo) Undo(ctx context.Context, mergeID int64, undoneBy string) (*MergeRecord, []movedAttachment, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin merge undo: %w", err)
+	}
+	defer tx.Rollback()
+
+	rec, err := scanMerge(tx.QueryRowContext(ctx, `SELECT `+mergeColumns+` FROM customer_merge WHERE id = $1 FOR UPDATE`, mergeID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, ErrMergeNotFound
+		}
+		return nil, nil, err
+	}
+	if rec.UndoneAt != nil {
+		return nil, nil, ErrMergeUndone
+	}
+
+	locked, err := lockCustomers(ctx, tx, rec.SurvivorID, rec.DuplicateID)
+	if err != nil {
+		return nil, nil, err
+	}
+	survivor, duplicate := locked[rec.SurvivorID], locked[rec.DuplicateID]
+	if survivor == nil || duplicate == nil {
+		return nil, nil, ErrNotFound
+	}
+	if survivor.mergedInto.Valid || !duplicate.mergedInto.Valid || duplicate.mergedInto.Int64 != rec.SurvivorID {
+		return nil, nil, ErrMergeNotUndoable
+	}
+
+	restored, err := moveTransactions(ctx, tx, `
+		UPDATE transaction SET customer_id = $1
+		WHERE id = ANY($3) AND customer_id = $2
+		RETURNING id`, rec.DuplicateID, rec.SurvivorID, pq.Array(rec.TransactionIDs))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE customer SET merged_into = NULL, merged_at = NULL WHERE id = $1`, rec.DuplicateID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reactivate customer: %w", err)
+	}
+
+	attachments, err := repointTransactions(ctx, tx, r.Rollup, restored, duplicate.companyID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rec.UndoneBy = undoneBy
+	rec.UndoneAt = new(time.Time)
+	err = tx.QueryRowContext(ctx, `
+		UPDATE customer_merge SET undone_by = $1, undone_at = CURRENT_TIMESTAMP
+		WHERE id = $2
+		RETURNING undone_at`, undoneBy, mergeID,
+	).Scan(rec.UndoneAt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to record merge undo: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit merge undo: %w", err)
+	}
+	return rec, attachments, nil
+}
+
+func (r *MergeRepo) ListByCustomer(ctx context.Context, customerID int64) ([]MergeRecord, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT `+mergeColumns+`
+		FROM customer_merge
+		WHERE survivor_id = $1 OR duplicate_id = $1
+		ORDER BY merged_at DESC, id DESC`, customerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query merges: %w", err)
+	}
+	defer rows.Close()
+
+	merges := make([]MergeRecord, 0)
+	for rows.Next() {
+		rec, err := scanMerge(rows)
+		if err != nil {
+			return nil, err
+		}
+		merges = append(merges, *rec)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+	return merges, nil
+}
+
+// repointTransactions brings what is derived from a transaction's customer
+// in line after transactions moved to a customer of companyID, whether by a
+// merge or by the customer changing company: the rollup buckets of their days
+// and the company stamped on their attachments.
+func repointTransactions(ctx context.Context, tx *sql.Tx, rollupRepo *rollup.RollupRepo, transactionIDs []int64, companyID int64) ([]movedAttachment, error) {
+	if len(transactionIDs) == 0 {
+		return nil, nil
+	}
+
+	if err := rollupRepo.RebuildTransactionDays(ctx, tx, transactionIDs); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		UPDATE transaction_attachment SET company_id = $1
+		WHERE transaction_id = ANY($2)
+		RETURNING id, transaction_id`, companyID, pq.Array(transactionIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update attachment company: %w", err)
+	}
+	defer rows.Close()
+
+	var attachments []movedAttachment
+	for rows.Next() {
+		var a movedAttachment
+		if err := rows.Scan(&a.ID, &a.TransactionID); err != nil {
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		attachments = append(attachments, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+	return attachments, nil
+}
+
+type lockedCustomer struct {
+	companyID  int64
+	mergedInto sql.NullInt64
+	deleted    bool
+}
+
+// lockCustomers takes row locks on both customers in id order, so concurrent
+// merges of the same pair cannot deadlock. Missing customers are absent from
+// the result.
+func lockCustomers(ctx context.Context, tx *sql.Tx, a, b int64) (map[int64]*lockedCustomer, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, company, merged_into, deleted_at IS NOT NULL
+		FROM customer
+		WHERE id IN ($1, $2)
+		ORDER BY id
+		FOR UPDATE`, a, b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock customers: %w", err)
+	}
+	defer rows.Close()
+
+	locked := make(map[int64]*lockedCustomer, 2)
+	for rows.Next() {
+		var id int64
+		var c lockedCustomer
+		if err := rows.Scan(&id, &c.companyID, &c.mergedInto, &c.deleted); err != nil {
+			return nil, fmt.Errorf("failed to scan locked customer: %w", err)
+		}
+		locked[id] = &c
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+	return locked, nil
+}
+
+func moveTransactions(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to move transactions: %w", err)
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan moved transaction: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+	return ids, nil
+}
+
+func scanMerge(row rowScanner) (*MergeRecord, error) {
+	var rec MergeRecord
+	var ids pq.Int64Array
+	var undoneBy sql.NullString
+	var undoneAt sql.NullTime
+
+	err := row.Scan(&rec.ID, &rec.SurvivorID, &rec.DuplicateID, &ids,
+		&rec.MergedBy, &rec.MergedAt, &undoneBy, &undoneAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan merge: %w", err)
+	}
+
+	rec.TransactionIDs = []int64(ids)
+	rec.UndoneBy = undoneBy.String
+	if undoneAt.Valid {
+		rec.UndoneAt = &undoneAt.Time
+	}
+	return &rec, nil
+}
@@ -1,21 +1,110 @@
 package customer
 
-import "time"
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"sinibeli/internal/pkg/apperr"
+	"sinibeli/internal/pkg/redact"
+	"sinibeli/pkg/validator"
+)
 
 type Customer struct {
-	ID          int64     `json:"id"`
-	FirstName   string    `json:"first_name"`
-	LastName    string    `json:"last_name"`
-	BirthDate   time.Time `json:"birth_date,omitempty"`
-	Email       string    `json:"email,omitempty"`
-	PhoneNumber string    `json:"phone_number,omitempty"`
-	Address     string    `json:"address,omitempty"`
-	Gender      string    `json:"gender,omitempty"`
-	CompanyID   int64     `json:"company_id"`
-	Photo       string    `json:"photo,omitempty"`
-}
-
-var CreateCustomerReq struct {
+	ID          int64      `json:"id"`
+	FirstName   string     `json:"first_name"`
+	LastName    string     `json:"last_name"`
+	BirthDate   time.Time  `json:"birth_date,omitzero"`
+	Email       string     `json:"email,omitempty"`
+	PhoneNumber string     `json:"phone_number,omitempty"`
+	PhoneE164   string     `json:"phone_e164,omitempty"`
+	Address     string     `json:"address,omitempty"`
+	Gender      string     `json:"gender,omitempty"`
+	CompanyID   int64      `json:"company_id"`
+	MergedInto  *int64     `json:"merged_into,omitempty"`
+	Version     int64      `json:"version"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+
+	PhotoURL     string `json:"photo_url,omitempty"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+
+	// PhotoKey and ThumbnailKey locate the photo in blob storage. Photo only
+	// holds a legacy data URI for rows the photo migration has not reached,
+	// and is loaded on demand rather than with every customer.
+	PhotoKey       string `json:"-"`
+	ThumbnailKey   string `json:"-"`
+	Photo          string `json:"-"`
+	HasLegacyPhoto bool   `json:"-"`
+}
+
+func (c Customer) HasPhoto() bool {
+	return c.PhotoKey != "" || c.HasLegacyPhoto
+}
+
+// Normalize validates the email and phone and derives PhoneE164. The phone
+// is kept as entered so nothing the customer gave is lost; the normalized
+// form is what indexes and comparisons use.
+func (c *Customer) Normalize() error {
+	if err := c.normalizeEmail(); err != nil {
+		return err
+	}
+	return c.normalizePhone()
+}
+
+func (c *Customer) normalizeEmail() error {
+	if c.Email == "" {
+		return nil
+	}
+	email, err := validator.Email(c.Email)
+	if err != nil {
+		return apperr.Wrap(apperr.Invalid, "invalid_email", err)
+	}
+	c.Email = email
+	return nil
+}
+
+func (c *Customer) normalizePhone() error {
+	c.PhoneNumber = strings.TrimSpace(c.PhoneNumber)
+	c.PhoneE164 = ""
+	if c.PhoneNumber != "" {
+		e164, err := validator.Phone(c.PhoneNumber)
+		if err != nil {
+			return apperr.Wrap(apperr.Invalid, "invalid_phone_number", err)
+		}
+		c.PhoneE164 = e164
+	}
+	return nil
+}
+
+// Masked is the view of a customer for callers without PII access: partial
+// email and phone, everything else that identifies the person left out.
+func (c Customer) Masked() Customer {
+	masked := c
+	if c.Email != "" {
+		masked.Email = redact.Email(c.Email)
+	}
+	if c.PhoneNumber != "" {
+		masked.PhoneNumber = redact.Phone(c.PhoneNumber)
+	}
+	if c.PhoneE164 != "" {
+		masked.PhoneE164 = redact.Phone(c.PhoneE164)
+	}
+	masked.BirthDate = time.Time{}
+	masked.Address = ""
+	masked.PhotoURL = ""
+	masked.ThumbnailURL = ""
+	return masked
+}
+
+// LogValue keeps PII out of logs when a customer is logged as an attribute.
+func (c Customer) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int64("id", c.ID),
+		slog.Int64("company_id", c.CompanyID),
+	)
+}
+
+type CreateCustomerReq struct {
 	ID          int64  `json:"id" binding:"required"`
 	FirstName   string `json:"first_name" binding:"required,max=50"`
 	LastName    string `json:"last_name" binding:"required,max=50"`
@@ -28,7 +117,7 @@ var CreateCustomerReq struct {
 	Photo       string `json:"photo"`
 }
 
-var UpdateCustomerReq struct {
+type UpdateCustomerReq struct {
 	FirstName   string `json:"first_name" binding:"required,max=50"`
 	LastName    string `json:"last_name" binding:"required,max=50"`
 	BirthDate   string `json:"birth_date"`
@@ -39,3 +128,62 @@ var UpdateCustomerReq struct {
 	CompanyID   int64  `json:"company_id" binding:"required"`
 	Photo       string `json:"photo"`
 }
+
+// CustomerFields is what a PATCH can change; the patched result is validated
+// with the same rules as a full update. The photo is not among them, it has
+// its own endpoints.
+type CustomerFields struct {
+	FirstName   string `json:"first_name" binding:"required,max=50"`
+	LastName    string `json:"last_name" binding:"required,max=50"`
+	BirthDate   string `json:"birth_date"`
+	Email       string `json:"email"`
+	PhoneNumber string `json:"phone_number"`
+	Address     string `json:"address"`
+	Gender      string `json:"gender"`
+	CompanyID   int64  `json:"company_id" binding:"required"`
+}
+
+type SearchFilter struct {
+	Query     string
+	CompanyID *int64
+	Page      int64
+	PageSize  int64
+}
+
+type SearchResult struct {
+	Customer
+	Score     float64  `json:"score"`
+	MatchedOn []string `json:"matched_on"`
+	Highlight string   `json:"highlight,omitempty"`
+}
+
+type Pagination struct {
+	Page       int64 `json:"page"`
+	PageSize   int64 `json:"page_size"`
+	TotalItems int64 `json:"total_items"`
+	TotalPages int64 `json:"total_pages"`
+}
+
+type SearchResponse struct {
+	Data       []SearchResult `json:"data"`
+	Pagination Pagination     `json:"pagination"`
+}
+
+var (
+	ErrSearchQueryTooShort = apperr.New(apperr.Invalid, "search_query_too_short", "q must be at least 2 characters")
+	ErrInvalidPage         = apperr.New(apperr.Invalid, "invalid_page", "page must be >= 1")
+	ErrInvalidPageSize     = apperr.New(apperr.Invalid, "invalid_page_size", "page_size must be between 1 and 100")
+)
+
+func (f *SearchFilter) Validate() error {
+	if len([]rune(strings.TrimSpace(f.Query))) < minSearchLength {
+		return ErrSearchQueryTooShort
+	}
+	if f.Page < 1 {
+		return ErrInvalidPage
+	}
+	if f.PageSize < 1 || f.PageSize > 100 {
+		return ErrInvalidPageSize
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package customer
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaskedHidesPII(t *testing.T) {
+	c := Customer{
+		ID:          7,
+		FirstName:   "Casey",
+		LastName:    "Pandey",
+		BirthDate:   time.Date(1990, 4, 12, 0, 0, 0, 0, time.UTC),
+		Email:       "casey.pandey@home.pl",
+		PhoneNumber: "997-474-3385",
+		Address:     "Jl. Sudirman No. 1",
+		CompanyID:   3,
+		Photo:       "data:image/png;base64,iVBORw0KGgo",
+	}
+
+	body, err := json.Marshal(c.Masked())
+	require.NoError(t, err)
+
+	out := string(body)
+	for _, raw := range []string{"casey.pandey@home.pl", "997-474-3385", "Jl. Sudirman", "1990-04-12", "base64"} {
+		assert.NotContains(t, out, raw)
+	}
+	assert.Contains(t, out, `"email":"c****@home.pl"`)
+	assert.Contains(t, out, `"phone_number":"***-***-3385"`)
+	assert.Contains(t, out, `"first_name":"Casey"`)
+	assert.NotContains(t, out, "birth_date")
+}
+
+func TestLogValueOmitsPII(t *testing.T) {
+	c := Customer{ID: 7, CompanyID: 3, Email: "casey.pandey@home.pl"}
+
+	assert.NotContains(t, c.LogValue().String(), "casey")
+}
@@ -0,0 +1,292 @@
+package customer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"sinibeli/internal/app/audit"
+	"sinibeli/internal/config"
+	"sinibeli/internal/infrastructure/cache"
+	"sinibeli/internal/infrastructure/storage"
+	"sinibeli/internal/pkg/apperr"
+	"sinibeli/internal/pkg/etag"
+	"sinibeli/internal/pkg/imaging"
+	logger "sinibeli/internal/pkg/logging"
+	"sinibeli/internal/pkg/tracing"
+)
+
+var (
+	ErrNoPhoto        = apperr.New(apperr.NotFound, "photo_not_found", "customer has no photo")
+	ErrPhotoTooLarge  = apperr.New(apperr.TooLarge, "photo_too_large", "photo exceeds the size limit")
+	ErrInvalidPhoto   = apperr.New(apperr.UnsupportedMediaType, "invalid_photo", "photo is not a supported image")
+	ErrInvalidDataURI = apperr.New(apperr.Invalid, "invalid_data_uri", "photo must be a base64 data URI")
+	ErrEmptyPhoto     = apperr.New(apperr.Invalid, "empty_photo", "photo is empty")
+)
+
+type PhotoService struct {
+	repo          *CustomerRepo
+	store         storage.Storage
+	invalidator   *cache.Invalidator
+	audit         *audit.Recorder
+	maxBytes      int64
+	thumbnailSize int
+}
+
+func NewPhotoService(repo *CustomerRepo, store storage.Storage, invalidator *cache.Invalidator, recorder *audit.Recorder, cfg config.StorageConfig) *PhotoService {
+	return &PhotoService{
+		repo:          repo,
+		store:         store,
+		invalidator:   invalidator,
+		audit:         recorder,
+		maxBytes:      cfg.PhotoMaxBytes,
+		thumbnailSize: cfg.ThumbnailSize,
+	}
+}
+
+func (s *PhotoService) MaxBytes() int64 {
+	return s.maxBytes
+}
+
+// Set stores data as the customer's photo along with a generated thumbnail,
+// when ifMatch holds for the customer's current version. Keys carry a version
+// so a reader never sees a half-replaced photo; the previous objects are
+// removed once the row points at the new ones.
+func (s *PhotoService) Set(ctx context.Context, id int64, ifMatch etag.Precondition, data []byte) (Customer, error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.Set")
+	defer span.End()
+
+	if int64(len(data)) > s.maxBytes {
+		return Customer{}, ErrPhotoTooLarge
+	}
+	return s.set(ctx, id, ifMatch, data, false)
+}
+
+// set is Set without the upload size limit, which the migration must not
+// apply to photos that were accepted before it existed. The migration also
+// moves the photos of soft-deleted customers, so they survive a restore.
+//
+// Two writers racing on one customer both read the same version, and only
+// the first gets to repoint the row: the other fails the version check and
+// removes what it uploaded, leaving the winner's objects in place.
+func (s *PhotoService) set(ctx context.Context, id int64, ifMatch etag.Precondition, data []byte, includeDeleted bool) (Customer, error) {
+	contentType, err := imaging.Sniff(data)
+	if err != nil {
+		return Customer{}, fmt.Errorf("%w: %v", ErrInvalidPhoto, err)
+	}
+	thumb, err := imaging.Thumbnail(data, s.thumbnailSize)
+	if err != nil {
+		return Customer{}, fmt.Errorf("%w: %v", ErrInvalidPhoto, err)
+	}
+
+	get := s.repo.GetByID
+	if includeDeleted {
+		get = s.repo.GetByIDWithDeleted
+	}
+	existing, err := get(ctx, id)
+	if err != nil {
+		return Customer{}, err
+	}
+	if existing == nil {
+		return Customer{}, ErrNotFound
+	}
+	if !ifMatch.Matches(existing.Version) {
+		return Customer{}, etag.ErrPreconditionFailed
+	}
+
+	version := time.Now().UnixNano()
+	photoKey := fmt.Sprintf("customers/%d/photo-%d%s", id, version, imaging.Extensions[contentType])
+	thumbKey := fmt.Sprintf("customers/%d/thumb-%d.png", id, version)
+
+	if err := s.store.Put(ctx, photoKey, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+		return Customer{}, fmt.Errorf("failed to store photo: %w", err)
+	}
+	if err := s.store.Put(ctx, thumbKey, bytes.NewReader(thumb), int64(len(thumb)), "image/png"); err != nil {
+		s.removeObjects(ctx, photoKey)
+		return Customer{}, fmt.Errorf("failed to store thumbnail: %w", err)
+	}
+	rowVersion, err := s.repo.SetPhotoKeys(ctx, id, photoKey, thumbKey, existing.Version)
+	if err != nil {
+		s.removeObjects(ctx, photoKey, thumbKey)
+		return Customer{}, err
+	}
+
+	s.removeObjects(ctx, existing.PhotoKey, existing.ThumbnailKey)
+	s.invalidator.Publish(ctx, cache.EventCustomerChanged, id)
+	if err := s.record(ctx, id, existing, photoKey); err != nil {
+		return Customer{}, err
+	}
+
+	existing.PhotoKey = photoKey
+	existing.ThumbnailKey = thumbKey
+	existing.HasLegacyPhoto = false
+	existing.Version = rowVersion
+	return *existing, nil
+}
+
+// Open returns the customer's photo, or its thumbnail. Photos that are still
+// inline data URIs are served from the row; those have no thumbnail, so the
+// full image stands in for it until the migration has run.
+func (s *PhotoService) Open(ctx context.Context, id int64, thumbnail bool) (io.ReadCloser, storage.ObjectInfo, error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.Open")
+	defer span.End()
+
+	cust, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, storage.ObjectInfo{}, err
+	}
+	if cust == nil {
+		return nil, storage.ObjectInfo{}, ErrNotFound
+	}
+
+	if cust.PhotoKey != "" {
+		key := cust.PhotoKey
+		if thumbnail && cust.ThumbnailKey != "" {
+			key = cust.ThumbnailKey
+		}
+		body, info, err := s.store.Get(ctx, key)
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, storage.ObjectInfo{}, ErrNoPhoto
+		}
+		return body, info, err
+	}
+
+	if !cust.HasLegacyPhoto {
+		return nil, storage.ObjectInfo{}, ErrNoPhoto
+	}
+	uri, err := s.repo.GetLegacyPhoto(ctx, id)
+	if err != nil {
+		return nil, storage.ObjectInfo{}, err
+	}
+	// A stored photo that does not decode is our fault, not the caller's.
+	data, err := DecodeDataURI(uri)
+	if err != nil {
+		return nil, storage.ObjectInfo{}, fmt.Errorf("failed to decode legacy photo: %v", err)
+	}
+	contentType, err := imaging.Sniff(data)
+	if err != nil {
+		return nil, storage.ObjectInfo{}, fmt.Errorf("failed to read legacy photo: %v", err)
+	}
+	info := storage.ObjectInfo{Size: int64(len(data)), ContentType: contentType}
+	return io.NopCloser(bytes.NewReader(data)), info, nil
+}
+
+// Delete removes the customer's photo when ifMatch holds for their current
+// version, and returns the version it moved them to.
+func (s *PhotoService) Delete(ctx context.Context, id int64, ifMatch etag.Precondition) (int64, error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.Delete")
+	defer span.End()
+
+	existing, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	if existing == nil {
+		return 0, ErrNotFound
+	}
+	if !ifMatch.Matches(existing.Version) {
+		return 0, etag.ErrPreconditionFailed
+	}
+	if !existing.HasPhoto() {
+		return 0, ErrNoPhoto
+	}
+
+	version, err := s.repo.SetPhotoKeys(ctx, id, "", "", existing.Version)
+	if err != nil {
+		return 0, err
+	}
+	s.removeObjects(ctx, existing.PhotoKey, existing.ThumbnailKey)
+	s.invalidator.Publish(ctx, cache.EventCustomerChanged, id)
+	if err := s.record(ctx, id, existing, ""); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// record audits a photo change as a change of the customer's photo key; a
+// legacy inline photo shows up as "inline".
+func (s *PhotoService) record(ctx context.Context, id int64, before *Customer, photoKey string) error {
+	was := before.PhotoKey
+	if was == "" && before.HasLegacyPhoto {
+		was = "inline"
+	}
+	return s.audit.Record(ctx, audit.Change{
+		Entity:   "customer",
+		EntityID: id,
+		Action:   audit.ActionUpdate,
+		Before:   map[string]string{"photo_key": was},
+		After:    map[string]string{"photo_key": photoKey},
+	})
+}
+
+// MigrateLegacy moves inline data URI photos into blob storage, batchSize
+// rows at a time. A photo that cannot be migrated is reported and skipped so
+// one bad row does not stop the run; it stays inline and is retried next time.
+func (s *PhotoService) MigrateLegacy(ctx context.Context, batchSize int, onError func(id int64, err error)) (int, error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.MigrateLegacy")
+	defer span.End()
+
+	var migrated int
+	var afterID int64
+	for {
+		batch, err := s.repo.ListLegacyPhotos(ctx, afterID, batchSize)
+		if err != nil {
+			return migrated, err
+		}
+		if len(batch) == 0 {
+			return migrated, nil
+		}
+
+		for _, c := range batch {
+			afterID = c.ID
+			data, err := DecodeDataURI(c.Photo)
+			if err == nil {
+				// A row edited since the batch was read fails the
+				// precondition and is picked up by the next run.
+				_, err = s.set(ctx, c.ID, etag.Version(c.Version), data, true)
+			}
+			if err != nil {
+				onError(c.ID, err)
+				continue
+			}
+			migrated++
+		}
+	}
+}
+
+// removeObjects deletes blobs that are no longer referenced. Failures only
+// leave an orphan behind, so they are logged rather than returned.
+func (s *PhotoService) removeObjects(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if err := s.store.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			logger.WarnCtx(ctx, "Failed to delete photo object", "key", key, "error", err)
+		}
+	}
+}
+
+// DecodeDataURI extracts the payload of a "data:<type>;base64,<data>" URI,
+// the format photos were stored in before blob storage.
+func DecodeDataURI(uri string) ([]byte, error) {
+	rest, ok := strings.CutPrefix(uri, "data:")
+	if !ok {
+		return nil, ErrInvalidDataURI
+	}
+	meta, payload, ok := strings.Cut(rest, ",")
+	if !ok || !strings.HasSuffix(meta, ";base64") {
+		return nil, ErrInvalidDataURI
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(payload))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDataURI, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,123 @@
+package customer
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sinibeli/internal/app/audit"
+	"sinibeli/internal/config"
+	"sinibeli/internal/infrastructure/cache"
+	"sinibeli/internal/infrastructure/storage"
+	"sinibeli/internal/pkg/etag"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// legacyPhoto is an inline photo as rows kept it before blob storage.
+var legacyPhoto = "data:image/png;base64," + base64.StdEncoding.EncodeToString(testPNG())
+
+func testPNG() []byte {
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		panic(err)
+	}
+	return img.Bytes()
+}
+
+func TestSetPhotoChecksVersion(t *testing.T) {
+	s, db, root := newPhotoService(t, legacyCustomer)
+
+	_, err := s.Set(context.Background(), 7, etag.Version(5), testPNG())
+	assert.Equal(t, etag.ErrPreconditionFailed, err)
+	assert.Empty(t, db.update())
+	assert.Empty(t, storedKeys(t, root), "nothing is uploaded for a stale version")
+
+	c, err := s.Set(context.Background(), 7, etag.Version(1), testPNG())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), c.Version)
+	assert.Contains(t, db.update(), "WHERE id = $3 AND version = $4")
+}
+
+func TestSetPhotoLosingRaceKeepsWinner(t *testing.T) {
+	s, db, root := newPhotoService(t, withPhoto())
+	// Another Set moved the row on between the read and the write.
+	db.stale = true
+	for _, key := range []string{"customers/7/photo-1.png", "customers/7/thumb-1.png"} {
+		require.NoError(t, s.store.Put(context.Background(), key, bytes.NewReader(testPNG()), int64(len(testPNG())), "image/png"))
+	}
+
+	_, err := s.Set(context.Background(), 7, etag.Version(1), testPNG())
+	assert.Equal(t, etag.ErrPreconditionFailed, err)
+	assert.ElementsMatch(t, []string{"customers/7/photo-1.png", "customers/7/thumb-1.png"}, storedKeys(t, root),
+		"the loser removes its own upload and leaves the row's objects alone")
+}
+
+func TestMigrateLegacyMovesDeletedCustomers(t *testing.T) {
+	deleted := append([]driver.Value(nil), legacyCustomer...)
+	deleted[12], deleted[15] = true, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	s, db, root := newPhotoService(t, deleted)
+
+	var failed []error
+	migrated, err := s.MigrateLegacy(context.Background(), 10, func(_ int64, err error) { failed = append(failed, err) })
+	require.NoError(t, err)
+	assert.Empty(t, failed)
+	assert.Equal(t, 1, migrated)
+	assert.Contains(t, db.update(), "SET photo_key = $1")
+	assert.Len(t, storedKeys(t, root), 2)
+}
+
+func TestDeletePhotoChecksVersion(t *testing.T) {
+	s, db, _ := newPhotoService(t, withPhoto())
+
+	_, err := s.Delete(context.Background(), 7, etag.Version(5))
+	assert.Equal(t, etag.ErrPreconditionFailed, err)
+	assert.Empty(t, db.update())
+
+	version, err := s.Delete(context.Background(), 7, etag.Version(1))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), version)
+	assert.Contains(t, db.update(), "WHERE id = $3 AND version = $4")
+}
+
+func withPhoto() []driver.Value {
+	row := append([]driver.Value(nil), legacyCustomer...)
+	row[10], row[11] = "customers/7/photo-1.png", "customers/7/thumb-1.png"
+	return row
+}
+
+// storedKeys lists the objects under a local storage root.
+func storedKeys(t *testing.T, root string) []string {
+	var keys []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		key, err := filepath.Rel(root, path)
+		keys = append(keys, filepath.ToSlash(key))
+		return err
+	})
+	require.NoError(t, err)
+	return keys
+}
+
+func newPhotoService(t *testing.T, row []driver.Value) (*PhotoService, *fakeDB, string) {
+	db := newFakeDB(t, row)
+	repo := newTestRepo(t, db)
+	root := t.TempDir()
+	store, err := storage.NewLocalStorage(root)
+	require.NoError(t, err)
+
+	invalidator := cache.NewInvalidator(cache.NewMemoryCache(100))
+	recorder := audit.NewRecorder(audit.NewAuditRepo(db.DB))
+	cfg := config.StorageConfig{PhotoMaxBytes: 1 << 20, ThumbnailSize: 2}
+	return NewPhotoService(repo, store, invalidator, recorder, cfg), db, root
+}
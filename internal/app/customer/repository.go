@@ -1,24 +1,49 @@
 package customer
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
+
+	"sinibeli/internal/app/rollup"
+	"sinibeli/internal/pkg/etag"
+	"sinibeli/internal/pkg/fieldcrypt"
 )
 
+// CustomerRepo reads and writes customers. Rollup is needed to move a
+// customer to another company; the maintenance commands, which never do,
+// leave it nil.
 type CustomerRepo struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Cipher *fieldcrypt.Cipher
+	Rollup *rollup.RollupRepo
 }
 
-func NewCustomerRepo(db *sql.DB) *CustomerRepo {
-	return &CustomerRepo{DB: db}
+func NewCustomerRepo(db *sql.DB, cipher *fieldcrypt.Cipher, rollupRepo *rollup.RollupRepo) *CustomerRepo {
+	return &CustomerRepo{DB: db, Cipher: cipher, Rollup: rollupRepo}
 }
 
-func (r *CustomerRepo) Create(c *Customer) error {
+// customerColumns leaves out the legacy photo payload; only whether one is
+// present is read, and GetLegacyPhoto loads it when it is actually served.
+const customerColumns = `id, first_name, last_name, birth_date, email,
+		       phone_number, phone_e164, address, gender, company,
+		       photo_key, photo_thumb_key, photo IS NOT NULL, merged_into, version, deleted_at`
+
+func (r *CustomerRepo) Create(ctx context.Context, c *Customer) error {
 	query := `
 		INSERT INTO customer (
-			id, first_name, last_name, birth_date, email, 
-			phone_number, address, gender, company, photo
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+			id, first_name, last_name, birth_date, email,
+			phone_number, phone_e164, address, gender, company,
+			email_bidx, phone_bidx, phone_suffix_bidx, pii_key_id
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		RETURNING version`
+
+	sealed, err := r.seal(c)
+	if err != nil {
+		return err
+	}
 
 	var birthDate interface{}
 	if !c.BirthDate.IsZero() {
@@ -27,27 +52,6 @@ func (r *CustomerRepo) Create(c *Customer) error {
 		birthDate = nil
 	}
 
-	var email interface{}
-	if c.Email != "" {
-		email = c.Email
-	} else {
-		email = nil
-	}
-
-	var phoneNumber interface{}
-	if c.PhoneNumber != "" {
-		phoneNumber = c.PhoneNumber
-	} else {
-		phoneNumber = nil
-	}
-
-	var address interface{}
-	if c.Address != "" {
-		address = c.Address
-	} else {
-		address = nil
-	}
-
 	var gender interface{}
 	if c.Gender != "" {
 		gender = c.Gender
@@ -55,212 +59,591 @@ func (r *CustomerRepo) Create(c *Customer) error {
 		gender = nil
 	}
 
-	var photo interface{}
-	if c.Photo != "" {
-		photo = c.Photo
-	} else {
-		photo = nil
-	}
-
-	_, err := r.DB.Exec(
+	err = r.DB.QueryRowContext(ctx,
 		query,
 		c.ID,
 		c.FirstName,
 		c.LastName,
 		birthDate,
-		email,
-		phoneNumber,
-		address,
+		sealed.email,
+		sealed.phoneNumber,
+		sealed.phoneE164,
+		sealed.address,
 		gender,
 		c.CompanyID,
-		photo,
-	)
+		sealed.emailIndex,
+		sealed.phoneIndex,
+		sealed.phoneSuffixIndex,
+		r.Cipher.ActiveKeyID(),
+	).Scan(&c.Version)
 	if err != nil {
 		return fmt.Errorf("failed to create customer: %w", err)
 	}
 	return nil
 }
 
-func (r *CustomerRepo) GetByID(id int64) (*Customer, error) {
-	query := `
-		SELECT id, first_name, last_name, birth_date, email,
-		       phone_number, address, gender, company, photo
-		FROM customer WHERE id = $1`
+// GetByID only finds customers that are not soft-deleted; use
+// GetByIDWithDeleted where a deleted customer must be visible too.
+func (r *CustomerRepo) GetByID(ctx context.Context, id int64) (*Customer, error) {
+	query := `SELECT ` + customerColumns + ` FROM customer WHERE id = $1 AND deleted_at IS NULL`
+
+	return r.getOne(ctx, query, id)
+}
+
+func (r *CustomerRepo) GetByIDWithDeleted(ctx context.Context, id int64) (*Customer, error) {
+	query := `SELECT ` + customerColumns + ` FROM customer WHERE id = $1`
+
+	return r.getOne(ctx, query, id)
+}
+
+// GetByEmail looks the customer up through the blind index, since the email
+// column itself holds a different ciphertext on every write.
+func (r *CustomerRepo) GetByEmail(ctx context.Context, email string) (*Customer, error) {
+	query := `SELECT ` + customerColumns + ` FROM customer WHERE email_bidx = $1 AND deleted_at IS NULL`
 
-	row := r.DB.QueryRow(query, id)
+	return r.getOne(ctx, query, r.Cipher.BlindIndex(email))
+}
 
+func (r *CustomerRepo) getOne(ctx context.Context, query string, arg interface{}) (*Customer, error) {
 	var c Customer
+	err := r.scanCustomer(r.DB.QueryRowContext(ctx, query, arg), &c)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *CustomerRepo) GetAll(ctx context.Context, includeDeleted bool) ([]*Customer, error) {
+	query := `SELECT ` + customerColumns + ` FROM customer WHERE merged_into IS NULL AND ($1 OR deleted_at IS NULL)`
+
+	rows, err := r.DB.QueryContext(ctx, query, includeDeleted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query customers: %w", err)
+	}
+	defer rows.Close()
+
+	customers := make([]*Customer, 0)
+	for rows.Next() {
+		var c Customer
+		if err := r.scanCustomer(rows, &c); err != nil {
+			return nil, err
+		}
+		customers = append(customers, &c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return customers, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanCustomer reads customerColumns, followed by any extra columns the query
+// selects, and decrypts the PII fields. sql.ErrNoRows is returned unwrapped.
+func (r *CustomerRepo) scanCustomer(row rowScanner, c *Customer, extra ...interface{}) error {
 	var birthDate sql.NullTime
-	var email, phone, addr, gender, photo sql.NullString
+	var email, phone, phoneE164, addr, gender, photoKey, thumbKey sql.NullString
+	var mergedInto sql.NullInt64
+	var deletedAt sql.NullTime
 
-	err := row.Scan(
+	dest := []interface{}{
 		&c.ID,
 		&c.FirstName,
 		&c.LastName,
 		&birthDate,
 		&email,
 		&phone,
+		&phoneE164,
 		&addr,
 		&gender,
 		&c.CompanyID,
-		&photo,
-	)
-	if err != nil {
+		&photoKey,
+		&thumbKey,
+		&c.HasLegacyPhoto,
+		&mergedInto,
+		&c.Version,
+		&deletedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
 		if err == sql.ErrNoRows {
-			return nil, nil
+			return err
 		}
-		return nil, fmt.Errorf("failed to scan customer: %w", err)
+		return fmt.Errorf("failed to scan customer: %w", err)
 	}
 
 	if birthDate.Valid {
 		c.BirthDate = birthDate.Time
 	}
-	if email.Valid {
-		c.Email = email.String
+	if gender.Valid {
+		c.Gender = gender.String
 	}
-	if phone.Valid {
-		c.PhoneNumber = phone.String
+	c.PhotoKey = photoKey.String
+	c.ThumbnailKey = thumbKey.String
+	if mergedInto.Valid {
+		c.MergedInto = &mergedInto.Int64
 	}
-	if addr.Valid {
-		c.Address = addr.String
+	if deletedAt.Valid {
+		c.DeletedAt = &deletedAt.Time
 	}
-	if gender.Valid {
-		c.Gender = gender.String
+	return r.open(c, email, phone, phoneE164, addr, sql.NullString{})
+}
+
+// Update only applies while the customer is still at version, and sets the
+// version it moved to on c. etag.ErrPreconditionFailed means another write
+// got there first.
+func (r *CustomerRepo) Update(ctx context.Context, c *Customer, version int64, moved bool) ([]movedAttachment, error) {
+	query := `
+		UPDATE customer
+		SET first_name = $1, last_name = $2, birth_date = $3, email = $4,
+		    phone_number = $5, phone_e164 = $6, address = $7, gender = $8, company = $9,
+		    email_bidx = $10, phone_bidx = $11, phone_suffix_bidx = $12, pii_key_id = $13
+		WHERE id = $14 AND version = $15 AND deleted_at IS NULL
+		RETURNING version`
+
+	sealed, err := r.seal(c)
+	if err != nil {
+		return nil, err
 	}
-	if photo.Valid {
-		c.Photo = photo.String
+
+	var birthDate interface{}
+	if !c.BirthDate.IsZero() {
+		birthDate = c.BirthDate.Format("2006-01-02")
+	} else {
+		birthDate = nil
 	}
 
-	return &c, nil
+	var gender interface{}
+	if c.Gender != "" {
+		gender = c.Gender
+	} else {
+		gender = nil
+	}
+
+	return r.write(ctx, c, moved, "update", query,
+		c.FirstName,
+		c.LastName,
+		birthDate,
+		sealed.email,
+		sealed.phoneNumber,
+		sealed.phoneE164,
+		sealed.address,
+		gender,
+		c.CompanyID,
+		sealed.emailIndex,
+		sealed.phoneIndex,
+		sealed.phoneSuffixIndex,
+		r.Cipher.ActiveKeyID(),
+		c.ID,
+		version,
+	)
+}
+
+// Patch writes only the given columns of c, under the same version check as
+// Update. A changed email or phone brings its blind indexes along; the
+// untouched PII columns keep whatever key sealed them.
+func (r *CustomerRepo) Patch(ctx context.Context, c *Customer, columns []string, version int64) ([]movedAttachment, error) {
+	sealed, err := r.seal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var birthDate, gender interface{}
+	if !c.BirthDate.IsZero() {
+		birthDate = c.BirthDate.Format("2006-01-02")
+	}
+	if c.Gender != "" {
+		gender = c.Gender
+	}
+
+	values := map[string]interface{}{
+		"first_name":        c.FirstName,
+		"last_name":         c.LastName,
+		"birth_date":        birthDate,
+		"email":             sealed.email,
+		"email_bidx":        sealed.emailIndex,
+		"phone_number":      sealed.phoneNumber,
+		"phone_e164":        sealed.phoneE164,
+		"phone_bidx":        sealed.phoneIndex,
+		"phone_suffix_bidx": sealed.phoneSuffixIndex,
+		"address":           sealed.address,
+		"gender":            gender,
+		"company":           c.CompanyID,
+	}
+	derived := map[string][]string{
+		"email":        {"email_bidx"},
+		"phone_number": {"phone_e164", "phone_bidx", "phone_suffix_bidx"},
+	}
+
+	var set []string
+	args := make([]interface{}, 0, len(columns)+2)
+	for _, column := range columns {
+		for _, col := range append([]string{column}, derived[column]...) {
+			args = append(args, values[col])
+			set = append(set, fmt.Sprintf("%s = $%d", col, len(args)))
+		}
+	}
+	args = append(args, c.ID, version)
+
+	query := fmt.Sprintf(`UPDATE customer SET %s WHERE id = $%d AND version = $%d AND deleted_at IS NULL RETURNING version`,
+		strings.Join(set, ", "), len(args)-1, len(args))
+	moved := false
+	for _, column := range columns {
+		moved = moved || column == "company"
+	}
+	return r.write(ctx, c, moved, "patch", query, args...)
+}
+
+// write runs an UPDATE of the customer that returns the new version. When it
+// moves the customer to another company, their transactions are repointed in
+// the same database transaction, as a merge does, so reports stop crediting
+// the old company and only the new one can reach the attachments. It returns
+// the attachments that moved.
+func (r *CustomerRepo) write(ctx context.Context, c *Customer, moved bool, op, query string, args ...interface{}) ([]movedAttachment, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin customer %s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&c.Version); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, etag.ErrPreconditionFailed
+		}
+		return nil, fmt.Errorf("failed to %s customer: %w", op, err)
+	}
+
+	var attachments []movedAttachment
+	if moved {
+		ids, err := moveTransactions(ctx, tx, `SELECT id FROM transaction WHERE customer_id = $1`, c.ID)
+		if err != nil {
+			return nil, err
+		}
+		if attachments, err = repointTransactions(ctx, tx, r.Rollup, ids, c.CompanyID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit customer %s: %w", op, err)
+	}
+	return attachments, nil
+}
+
+// changedColumns lists the columns whose values differ between two states of
+// a customer. A phone counts as changed when its normalized form does.
+func changedColumns(before, after *Customer) []string {
+	var columns []string
+	if before.FirstName != after.FirstName {
+		columns = append(columns, "first_name")
+	}
+	if before.LastName != after.LastName {
+		columns = append(columns, "last_name")
+	}
+	if !before.BirthDate.Equal(after.BirthDate) {
+		columns = append(columns, "birth_date")
+	}
+	if before.Email != after.Email {
+		columns = append(columns, "email")
+	}
+	if before.PhoneNumber != after.PhoneNumber || before.PhoneE164 != after.PhoneE164 {
+		columns = append(columns, "phone_number")
+	}
+	if before.Address != after.Address {
+		columns = append(columns, "address")
+	}
+	if before.Gender != after.Gender {
+		columns = append(columns, "gender")
+	}
+	if before.CompanyID != after.CompanyID {
+		columns = append(columns, "company")
+	}
+	return columns
 }
 
-func (r *CustomerRepo) GetAll() ([]*Customer, error) {
+// Search ranks customers against the query: an exact email or phone match
+// first, then the best of trigram similarity and prefix full-text match on
+// the name. The total is the number of matches before pagination.
+func (r *CustomerRepo) Search(ctx context.Context, filter SearchFilter) ([]SearchResult, int64, error) {
 	query := `
-		SELECT id, first_name, last_name, birth_date, email,
-		       phone_number, address, gender, company, photo
-		FROM customer`
+		SELECT ` + customerColumns + `,
+		       m.name_match, m.email_match, m.phone_match,
+		       CASE WHEN m.email_match OR m.phone_exact THEN 2
+		            WHEN m.phone_match THEN 1.5
+		            ELSE m.name_score END AS score,
+		       COUNT(*) OVER () AS total
+		FROM customer
+		CROSS JOIN LATERAL (
+			SELECT COALESCE(search_name % $1 OR $1 <% search_name OR search_name LIKE $2
+			                OR ($3 <> '' AND search_tsv @@ to_tsquery('simple', $3)), false) AS name_match,
+			       COALESCE(email_bidx = $4, false) AS email_match,
+			       COALESCE(phone_bidx = $5 OR phone_suffix_bidx = $6, false) AS phone_match,
+			       COALESCE(phone_bidx = $5, false) AS phone_exact,
+			       GREATEST(word_similarity($1, search_name), similarity(search_name, $1))
+			         + CASE WHEN $3 <> '' THEN ts_rank(search_tsv, to_tsquery('simple', $3)) ELSE 0 END AS name_score
+		) m
+		WHERE merged_into IS NULL AND deleted_at IS NULL
+		  AND ($7::bigint IS NULL OR company = $7)
+		  AND (search_name % $1 OR $1 <% search_name OR search_name LIKE $2
+		       OR ($3 <> '' AND search_tsv @@ to_tsquery('simple', $3))
+		       OR email_bidx = $4 OR phone_bidx = $5 OR phone_suffix_bidx = $6)
+		ORDER BY score DESC, customer.id
+		LIMIT $8 OFFSET $9`
+
+	terms := parseSearchQuery(filter.Query)
+	var email, phone, phoneSuffix interface{}
+	if terms.email != "" {
+		email = r.Cipher.BlindIndex(terms.email)
+	}
+	if terms.phone != "" {
+		phone = r.Cipher.BlindIndex(terms.phone)
+	}
+	if terms.phoneSuffix != "" {
+		phoneSuffix = r.phoneSuffixIndex(terms.phoneSuffix)
+	}
+
+	var companyID interface{}
+	if filter.CompanyID != nil {
+		companyID = *filter.CompanyID
+	}
 
-	rows, err := r.DB.Query(query)
+	rows, err := r.DB.QueryContext(ctx, query,
+		terms.name,
+		terms.namePattern,
+		terms.tsQuery,
+		email,
+		phone,
+		phoneSuffix,
+		companyID,
+		filter.PageSize,
+		(filter.Page-1)*filter.PageSize,
+	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query customers: %w", err)
+		return nil, 0, fmt.Errorf("failed to search customers: %w", err)
 	}
 	defer rows.Close()
 
-	customers := make([]*Customer, 0)
+	results := make([]SearchResult, 0)
+	var total int64
 	for rows.Next() {
-		var c Customer
-		var birthDate sql.NullTime
-		var email, phone, addr, gender, photo sql.NullString
-
-		err := rows.Scan(
-			&c.ID,
-			&c.FirstName,
-			&c.LastName,
-			&birthDate,
-			&email,
-			&phone,
-			&addr,
-			&gender,
-			&c.CompanyID,
-			&photo,
-		)
+		var res SearchResult
+		var nameMatch, emailMatch, phoneMatch bool
+		err := r.scanCustomer(rows, &res.Customer, &nameMatch, &emailMatch, &phoneMatch, &res.Score, &total)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan customer row: %w", err)
+			return nil, 0, err
 		}
 
-		if birthDate.Valid {
-			c.BirthDate = birthDate.Time
-		}
-		if email.Valid {
-			c.Email = email.String
+		res.MatchedOn = make([]string, 0, 3)
+		if nameMatch {
+			res.MatchedOn = append(res.MatchedOn, "name")
+			res.Highlight = highlightName(res.FirstName, res.LastName, filter.Query)
 		}
-		if phone.Valid {
-			c.PhoneNumber = phone.String
+		if emailMatch {
+			res.MatchedOn = append(res.MatchedOn, "email")
 		}
-		if addr.Valid {
-			c.Address = addr.String
+		if phoneMatch {
+			res.MatchedOn = append(res.MatchedOn, "phone")
 		}
-		if gender.Valid {
-			c.Gender = gender.String
+		results = append(results, res)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("row iteration error: %w", err)
+	}
+	return results, total, nil
+}
+
+// ListPhones returns up to limit customers after afterID that have a phone
+// number, with PhoneNumber and PhoneE164 populated.
+func (r *CustomerRepo) ListPhones(ctx context.Context, afterID int64, limit int) ([]Customer, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT id, phone_number, phone_e164
+		FROM customer
+		WHERE phone_number IS NOT NULL AND id > $1
+		ORDER BY id
+		LIMIT $2`, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query customer phones: %w", err)
+	}
+	defer rows.Close()
+
+	var customers []Customer
+	for rows.Next() {
+		var c Customer
+		var phone, phoneE164 sql.NullString
+		if err := rows.Scan(&c.ID, &phone, &phoneE164); err != nil {
+			return nil, fmt.Errorf("failed to scan customer phone: %w", err)
 		}
-		if photo.Valid {
-			c.Photo = photo.String
+		if err := r.open(&c, sql.NullString{}, phone, phoneE164, sql.NullString{}, sql.NullString{}); err != nil {
+			return nil, err
 		}
-
-		customers = append(customers, &c)
+		customers = append(customers, c)
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, fmt.Errorf("row iteration error: %w", err)
 	}
-
 	return customers, nil
 }
 
-func (r *CustomerRepo) Update(c *Customer) error {
-	query := `
+// UpdatePhoneE164 stores the normalized phone of c and re-derives the phone
+// blind indexes from it, leaving the number as entered untouched.
+func (r *CustomerRepo) UpdatePhoneE164(ctx context.Context, c *Customer) error {
+	var phoneE164 interface{}
+	if c.PhoneE164 != "" {
+		ciphertext, err := r.Cipher.Encrypt(c.PhoneE164, piiAAD("phone_e164", c.ID))
+		if err != nil {
+			return fmt.Errorf("failed to encrypt customer phone_e164: %w", err)
+		}
+		phoneE164 = ciphertext
+	}
+	phoneIndex, phoneSuffixIndex := r.phoneIndexes(c)
+
+	_, err := r.DB.ExecContext(ctx, `
 		UPDATE customer
-		SET first_name = $1, last_name = $2, birth_date = $3, email = $4,
-		    phone_number = $5, address = $6, gender = $7, company = $8, photo = $9
-		WHERE id = $10`
+		SET phone_e164 = $1, phone_bidx = $2, phone_suffix_bidx = $3
+		WHERE id = $4`, phoneE164, phoneIndex, phoneSuffixIndex, c.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update customer phone: %w", err)
+	}
+	return nil
+}
 
-	var birthDate interface{}
-	if !c.BirthDate.IsZero() {
-		birthDate = c.BirthDate.Format("2006-01-02")
-	} else {
-		birthDate = nil
+// GetLegacyPhoto returns the data URI still stored inline for a customer
+// whose photo has not been moved to blob storage, or "" if there is none.
+func (r *CustomerRepo) GetLegacyPhoto(ctx context.Context, id int64) (string, error) {
+	var photo sql.NullString
+	err := r.DB.QueryRowContext(ctx, `SELECT photo FROM customer WHERE id = $1`, id).Scan(&photo)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to query customer photo: %w", err)
 	}
 
-	var email interface{}
-	if c.Email != "" {
-		email = c.Email
-	} else {
-		email = nil
+	c := Customer{ID: id}
+	if err := r.open(&c, sql.NullString{}, sql.NullString{}, sql.NullString{}, sql.NullString{}, photo); err != nil {
+		return "", err
 	}
+	return c.Photo, nil
+}
 
-	var phoneNumber interface{}
-	if c.PhoneNumber != "" {
-		phoneNumber = c.PhoneNumber
-	} else {
-		phoneNumber = nil
+// ListLegacyPhotos returns up to limit customers after afterID whose photo is
+// still an inline data URI, with Photo populated.
+func (r *CustomerRepo) ListLegacyPhotos(ctx context.Context, afterID int64, limit int) ([]Customer, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT id, version, photo
+		FROM customer
+		WHERE photo IS NOT NULL AND id > $1
+		ORDER BY id
+		LIMIT $2`, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query legacy photos: %w", err)
 	}
+	defer rows.Close()
 
-	var address interface{}
-	if c.Address != "" {
-		address = c.Address
-	} else {
-		address = nil
+	var customers []Customer
+	for rows.Next() {
+		var c Customer
+		var photo sql.NullString
+		if err := rows.Scan(&c.ID, &c.Version, &photo); err != nil {
+			return nil, fmt.Errorf("failed to scan legacy photo: %w", err)
+		}
+		if err := r.open(&c, sql.NullString{}, sql.NullString{}, sql.NullString{}, sql.NullString{}, photo); err != nil {
+			return nil, err
+		}
+		customers = append(customers, c)
 	}
 
-	var gender interface{}
-	if c.Gender != "" {
-		gender = c.Gender
-	} else {
-		gender = nil
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
 	}
+	return customers, nil
+}
 
-	var photo interface{}
-	if c.Photo != "" {
-		photo = c.Photo
-	} else {
-		photo = nil
+// SetPhotoKeys points the customer at new blob storage objects, or at none
+// when both keys are empty, drops any legacy inline photo, and returns the
+// version it moved the customer to. Like Update, it only applies while the
+// customer is still at version.
+func (r *CustomerRepo) SetPhotoKeys(ctx context.Context, id int64, photoKey, thumbKey string, version int64) (int64, error) {
+	var photo, thumb interface{}
+	if photoKey != "" {
+		photo, thumb = photoKey, thumbKey
 	}
 
-	res, err := r.DB.Exec(
-		query,
-		c.FirstName,
-		c.LastName,
-		birthDate,
-		email,
-		phoneNumber,
-		address,
-		gender,
-		c.CompanyID,
-		photo,
-		c.ID,
-	)
+	err := r.DB.QueryRowContext(ctx, `
+		UPDATE customer
+		SET photo_key = $1, photo_thumb_key = $2, photo = NULL
+		WHERE id = $3 AND version = $4
+		RETURNING version`, photo, thumb, id, version).Scan(&version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, etag.ErrPreconditionFailed
+		}
+		return 0, fmt.Errorf("failed to update customer photo: %w", err)
+	}
+
+	return version, nil
+}
+
+// SoftDelete stamps deleted_at on the customer at version and returns it.
+func (r *CustomerRepo) SoftDelete(ctx context.Context, id, version int64) (time.Time, error) {
+	query := `UPDATE customer SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND version = $2 AND deleted_at IS NULL RETURNING deleted_at`
+
+	var deletedAt time.Time
+	if err := r.DB.QueryRowContext(ctx, query, id, version).Scan(&deletedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return time.Time{}, etag.ErrPreconditionFailed
+		}
+		return time.Time{}, fmt.Errorf("failed to delete customer: %w", err)
+	}
+	return deletedAt, nil
+}
+
+// Restore clears deleted_at and returns the version it moved the customer to;
+// restored is false when the customer was not deleted.
+func (r *CustomerRepo) Restore(ctx context.Context, id int64) (version int64, restored bool, err error) {
+	query := `UPDATE customer SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL RETURNING version`
+	if err := r.DB.QueryRowContext(ctx, query, id).Scan(&version); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("failed to restore customer: %w", err)
+	}
+	return version, true, nil
+}
+
+// References counts the rows that keep the customer from being purged. Merge
+// records and merged duplicates count too: purging would break undo.
+func (r *CustomerRepo) References(ctx context.Context, id int64) (map[string]int64, error) {
+	query := `
+		SELECT (SELECT COUNT(*) FROM transaction WHERE customer_id = $1),
+		       (SELECT COUNT(*) FROM customer_merge WHERE survivor_id = $1 OR duplicate_id = $1),
+		       (SELECT COUNT(*) FROM customer WHERE merged_into = $1)`
+
+	var transactions, merges, merged int64
+	if err := r.DB.QueryRowContext(ctx, query, id).Scan(&transactions, &merges, &merged); err != nil {
+		return nil, fmt.Errorf("failed to count customer references: %w", err)
+	}
+	return map[string]int64{
+		"transactions":     transactions,
+		"merges":           merges,
+		"merged_customers": merged,
+	}, nil
+}
+
+// Purge removes the customer row at version for good, deleted or not.
+func (r *CustomerRepo) Purge(ctx context.Context, id, version int64) error {
+	query := `DELETE FROM customer WHERE id = $1 AND version = $2`
+	res, err := r.DB.ExecContext(ctx, query, id, version)
 	if err != nil {
-		return fmt.Errorf("failed to update customer: %w", err)
+		return fmt.Errorf("failed to purge customer: %w", err)
 	}
 
 	rowsAffected, err := res.RowsAffected()
@@ -268,26 +651,194 @@ func (r *CustomerRepo) Update(c *Customer) error {
 		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
 	if rowsAffected == 0 {
-		return fmt.Errorf("no customer found with id %d", c.ID)
+		return etag.ErrPreconditionFailed
 	}
 
 	return nil
 }
 
-func (r *CustomerRepo) Delete(id int64) error {
-	query := `DELETE FROM customer WHERE id = $1`
-	res, err := r.DB.Exec(query, id)
+// CountUnindexedEmails counts customers whose email has no blind index yet.
+// Email uniqueness rests on that index, so those rows must be backfilled by
+// ReencryptBatch before the API takes writes.
+func (r *CustomerRepo) CountUnindexedEmails(ctx context.Context) (int64, error) {
+	var n int64
+	err := r.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM customer WHERE email IS NOT NULL AND email_bidx IS NULL`).Scan(&n)
 	if err != nil {
-		return fmt.Errorf("failed to delete customer: %w", err)
+		return 0, fmt.Errorf("failed to count unindexed customer emails: %w", err)
 	}
+	return n, nil
+}
 
-	rowsAffected, err := res.RowsAffected()
+// ReencryptBatch rewrites up to batchSize customers that are not yet sealed
+// with the active key, including legacy plaintext rows and rows written before
+// the email or phone blind indexes existed, and returns how many it touched. Rows are
+// locked with SKIP LOCKED so several runs can share the work.
+func (r *CustomerRepo) ReencryptBatch(ctx context.Context, batchSize int) (int, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return 0, fmt.Errorf("failed to begin re-encryption: %w", err)
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("no customer found with id %d", id)
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, email, phone_number, phone_e164, address, photo
+		FROM customer
+		WHERE pii_key_id IS DISTINCT FROM $1
+		   OR (email IS NOT NULL AND email_bidx IS NULL)
+		   OR (phone_number IS NOT NULL AND phone_bidx IS NULL)
+		ORDER BY id
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED`, r.Cipher.ActiveKeyID(), batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to select customers for re-encryption: %w", err)
+	}
+
+	var batch []Customer
+	for rows.Next() {
+		var c Customer
+		var email, phone, phoneE164, addr, photo sql.NullString
+		if err := rows.Scan(&c.ID, &email, &phone, &phoneE164, &addr, &photo); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan customer for re-encryption: %w", err)
+		}
+		if err := r.open(&c, email, phone, phoneE164, addr, photo); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	for i := range batch {
+		sealed, err := r.seal(&batch[i])
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE customer
+			SET email = $1, phone_number = $2, phone_e164 = $3, address = $4, photo = $5,
+			    email_bidx = $6, phone_bidx = $7, phone_suffix_bidx = $8, pii_key_id = $9
+			WHERE id = $10`,
+			sealed.email, sealed.phoneNumber, sealed.phoneE164, sealed.address, sealed.photo,
+			sealed.emailIndex, sealed.phoneIndex, sealed.phoneSuffixIndex,
+			r.Cipher.ActiveKeyID(), batch[i].ID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to re-encrypt customer %d: %w", batch[i].ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit re-encryption: %w", err)
+	}
+	return len(batch), nil
+}
+
+// sealedPII holds the column values for the encrypted fields, nil where the
+// field is empty so the column stays NULL.
+type sealedPII struct {
+	email       interface{}
+	phoneNumber interface{}
+	phoneE164   interface{}
+	address     interface{}
+	photo       interface{}
+	emailIndex  interface{}
+
+	phoneIndex       interface{}
+	phoneSuffixIndex interface{}
+}
+
+func (r *CustomerRepo) seal(c *Customer) (sealedPII, error) {
+	var sealed sealedPII
+	fields := []struct {
+		column string
+		value  string
+		dest   *interface{}
+	}{
+		{"email", c.Email, &sealed.email},
+		{"phone_number", c.PhoneNumber, &sealed.phoneNumber},
+		{"phone_e164", c.PhoneE164, &sealed.phoneE164},
+		{"address", c.Address, &sealed.address},
+		{"photo", c.Photo, &sealed.photo},
+	}
+
+	for _, f := range fields {
+		if f.value == "" {
+			continue
+		}
+		ciphertext, err := r.Cipher.Encrypt(f.value, piiAAD(f.column, c.ID))
+		if err != nil {
+			return sealedPII{}, fmt.Errorf("failed to encrypt customer %s: %w", f.column, err)
+		}
+		*f.dest = ciphertext
+	}
+
+	if c.Email != "" {
+		sealed.emailIndex = r.Cipher.BlindIndex(c.Email)
+	}
+	sealed.phoneIndex, sealed.phoneSuffixIndex = r.phoneIndexes(c)
+	return sealed, nil
+}
+
+func (r *CustomerRepo) open(c *Customer, email, phone, phoneE164, addr, photo sql.NullString) error {
+	fields := []struct {
+		column string
+		value  sql.NullString
+		dest   *string
+	}{
+		{"email", email, &c.Email},
+		{"phone_number", phone, &c.PhoneNumber},
+		{"phone_e164", phoneE164, &c.PhoneE164},
+		{"address", addr, &c.Address},
+		{"photo", photo, &c.Photo},
 	}
 
+	for _, f := range fields {
+		if !f.value.Valid {
+			continue
+		}
+		plaintext, err := r.Cipher.Decrypt(f.value.String, piiAAD(f.column, c.ID))
+		if err != nil {
+			return fmt.Errorf("failed to decrypt customer %d %s: %w", c.ID, f.column, err)
+		}
+		*f.dest = plaintext
+	}
 	return nil
 }
+
+// phoneIndexes returns the blind indexes for the customer's phone, nil when
+// there is none. The full index is over the E.164 form, so any way of writing
+// the number finds it; numbers that never normalized fall back to their
+// digits.
+func (r *CustomerRepo) phoneIndexes(c *Customer) (full, suffix interface{}) {
+	if c.PhoneNumber == "" {
+		return nil, nil
+	}
+
+	key := c.PhoneE164
+	if key == "" {
+		key = phoneDigits(c.PhoneNumber)
+	}
+	if key == "" {
+		key = c.PhoneNumber
+	}
+	full = r.Cipher.BlindIndex(key)
+
+	if digits := phoneDigits(key); len(digits) >= phoneSuffixLength {
+		suffix = r.phoneSuffixIndex(digits)
+	}
+	return full, suffix
+}
+
+// phoneSuffixIndex is kept apart from the full-number index by a prefix, so a
+// four-digit phone number and another number's last four digits never share
+// an index value.
+func (r *CustomerRepo) phoneSuffixIndex(digits string) string {
+	return r.Cipher.BlindIndex("suffix:" + digits[len(digits)-phoneSuffixLength:])
+}
+
+func piiAAD(column string, id int64) string {
+	return fmt.Sprintf("customer.%s:%d", column, id)
+}
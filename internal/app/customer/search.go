@@ -0,0 +1,156 @@
+package customer
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"sinibeli/pkg/validator"
+)
+
+// phoneSuffixLength is how many trailing digits get their own blind index, so
+// support can find a customer from the last digits read out over the phone.
+const phoneSuffixLength = 4
+
+// minSearchLength keeps one-letter queries from matching most of the table.
+const minSearchLength = 2
+
+// searchTerms is a query broken down into the forms each index understands.
+// Email and phone are encrypted, so they can only be matched exactly through
+// their blind indexes; names are matched fuzzily.
+type searchTerms struct {
+	name        string
+	namePattern string
+	tsQuery     string
+	email       string
+	phone       string
+	phoneSuffix string
+}
+
+func parseSearchQuery(q string) searchTerms {
+	q = strings.Join(strings.Fields(q), " ")
+	terms := searchTerms{
+		name:        strings.ToLower(q),
+		namePattern: "%" + escapeLike(strings.ToLower(q)) + "%",
+		tsQuery:     prefixTSQuery(q),
+	}
+
+	if strings.Contains(q, "@") {
+		terms.email = q
+	}
+	if isPhoneQuery(q) {
+		digits := phoneDigits(q)
+		switch {
+		case len(digits) == phoneSuffixLength:
+			terms.phoneSuffix = digits
+		case len(digits) > phoneSuffixLength:
+			// Stored numbers are indexed by their E.164 form when they have
+			// one, by their digits otherwise; see CustomerRepo.phoneIndexes.
+			if e164, err := validator.Phone(q); err == nil {
+				terms.phone = e164
+			} else {
+				terms.phone = digits
+			}
+		}
+	}
+	return terms
+}
+
+// phoneDigits normalizes a phone number to its digits, so "997-474-3385" and
+// "(997) 474 3385" index and search the same.
+func phoneDigits(phone string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+}
+
+func isPhoneQuery(q string) bool {
+	for _, r := range q {
+		if !unicode.IsDigit(r) && !strings.ContainsRune(" +-().", r) {
+			return false
+		}
+	}
+	return true
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// prefixTSQuery builds a to_tsquery expression matching every word of q as a
+// prefix, e.g. "cas pan" becomes "cas:* & pan:*". Punctuation is dropped so
+// user input cannot inject tsquery operators.
+func prefixTSQuery(q string) string {
+	var words []string
+	for _, word := range strings.Fields(q) {
+		word = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return unicode.ToLower(r)
+			}
+			return -1
+		}, word)
+		if word != "" {
+			words = append(words, word+":*")
+		}
+	}
+	return strings.Join(words, " & ")
+}
+
+// highlightName marks the parts of the full name that contain a query word.
+// The name is HTML-escaped first, so the result is safe to render as HTML.
+// Fuzzy matches with no literal overlap get no highlight.
+func highlightName(firstName, lastName, q string) string {
+	name := firstName + " " + lastName
+
+	// Lowercasing can change how many bytes a rune takes (Ⱥ is two, ⱥ
+	// three), so origin maps every byte of lower back to the start of the
+	// rune in name it came from. Marks are kept on those rune starts.
+	var lb strings.Builder
+	origin := make([]int, 0, len(name))
+	for i, r := range name {
+		n, _ := lb.WriteRune(unicode.ToLower(r))
+		for ; n > 0; n-- {
+			origin = append(origin, i)
+		}
+	}
+	lower := lb.String()
+
+	marked := make([]bool, len(name))
+	found := false
+	for _, word := range strings.Fields(strings.ToLower(q)) {
+		for from := 0; ; {
+			i := strings.Index(lower[from:], word)
+			if i < 0 {
+				break
+			}
+			for j := from + i; j < from+i+len(word); j++ {
+				marked[origin[j]] = true
+			}
+			found = true
+			from += i + len(word)
+		}
+	}
+	if !found {
+		return ""
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(name); {
+		j := i
+		for j < len(name) && marked[j] == marked[i] {
+			_, size := utf8.DecodeRuneInString(name[j:])
+			j += size
+		}
+		if marked[i] {
+			b.WriteString("<mark>" + html.EscapeString(name[i:j]) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(name[i:j]))
+		}
+		i = j
+	}
+	return b.String()
+}
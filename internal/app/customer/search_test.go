@@ -0,0 +1,30 @@
+package customer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHighlightName(t *testing.T) {
+	tests := []struct {
+		name        string
+		first, last string
+		q           string
+		want        string
+	}{
+		{"prefix", "Casey", "Pandey", "cas", "<mark>Cas</mark>ey Pandey"},
+		{"every word", "Casey", "Pandey", "pan cas", "<mark>Cas</mark>ey <mark>Pan</mark>dey"},
+		{"repeated", "Anna", "Banana", "an", "<mark>An</mark>na B<mark>anan</mark>a"},
+		{"escaped", "<b>", "O'Neil", "neil", "&lt;b&gt; O&#39;<mark>Neil</mark>"},
+		{"no literal overlap", "Casey", "Pandey", "kasey", ""},
+		{"rune grows when lowered", "ȺȺȺ", "Bob", "bob", "ȺȺȺ <mark>Bob</mark>"},
+		{"match on grown runes", "ȺȺȺ", "Bob", "ⱥⱥ", "<mark>ȺȺ</mark>Ⱥ Bob"},
+		{"rune shrinks when lowered", "İlker", "Bob", "bob", "İlker <mark>Bob</mark>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, highlightName(tt.first, tt.last, tt.q))
+		})
+	}
+}
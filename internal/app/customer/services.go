@@ -1,27 +1,64 @@
 package customer
 
 import (
-	"errors"
+	"context"
+
+	"sinibeli/internal/app/audit"
+	"sinibeli/internal/infrastructure/cache"
+	"sinibeli/internal/pkg/apperr"
+	"sinibeli/internal/pkg/etag"
+	"sinibeli/internal/pkg/softdelete"
+	"sinibeli/internal/pkg/tracing"
 )
 
 var (
-	ErrNotFound = errors.New("customer not found")
+	ErrNotFound = apperr.New(apperr.NotFound, "customer_not_found", "customer not found")
 )
 
+// piiFields are the customer fields only callers with PII access see. Their
+// values also stay out of the audit log; a change to them is still recorded.
+var piiFields = []string{"birth_date", "email", "phone_number", "phone_e164", "address"}
+
 type CustomerService struct {
-	repo *CustomerRepo
+	repo        *CustomerRepo
+	photos      *PhotoService
+	cache       cache.Cache
+	invalidator *cache.Invalidator
+	audit       *audit.Recorder
+}
+
+func NewCustomerService(repo *CustomerRepo, photos *PhotoService, c cache.Cache, invalidator *cache.Invalidator, recorder *audit.Recorder) *CustomerService {
+	return &CustomerService{repo: repo, photos: photos, cache: c, invalidator: invalidator, audit: recorder}
 }
 
-func NewCustomerService(repo *CustomerRepo) *CustomerService {
-	return &CustomerService{repo: repo}
+func (s *CustomerService) record(ctx context.Context, action string, id int64, before, after interface{}) error {
+	return s.audit.Record(ctx, audit.Change{Entity: "customer", EntityID: id, Action: action, Before: before, After: after, Redact: piiFields})
 }
 
-func (s *CustomerService) Create(c *Customer) error {
-	return s.repo.Create(c)
+func (s *CustomerService) Create(ctx context.Context, c *Customer) error {
+	ctx, span := tracing.Start(ctx, "CustomerService.Create")
+	defer span.End()
+
+	if err := c.Normalize(); err != nil {
+		return err
+	}
+
+	if err := s.repo.Create(ctx, c); err != nil {
+		return err
+	}
+	s.invalidator.Publish(ctx, cache.EventCustomerChanged, c.ID)
+	return s.record(ctx, audit.ActionCreate, c.ID, nil, c)
 }
 
-func (s *CustomerService) GetByID(id int64) (Customer, error) {
-	c, err := s.repo.GetByID(id)
+func (s *CustomerService) GetByID(ctx context.Context, id int64, includeDeleted bool) (Customer, error) {
+	ctx, span := tracing.Start(ctx, "CustomerService.GetByID")
+	defer span.End()
+
+	get := s.repo.GetByID
+	if includeDeleted {
+		get = s.repo.GetByIDWithDeleted
+	}
+	c, err := get(ctx, id)
 	if err != nil {
 		return Customer{}, err
 	}
@@ -31,8 +68,25 @@ func (s *CustomerService) GetByID(id int64) (Customer, error) {
 	return *c, nil
 }
 
-func (s *CustomerService) GetAll() ([]Customer, error) {
-	customers, err := s.repo.GetAll()
+func (s *CustomerService) GetByEmail(ctx context.Context, email string) (Customer, error) {
+	ctx, span := tracing.Start(ctx, "CustomerService.GetByEmail")
+	defer span.End()
+
+	c, err := s.repo.GetByEmail(ctx, email)
+	if err != nil {
+		return Customer{}, err
+	}
+	if c == nil {
+		return Customer{}, ErrNotFound
+	}
+	return *c, nil
+}
+
+func (s *CustomerService) GetAll(ctx context.Context, includeDeleted bool) ([]Customer, error) {
+	ctx, span := tracing.Start(ctx, "CustomerService.GetAll")
+	defer span.End()
+
+	customers, err := s.repo.GetAll(ctx, includeDeleted)
 	if err != nil {
 		return []Customer{}, err
 	}
@@ -46,24 +100,211 @@ func (s *CustomerService) GetAll() ([]Customer, error) {
 	return result, nil
 }
 
-func (s *CustomerService) Update(c *Customer) error {
-	existing, err := s.repo.GetByID(c.ID)
+func (s *CustomerService) Search(ctx context.Context, filter SearchFilter) (SearchResponse, error) {
+	ctx, span := tracing.Start(ctx, "CustomerService.Search")
+	defer span.End()
+
+	if err := filter.Validate(); err != nil {
+		return SearchResponse{}, err
+	}
+
+	results, total, err := s.repo.Search(ctx, filter)
+	if err != nil {
+		return SearchResponse{}, err
+	}
+
+	totalPages := total / filter.PageSize
+	if total%filter.PageSize > 0 {
+		totalPages++
+	}
+
+	return SearchResponse{
+		Data: results,
+		Pagination: Pagination{
+			Page:       filter.Page,
+			PageSize:   filter.PageSize,
+			TotalItems: total,
+			TotalPages: totalPages,
+		},
+	}, nil
+}
+
+// Update overwrites the customer when ifMatch holds for its current version,
+// and fails with etag.ErrPreconditionFailed otherwise.
+func (s *CustomerService) Update(ctx context.Context, c *Customer, ifMatch etag.Precondition) error {
+	ctx, span := tracing.Start(ctx, "CustomerService.Update")
+	defer span.End()
+
+	if err := c.Normalize(); err != nil {
+		return err
+	}
+
+	existing, err := s.repo.GetByID(ctx, c.ID)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return ErrNotFound
+	}
+	if !ifMatch.Matches(existing.Version) {
+		return etag.ErrPreconditionFailed
+	}
+	moved := existing.CompanyID != c.CompanyID
+	attachments, err := s.repo.Update(ctx, c, existing.Version, moved)
+	if err != nil {
+		return err
+	}
+	s.invalidator.Publish(ctx, cache.EventCustomerChanged, c.ID)
+	if moved {
+		s.invalidator.Publish(ctx, cache.EventTransactionChanged, c.ID)
+		invalidateAttachments(ctx, s.cache, s.invalidator, attachments)
+	}
+	return s.record(ctx, audit.ActionUpdate, c.ID, existing, c)
+}
+
+// Patch applies edit to the customer's current state when ifMatch holds for
+// its version, and writes only the columns edit changed.
+func (s *CustomerService) Patch(ctx context.Context, id int64, ifMatch etag.Precondition, edit func(*Customer) error) (Customer, error) {
+	ctx, span := tracing.Start(ctx, "CustomerService.Patch")
+	defer span.End()
+
+	existing, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return Customer{}, err
+	}
+	if existing == nil {
+		return Customer{}, ErrNotFound
+	}
+	if !ifMatch.Matches(existing.Version) {
+		return Customer{}, etag.ErrPreconditionFailed
+	}
+
+	c := *existing
+	if err := edit(&c); err != nil {
+		return Customer{}, err
+	}
+	// Only what the patch touched is validated: rows written before the
+	// phone rules existed must stay editable without fixing the phone first.
+	for _, column := range changedColumns(existing, &c) {
+		switch column {
+		case "email":
+			err = c.normalizeEmail()
+		case "phone_number":
+			err = c.normalizePhone()
+		}
+		if err != nil {
+			return Customer{}, err
+		}
+	}
+	columns := changedColumns(existing, &c)
+	if len(columns) == 0 {
+		return c, nil
+	}
+	attachments, err := s.repo.Patch(ctx, &c, columns, existing.Version)
+	if err != nil {
+		return Customer{}, err
+	}
+	s.invalidator.Publish(ctx, cache.EventCustomerChanged, id)
+	if existing.CompanyID != c.CompanyID {
+		s.invalidator.Publish(ctx, cache.EventTransactionChanged, id)
+		invalidateAttachments(ctx, s.cache, s.invalidator, attachments)
+	}
+	if err := s.record(ctx, audit.ActionUpdate, id, existing, c); err != nil {
+		return Customer{}, err
+	}
+	return c, nil
+}
+
+func (s *CustomerService) Delete(ctx context.Context, id int64, ifMatch etag.Precondition) error {
+	ctx, span := tracing.Start(ctx, "CustomerService.Delete")
+	defer span.End()
+
+	existing, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return err
 	}
 	if existing == nil {
 		return ErrNotFound
 	}
-	return s.repo.Update(c)
+	if !ifMatch.Matches(existing.Version) {
+		return etag.ErrPreconditionFailed
+	}
+	deletedAt, err := s.repo.SoftDelete(ctx, id, existing.Version)
+	if err != nil {
+		return err
+	}
+	s.invalidator.Publish(ctx, cache.EventCustomerChanged, id)
+
+	deleted := *existing
+	deleted.DeletedAt = &deletedAt
+	return s.record(ctx, audit.ActionDelete, id, existing, deleted)
+}
+
+func (s *CustomerService) Restore(ctx context.Context, id int64) (Customer, error) {
+	ctx, span := tracing.Start(ctx, "CustomerService.Restore")
+	defer span.End()
+
+	existing, err := s.repo.GetByIDWithDeleted(ctx, id)
+	if err != nil {
+		return Customer{}, err
+	}
+	if existing == nil {
+		return Customer{}, ErrNotFound
+	}
+
+	version, restored, err := s.repo.Restore(ctx, id)
+	if err != nil {
+		return Customer{}, err
+	}
+	if !restored {
+		return Customer{}, softdelete.ErrNotDeleted
+	}
+	s.invalidator.Publish(ctx, cache.EventCustomerChanged, id)
+
+	c := *existing
+	c.DeletedAt = nil
+	c.Version = version
+	if err := s.record(ctx, audit.ActionRestore, id, existing, c); err != nil {
+		return Customer{}, err
+	}
+	return c, nil
 }
 
-func (s *CustomerService) Delete(id int64) error {
-	existing, err := s.repo.GetByID(id)
+// Purge hard-deletes the customer and its photo. It is refused with a
+// *softdelete.ReferencedError while anything still points at the customer.
+func (s *CustomerService) Purge(ctx context.Context, id int64, ifMatch etag.Precondition) error {
+	ctx, span := tracing.Start(ctx, "CustomerService.Purge")
+	defer span.End()
+
+	existing, err := s.repo.GetByIDWithDeleted(ctx, id)
 	if err != nil {
 		return err
 	}
 	if existing == nil {
 		return ErrNotFound
 	}
-	return s.repo.Delete(id)
+	if !ifMatch.Matches(existing.Version) {
+		return etag.ErrPreconditionFailed
+	}
+
+	refs, err := s.repo.References(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := softdelete.Check("customer", refs); err != nil {
+		return err
+	}
+
+	if err := s.repo.Purge(ctx, id, existing.Version); err != nil {
+		if !softdelete.IsForeignKeyViolation(err) {
+			return err
+		}
+		if refs, err = s.repo.References(ctx, id); err != nil {
+			return err
+		}
+		return &softdelete.ReferencedError{Entity: "customer", References: refs}
+	}
+	s.photos.removeObjects(ctx, existing.PhotoKey, existing.ThumbnailKey)
+	s.invalidator.Publish(ctx, cache.EventCustomerChanged, id)
+	return s.record(ctx, audit.ActionPurge, id, existing, nil)
 }
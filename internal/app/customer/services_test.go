@@ -0,0 +1,254 @@
+package customer
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"sinibeli/internal/app/audit"
+	"sinibeli/internal/app/rollup"
+	"sinibeli/internal/config"
+	"sinibeli/internal/infrastructure/cache"
+	"sinibeli/internal/pkg/apperr"
+	"sinibeli/internal/pkg/etag"
+	"sinibeli/internal/pkg/fieldcrypt"
+	logger "sinibeli/internal/pkg/logging"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// legacyCustomer is stored the way cmd/backfillphones leaves a phone it could
+// not parse: as entered, in plaintext, with no E.164 form.
+var legacyCustomer = []driver.Value{
+	int64(7), "Casey", "Pandey", nil, "casey.pandey@home.pl",
+	"997-474-3385", nil, "Jl. Sudirman No. 1", nil, int64(3),
+	nil, nil, false, nil, int64(1), nil,
+}
+
+func TestPatchKeepsLegacyPhone(t *testing.T) {
+	s, db := newPatchService(t)
+
+	c, err := s.Patch(context.Background(), 7, anyVersion(t), func(c *Customer) error {
+		c.Address = "Jl. Thamrin No. 2"
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Jl. Thamrin No. 2", c.Address)
+	assert.Equal(t, "997-474-3385", c.PhoneNumber)
+	assert.Equal(t, int64(2), c.Version)
+
+	update := db.update()
+	assert.Contains(t, update, "SET address = $1 WHERE")
+	assert.NotContains(t, update, "phone")
+}
+
+func TestPatchCompanyRebuildsRollup(t *testing.T) {
+	s, db := newPatchService(t)
+	ctx := context.Background()
+	metadataKey := fmt.Sprintf(cache.FileMetadataKey, "att-1")
+	require.NoError(t, s.cache.Set(ctx, metadataKey, "cached", time.Minute))
+
+	c, err := s.Patch(ctx, 7, anyVersion(t), func(c *Customer) error {
+		c.CompanyID = 4
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), c.CompanyID)
+	assert.Contains(t, db.update(), "SET company = $1 WHERE")
+	assert.True(t, db.ran("DELETE FROM transaction_daily_rollup"), "the days of the moved transactions are rebuilt")
+	assert.True(t, db.ran("UPDATE transaction_attachment SET company_id"), "the attachments follow the customer")
+
+	var cached string
+	assert.ErrorIs(t, s.cache.Get(ctx, metadataKey, &cached), cache.ErrCacheMiss, "the moved attachment's metadata is no longer cached")
+}
+
+func TestPatchWithoutMoveKeepsRollup(t *testing.T) {
+	s, db := newPatchService(t)
+
+	_, err := s.Patch(context.Background(), 7, anyVersion(t), func(c *Customer) error {
+		c.FirstName = "Kasey"
+		return nil
+	})
+	require.NoError(t, err)
+	assert.False(t, db.ran("FROM transaction WHERE customer_id"))
+	assert.False(t, db.ran("transaction_daily_rollup"))
+}
+
+func TestPatchValidatesChangedPhone(t *testing.T) {
+	s, db := newPatchService(t)
+
+	_, err := s.Patch(context.Background(), 7, anyVersion(t), func(c *Customer) error {
+		c.PhoneNumber = "not a phone"
+		return nil
+	})
+	var typed *apperr.Error
+	require.True(t, errors.As(err, &typed))
+	assert.Equal(t, "invalid_phone_number", typed.Code)
+	assert.Empty(t, db.update())
+}
+
+func anyVersion(t *testing.T) etag.Precondition {
+	p, err := etag.ParseIfMatch("*")
+	require.NoError(t, err)
+	return p
+}
+
+func newPatchService(t *testing.T) (*CustomerService, *fakeDB) {
+	db := newFakeDB(t, legacyCustomer)
+	repo := newTestRepo(t, db)
+	memory := cache.NewMemoryCache(100)
+	invalidator := cache.NewInvalidator(memory)
+	recorder := audit.NewRecorder(audit.NewAuditRepo(db.DB))
+	return NewCustomerService(repo, nil, memory, invalidator, recorder), db
+}
+
+// newTestRepo also sets up the logger, which the caches need as well.
+func newTestRepo(t *testing.T, db *fakeDB) *CustomerRepo {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	ring, err := fieldcrypt.LoadKeyring(config.EncryptionConfig{
+		Keys:          "test-1:" + strings.Repeat("A", 43) + "=",
+		ActiveKey:     "test-1",
+		BlindIndexKey: strings.Repeat("B", 43) + "=",
+	})
+	require.NoError(t, err)
+	return NewCustomerRepo(db.DB, fieldcrypt.NewCipher(ring), rollup.NewRollupRepo(db.DB, time.UTC))
+}
+
+// fakeDB is a database/sql driver that answers customer lookups with one
+// stored row, the customer's transactions with ID 11 on 1 March 2024, their
+// attachments with att-1 and every other RETURNING with 2. It remembers the
+// customer UPDATE and every statement run. With stale set, a customer UPDATE
+// finds the version already moved on.
+type fakeDB struct {
+	DB    *sql.DB
+	row   []driver.Value
+	stale bool
+
+	mu         sync.Mutex
+	updates    []string
+	statements []string
+}
+
+var (
+	registerFake sync.Once
+	fakeDBs      sync.Map
+)
+
+func newFakeDB(t *testing.T, row []driver.Value) *fakeDB {
+	d := &fakeDB{row: row}
+	registerFake.Do(func() { sql.Register("customer-fake", fakeDriver{}) })
+	fakeDBs.Store(t.Name(), d)
+
+	db, err := sql.Open("customer-fake", t.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	d.DB = db
+	return d
+}
+
+func (d *fakeDB) ran(fragment string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, stmt := range d.statements {
+		if strings.Contains(stmt, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *fakeDB) log(stmt string) {
+	d.mu.Lock()
+	d.statements = append(d.statements, stmt)
+	d.mu.Unlock()
+}
+
+func (d *fakeDB) update() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return strings.Join(d.updates, "\n")
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	d, ok := fakeDBs.Load(name)
+	if !ok {
+		return nil, errors.New("no fake database " + name)
+	}
+	return &fakeConn{db: d.(*fakeDB)}, nil
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *fakeConn) Commit() error             { return nil }
+func (c *fakeConn) Rollback() error           { return nil }
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.db.log(query)
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.db.log(query)
+	switch {
+	case strings.Contains(query, "WHERE photo IS NOT NULL"):
+		if args[0].Value.(int64) >= c.db.row[0].(int64) {
+			return &fakeRows{}, nil
+		}
+		return &fakeRows{row: []driver.Value{c.db.row[0], c.db.row[14], legacyPhoto}}, nil
+	case strings.Contains(query, "FROM transaction WHERE customer_id"):
+		return &fakeRows{row: []driver.Value{int64(11)}}, nil
+	case strings.Contains(query, "SELECT DISTINCT"):
+		return &fakeRows{row: []driver.Value{time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)}}, nil
+	case strings.Contains(query, "UPDATE transaction_attachment"):
+		return &fakeRows{row: []driver.Value{"att-1", int64(11)}}, nil
+	case strings.Contains(query, "UPDATE customer"):
+		c.db.mu.Lock()
+		c.db.updates = append(c.db.updates, query)
+		c.db.mu.Unlock()
+		if c.db.stale {
+			return &fakeRows{}, nil
+		}
+		return &fakeRows{row: []driver.Value{int64(2)}}, nil
+	case strings.Contains(query, "FROM customer WHERE id"):
+		if strings.Contains(query, "deleted_at IS NULL") && c.db.row[15] != nil {
+			return &fakeRows{}, nil
+		}
+		return &fakeRows{row: c.db.row}, nil
+	case strings.Contains(query, "RETURNING"):
+		return &fakeRows{row: []driver.Value{int64(2)}}, nil
+	}
+	return &fakeRows{}, nil
+}
+
+type fakeRows struct {
+	row  []driver.Value
+	done bool
+}
+
+func (r *fakeRows) Columns() []string { return make([]string, len(r.row)) }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done || r.row == nil {
+		return io.EOF
+	}
+	r.done = true
+	copy(dest, r.row)
+	return nil
+}
@@ -0,0 +1,125 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"sinibeli/internal/infrastructure/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+	StatusDown     = "down"
+	StatusDraining = "draining"
+)
+
+type Check struct {
+	Name     string
+	Critical bool
+	Run      func(ctx context.Context) error
+}
+
+type CheckResult struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	Critical  bool    `json:"critical"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+type HealthHandler struct {
+	checks   []Check
+	timeout  time.Duration
+	draining atomic.Bool
+}
+
+func NewHealthHandler(db *sql.DB, appCache cache.Cache, timeout time.Duration) *HealthHandler {
+	return &HealthHandler{
+		timeout: timeout,
+		checks: []Check{
+			{Name: "postgres", Critical: true, Run: db.PingContext},
+			{Name: "cache", Critical: false, Run: appCache.Ping},
+		},
+	}
+}
+
+// SetDraining makes readiness fail from now on, so load balancers stop
+// routing new requests while in-flight ones finish.
+func (h *HealthHandler) SetDraining() {
+	h.draining.Store(true)
+}
+
+func (h *HealthHandler) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": StatusOK})
+}
+
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	if h.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, Report{Status: StatusDraining, Checks: []CheckResult{}})
+		return
+	}
+
+	report := h.run(c.Request.Context())
+	if report.Status == StatusDown {
+		c.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// run executes every check concurrently under one deadline. A failing
+// critical dependency makes the instance unready; a failing optional one
+// (the cache degrades to the database) only marks it degraded.
+func (h *HealthHandler) run(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	results := make([]CheckResult, len(h.checks))
+	var wg sync.WaitGroup
+	for i, check := range h.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := check.Run(ctx)
+			result := CheckResult{
+				Name:      check.Name,
+				Status:    StatusOK,
+				Critical:  check.Critical,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				result.Status = StatusDown
+				result.Error = err.Error()
+			}
+			results[i] = result
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: results}
+	for _, result := range results {
+		if result.Status == StatusOK {
+			continue
+		}
+		if result.Critical {
+			report.Status = StatusDown
+			break
+		}
+		report.Status = StatusDegraded
+	}
+	return report
+}
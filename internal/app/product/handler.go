@@ -4,9 +4,19 @@ import (
 	"net/http"
 	"strconv"
 
+	"sinibeli/internal/pkg/apperr"
+	"sinibeli/internal/pkg/etag"
+	"sinibeli/internal/pkg/patch"
+	"sinibeli/internal/pkg/request"
+
 	"github.com/gin-gonic/gin"
 )
 
+var (
+	errInvalidID         = apperr.InvalidParam("id", "invalid product ID")
+	errInvalidServiceFee = apperr.InvalidParam("service_fee", "invalid service_fee format")
+)
+
 type ProductHandler struct {
 	service *ProductService
 }
@@ -17,56 +27,58 @@ func NewProductHandler(service *ProductService) *ProductHandler {
 
 func (h *ProductHandler) Create(c *gin.Context) {
 
-	if err := c.ShouldBindJSON(&CreateProductReq); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	req, ok := request.BindJSON[CreateProductReq](c)
+	if !ok {
 		return
 	}
 
-	serviceFee, err := strconv.ParseFloat(CreateProductReq.ServiceFee, 64)
+	serviceFee, err := strconv.ParseFloat(req.ServiceFee, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid service_fee format"})
+		c.Error(errInvalidServiceFee)
 		return
 	}
 
 	product := &Product{
-		ID:                   CreateProductReq.ID,
-		ProductName:          CreateProductReq.ProductName,
+		ID:                   req.ID,
+		ProductName:          req.ProductName,
 		ServiceFee:           serviceFee,
-		ServiceFeePercentage: CreateProductReq.ServiceFeePercentage,
+		ServiceFeePercentage: req.ServiceFeePercentage,
 	}
 
-	if err := h.service.Create(product); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.service.Create(c.Request.Context(), product); err != nil {
+		c.Error(err)
 		return
 	}
 
+	c.Header("ETag", etag.Format(product.Version))
 	c.JSON(http.StatusCreated, product)
 }
 
 func (h *ProductHandler) GetByID(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+		c.Error(errInvalidID)
 		return
 	}
 
-	product, err := h.service.GetByID(id)
+	product, err := h.service.GetByID(c.Request.Context(), id, c.Query("include_deleted") == "true")
 	if err != nil {
-		if err == ErrNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
+	c.Header("ETag", etag.Format(product.Version))
+	if etag.NoneMatch(c.GetHeader("If-None-Match"), product.Version) {
+		c.Status(http.StatusNotModified)
+		return
+	}
 	c.JSON(http.StatusOK, product)
 }
 
 func (h *ProductHandler) GetAll(c *gin.Context) {
-	products, err := h.service.GetAll()
+	products, err := h.service.GetAll(c.Request.Context(), c.Query("include_deleted") == "true")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, products)
@@ -75,55 +87,135 @@ func (h *ProductHandler) GetAll(c *gin.Context) {
 func (h *ProductHandler) Update(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+		c.Error(errInvalidID)
+		return
+	}
+
+	ifMatch, err := etag.ParseIfMatch(c.GetHeader("If-Match"))
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
-	if err := c.ShouldBindJSON(&UpdateProductReq); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	req, ok := request.BindJSON[UpdateProductReq](c)
+	if !ok {
 		return
 	}
 
-	serviceFee, err := strconv.ParseFloat(UpdateProductReq.ServiceFee, 64)
+	serviceFee, err := strconv.ParseFloat(req.ServiceFee, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid service_fee format"})
+		c.Error(errInvalidServiceFee)
 		return
 	}
 
 	product := &Product{
 		ID:                   id,
-		ProductName:          UpdateProductReq.ProductName,
+		ProductName:          req.ProductName,
 		ServiceFee:           serviceFee,
-		ServiceFeePercentage: UpdateProductReq.ServiceFeePercentage,
+		ServiceFeePercentage: req.ServiceFeePercentage,
+	}
+
+	if err := h.service.Update(c.Request.Context(), product, ifMatch); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Header("ETag", etag.Format(product.Version))
+	c.JSON(http.StatusOK, product)
+}
+
+// Patch applies a JSON Merge Patch or JSON Patch to the product. Members the
+// patch leaves out keep their values, and the result must pass the same
+// validation as a full update.
+func (h *ProductHandler) Patch(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errInvalidID)
+		return
+	}
+
+	ifMatch, err := etag.ParseIfMatch(c.GetHeader("If-Match"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		c.Error(request.ErrUnreadableBody.WithCause(err))
+		return
+	}
+	doc, err := patch.Parse(c.ContentType(), body)
+	if err != nil {
+		c.Error(err)
+		return
 	}
 
-	if err := h.service.Update(product); err != nil {
-		if err == ErrNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
-			return
+	product, err := h.service.Patch(c.Request.Context(), id, ifMatch, func(p *Product) error {
+		fields := ProductFields{
+			ProductName:          p.ProductName,
+			ServiceFee:           p.ServiceFee,
+			ServiceFeePercentage: p.ServiceFeePercentage,
+		}
+		if err := doc.ApplyTo(&fields); err != nil {
+			return err
+		}
+		if err := request.Validate(&fields); err != nil {
+			return err
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		p.ProductName, p.ServiceFee, p.ServiceFeePercentage = fields.ProductName, fields.ServiceFee, fields.ServiceFeePercentage
+		return nil
+	})
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
+	c.Header("ETag", etag.Format(product.Version))
 	c.JSON(http.StatusOK, product)
 }
 
+// Delete soft-deletes the product; ?purge=true removes it for good, which is
+// refused with the reference counts while anything still points at it.
 func (h *ProductHandler) Delete(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+		c.Error(errInvalidID)
 		return
 	}
 
-	if err := h.service.Delete(id); err != nil {
-		if err == ErrNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	ifMatch, err := etag.ParseIfMatch(c.GetHeader("If-Match"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if c.Query("purge") == "true" {
+		err = h.service.Purge(c.Request.Context(), id, ifMatch)
+	} else {
+		err = h.service.Delete(c.Request.Context(), id, ifMatch)
+	}
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusNoContent, nil)
 }
+
+func (h *ProductHandler) Restore(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(errInvalidID)
+		return
+	}
+
+	product, err := h.service.Restore(c.Request.Context(), id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Header("ETag", etag.Format(product.Version))
+	c.JSON(http.StatusOK, product)
+}
@@ -1,21 +1,33 @@
 package product
 
+import "time"
+
 type Product struct {
-	ID                   int64   `json:"id"`
-	ProductName          string  `json:"product_name"`
-	ServiceFee           float64 `json:"service_fee"`
-	ServiceFeePercentage bool    `json:"service_fee_percentage"`
+	ID                   int64      `json:"id"`
+	ProductName          string     `json:"product_name"`
+	ServiceFee           float64    `json:"service_fee"`
+	ServiceFeePercentage bool       `json:"service_fee_percentage"`
+	Version              int64      `json:"version"`
+	DeletedAt            *time.Time `json:"deleted_at,omitempty"`
 }
 
-var CreateProductReq struct {
+type CreateProductReq struct {
 	ID                   int64  `json:"id" binding:"required"`
 	ProductName          string `json:"product_name" binding:"required,max=100"`
 	ServiceFee           string `json:"service_fee" binding:"required"`
 	ServiceFeePercentage bool   `json:"service_fee_percentage" binding:"required"`
 }
 
-var UpdateProductReq struct {
+type UpdateProductReq struct {
 	ProductName          string `json:"product_name" binding:"required,max=100"`
 	ServiceFee           string `json:"service_fee" binding:"required"`
 	ServiceFeePercentage bool   `json:"service_fee_percentage" binding:"required"`
 }
+
+// ProductFields is what a PATCH can change. service_fee is a number here, as
+// products are read, rather than the string create and update take.
+type ProductFields struct {
+	ProductName          string  `json:"product_name" binding:"required,max=100"`
+	ServiceFee           float64 `json:"service_fee" binding:"gte=0"`
+	ServiceFeePercentage bool    `json:"service_fee_percentage"`
+}
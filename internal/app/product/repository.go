@@ -1,40 +1,59 @@
 package product
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
+
+	"sinibeli/internal/app/rollup"
+	"sinibeli/internal/pkg/etag"
 )
 
 type ProductRepo struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Rollup *rollup.RollupRepo
 }
 
-func NewProductRepo(db *sql.DB) *ProductRepo {
-	return &ProductRepo{DB: db}
+func NewProductRepo(db *sql.DB, rollupRepo *rollup.RollupRepo) *ProductRepo {
+	return &ProductRepo{DB: db, Rollup: rollupRepo}
 }
 
-func (r *ProductRepo) Create(p *Product) error {
+func (r *ProductRepo) Create(ctx context.Context, p *Product) error {
 	query := `
 		INSERT INTO product (id, product_name, service_fee, service_fee_percentage)
-		VALUES ($1, $2, $3, $4)`
-	_, err := r.DB.Exec(query, p.ID, p.ProductName, p.ServiceFee, p.ServiceFeePercentage)
-	if err != nil {
+		VALUES ($1, $2, $3, $4)
+		RETURNING version`
+	row := r.DB.QueryRowContext(ctx, query, p.ID, p.ProductName, p.ServiceFee, p.ServiceFeePercentage)
+	if err := row.Scan(&p.Version); err != nil {
 		return fmt.Errorf("failed to create product: %w", err)
 	}
 	return nil
 }
 
-func (r *ProductRepo) GetByID(id int64) (*Product, error) {
+// GetByID only finds products that are not soft-deleted; use
+// GetByIDWithDeleted where a deleted product must be visible too.
+func (r *ProductRepo) GetByID(ctx context.Context, id int64) (*Product, error) {
+	return r.getByID(ctx, id, false)
+}
+
+func (r *ProductRepo) GetByIDWithDeleted(ctx context.Context, id int64) (*Product, error) {
+	return r.getByID(ctx, id, true)
+}
+
+func (r *ProductRepo) getByID(ctx context.Context, id int64, includeDeleted bool) (*Product, error) {
 	query := `
-		SELECT id, product_name, service_fee, service_fee_percentage
-		FROM product WHERE id = $1`
-	row := r.DB.QueryRow(query, id)
+		SELECT id, product_name, service_fee, service_fee_percentage, version, deleted_at
+		FROM product WHERE id = $1 AND ($2 OR deleted_at IS NULL)`
+	row := r.DB.QueryRowContext(ctx, query, id, includeDeleted)
 
 	var p Product
 	var serviceFee float64
 	var isPercentage bool
+	var deletedAt sql.NullTime
 
-	err := row.Scan(&p.ID, &p.ProductName, &serviceFee, &isPercentage)
+	err := row.Scan(&p.ID, &p.ProductName, &serviceFee, &isPercentage, &p.Version, &deletedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -43,15 +62,18 @@ func (r *ProductRepo) GetByID(id int64) (*Product, error) {
 	}
 	p.ServiceFee = serviceFee
 	p.ServiceFeePercentage = isPercentage
+	if deletedAt.Valid {
+		p.DeletedAt = &deletedAt.Time
+	}
 
 	return &p, nil
 }
 
-func (r *ProductRepo) GetAll() ([]*Product, error) {
+func (r *ProductRepo) GetAll(ctx context.Context, includeDeleted bool) ([]*Product, error) {
 	query := `
-		SELECT id, product_name, service_fee, service_fee_percentage
-		FROM product`
-	rows, err := r.DB.Query(query)
+		SELECT id, product_name, service_fee, service_fee_percentage, version, deleted_at
+		FROM product WHERE $1 OR deleted_at IS NULL`
+	rows, err := r.DB.QueryContext(ctx, query, includeDeleted)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query products: %w", err)
 	}
@@ -62,13 +84,17 @@ func (r *ProductRepo) GetAll() ([]*Product, error) {
 		var p Product
 		var serviceFee float64
 		var isPercentage bool
+		var deletedAt sql.NullTime
 
-		err := rows.Scan(&p.ID, &p.ProductName, &serviceFee, &isPercentage)
+		err := rows.Scan(&p.ID, &p.ProductName, &serviceFee, &isPercentage, &p.Version, &deletedAt)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan product row: %w", err)
 		}
 		p.ServiceFee = serviceFee
 		p.ServiceFeePercentage = isPercentage
+		if deletedAt.Valid {
+			p.DeletedAt = &deletedAt.Time
+		}
 
 		products = append(products, &p)
 	}
@@ -80,32 +106,138 @@ func (r *ProductRepo) GetAll() ([]*Product, error) {
 	return products, nil
 }
 
-func (r *ProductRepo) Update(p *Product) error {
+// Update only applies while the product is still at version, and sets the
+// version it moved to on p. etag.ErrPreconditionFailed means another write
+// got there first. feeChanged rebuilds the product's rollup buckets.
+func (r *ProductRepo) Update(ctx context.Context, p *Product, version int64, feeChanged bool) error {
 	query := `
 		UPDATE product
 		SET product_name = $1, service_fee = $2, service_fee_percentage = $3
-		WHERE id = $4`
-	res, err := r.DB.Exec(query, p.ProductName, p.ServiceFee, p.ServiceFeePercentage, p.ID)
-	if err != nil {
-		return fmt.Errorf("failed to update product: %w", err)
+		WHERE id = $4 AND version = $5 AND deleted_at IS NULL
+		RETURNING version`
+	return r.write(ctx, p, feeChanged, "update", query, p.ProductName, p.ServiceFee, p.ServiceFeePercentage, p.ID, version)
+}
+
+// Patch writes only the given columns of p, under the same version check as
+// Update.
+func (r *ProductRepo) Patch(ctx context.Context, p *Product, columns []string, version int64) error {
+	values := map[string]interface{}{
+		"product_name":           p.ProductName,
+		"service_fee":            p.ServiceFee,
+		"service_fee_percentage": p.ServiceFeePercentage,
 	}
 
-	rowsAffected, err := res.RowsAffected()
+	set := make([]string, len(columns))
+	args := make([]interface{}, 0, len(columns)+2)
+	for i, column := range columns {
+		args = append(args, values[column])
+		set[i] = fmt.Sprintf("%s = $%d", column, len(args))
+	}
+	args = append(args, p.ID, version)
+
+	query := fmt.Sprintf(`UPDATE product SET %s WHERE id = $%d AND version = $%d AND deleted_at IS NULL RETURNING version`,
+		strings.Join(set, ", "), len(args)-1, len(args))
+	feeChanged := false
+	for _, column := range columns {
+		feeChanged = feeChanged || column == "service_fee" || column == "service_fee_percentage"
+	}
+	return r.write(ctx, p, feeChanged, "patch", query, args...)
+}
+
+// write runs an UPDATE of the product that returns the new version. When the
+// fee may have changed, the product's rollup buckets are rebuilt in the same
+// database transaction so reports charge the fee the raw rows are read with.
+func (r *ProductRepo) write(ctx context.Context, p *Product, feeChanged bool, op, query string, args ...interface{}) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return fmt.Errorf("failed to begin product %s: %w", op, err)
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("no product found with id %d", p.ID)
+	defer tx.Rollback()
+
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&p.Version); err != nil {
+		if err == sql.ErrNoRows {
+			return etag.ErrPreconditionFailed
+		}
+		return fmt.Errorf("failed to %s product: %w", op, err)
 	}
 
+	if feeChanged {
+		if err := r.Rollup.RebuildProduct(ctx, tx, p.ID); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit product %s: %w", op, err)
+	}
 	return nil
 }
 
-func (r *ProductRepo) Delete(id int64) error {
-	query := `DELETE FROM product WHERE id = $1`
-	res, err := r.DB.Exec(query, id)
+// changedColumns lists the columns whose values differ between two states of
+// a product.
+func changedColumns(before, after *Product) []string {
+	var columns []string
+	if before.ProductName != after.ProductName {
+		columns = append(columns, "product_name")
+	}
+	if before.ServiceFee != after.ServiceFee {
+		columns = append(columns, "service_fee")
+	}
+	if before.ServiceFeePercentage != after.ServiceFeePercentage {
+		columns = append(columns, "service_fee_percentage")
+	}
+	return columns
+}
+
+// SoftDelete stamps deleted_at on the product at version and returns it.
+func (r *ProductRepo) SoftDelete(ctx context.Context, id, version int64) (time.Time, error) {
+	query := `UPDATE product SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND version = $2 AND deleted_at IS NULL RETURNING deleted_at`
+
+	var deletedAt time.Time
+	if err := r.DB.QueryRowContext(ctx, query, id, version).Scan(&deletedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return time.Time{}, etag.ErrPreconditionFailed
+		}
+		return time.Time{}, fmt.Errorf("failed to delete product: %w", err)
+	}
+	return deletedAt, nil
+}
+
+// Restore clears deleted_at and returns the version it moved the product to;
+// restored is false when the product was not deleted.
+func (r *ProductRepo) Restore(ctx context.Context, id int64) (version int64, restored bool, err error) {
+	query := `UPDATE product SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL RETURNING version`
+	if err := r.DB.QueryRowContext(ctx, query, id).Scan(&version); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("failed to restore product: %w", err)
+	}
+	return version, true, nil
+}
+
+// References counts the rows that keep the product from being purged.
+func (r *ProductRepo) References(ctx context.Context, id int64) (map[string]int64, error) {
+	query := `
+		SELECT (SELECT COUNT(*) FROM transaction WHERE product_id = $1),
+		       (SELECT COUNT(*) FROM transaction_daily_rollup WHERE product_id = $1)`
+
+	var transactions, rollups int64
+	if err := r.DB.QueryRowContext(ctx, query, id).Scan(&transactions, &rollups); err != nil {
+		return nil, fmt.Errorf("failed to count product references: %w", err)
+	}
+	return map[string]int64{
+		"transactions": transactions,
+		"rollup_rows":  rollups,
+	}, nil
+}
+
+// Purge removes the product row at version for good, deleted or not.
+func (r *ProductRepo) Purge(ctx context.Context, id, version int64) error {
+	query := `DELETE FROM product WHERE id = $1 AND version = $2`
+	res, err := r.DB.ExecContext(ctx, query, id, version)
 	if err != nil {
-		return fmt.Errorf("failed to delete product: %w", err)
+		return fmt.Errorf("failed to purge product: %w", err)
 	}
 
 	rowsAffected, err := res.RowsAffected()
@@ -113,7 +245,7 @@ func (r *ProductRepo) Delete(id int64) error {
 		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
 	if rowsAffected == 0 {
-		return fmt.Errorf("no product found with id %d", id)
+		return etag.ErrPreconditionFailed
 	}
 
 	return nil
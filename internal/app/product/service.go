@@ -1,70 +1,255 @@
 package product
 
 import (
-	"errors"
+	"context"
+	"fmt"
+
+	"sinibeli/internal/app/audit"
+	"sinibeli/internal/infrastructure/cache"
+	"sinibeli/internal/pkg/apperr"
+	"sinibeli/internal/pkg/etag"
+	"sinibeli/internal/pkg/softdelete"
+	"sinibeli/internal/pkg/tracing"
 )
 
 var (
-	ErrNotFound = errors.New("product not found")
+	ErrNotFound = apperr.New(apperr.NotFound, "product_not_found", "product not found")
 )
 
 type ProductService struct {
-	repo *ProductRepo
+	repo        *ProductRepo
+	cache       cache.Cache
+	invalidator *cache.Invalidator
+	audit       *audit.Recorder
 }
 
-func NewProductService(repo *ProductRepo) *ProductService {
-	return &ProductService{repo: repo}
+func NewProductService(repo *ProductRepo, appCache cache.Cache, invalidator *cache.Invalidator, recorder *audit.Recorder) *ProductService {
+	return &ProductService{repo: repo, cache: appCache, invalidator: invalidator, audit: recorder}
 }
 
-func (s *ProductService) Create(p *Product) error {
+func (s *ProductService) Create(ctx context.Context, p *Product) error {
+	ctx, span := tracing.Start(ctx, "ProductService.Create")
+	defer span.End()
 
-	return s.repo.Create(p)
+	if err := s.repo.Create(ctx, p); err != nil {
+		return err
+	}
+	s.invalidator.Publish(ctx, cache.EventProductChanged, p.ID)
+	return s.audit.Record(ctx, audit.Change{Entity: "product", EntityID: p.ID, Action: audit.ActionCreate, After: p})
 }
 
-func (s *ProductService) GetByID(id int64) (Product, error) {
-	p, err := s.repo.GetByID(id)
+// GetByID returns the product unless it is soft-deleted. Including deleted
+// products skips the cache, which only ever holds live ones.
+func (s *ProductService) GetByID(ctx context.Context, id int64, includeDeleted bool) (Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.GetByID")
+	defer span.End()
+
+	if includeDeleted {
+		p, err := s.repo.GetByIDWithDeleted(ctx, id)
+		if err != nil {
+			return Product{}, err
+		}
+		if p == nil {
+			return Product{}, ErrNotFound
+		}
+		return *p, nil
+	}
+
+	var p Product
+	err := s.cache.GetOrSet(ctx, fmt.Sprintf(cache.ProductKey, fmt.Sprint(id)), &p, cache.ProductTTL, func(ctx context.Context) (interface{}, error) {
+		p, err := s.repo.GetByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			return nil, ErrNotFound
+		}
+		return p, nil
+	})
 	if err != nil {
 		return Product{}, err
 	}
-	if p == nil {
-		return Product{}, ErrNotFound
-	}
-	return *p, nil
+	return p, nil
 }
 
-func (s *ProductService) GetAll() ([]Product, error) {
-	products, err := s.repo.GetAll()
-	if err != nil {
-		return []Product{}, err
+func (s *ProductService) GetAll(ctx context.Context, includeDeleted bool) ([]Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.GetAll")
+	defer span.End()
+
+	listKey := "all"
+	if includeDeleted {
+		listKey = "with-deleted"
 	}
 
-	result := make([]Product, len(products))
-	for i, p := range products {
-		if p != nil {
-			result[i] = *p
+	var result []Product
+	err := s.cache.GetOrSet(ctx, fmt.Sprintf(cache.ProductListKey, listKey), &result, cache.ProductListTTL, func(ctx context.Context) (interface{}, error) {
+		products, err := s.repo.GetAll(ctx, includeDeleted)
+		if err != nil {
+			return nil, err
+		}
+
+		result := make([]Product, len(products))
+		for i, p := range products {
+			if p != nil {
+				result[i] = *p
+			}
 		}
+		return result, nil
+	})
+	if err != nil {
+		return []Product{}, err
 	}
 	return result, nil
 }
 
-func (s *ProductService) Update(p *Product) error {
-	existing, err := s.repo.GetByID(p.ID)
+// Update overwrites the product when ifMatch holds for its current version,
+// and fails with etag.ErrPreconditionFailed otherwise.
+func (s *ProductService) Update(ctx context.Context, p *Product, ifMatch etag.Precondition) error {
+	ctx, span := tracing.Start(ctx, "ProductService.Update")
+	defer span.End()
+
+	existing, err := s.repo.GetByID(ctx, p.ID)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return ErrNotFound
+	}
+	if !ifMatch.Matches(existing.Version) {
+		return etag.ErrPreconditionFailed
+	}
+	feeChanged := existing.ServiceFee != p.ServiceFee || existing.ServiceFeePercentage != p.ServiceFeePercentage
+	if err := s.repo.Update(ctx, p, existing.Version, feeChanged); err != nil {
+		return err
+	}
+	s.invalidator.Publish(ctx, cache.EventProductChanged, p.ID)
+	return s.audit.Record(ctx, audit.Change{Entity: "product", EntityID: p.ID, Action: audit.ActionUpdate, Before: existing, After: p})
+}
+
+// Patch applies edit to the product's current state when ifMatch holds for
+// its version, and writes only the columns edit changed.
+func (s *ProductService) Patch(ctx context.Context, id int64, ifMatch etag.Precondition, edit func(*Product) error) (Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.Patch")
+	defer span.End()
+
+	existing, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return Product{}, err
+	}
+	if existing == nil {
+		return Product{}, ErrNotFound
+	}
+	if !ifMatch.Matches(existing.Version) {
+		return Product{}, etag.ErrPreconditionFailed
+	}
+
+	p := *existing
+	if err := edit(&p); err != nil {
+		return Product{}, err
+	}
+	columns := changedColumns(existing, &p)
+	if len(columns) == 0 {
+		return p, nil
+	}
+	if err := s.repo.Patch(ctx, &p, columns, existing.Version); err != nil {
+		return Product{}, err
+	}
+	s.invalidator.Publish(ctx, cache.EventProductChanged, id)
+	if err := s.audit.Record(ctx, audit.Change{Entity: "product", EntityID: id, Action: audit.ActionUpdate, Before: existing, After: p}); err != nil {
+		return Product{}, err
+	}
+	return p, nil
+}
+
+func (s *ProductService) Delete(ctx context.Context, id int64, ifMatch etag.Precondition) error {
+	ctx, span := tracing.Start(ctx, "ProductService.Delete")
+	defer span.End()
+
+	existing, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return err
 	}
 	if existing == nil {
 		return ErrNotFound
 	}
-	return s.repo.Update(p)
+	if !ifMatch.Matches(existing.Version) {
+		return etag.ErrPreconditionFailed
+	}
+	deletedAt, err := s.repo.SoftDelete(ctx, id, existing.Version)
+	if err != nil {
+		return err
+	}
+	s.invalidator.Publish(ctx, cache.EventProductChanged, id)
+
+	deleted := *existing
+	deleted.DeletedAt = &deletedAt
+	return s.audit.Record(ctx, audit.Change{Entity: "product", EntityID: id, Action: audit.ActionDelete, Before: existing, After: deleted})
+}
+
+func (s *ProductService) Restore(ctx context.Context, id int64) (Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.Restore")
+	defer span.End()
+
+	existing, err := s.repo.GetByIDWithDeleted(ctx, id)
+	if err != nil {
+		return Product{}, err
+	}
+	if existing == nil {
+		return Product{}, ErrNotFound
+	}
+
+	version, restored, err := s.repo.Restore(ctx, id)
+	if err != nil {
+		return Product{}, err
+	}
+	if !restored {
+		return Product{}, softdelete.ErrNotDeleted
+	}
+	s.invalidator.Publish(ctx, cache.EventProductChanged, id)
+
+	p := *existing
+	p.DeletedAt = nil
+	p.Version = version
+	if err := s.audit.Record(ctx, audit.Change{Entity: "product", EntityID: id, Action: audit.ActionRestore, Before: existing, After: p}); err != nil {
+		return Product{}, err
+	}
+	return p, nil
 }
 
-func (s *ProductService) Delete(id int64) error {
-	existing, err := s.repo.GetByID(id)
+// Purge hard-deletes the product. It is refused with a
+// *softdelete.ReferencedError while anything still points at the product.
+func (s *ProductService) Purge(ctx context.Context, id int64, ifMatch etag.Precondition) error {
+	ctx, span := tracing.Start(ctx, "ProductService.Purge")
+	defer span.End()
+
+	existing, err := s.repo.GetByIDWithDeleted(ctx, id)
 	if err != nil {
 		return err
 	}
 	if existing == nil {
 		return ErrNotFound
 	}
-	return s.repo.Delete(id)
+	if !ifMatch.Matches(existing.Version) {
+		return etag.ErrPreconditionFailed
+	}
+
+	refs, err := s.repo.References(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := softdelete.Check("product", refs); err != nil {
+		return err
+	}
+
+	if err := s.repo.Purge(ctx, id, existing.Version); err != nil {
+		if !softdelete.IsForeignKeyViolation(err) {
+			return err
+		}
+		if refs, err = s.repo.References(ctx, id); err != nil {
+			return err
+		}
+		return &softdelete.ReferencedError{Entity: "product", References: refs}
+	}
+	s.invalidator.Publish(ctx, cache.EventProductChanged, id)
+	return s.audit.Record(ctx, audit.Change{Entity: "product", EntityID: id, Action: audit.ActionPurge, Before: existing})
 }
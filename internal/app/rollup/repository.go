@@ -0,0 +1,209 @@
+package rollup
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const dateLayout = "2006-01-02"
+
+const feeExpression = `CASE WHEN p.service_fee_percentage THEN t.amount * p.service_fee / 100 ELSE p.service_fee END`
+
+type RollupRepo struct {
+	DB       *sql.DB
+	Location *time.Location
+}
+
+func NewRollupRepo(db *sql.DB, loc *time.Location) *RollupRepo {
+	return &RollupRepo{DB: db, Location: loc}
+}
+
+// ApplyTransaction folds a freshly inserted transaction into its daily bucket.
+// It must run in the same database transaction as the insert so the rollup
+// never drifts from the source rows.
+func (r *RollupRepo) ApplyTransaction(ctx context.Context, tx *sql.Tx, transactionID int64) error {
+	query := `
+		INSERT INTO transaction_daily_rollup AS r (
+			day, company_id, product_id, transaction_type, payment_status,
+			trx_count, amount, tax_amount, fee_amount,
+			first_trx_on, id_first_trx, last_trx_on, id_last_trx
+		)
+		SELECT
+			((t.transaction_datetime AT TIME ZONE 'UTC') AT TIME ZONE $2)::date,
+			cu.company,
+			p.id,
+			t.transaction_type,
+			t.payment_status,
+			1,
+			t.amount,
+			t.tax_amount,
+			` + feeExpression + `,
+			t.transaction_datetime,
+			t.id,
+			t.transaction_datetime,
+			t.id
+		FROM transaction t
+			INNER JOIN customer cu ON cu.id = t.customer_id
+			INNER JOIN product p ON p.id = t.product_id
+		WHERE t.id = $1
+		ON CONFLICT (day, company_id, product_id, transaction_type, payment_status) DO UPDATE SET
+			trx_count = r.trx_count + EXCLUDED.trx_count,
+			amount = r.amount + EXCLUDED.amount,
+			tax_amount = r.tax_amount + EXCLUDED.tax_amount,
+			fee_amount = r.fee_amount + EXCLUDED.fee_amount,
+			id_first_trx = CASE
+				WHEN (EXCLUDED.first_trx_on, EXCLUDED.id_first_trx) < (r.first_trx_on, r.id_first_trx)
+				THEN EXCLUDED.id_first_trx ELSE r.id_first_trx END,
+			first_trx_on = LEAST(r.first_trx_on, EXCLUDED.first_trx_on),
+			id_last_trx = CASE
+				WHEN (EXCLUDED.last_trx_on, EXCLUDED.id_last_trx) > (r.last_trx_on, r.id_last_trx)
+				THEN EXCLUDED.id_last_trx ELSE r.id_last_trx END,
+			last_trx_on = GREATEST(r.last_trx_on, EXCLUDED.last_trx_on),
+			refreshed_at = CURRENT_TIMESTAMP`
+
+	_, err := tx.ExecContext(ctx, query, transactionID, r.Location.String())
+	if err != nil {
+		return fmt.Errorf("failed to apply transaction to rollup: %w", err)
+	}
+	return nil
+}
+
+// Rebuild recomputes every bucket whose day falls in [from, to] from the
+// transaction table, replacing whatever was stored for those days.
+func (r *RollupRepo) Rebuild(ctx context.Context, from, to time.Time) (int64, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin rollup rebuild: %w", err)
+	}
+	defer tx.Rollback()
+
+	rowsAffected, err := r.rebuild(ctx, tx, from.Format(dateLayout), to.Format(dateLayout))
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit rollup rebuild: %w", err)
+	}
+
+	return rowsAffected, nil
+}
+
+// RebuildTransactionDays recomputes the days the given transactions fall on,
+// inside the caller's database transaction. It is for changes that move
+// existing transactions between buckets, such as re-pointing them to a
+// customer of another company, which ApplyTransaction cannot express.
+func (r *RollupRepo) RebuildTransactionDays(ctx context.Context, tx *sql.Tx, transactionIDs []int64) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT DISTINCT ((transaction_datetime AT TIME ZONE 'UTC') AT TIME ZONE $2)::date
+		FROM transaction
+		WHERE id = ANY($1)`, pq.Array(transactionIDs), r.Location.String())
+	if err != nil {
+		return fmt.Errorf("failed to query transaction days: %w", err)
+	}
+
+	var days []string
+	for rows.Next() {
+		var day time.Time
+		if err := rows.Scan(&day); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan transaction day: %w", err)
+		}
+		days = append(days, day.Format(dateLayout))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("row iteration error: %w", err)
+	}
+
+	for _, day := range days {
+		if _, err := r.rebuild(ctx, tx, day, day); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RebuildProduct recomputes every bucket of a product, inside the caller's
+// database transaction. Fees are derived from the product when the rollup is
+// written, so a change to its fee has to reach the days already stored.
+func (r *RollupRepo) RebuildProduct(ctx context.Context, tx *sql.Tx, productID int64) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM transaction_daily_rollup WHERE product_id = $1`, productID)
+	if err != nil {
+		return fmt.Errorf("failed to clear product rollup: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, rebuildQuery(`t.product_id = $2`, `TRUE`), r.Location.String(), productID)
+	if err != nil {
+		return fmt.Errorf("failed to rebuild product rollup: %w", err)
+	}
+	return nil
+}
+
+func (r *RollupRepo) rebuild(ctx context.Context, tx *sql.Tx, fromDay, toDay string) (int64, error) {
+	_, err := tx.ExecContext(ctx, `DELETE FROM transaction_daily_rollup WHERE day BETWEEN $1::date AND $2::date`, fromDay, toDay)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear rollup range: %w", err)
+	}
+
+	// The transactions are read a day either side of the range: which day a
+	// transaction falls on depends on the report time zone.
+	query := rebuildQuery(
+		`t.transaction_datetime >= $2::date - INTERVAL '1 day' AND t.transaction_datetime < $3::date + INTERVAL '2 days'`,
+		`d.day BETWEEN $2::date AND $3::date`)
+
+	res, err := tx.ExecContext(ctx, query, r.Location.String(), fromDay, toDay)
+	if err != nil {
+		return 0, fmt.Errorf("failed to rebuild rollup range: %w", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rowsAffected, nil
+}
+
+// rebuildQuery inserts the buckets of the transactions matching filter whose
+// day matches days. $1 is the report time zone.
+func rebuildQuery(filter, days string) string {
+	return `
+		INSERT INTO transaction_daily_rollup (
+			day, company_id, product_id, transaction_type, payment_status,
+			trx_count, amount, tax_amount, fee_amount,
+			first_trx_on, id_first_trx, last_trx_on, id_last_trx
+		)
+		SELECT
+			d.day, d.company_id, d.product_id, d.transaction_type, d.payment_status,
+			COUNT(*),
+			SUM(d.amount),
+			SUM(d.tax_amount),
+			SUM(d.fee_amount),
+			MIN(d.transaction_datetime),
+			(array_agg(d.id ORDER BY d.transaction_datetime ASC, d.id ASC))[1],
+			MAX(d.transaction_datetime),
+			(array_agg(d.id ORDER BY d.transaction_datetime DESC, d.id DESC))[1]
+		FROM (
+			SELECT
+				((t.transaction_datetime AT TIME ZONE 'UTC') AT TIME ZONE $1)::date AS day,
+				cu.company AS company_id,
+				p.id AS product_id,
+				t.transaction_type,
+				t.payment_status,
+				t.amount,
+				t.tax_amount,
+				` + feeExpression + ` AS fee_amount,
+				t.transaction_datetime,
+				t.id
+			FROM transaction t
+				INNER JOIN customer cu ON cu.id = t.customer_id
+				INNER JOIN product p ON p.id = t.product_id
+			WHERE ` + filter + `
+		) d
+		WHERE ` + days + `
+		GROUP BY d.day, d.company_id, d.product_id, d.transaction_type, d.payment_status`
+}
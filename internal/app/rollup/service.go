@@ -0,0 +1,95 @@
+package rollup
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	logger "sinibeli/internal/pkg/logging"
+	"sinibeli/internal/pkg/tracing"
+)
+
+const rebuildChunkDays = 31
+
+var (
+	ErrInvalidRange = errors.New("from must not be after to")
+)
+
+type RollupService struct {
+	repo *RollupRepo
+}
+
+func NewRollupService(repo *RollupRepo) *RollupService {
+	return &RollupService{repo: repo}
+}
+
+func (s *RollupService) Location() *time.Location {
+	return s.repo.Location
+}
+
+// Rebuild walks the range in month-sized chunks so a multi-year backfill does
+// not hold one huge transaction open.
+func (s *RollupService) Rebuild(ctx context.Context, from, to time.Time) (int64, error) {
+	ctx, span := tracing.Start(ctx, "RollupService.Rebuild")
+	defer span.End()
+
+	if from.After(to) {
+		return 0, ErrInvalidRange
+	}
+
+	var total int64
+	for start := from; !start.After(to); start = start.AddDate(0, 0, rebuildChunkDays) {
+		end := start.AddDate(0, 0, rebuildChunkDays-1)
+		if end.After(to) {
+			end = to
+		}
+
+		n, err := s.repo.Rebuild(ctx, start, end)
+		if err != nil {
+			return total, err
+		}
+		total += n
+
+		logger.InfoCtx(ctx, "Rollup range rebuilt",
+			"from", start.Format(dateLayout), "to", end.Format(dateLayout), "buckets", n)
+	}
+
+	return total, nil
+}
+
+type Refresher struct {
+	service  *RollupService
+	interval time.Duration
+	lookback int
+}
+
+func NewRefresher(service *RollupService, interval time.Duration, lookbackDays int) *Refresher {
+	return &Refresher{service: service, interval: interval, lookback: lookbackDays}
+}
+
+// Run periodically rebuilds the most recent days so rows changed outside the
+// API (status updates, manual fixes, bulk loads) are reflected in reports.
+// An interval of zero or less disables the refresher.
+func (r *Refresher) Run(ctx context.Context) {
+	if r.interval <= 0 {
+		logger.InfoCtx(ctx, "Rollup refresher disabled", "interval", r.interval)
+		return
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			today := time.Now().In(r.service.Location())
+			from := today.AddDate(0, 0, -r.lookback)
+			runCtx := logger.WithRequestID(ctx)
+			if _, err := r.service.Rebuild(runCtx, from, today); err != nil {
+				logger.ErrorCtx(runCtx, "Rollup refresh failed", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package rollup
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	logger "sinibeli/internal/pkg/logging"
+)
+
+func TestRefresherDisabled(t *testing.T) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	service := NewRollupService(NewRollupRepo(nil, time.UTC))
+
+	for _, interval := range []time.Duration{0, -time.Minute} {
+		done := make(chan struct{})
+		go func() {
+			NewRefresher(service, interval, 2).Run(context.Background())
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("Run with interval %s did not return", interval)
+		}
+	}
+}
@@ -5,9 +5,29 @@ import (
 	"strconv"
 	"time"
 
+	"sinibeli/internal/pkg/apperr"
+	"sinibeli/internal/pkg/request"
+
 	"github.com/gin-gonic/gin"
 )
 
+var (
+	errInvalidID              = apperr.InvalidParam("id", "invalid transaction ID")
+	errInvalidAmountFormat    = apperr.InvalidParam("amount", "invalid amount format, must be a valid number")
+	errInvalidTaxAmountFormat = apperr.InvalidParam("tax_amount", "invalid tax_amount format, must be a valid number")
+	errInvalidDatetimeFormat  = apperr.InvalidParam("transaction_datetime", "invalid transaction_datetime format, use RFC3339").With("example", "2023-12-25T10:30:00Z")
+	errRefundTaxExceedsAmount = apperr.New(apperr.Invalid, "refund_tax_exceeds_amount", "tax_amount cannot be greater than refund amount")
+	errInvalidPageParam       = apperr.InvalidParam("page", "page must be a positive integer >= 1")
+	errInvalidPageSizeParam   = apperr.InvalidParam("page_size", "page_size must be between 1 and 100")
+	errInvalidCompanyIDParam  = apperr.InvalidParam("company_id", "company_id must be a positive integer")
+	errInvalidProductIDParam  = apperr.InvalidParam("product_id", "product_id must be a positive integer")
+	errInvalidStartDateParam  = apperr.InvalidParam("start_date", "start_date must be in YYYY-MM-DD format").With("example", "2023-01-01")
+	errInvalidEndDateParam    = apperr.InvalidParam("end_date", "end_date must be in YYYY-MM-DD format").With("example", "2023-12-31")
+	errInvalidMinAmountParam  = apperr.InvalidParam("min_amount", "min_amount must be a non-negative number")
+	errInvalidMaxAmountParam  = apperr.InvalidParam("max_amount", "max_amount must be a non-negative number")
+	errInvalidMinTrxParam     = apperr.InvalidParam("min_trx", "min_trx must be a non-negative integer")
+)
+
 type TransactionHandler struct {
 	service *TransactionService
 }
@@ -18,81 +38,64 @@ func NewTransactionHandler(service *TransactionService) *TransactionHandler {
 
 func (h *TransactionHandler) Create(c *gin.Context) {
 
-	if err := c.ShouldBindJSON(&CreateTxReq); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":                   "validation failed",
-			"details":                 err.Error(),
-			"valid_transaction_types": ValidTransactionTypes,
-			"valid_payment_statuses":  ValidPaymentStatuses,
-			"valid_tax_types":         ValidTaxTypes,
-		})
+	req, ok := request.BindJSON[CreateTxReq](c)
+	if !ok {
 		return
 	}
 
-	amount, err := strconv.ParseFloat(CreateTxReq.Amount, 64)
+	amount, err := strconv.ParseFloat(req.Amount, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid amount format, must be a valid number"})
+		c.Error(errInvalidAmountFormat)
 		return
 	}
 	if amount <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be greater than 0"})
+		c.Error(ErrInvalidAmount)
 		return
 	}
 
-	taxAmount, err := strconv.ParseFloat(CreateTxReq.TaxAmount, 64)
+	taxAmount, err := strconv.ParseFloat(req.TaxAmount, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tax_amount format, must be a valid number"})
+		c.Error(errInvalidTaxAmountFormat)
 		return
 	}
 	if taxAmount < 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "tax_amount must be >= 0"})
+		c.Error(ErrInvalidTaxAmount)
 		return
 	}
 
 	var trxTime time.Time
-	if CreateTxReq.TransactionDatetimeStr != "" {
-		trxTime, err = time.Parse(time.RFC3339, CreateTxReq.TransactionDatetimeStr)
+	if req.TransactionDatetimeStr != "" {
+		trxTime, err = time.Parse(time.RFC3339, req.TransactionDatetimeStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":   "invalid transaction_datetime format, use RFC3339",
-				"example": "2023-12-25T10:30:00Z",
-			})
+			c.Error(errInvalidDatetimeFormat)
 			return
 		}
 
 		if trxTime.After(time.Now()) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "transaction_datetime cannot be in the future"})
+			c.Error(ErrFutureTransactionDate)
 			return
 		}
 	}
 
-	if CreateTxReq.TransactionType == "refund" && taxAmount > amount {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "tax_amount cannot be greater than refund amount"})
+	if req.TransactionType == "refund" && taxAmount > amount {
+		c.Error(errRefundTaxExceedsAmount)
 		return
 	}
 
 	t := &Transaction{
-		ID:                  CreateTxReq.ID,
-		CustomerID:          CreateTxReq.CustomerID,
-		TransactionType:     CreateTxReq.TransactionType,
+		ID:                  req.ID,
+		CustomerID:          req.CustomerID,
+		TransactionType:     req.TransactionType,
 		Amount:              amount,
 		TaxAmount:           taxAmount,
-		PaymentStatus:       CreateTxReq.PaymentStatus,
-		ProductID:           CreateTxReq.ProductID,
+		PaymentStatus:       req.PaymentStatus,
+		ProductID:           req.ProductID,
 		TransactionDatetime: trxTime,
-		TaxType:             CreateTxReq.TaxType,
+		TaxType:             req.TaxType,
 	}
 
-	if err := h.service.Create(t); err != nil {
-		switch {
-		case err == ErrInvalidAmount || err == ErrInvalidTaxAmount ||
-			err == ErrInvalidTransactionType || err == ErrInvalidPaymentStatus ||
-			err == ErrInvalidTaxType || err == ErrFutureTransactionDate ||
-			err == ErrInvalidCustomerID || err == ErrInvalidProductID:
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		}
+	if err := h.service.Create(c.Request.Context(), t); err != nil {
+		c.Error(err)
 		return
 	}
 
@@ -100,9 +103,9 @@ func (h *TransactionHandler) Create(c *gin.Context) {
 }
 
 func (h *TransactionHandler) GetAll(c *gin.Context) {
-	txs, err := h.service.GetAll()
+	txs, err := h.service.GetAll(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, txs)
@@ -111,17 +114,13 @@ func (h *TransactionHandler) GetAll(c *gin.Context) {
 func (h *TransactionHandler) GetByID(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid transaction ID"})
+		c.Error(errInvalidID)
 		return
 	}
 
-	tx, err := h.service.GetByID(id)
+	tx, err := h.service.GetByID(c.Request.Context(), id)
 	if err != nil {
-		if err.Error() == "Transaction not found" {
-			c.JSON(http.StatusNotFound, gin.H{"error": "transaction not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -129,9 +128,9 @@ func (h *TransactionHandler) GetByID(c *gin.Context) {
 }
 
 func (h *TransactionHandler) GetTransactionSummary(c *gin.Context) {
-	summaries, err := h.service.GetTransactionSummary()
+	summaries, err := h.service.GetTransactionSummary(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, summaries)
@@ -144,10 +143,7 @@ func (h *TransactionHandler) GetTransactionSummaryFiltered(c *gin.Context) {
 	if pStr := c.DefaultQuery("page", "1"); pStr != "" {
 		p, err := strconv.ParseInt(pStr, 10, 64)
 		if err != nil || p < 1 {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":   "invalid page parameter",
-				"details": "page must be a positive integer >= 1",
-			})
+			c.Error(errInvalidPageParam)
 			return
 		}
 		page = p
@@ -157,10 +153,7 @@ func (h *TransactionHandler) GetTransactionSummaryFiltered(c *gin.Context) {
 	if psStr := c.DefaultQuery("page_size", "10"); psStr != "" {
 		ps, err := strconv.ParseInt(psStr, 10, 64)
 		if err != nil || ps < 1 || ps > 100 {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":   "invalid page_size parameter",
-				"details": "page_size must be between 1 and 100",
-			})
+			c.Error(errInvalidPageSizeParam)
 			return
 		}
 		pageSize = ps
@@ -172,10 +165,7 @@ func (h *TransactionHandler) GetTransactionSummaryFiltered(c *gin.Context) {
 	if cidStr := c.Query("company_id"); cidStr != "" {
 		cid, err := strconv.ParseInt(cidStr, 10, 64)
 		if err != nil || cid <= 0 {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":   "invalid company_id parameter",
-				"details": "company_id must be a positive integer",
-			})
+			c.Error(errInvalidCompanyIDParam)
 			return
 		}
 		filter.CompanyID = &cid
@@ -184,10 +174,7 @@ func (h *TransactionHandler) GetTransactionSummaryFiltered(c *gin.Context) {
 	if pidStr := c.Query("product_id"); pidStr != "" {
 		pid, err := strconv.ParseInt(pidStr, 10, 64)
 		if err != nil || pid <= 0 {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":   "invalid product_id parameter",
-				"details": "product_id must be a positive integer",
-			})
+			c.Error(errInvalidProductIDParam)
 			return
 		}
 		filter.ProductID = &pid
@@ -196,11 +183,7 @@ func (h *TransactionHandler) GetTransactionSummaryFiltered(c *gin.Context) {
 	if startDateStr := c.Query("start_date"); startDateStr != "" {
 		startDate, err := time.Parse("2006-01-02", startDateStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":   "invalid start_date format",
-				"details": "start_date must be in YYYY-MM-DD format",
-				"example": "2023-01-01",
-			})
+			c.Error(errInvalidStartDateParam)
 			return
 		}
 		filter.StartDate = &startDate
@@ -209,11 +192,7 @@ func (h *TransactionHandler) GetTransactionSummaryFiltered(c *gin.Context) {
 	if endDateStr := c.Query("end_date"); endDateStr != "" {
 		endDate, err := time.Parse("2006-01-02", endDateStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":   "invalid end_date format",
-				"details": "end_date must be in YYYY-MM-DD format",
-				"example": "2023-12-31",
-			})
+			c.Error(errInvalidEndDateParam)
 			return
 		}
 		endDate = endDate.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
@@ -223,10 +202,7 @@ func (h *TransactionHandler) GetTransactionSummaryFiltered(c *gin.Context) {
 	if minAmountStr := c.Query("min_amount"); minAmountStr != "" {
 		minAmount, err := strconv.ParseFloat(minAmountStr, 64)
 		if err != nil || minAmount < 0 {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":   "invalid min_amount parameter",
-				"details": "min_amount must be a non-negative number",
-			})
+			c.Error(errInvalidMinAmountParam)
 			return
 		}
 		filter.MinAmount = &minAmount
@@ -235,10 +211,7 @@ func (h *TransactionHandler) GetTransactionSummaryFiltered(c *gin.Context) {
 	if maxAmountStr := c.Query("max_amount"); maxAmountStr != "" {
 		maxAmount, err := strconv.ParseFloat(maxAmountStr, 64)
 		if err != nil || maxAmount < 0 {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":   "invalid max_amount parameter",
-				"details": "max_amount must be a non-negative number",
-			})
+			c.Error(errInvalidMaxAmountParam)
 			return
 		}
 		filter.MaxAmount = &maxAmount
@@ -246,33 +219,21 @@ func (h *TransactionHandler) GetTransactionSummaryFiltered(c *gin.Context) {
 
 	if filter.StartDate != nil && filter.EndDate != nil {
 		if filter.StartDate.After(*filter.EndDate) {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":   "invalid date range",
-				"details": "start_date must be before or equal to end_date",
-			})
+			c.Error(ErrInvalidDateRange)
 			return
 		}
 	}
 
 	if filter.MinAmount != nil && filter.MaxAmount != nil {
 		if *filter.MinAmount >= *filter.MaxAmount {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":   "invalid amount range",
-				"details": "min_amount must be less than max_amount",
-			})
+			c.Error(ErrInvalidAmountRange)
 			return
 		}
 	}
 
-	resp, err := h.service.GetTransactionSummaryWithFilter(filter)
+	resp, err := h.service.GetTransactionSummaryWithFilter(c.Request.Context(), filter)
 	if err != nil {
-		switch {
-		case err == ErrInvalidPage || err == ErrInvalidPageSize ||
-			err == ErrInvalidDateRange || err == ErrInvalidAmountRange:
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		}
+		c.Error(err)
 		return
 	}
 
@@ -297,7 +258,7 @@ func (h *TransactionHandler) GetCustomerActivity(c *gin.Context) {
 	if cidStr := c.Query("company_id"); cidStr != "" {
 		cid, err := strconv.ParseInt(cidStr, 10, 64)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid company_id"})
+			c.Error(errInvalidCompanyIDParam)
 			return
 		}
 		companyID = &cid
@@ -307,7 +268,7 @@ func (h *TransactionHandler) GetCustomerActivity(c *gin.Context) {
 	if minStr := c.Query("min_trx"); minStr != "" {
 		min, err := strconv.ParseInt(minStr, 10, 64)
 		if err != nil || min < 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid min_trx (must be non-negative integer)"})
+			c.Error(errInvalidMinTrxParam)
 			return
 		}
 		minTrxCount = &min
@@ -317,7 +278,7 @@ func (h *TransactionHandler) GetCustomerActivity(c *gin.Context) {
 	if pStr := c.DefaultQuery("page", "1"); pStr != "" {
 		p, err := strconv.ParseInt(pStr, 10, 64)
 		if err != nil || p < 1 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid page"})
+			c.Error(errInvalidPageParam)
 			return
 		}
 		page = p
@@ -327,20 +288,15 @@ func (h *TransactionHandler) GetCustomerActivity(c *gin.Context) {
 	if psStr := c.DefaultQuery("page_size", "10"); psStr != "" {
 		ps, err := strconv.ParseInt(psStr, 10, 64)
 		if err != nil || ps < 1 || ps > 100 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "page_size must be between 1 and 100"})
+			c.Error(errInvalidPageSizeParam)
 			return
 		}
 		pageSize = ps
 	}
 
-	resp, err := h.service.GetCustomerActivity(companyID, minTrxCount, page, pageSize)
+	resp, err := h.service.GetCustomerActivity(c.Request.Context(), companyID, minTrxCount, page, pageSize)
 	if err != nil {
-		switch {
-		case err == ErrInvalidPage || err == ErrInvalidPageSize:
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		}
+		c.Error(err)
 		return
 	}
 
@@ -1,8 +1,9 @@
 package transaction
 
 import (
-	"errors"
 	"time"
+
+	"sinibeli/internal/pkg/apperr"
 )
 
 type TransactionSummary struct {
@@ -21,7 +22,7 @@ type TransactionSummary struct {
 	IDFirstTrx    int64   `json:"id_first_trx"`
 }
 
-var CreateTxReq struct {
+type CreateTxReq struct {
 	ID                     int64  `json:"id" binding:"required,min=1"`
 	CustomerID             int64  `json:"customer_id" binding:"required,min=1"`
 	TransactionType        string `json:"transaction_type" binding:"required,oneof=purchase refund payment"`
@@ -90,25 +91,37 @@ type TransactionSummaryResponse struct {
 }
 
 var (
-	ErrInvalidPage            = errors.New("page must be >= 1")
-	ErrInvalidPageSize        = errors.New("page_size must be between 1 and 100")
-	ErrInvalidAmount          = errors.New("amount must be greater than 0")
-	ErrInvalidTaxAmount       = errors.New("tax_amount must be >= 0")
-	ErrInvalidTransactionType = errors.New("transaction_type must be one of: purchase, refund, payment")
-	ErrInvalidPaymentStatus   = errors.New("payment_status must be one of: pending, completed, failed, cancelled")
-	ErrInvalidTaxType         = errors.New("tax_type must be one of: VAT, GST, SALES_TAX, or empty")
-	ErrInvalidDateRange       = errors.New("start_date must be before end_date")
-	ErrInvalidAmountRange     = errors.New("min_amount must be less than max_amount")
-	ErrFutureTransactionDate  = errors.New("transaction_datetime cannot be in the future")
-	ErrInvalidCustomerID      = errors.New("customer_id must be greater than 0")
-	ErrInvalidProductID       = errors.New("product_id must be greater than 0")
-
-	ErrCustomerNotFound            = errors.New("customer not found")
-	ErrProductNotFound             = errors.New("product not found")
-	ErrCustomerCompanyMismatch     = errors.New("customer does not belong to the same company as the product")
-	ErrRefundExceedsOriginal       = errors.New("refund amount exceeds original purchase amount")
-	ErrInsufficientPurchaseHistory = errors.New("insufficient purchase history for refund")
-	ErrDuplicateTransactionID      = errors.New("transaction ID already exists")
+	ErrNotFound = apperr.New(apperr.NotFound, "transaction_not_found", "transaction not found")
+
+	ErrInvalidPage            = apperr.New(apperr.Invalid, "invalid_page", "page must be >= 1")
+	ErrInvalidPageSize        = apperr.New(apperr.Invalid, "invalid_page_size", "page_size must be between 1 and 100")
+	ErrInvalidAmount          = apperr.New(apperr.Invalid, "invalid_amount", "amount must be greater than 0")
+	ErrInvalidTaxAmount       = apperr.New(apperr.Invalid, "invalid_tax_amount", "tax_amount must be >= 0")
+	ErrInvalidTransactionType = apperr.New(apperr.Invalid, "invalid_transaction_type", "transaction_type must be one of: purchase, refund, payment")
+	ErrInvalidPaymentStatus   = apperr.New(apperr.Invalid, "invalid_payment_status", "payment_status must be one of: pending, completed, failed, cancelled")
+	ErrInvalidTaxType         = apperr.New(apperr.Invalid, "invalid_tax_type", "tax_type must be one of: VAT, GST, SALES_TAX, or empty")
+	ErrInvalidDateRange       = apperr.New(apperr.Invalid, "invalid_date_range", "start_date must be before end_date")
+	ErrInvalidAmountRange     = apperr.New(apperr.Invalid, "invalid_amount_range", "min_amount must be less than max_amount")
+	ErrFutureTransactionDate  = apperr.New(apperr.Invalid, "future_transaction_date", "transaction_datetime cannot be in the future")
+	ErrInvalidCustomerID      = apperr.New(apperr.Invalid, "invalid_customer_id", "customer_id must be greater than 0")
+	ErrInvalidProductID       = apperr.New(apperr.Invalid, "invalid_product_id", "product_id must be greater than 0")
+	ErrInvalidCompanyID       = apperr.New(apperr.Invalid, "invalid_company_id", "company_id must be greater than 0")
+	ErrInvalidMinAmount       = apperr.New(apperr.Invalid, "invalid_min_amount", "min_amount must be >= 0")
+	ErrInvalidMaxAmount       = apperr.New(apperr.Invalid, "invalid_max_amount", "max_amount must be >= 0")
+	ErrCustomerMerged         = apperr.New(apperr.Invalid, "customer_merged", "customer has been merged into another customer")
+
+	ErrCustomerNotFound            = apperr.New(apperr.Unprocessable, "unknown_customer", "customer not found")
+	ErrProductNotFound             = apperr.New(apperr.Unprocessable, "unknown_product", "product not found")
+	ErrCustomerCompanyMismatch     = apperr.New(apperr.Unprocessable, "customer_company_mismatch", "customer does not belong to the same company as the product")
+	ErrRefundExceedsOriginal       = apperr.New(apperr.Unprocessable, "refund_exceeds_original", "refund amount exceeds original purchase amount")
+	ErrInsufficientPurchaseHistory = apperr.New(apperr.Unprocessable, "insufficient_purchase_history", "insufficient purchase history for refund")
+	ErrNoPurchaseForRefund         = apperr.New(apperr.Unprocessable, "no_purchase_for_refund", "no purchase found for refund")
+	ErrRefundPeriodExpired         = apperr.New(apperr.Unprocessable, "refund_period_expired", "refund period has expired (30 days limit)")
+	ErrPurchaseBelowMinimum        = apperr.New(apperr.Unprocessable, "purchase_below_minimum", "minimum purchase amount is 1.00")
+	ErrPurchaseAboveMaximum        = apperr.New(apperr.Unprocessable, "purchase_above_maximum", "purchase amount exceeds maximum allowed limit")
+	ErrTaxTooHigh                  = apperr.New(apperr.Unprocessable, "tax_too_high", "tax amount seems unreasonably high (>50% of purchase amount)")
+	ErrTaxRateTooHigh              = apperr.New(apperr.Unprocessable, "tax_rate_too_high", "tax rate is too high")
+	ErrDuplicateTransactionID      = apperr.New(apperr.Conflict, "duplicate_transaction_id", "transaction ID already exists")
 )
 
 var (
@@ -174,17 +187,17 @@ func (f *TransactionSummaryFilter) Validate() error {
 	}
 
 	if f.MinAmount != nil && *f.MinAmount < 0 {
-		return errors.New("min_amount must be >= 0")
+		return ErrInvalidMinAmount
 	}
 	if f.MaxAmount != nil && *f.MaxAmount < 0 {
-		return errors.New("max_amount must be >= 0")
+		return ErrInvalidMaxAmount
 	}
 
 	if f.CompanyID != nil && *f.CompanyID <= 0 {
-		return errors.New("company_id must be greater than 0")
+		return ErrInvalidCompanyID
 	}
 	if f.ProductID != nil && *f.ProductID <= 0 {
-		return errors.New("product_id must be greater than 0")
+		return ErrInvalidProductID
 	}
 
 	return nil
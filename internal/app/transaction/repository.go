@@ -1,20 +1,24 @@
 package transaction
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
+
+	"sinibeli/internal/app/rollup"
 )
 
 type TransactionRepo struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Rollup *rollup.RollupRepo
 }
 
-func NewTransactionRepo(db *sql.DB) *TransactionRepo {
-	return &TransactionRepo{DB: db}
+func NewTransactionRepo(db *sql.DB, rollupRepo *rollup.RollupRepo) *TransactionRepo {
+	return &TransactionRepo{DB: db, Rollup: rollupRepo}
 }
 
-func (r *TransactionRepo) Create(t *Transaction) error {
+func (r *TransactionRepo) Create(ctx context.Context, t *Transaction) error {
 	query := `
 		INSERT INTO transaction (
 			id, customer_id, transaction_type, amount,
@@ -29,7 +33,13 @@ func (r *TransactionRepo) Create(t *Transaction) error {
 		taxType = nil
 	}
 
-	_, err := r.DB.Exec(
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
 		query,
 		t.ID,
 		t.CustomerID,
@@ -44,16 +54,24 @@ func (r *TransactionRepo) Create(t *Transaction) error {
 	if err != nil {
 		return fmt.Errorf("failed to create transaction: %w", err)
 	}
+
+	if err := r.Rollup.ApplyTransaction(ctx, tx, t.ID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return nil
 }
 
-func (r *TransactionRepo) GetByID(id int64) (*Transaction, error) {
+func (r *TransactionRepo) GetByID(ctx context.Context, id int64) (*Transaction, error) {
 	query := `
 		SELECT id, customer_id, transaction_type, amount,
 		       transaction_datetime, tax_amount, tax_type,
 		       payment_status, product_id
 		FROM transaction WHERE id = $1`
-	row := r.DB.QueryRow(query, id)
+	row := r.DB.QueryRowContext(ctx, query, id)
 
 	var t Transaction
 	var taxType sql.NullString
@@ -84,13 +102,13 @@ func (r *TransactionRepo) GetByID(id int64) (*Transaction, error) {
 	return &t, nil
 }
 
-func (r *TransactionRepo) GetAll() ([]*Transaction, error) {
+func (r *TransactionRepo) GetAll(ctx context.Context) ([]*Transaction, error) {
 	query := `
 		SELECT id, customer_id, transaction_type, amount,
 		       transaction_datetime, tax_amount, tax_type,
 		       payment_status, product_id
 		FROM transaction`
-	rows, err := r.DB.Query(query)
+	rows, err := r.DB.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query transactions: %w", err)
 	}
@@ -130,84 +148,43 @@ func (r *TransactionRepo) GetAll() ([]*Transaction, error) {
 	return transactions, nil
 }
 
-func (r *TransactionRepo) GetTransactionSummary() ([]TransactionSummary, error) {
-	query := `
-SELECT
-    c.id,
-    c.name AS company_name,
-    p.id AS product_id,
-    p.product_name,
-    SUM(t.amount) AS amount,
-    COUNT(t.id) AS count,
-    SUM(t.tax_amount) AS tax_value,
-    p.service_fee_percentage,
-    p.service_fee,
-    MAX(t.transaction_datetime) AS last_trx_on,
-    (
-        SELECT t2.id
-        FROM transaction t2
-        INNER JOIN customer cu2 ON t2.customer_id = cu2.id
-        WHERE cu2.company = c.id AND t2.product_id = p.id
-        ORDER BY t2.transaction_datetime DESC, t2.id DESC
-        LIMIT 1
-    ) AS id_last_trx,
-    MIN(t.transaction_datetime) AS first_trx_on,
-    (
-        SELECT t3.id
-        FROM transaction t3
-        INNER JOIN customer cu3 ON t3.customer_id = cu3.id
-        WHERE cu3.company = c.id AND t3.product_id = p.id
-        ORDER BY t3.transaction_datetime ASC, t3.id ASC
-        LIMIT 1
-    ) AS id_first_trx
-FROM
-    company c
-    INNER JOIN customer cu ON c.id = cu.company
-    INNER JOIN transaction t ON cu.id = t.customer_id
-    INNER JOIN product p ON t.product_id = p.id
-GROUP BY
-    c.id, c.name, p.id, p.product_name, p.service_fee_percentage, p.service_fee
-ORDER BY c.id, p.id;
-`
-
-	rows, err := r.DB.Query(query)
+const rollupSummaryQuery = `
+		SELECT
+			c.id,
+			c.name AS company_name,
+			p.id AS product_id,
+			p.product_name,
+			SUM(r.amount) AS amount,
+			SUM(r.trx_count) AS count,
+			SUM(r.tax_amount) AS tax_value,
+			p.service_fee_percentage,
+			p.service_fee,
+			MAX(r.last_trx_on) AS last_trx_on,
+			(array_agg(r.id_last_trx ORDER BY r.last_trx_on DESC, r.id_last_trx DESC))[1] AS id_last_trx,
+			MIN(r.first_trx_on) AS first_trx_on,
+			(array_agg(r.id_first_trx ORDER BY r.first_trx_on ASC, r.id_first_trx ASC))[1] AS id_first_trx
+		FROM
+			transaction_daily_rollup r
+			INNER JOIN company c ON c.id = r.company_id
+			INNER JOIN product p ON p.id = r.product_id
+		WHERE 1=1`
+
+const rollupSummaryGroupBy = `
+		GROUP BY
+			c.id, c.name, p.id, p.product_name, p.service_fee_percentage, p.service_fee
+		ORDER BY c.id, p.id`
+
+func (r *TransactionRepo) GetTransactionSummary(ctx context.Context) ([]TransactionSummary, error) {
+	rows, err := r.DB.QueryContext(ctx, rollupSummaryQuery+rollupSummaryGroupBy)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query transaction summary: %w", err)
 	}
 	defer rows.Close()
 
-	var summaries []TransactionSummary
-	for rows.Next() {
-		var s TransactionSummary
-		err := rows.Scan(
-			&s.ID,
-			&s.CompanyName,
-			&s.ProductID,
-			&s.ProductName,
-			&s.Amount,
-			&s.Count,
-			&s.TaxValue,
-			&s.ServiceFeePct,
-			&s.ServiceFee,
-			&s.LastTrxOn,
-			&s.IDLastTrx,
-			&s.FirstTrxOn,
-			&s.IDFirstTrx,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan row: %w", err)
-		}
-		summaries = append(summaries, s)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("row iteration error: %w", err)
-	}
-
-	return summaries, nil
+	return scanSummaries(rows)
 }
 
-func (r *TransactionRepo) GetCustomerActivity(filter CustomerActivityFilter) ([]CustomerActivity, int64, error) {
+func (r *TransactionRepo) GetCustomerActivity(ctx context.Context, filter CustomerActivityFilter) ([]CustomerActivity, int64, error) {
 
 	baseQuery := `
 		WITH ranked AS (
@@ -253,7 +230,7 @@ func (r *TransactionRepo) GetCustomerActivity(filter CustomerActivityFilter) ([]
 		SELECT COUNT(*) FROM (` + baseQuery + `) AS total`
 
 	var total int64
-	err := r.DB.QueryRow(countQuery, args...).Scan(&total)
+	err := r.DB.QueryRowContext(ctx, countQuery, args...).Scan(&total)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to count total rows: %w", err)
 	}
@@ -262,7 +239,7 @@ func (r *TransactionRepo) GetCustomerActivity(filter CustomerActivityFilter) ([]
 	paginatedQuery := baseQuery + fmt.Sprintf(" LIMIT $%d OFFSET $%d", argPos, argPos+1)
 	args = append(args, filter.PageSize, offset)
 
-	rows, err := r.DB.Query(paginatedQuery, args...)
+	rows, err := r.DB.QueryContext(ctx, paginatedQuery, args...)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to query customer activity: %w", err)
 	}
@@ -292,7 +269,7 @@ func (r *TransactionRepo) GetCustomerActivity(filter CustomerActivityFilter) ([]
 	return result, total, nil
 }
 
-func (r *TransactionRepo) GetTransactionsByCustomerAndProduct(customerID, productID int64) ([]Transaction, error) {
+func (r *TransactionRepo) GetTransactionsByCustomerAndProduct(ctx context.Context, customerID, productID int64) ([]Transaction, error) {
 	query := `
 		SELECT id, customer_id, transaction_type, amount,
 		       transaction_datetime, tax_amount, tax_type,
@@ -301,7 +278,7 @@ func (r *TransactionRepo) GetTransactionsByCustomerAndProduct(customerID, produc
 		WHERE customer_id = $1 AND product_id = $2
 		ORDER BY transaction_datetime DESC`
 
-	rows, err := r.DB.Query(query, customerID, productID)
+	rows, err := r.DB.QueryContext(ctx, query, customerID, productID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query transactions by customer and product: %w", err)
 	}
@@ -343,7 +320,90 @@ func (r *TransactionRepo) GetTransactionsByCustomerAndProduct(customerID, produc
 	return transactions, nil
 }
 
-func (r *TransactionRepo) GetTransactionSummaryWithFilter(filter TransactionSummaryFilter) ([]TransactionSummary, int64, error) {
+// GetTransactionSummaryWithFilter reads from the daily rollup unless an amount
+// filter is set, since those apply to individual transactions.
+func (r *TransactionRepo) GetTransactionSummaryWithFilter(ctx context.Context, filter TransactionSummaryFilter) ([]TransactionSummary, int64, error) {
+	if filter.MinAmount != nil || filter.MaxAmount != nil {
+		return r.getTransactionSummaryFromTransactions(ctx, filter)
+	}
+	return r.getTransactionSummaryFromRollup(ctx, filter)
+}
+
+func (r *TransactionRepo) getTransactionSummaryFromRollup(ctx context.Context, filter TransactionSummaryFilter) ([]TransactionSummary, int64, error) {
+	baseQuery := rollupSummaryQuery
+
+	var args []interface{}
+	argPos := 1
+
+	if filter.CompanyID != nil {
+		baseQuery += fmt.Sprintf(" AND r.company_id = $%d", argPos)
+		args = append(args, *filter.CompanyID)
+		argPos++
+	}
+
+	if filter.ProductID != nil {
+		baseQuery += fmt.Sprintf(" AND r.product_id = $%d", argPos)
+		args = append(args, *filter.ProductID)
+		argPos++
+	}
+
+	if filter.StartDate != nil {
+		baseQuery += fmt.Sprintf(" AND r.day >= $%d::date", argPos)
+		args = append(args, filter.StartDate.Format("2006-01-02"))
+		argPos++
+	}
+
+	if filter.EndDate != nil {
+		baseQuery += fmt.Sprintf(" AND r.day <= $%d::date", argPos)
+		args = append(args, filter.EndDate.Format("2006-01-02"))
+		argPos++
+	}
+
+	baseQuery += rollupSummaryGroupBy
+
+	countQuery := `SELECT COUNT(*) FROM (` + baseQuery + `) AS total`
+	var total int64
+	err := r.DB.QueryRowContext(ctx, countQuery, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count total rows: %w", err)
+	}
+
+	offset := (filter.Page - 1) * filter.PageSize
+	paginatedQuery := baseQuery + fmt.Sprintf(" LIMIT $%d OFFSET $%d", argPos, argPos+1)
+	args = append(args, filter.PageSize, offset)
+
+	rows, err := r.DB.QueryContext(ctx, paginatedQuery, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query transaction summary with filter: %w", err)
+	}
+	defer rows.Close()
+
+	summaries, err := scanSummaries(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return summaries, total, nil
+}
+
+// reportDayBounds turns the start and end dates of a filter into the UTC
+// instants that begin the first day and end the last, with days counted in
+// loc like the rollup's. The end is exclusive.
+func reportDayBounds(loc *time.Location, start, end *time.Time) (from, to *time.Time) {
+	if start != nil {
+		y, m, d := start.Date()
+		t := time.Date(y, m, d, 0, 0, 0, 0, loc).UTC()
+		from = &t
+	}
+	if end != nil {
+		y, m, d := end.Date()
+		t := time.Date(y, m, d+1, 0, 0, 0, 0, loc).UTC()
+		to = &t
+	}
+	return from, to
+}
+
+func (r *TransactionRepo) getTransactionSummaryFromTransactions(ctx context.Context, filter TransactionSummaryFilter) ([]TransactionSummary, int64, error) {
 
 	baseQuery := `
 		SELECT
@@ -396,15 +456,16 @@ func (r *TransactionRepo) GetTransactionSummaryWithFilter(filter TransactionSumm
 		argPos++
 	}
 
-	if filter.StartDate != nil {
+	from, to := reportDayBounds(r.Rollup.Location, filter.StartDate, filter.EndDate)
+	if from != nil {
 		baseQuery += fmt.Sprintf(" AND t.transaction_datetime >= $%d", argPos)
-		args = append(args, *filter.StartDate)
+		args = append(args, *from)
 		argPos++
 	}
 
-	if filter.EndDate != nil {
-		baseQuery += fmt.Sprintf(" AND t.transaction_datetime <= $%d", argPos)
-		args = append(args, *filter.EndDate)
+	if to != nil {
+		baseQuery += fmt.Sprintf(" AND t.transaction_datetime < $%d", argPos)
+		args = append(args, *to)
 		argPos++
 	}
 
@@ -427,7 +488,7 @@ func (r *TransactionRepo) GetTransactionSummaryWithFilter(filter TransactionSumm
 
 	countQuery := `SELECT COUNT(*) FROM (` + baseQuery + `) AS total`
 	var total int64
-	err := r.DB.QueryRow(countQuery, args...).Scan(&total)
+	err := r.DB.QueryRowContext(ctx, countQuery, args...).Scan(&total)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to count total rows: %w", err)
 	}
@@ -436,12 +497,21 @@ func (r *TransactionRepo) GetTransactionSummaryWithFilter(filter TransactionSumm
 	paginatedQuery := baseQuery + fmt.Sprintf(" LIMIT $%d OFFSET $%d", argPos, argPos+1)
 	args = append(args, filter.PageSize, offset)
 
-	rows, err := r.DB.Query(paginatedQuery, args...)
+	rows, err := r.DB.QueryContext(ctx, paginatedQuery, args...)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to query transaction summary with filter: %w", err)
 	}
 	defer rows.Close()
 
+	summaries, err := scanSummaries(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return summaries, total, nil
+}
+
+func scanSummaries(rows *sql.Rows) ([]TransactionSummary, error) {
 	var summaries []TransactionSummary
 	for rows.Next() {
 		var s TransactionSummary
@@ -461,14 +531,14 @@ func (r *TransactionRepo) GetTransactionSummaryWithFilter(filter TransactionSumm
 			&s.IDFirstTrx,
 		)
 		if err != nil {
-			return nil, 0, fmt.Errorf("failed to scan row: %w", err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 		summaries = append(summaries, s)
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, 0, fmt.Errorf("row iteration error: %w", err)
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
 	}
 
-	return summaries, total, nil
+	return summaries, nil
 }
@@ -0,0 +1,77 @@
+package transaction
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSummaryPathsAgreeOnDays checks that the raw summary path, taken when an
+// amount filter is set, selects the same transactions for a date range as the
+// rollup path, which buckets them by calendar day in the report time zone.
+func TestSummaryPathsAgreeOnDays(t *testing.T) {
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	require.NoError(t, err)
+
+	// Stored instants are UTC; Jakarta is UTC+7.
+	trx := []struct {
+		at     time.Time
+		amount float64
+	}{
+		{time.Date(2024, 2, 29, 16, 59, 59, 0, time.UTC), 1},  // 29 Feb 23:59:59 WIB
+		{time.Date(2024, 2, 29, 17, 0, 0, 0, time.UTC), 10},   // 1 Mar 00:00 WIB
+		{time.Date(2024, 3, 1, 3, 0, 0, 0, time.UTC), 100},    // 1 Mar 10:00 WIB
+		{time.Date(2024, 3, 1, 20, 0, 0, 0, time.UTC), 1000},  // 2 Mar 03:00 WIB
+		{time.Date(2024, 3, 2, 16, 59, 59, 0, time.UTC), 1e4}, // 2 Mar 23:59:59 WIB
+		{time.Date(2024, 3, 2, 17, 0, 0, 0, time.UTC), 1e5},   // 3 Mar 00:00 WIB
+		{time.Date(2024, 3, 2, 23, 59, 59, 0, time.UTC), 1e6}, // 3 Mar 06:59:59 WIB
+	}
+
+	tests := []struct {
+		name       string
+		start, end string
+		want       float64
+	}{
+		{"single day", "2024-03-01", "2024-03-01", 110},
+		{"two days", "2024-03-01", "2024-03-02", 11110},
+		{"last day only", "2024-03-03", "2024-03-03", 1100000},
+		{"open start", "", "2024-02-29", 1},
+		{"open end", "2024-03-02", "", 1111000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The handler parses dates as UTC and moves the end to its last second.
+			var start, end *time.Time
+			if tt.start != "" {
+				d, _ := time.Parse("2006-01-02", tt.start)
+				start = &d
+			}
+			if tt.end != "" {
+				d, _ := time.Parse("2006-01-02", tt.end)
+				d = d.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
+				end = &d
+			}
+
+			var rollup float64
+			for _, x := range trx {
+				day := x.at.In(jakarta).Format("2006-01-02")
+				if (start == nil || day >= start.Format("2006-01-02")) && (end == nil || day <= end.Format("2006-01-02")) {
+					rollup += x.amount
+				}
+			}
+
+			var raw float64
+			from, to := reportDayBounds(jakarta, start, end)
+			for _, x := range trx {
+				if (from == nil || !x.at.Before(*from)) && (to == nil || x.at.Before(*to)) {
+					raw += x.amount
+				}
+			}
+
+			assert.Equal(t, tt.want, rollup)
+			assert.Equal(t, rollup, raw)
+		})
+	}
+}
@@ -1,10 +1,16 @@
 package transaction
 
 import (
+	"context"
 	"database/sql"
-	"errors"
+	"fmt"
+	"sinibeli/internal/app/audit"
 	"sinibeli/internal/app/customer"
 	"sinibeli/internal/app/product"
+	"sinibeli/internal/infrastructure/cache"
+	"sinibeli/internal/pkg/metrics"
+	"sinibeli/internal/pkg/tracing"
+	"strconv"
 	"time"
 )
 
@@ -12,17 +18,33 @@ type TransactionService struct {
 	Repo         *TransactionRepo
 	CustomerRepo *customer.CustomerRepo
 	ProductRepo  *product.ProductRepo
+	Cache        cache.Cache
+	Invalidator  *cache.Invalidator
+	Audit        *audit.Recorder
 }
 
-func NewTransactionService(repo *TransactionRepo, customerRepo *customer.CustomerRepo, productRepo *product.ProductRepo) *TransactionService {
+func NewTransactionService(
+	repo *TransactionRepo,
+	customerRepo *customer.CustomerRepo,
+	productRepo *product.ProductRepo,
+	appCache cache.Cache,
+	invalidator *cache.Invalidator,
+	recorder *audit.Recorder,
+) *TransactionService {
 	return &TransactionService{
 		Repo:         repo,
 		CustomerRepo: customerRepo,
 		ProductRepo:  productRepo,
+		Cache:        appCache,
+		Invalidator:  invalidator,
+		Audit:        recorder,
 	}
 }
 
-func (s *TransactionService) Create(t *Transaction) error {
+func (s *TransactionService) Create(ctx context.Context, t *Transaction) error {
+
+	ctx, span := tracing.Start(ctx, "TransactionService.Create")
+	defer span.End()
 
 	if err := t.Validate(); err != nil {
 		return err
@@ -32,7 +54,7 @@ func (s *TransactionService) Create(t *Transaction) error {
 		t.TransactionDatetime = time.Now()
 	}
 
-	customer, err := s.CustomerRepo.GetByID(t.CustomerID)
+	customer, err := s.CustomerRepo.GetByID(ctx, t.CustomerID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return ErrCustomerNotFound
@@ -42,8 +64,11 @@ func (s *TransactionService) Create(t *Transaction) error {
 	if customer == nil {
 		return ErrCustomerNotFound
 	}
+	if customer.MergedInto != nil {
+		return ErrCustomerMerged
+	}
 
-	product, err := s.ProductRepo.GetByID(t.ProductID)
+	product, err := s.ProductRepo.GetByID(ctx, t.ProductID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return ErrProductNotFound
@@ -54,7 +79,7 @@ func (s *TransactionService) Create(t *Transaction) error {
 		return ErrProductNotFound
 	}
 
-	existing, err := s.Repo.GetByID(t.ID)
+	existing, err := s.Repo.GetByID(ctx, t.ID)
 	if err != nil && err != sql.ErrNoRows {
 		return err
 	}
@@ -65,12 +90,13 @@ func (s *TransactionService) Create(t *Transaction) error {
 	switch t.TransactionType {
 	case "refund":
 
-		purchaseHistory, err := s.Repo.GetTransactionsByCustomerAndProduct(t.CustomerID, t.ProductID)
+		purchaseHistory, err := s.Repo.GetTransactionsByCustomerAndProduct(ctx, t.CustomerID, t.ProductID)
 		if err != nil {
 			return err
 		}
 
 		if len(purchaseHistory) == 0 {
+			metrics.RefundsRejected.WithLabelValues(metrics.RefundReasonNoHistory).Inc()
 			return ErrInsufficientPurchaseHistory
 		}
 
@@ -91,78 +117,94 @@ func (s *TransactionService) Create(t *Transaction) error {
 
 		availableRefund := totalPurchased - totalRefunded
 		if t.Amount > availableRefund {
+			metrics.RefundsRejected.WithLabelValues(metrics.RefundReasonExceeds).Inc()
 			return ErrRefundExceedsOriginal
 		}
 
 		if t.Amount <= 0 {
-			return errors.New("refund amount must be greater than 0")
+			metrics.RefundsRejected.WithLabelValues(metrics.RefundReasonInvalidAmount).Inc()
+			return ErrInvalidAmount
 		}
 
 		if latestPurchase == nil {
-			return errors.New("no purchase found for refund")
+			metrics.RefundsRejected.WithLabelValues(metrics.RefundReasonNoPurchase).Inc()
+			return ErrNoPurchaseForRefund
 		}
 
 		refundDeadline := latestPurchase.TransactionDatetime.AddDate(0, 0, 30)
 		if t.TransactionDatetime.After(refundDeadline) {
-			return errors.New("refund period has expired (30 days limit)")
+			metrics.RefundsRejected.WithLabelValues(metrics.RefundReasonExpired).Inc()
+			return ErrRefundPeriodExpired
 		}
 
 	case "purchase":
 
 		if t.Amount < 1.0 {
-			return errors.New("minimum purchase amount is 1.00")
+			return ErrPurchaseBelowMinimum
 		}
 
 		maxPurchaseAmount := 1000000.0
 		if t.Amount > maxPurchaseAmount {
-			return errors.New("purchase amount exceeds maximum allowed limit")
+			return ErrPurchaseAboveMaximum
 		}
 
 		if t.TaxAmount > 0 {
 			taxPercentage := (t.TaxAmount / t.Amount) * 100
 
 			if taxPercentage > 50.0 {
-				return errors.New("tax amount seems unreasonably high (>50% of purchase amount)")
+				return ErrTaxTooHigh
 			}
 
 			switch t.TaxType {
 			case "VAT":
 				if taxPercentage > 25.0 {
-					return errors.New("VAT rate exceeds typical maximum (25%)")
+					return fmt.Errorf("%w: VAT rate exceeds typical maximum (25%%)", ErrTaxRateTooHigh)
 				}
 			case "GST":
 				if taxPercentage > 15.0 {
-					return errors.New("GST rate exceeds typical maximum (15%)")
+					return fmt.Errorf("%w: GST rate exceeds typical maximum (15%%)", ErrTaxRateTooHigh)
 				}
 			case "SALES_TAX":
 				if taxPercentage > 12.0 {
-					return errors.New("sales tax rate exceeds typical maximum (12%)")
+					return fmt.Errorf("%w: sales tax rate exceeds typical maximum (12%%)", ErrTaxRateTooHigh)
 				}
 			}
 		}
 
 	case "payment":
 		if t.Amount <= 0 {
-			return errors.New("payment amount must be greater than 0")
+			return ErrInvalidAmount
 		}
 	}
 
-	return s.Repo.Create(t)
+	if err := s.Repo.Create(ctx, t); err != nil {
+		return err
+	}
+	s.Invalidator.Publish(ctx, cache.EventTransactionChanged, t.ID)
+	metrics.TransactionsCreated.WithLabelValues(t.TransactionType, t.PaymentStatus).Inc()
+	metrics.TransactionAmount.WithLabelValues(strconv.FormatInt(customer.CompanyID, 10)).Add(t.Amount)
+	return s.Audit.Record(ctx, audit.Change{Entity: "transaction", EntityID: t.ID, Action: audit.ActionCreate, After: t})
 }
 
-func (s *TransactionService) GetByID(id int64) (Transaction, error) {
-	t, err := s.Repo.GetByID(id)
+func (s *TransactionService) GetByID(ctx context.Context, id int64) (Transaction, error) {
+	ctx, span := tracing.Start(ctx, "TransactionService.GetByID")
+	defer span.End()
+
+	t, err := s.Repo.GetByID(ctx, id)
 	if err != nil {
 		return Transaction{}, err
 	}
 	if t == nil {
-		return Transaction{}, errors.New("transaction not found")
+		return Transaction{}, ErrNotFound
 	}
 	return *t, nil
 }
 
-func (s *TransactionService) GetAll() ([]Transaction, error) {
-	transactions, err := s.Repo.GetAll()
+func (s *TransactionService) GetAll(ctx context.Context) ([]Transaction, error) {
+	ctx, span := tracing.Start(ctx, "TransactionService.GetAll")
+	defer span.End()
+
+	transactions, err := s.Repo.GetAll(ctx)
 	if err != nil {
 		return []Transaction{}, err
 	}
@@ -176,38 +218,54 @@ func (s *TransactionService) GetAll() ([]Transaction, error) {
 	return result, nil
 }
 
-func (s *TransactionService) GetTransactionSummary() ([]TransactionSummary, error) {
-	return s.Repo.GetTransactionSummary()
+func (s *TransactionService) GetTransactionSummary(ctx context.Context) ([]TransactionSummary, error) {
+	ctx, span := tracing.Start(ctx, "TransactionService.GetTransactionSummary")
+	defer span.End()
+
+	return s.Repo.GetTransactionSummary(ctx)
 }
 
-func (s *TransactionService) GetTransactionSummaryWithFilter(filter TransactionSummaryFilter) (TransactionSummaryResponse, error) {
+func (s *TransactionService) GetTransactionSummaryWithFilter(ctx context.Context, filter TransactionSummaryFilter) (TransactionSummaryResponse, error) {
+
+	ctx, span := tracing.Start(ctx, "TransactionService.GetTransactionSummaryWithFilter")
+	defer span.End()
 
 	if err := filter.Validate(); err != nil {
 		return TransactionSummaryResponse{}, err
 	}
 
-	data, total, err := s.Repo.GetTransactionSummaryWithFilter(filter)
+	var resp TransactionSummaryResponse
+	key := fmt.Sprintf(cache.TransactionSummaryKey, cache.HashKey(filter))
+	err := s.Cache.GetOrSet(ctx, key, &resp, cache.ReportTTL, func(ctx context.Context) (interface{}, error) {
+		data, total, err := s.Repo.GetTransactionSummaryWithFilter(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		totalPages := total / filter.PageSize
+		if total%filter.PageSize > 0 {
+			totalPages++
+		}
+
+		return TransactionSummaryResponse{
+			Data: data,
+			Pagination: Pagination{
+				Page:       filter.Page,
+				PageSize:   filter.PageSize,
+				TotalItems: total,
+				TotalPages: totalPages,
+			},
+		}, nil
+	})
 	if err != nil {
 		return TransactionSummaryResponse{}, err
 	}
 
-	totalPages := total / filter.PageSize
-	if total%filter.PageSize > 0 {
-		totalPages++
-	}
-
-	return TransactionSummaryResponse{
-		Data: data,
-		Pagination: Pagination{
-			Page:       filter.Page,
-			PageSize:   filter.PageSize,
-			TotalItems: total,
-			TotalPages: totalPages,
-		},
-	}, nil
+	return resp, nil
 }
 
 func (s *TransactionService) GetCustomerActivity(
+	ctx context.Context,
 	companyID *int64,
 	minTrxCount *int64,
 	page int64,
@@ -228,23 +286,32 @@ func (s *TransactionService) GetCustomerActivity(
 		PageSize:    pageSize,
 	}
 
-	data, total, err := s.Repo.GetCustomerActivity(filter)
+	var resp CustomerActivityResponse
+	key := fmt.Sprintf(cache.CustomerActivityKey, cache.HashKey(filter))
+	err := s.Cache.GetOrSet(ctx, key, &resp, cache.ReportTTL, func(ctx context.Context) (interface{}, error) {
+		data, total, err := s.Repo.GetCustomerActivity(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		totalPages := total / pageSize
+		if total%pageSize > 0 {
+			totalPages++
+		}
+
+		return CustomerActivityResponse{
+			Data: data,
+			Pagination: Pagination{
+				Page:       page,
+				PageSize:   pageSize,
+				TotalItems: total,
+				TotalPages: totalPages,
+			},
+		}, nil
+	})
 	if err != nil {
 		return CustomerActivityResponse{}, err
 	}
 
-	totalPages := total / pageSize
-	if total%pageSize > 0 {
-		totalPages++
-	}
-
-	return CustomerActivityResponse{
-		Data: data,
-		Pagination: Pagination{
-			Page:       page,
-			PageSize:   pageSize,
-			TotalItems: total,
-			TotalPages: totalPages,
-		},
-	}, nil
+	return resp, nil
 }
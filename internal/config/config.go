@@ -3,21 +3,33 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Server   ServerConfig   `json:"server"`
-	Database DatabaseConfig `json:"database"`
-	Cache    CacheConfig    `json:"cache"`
-	Logger   LoggerConfig   `json:"logger"`
-	JWT      JWTConfig      `json:"jwt"`
+	Server     ServerConfig     `json:"server"`
+	Database   DatabaseConfig   `json:"database"`
+	Cache      CacheConfig      `json:"cache"`
+	Logger     LoggerConfig     `json:"logger"`
+	JWT        JWTConfig        `json:"jwt"`
+	Report     ReportConfig     `json:"report"`
+	Tracing    TracingConfig    `json:"tracing"`
+	PII        PIIConfig        `json:"pii"`
+	Admin      AdminConfig      `json:"admin"`
+	Encryption EncryptionConfig `json:"encryption"`
+	Storage    StorageConfig    `json:"storage"`
+	I18N       I18NConfig       `json:"i18n"`
 }
 
 type ServerConfig struct {
-	Host string `json:"host"`
-	Port int    `json:"port"`
+	Host             string        `json:"host"`
+	Port             int           `json:"port"`
+	ShutdownTimeout  time.Duration `json:"shutdown_timeout"`
+	DrainDelay       time.Duration `json:"drain_delay"`
+	ReadinessTimeout time.Duration `json:"readiness_timeout"`
 }
 
 type DatabaseConfig struct {
@@ -30,15 +42,27 @@ type DatabaseConfig struct {
 }
 
 type CacheConfig struct {
-	Host     string `json:"host"`
-	Port     int    `json:"port"`
-	Password string `json:"password"`
-	DB       int    `json:"db"`
+	Driver           string        `json:"driver"`
+	MemorySize       int           `json:"memory_size"`
+	Host             string        `json:"host"`
+	Port             int           `json:"port"`
+	Password         string        `json:"password"`
+	DB               int           `json:"db"`
+	LocalSize        int           `json:"local_size"`
+	LocalTTL         time.Duration `json:"local_ttl"`
+	BreakerThreshold int           `json:"breaker_threshold"`
+	BreakerCooldown  time.Duration `json:"breaker_cooldown"`
 }
 
 type LoggerConfig struct {
-	Level string `json:"level"`
-	Type  string `json:"type"`
+	Level         string `json:"level"`
+	Type          string `json:"type"`
+	PackageLevels string `json:"package_levels"`
+	Output        string `json:"output"`
+	MaxSizeMB     int    `json:"max_size_mb"`
+	MaxBackups    int    `json:"max_backups"`
+	MaxAgeDays    int    `json:"max_age_days"`
+	Compress      bool   `json:"compress"`
 }
 
 type JWTConfig struct {
@@ -46,6 +70,59 @@ type JWTConfig struct {
 	Issuer    string `json:"issuer"`
 }
 
+type ReportConfig struct {
+	TimeZone              string        `json:"time_zone"`
+	RollupRefreshInterval time.Duration `json:"rollup_refresh_interval"`
+	RollupLookbackDays    int           `json:"rollup_lookback_days"`
+}
+
+type TracingConfig struct {
+	Exporter    string  `json:"exporter"`
+	Endpoint    string  `json:"endpoint"`
+	File        string  `json:"file"`
+	ServiceName string  `json:"service_name"`
+	SampleRatio float64 `json:"sample_ratio"`
+}
+
+type PIIConfig struct {
+	PrivilegedRoles []string `json:"privileged_roles"`
+}
+
+type AdminConfig struct {
+	Roles []string `json:"roles"`
+}
+
+type EncryptionConfig struct {
+	Keys          string `json:"-"`
+	ActiveKey     string `json:"active_key"`
+	BlindIndexKey string `json:"-"`
+	KeystoreFile  string `json:"keystore_file"`
+	// GenerateKeystore creates KeystoreFile when it is missing. Only
+	// ENV=development turns it on; anywhere else a missing keystore must
+	// stop the service rather than encrypt under throwaway keys.
+	GenerateKeystore bool `json:"generate_keystore"`
+}
+
+type StorageConfig struct {
+	Driver        string `json:"driver"`
+	LocalRoot     string `json:"local_root"`
+	S3Endpoint    string `json:"s3_endpoint"`
+	S3Region      string `json:"s3_region"`
+	S3Bucket      string `json:"s3_bucket"`
+	S3AccessKey   string `json:"-"`
+	S3SecretKey   string `json:"-"`
+	S3UseSSL      bool   `json:"s3_use_ssl"`
+	PhotoMaxBytes int64  `json:"photo_max_bytes"`
+	ThumbnailSize int    `json:"thumbnail_size"`
+
+	AttachmentMaxBytes int64 `json:"attachment_max_bytes"`
+}
+
+type I18NConfig struct {
+	DefaultLanguage string `json:"default_language"`
+	CatalogDir      string `json:"catalog_dir"`
+}
+
 func LoadConfig(envPath string) (*Config, error) {
 
 	if err := godotenv.Load(envPath); err != nil {
@@ -57,6 +134,21 @@ func LoadConfig(envPath string) (*Config, error) {
 		serverPort = 8080
 	}
 
+	shutdownTimeout, err := time.ParseDuration(getEnv("SHUTDOWN_TIMEOUT", "30s"))
+	if err != nil {
+		shutdownTimeout = 30 * time.Second
+	}
+
+	drainDelay, err := time.ParseDuration(getEnv("SHUTDOWN_DRAIN_DELAY", "5s"))
+	if err != nil || drainDelay < 0 {
+		drainDelay = 5 * time.Second
+	}
+
+	readinessTimeout, err := time.ParseDuration(getEnv("READINESS_TIMEOUT", "2s"))
+	if err != nil {
+		readinessTimeout = 2 * time.Second
+	}
+
 	dbPort, err := strconv.Atoi(getEnv("DB_PORT", "5000"))
 	if err != nil {
 		dbPort = 5000
@@ -72,10 +164,93 @@ func LoadConfig(envPath string) (*Config, error) {
 		cacheDB = 0
 	}
 
+	cacheMemorySize, err := strconv.Atoi(getEnv("CACHE_MEMORY_SIZE", "10000"))
+	if err != nil {
+		cacheMemorySize = 10000
+	}
+
+	cacheLocalSize, err := strconv.Atoi(getEnv("CACHE_LOCAL_SIZE", "1000"))
+	if err != nil {
+		cacheLocalSize = 1000
+	}
+
+	cacheLocalTTL, err := time.ParseDuration(getEnv("CACHE_LOCAL_TTL", "30s"))
+	if err != nil {
+		cacheLocalTTL = 30 * time.Second
+	}
+
+	cacheBreakerThreshold, err := strconv.Atoi(getEnv("CACHE_BREAKER_THRESHOLD", "5"))
+	if err != nil {
+		cacheBreakerThreshold = 5
+	}
+
+	cacheBreakerCooldown, err := time.ParseDuration(getEnv("CACHE_BREAKER_COOLDOWN", "30s"))
+	if err != nil {
+		cacheBreakerCooldown = 30 * time.Second
+	}
+
+	rollupRefreshInterval, err := time.ParseDuration(getEnv("ROLLUP_REFRESH_INTERVAL", "5m"))
+	if err != nil {
+		rollupRefreshInterval = 5 * time.Minute
+	}
+
+	rollupLookbackDays, err := strconv.Atoi(getEnv("ROLLUP_LOOKBACK_DAYS", "2"))
+	if err != nil {
+		rollupLookbackDays = 2
+	}
+
+	logMaxSize, err := strconv.Atoi(getEnv("LOG_MAX_SIZE_MB", "100"))
+	if err != nil {
+		logMaxSize = 100
+	}
+
+	logMaxBackups, err := strconv.Atoi(getEnv("LOG_MAX_BACKUPS", "5"))
+	if err != nil {
+		logMaxBackups = 5
+	}
+
+	logMaxAge, err := strconv.Atoi(getEnv("LOG_MAX_AGE_DAYS", "30"))
+	if err != nil {
+		logMaxAge = 30
+	}
+
+	logCompress, err := strconv.ParseBool(getEnv("LOG_COMPRESS", "false"))
+	if err != nil {
+		logCompress = false
+	}
+
+	storageS3UseSSL, err := strconv.ParseBool(getEnv("STORAGE_S3_USE_SSL", "true"))
+	if err != nil {
+		storageS3UseSSL = true
+	}
+
+	photoMaxBytes, err := strconv.ParseInt(getEnv("PHOTO_MAX_BYTES", "5242880"), 10, 64)
+	if err != nil {
+		photoMaxBytes = 5 << 20
+	}
+
+	thumbnailSize, err := strconv.Atoi(getEnv("PHOTO_THUMBNAIL_SIZE", "128"))
+	if err != nil {
+		thumbnailSize = 128
+	}
+
+	attachmentMaxBytes, err := strconv.ParseInt(getEnv("ATTACHMENT_MAX_BYTES", "10485760"), 10, 64)
+	if err != nil {
+		attachmentMaxBytes = 10 << 20
+	}
+
+	tracingSampleRatio, err := strconv.ParseFloat(getEnv("TRACING_SAMPLE_RATIO", "1"), 64)
+	if err != nil {
+		tracingSampleRatio = 1
+	}
+
 	config := &Config{
 		Server: ServerConfig{
-			Host: getEnv("SERVER_HOST", "localhost"),
-			Port: serverPort,
+			Host:             getEnv("SERVER_HOST", "localhost"),
+			Port:             serverPort,
+			ShutdownTimeout:  shutdownTimeout,
+			DrainDelay:       drainDelay,
+			ReadinessTimeout: readinessTimeout,
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -86,19 +261,74 @@ func LoadConfig(envPath string) (*Config, error) {
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		},
 		Cache: CacheConfig{
-			Host:     getEnv("CACHE_HOST", "localhost"),
-			Port:     cachePort,
-			Password: getEnv("CACHE_PASSWORD", ""),
-			DB:       cacheDB,
+			Driver:           getEnv("CACHE_DRIVER", "redis"),
+			MemorySize:       cacheMemorySize,
+			Host:             getEnv("CACHE_HOST", "localhost"),
+			Port:             cachePort,
+			Password:         getEnv("CACHE_PASSWORD", ""),
+			DB:               cacheDB,
+			LocalSize:        cacheLocalSize,
+			LocalTTL:         cacheLocalTTL,
+			BreakerThreshold: cacheBreakerThreshold,
+			BreakerCooldown:  cacheBreakerCooldown,
 		},
 		Logger: LoggerConfig{
-			Level: getEnv("LOG_LEVEL", "info"),
-			Type:  getEnv("LOG_TYPE", "simple"),
+			Level:         getEnv("LOG_LEVEL", "info"),
+			Type:          getEnv("LOG_TYPE", "simple"),
+			PackageLevels: getEnv("LOG_PACKAGE_LEVELS", ""),
+			Output:        getEnv("LOG_OUTPUT", "stdout"),
+			MaxSizeMB:     logMaxSize,
+			MaxBackups:    logMaxBackups,
+			MaxAgeDays:    logMaxAge,
+			Compress:      logCompress,
 		},
 		JWT: JWTConfig{
 			SecretKey: getEnv("JWT_SECRET_KEY", "your-secret-key"),
 			Issuer:    getEnv("JWT_ISSUER", "belimang-app"),
 		},
+		Report: ReportConfig{
+			TimeZone:              getEnv("REPORT_TIMEZONE", "Asia/Jakarta"),
+			RollupRefreshInterval: rollupRefreshInterval,
+			RollupLookbackDays:    rollupLookbackDays,
+		},
+		Tracing: TracingConfig{
+			Exporter:    getEnv("TRACING_EXPORTER", "none"),
+			Endpoint:    getEnv("TRACING_OTLP_ENDPOINT", ""),
+			File:        getEnv("TRACING_FILE", ""),
+			ServiceName: getEnv("TRACING_SERVICE_NAME", "sinibeli"),
+			SampleRatio: tracingSampleRatio,
+		},
+		PII: PIIConfig{
+			PrivilegedRoles: splitList(getEnv("PII_PRIVILEGED_ROLES", "admin,support")),
+		},
+		Admin: AdminConfig{
+			Roles: splitList(getEnv("ADMIN_ROLES", "admin")),
+		},
+		Encryption: EncryptionConfig{
+			Keys:             getEnv("ENCRYPTION_KEYS", ""),
+			ActiveKey:        getEnv("ENCRYPTION_ACTIVE_KEY", ""),
+			BlindIndexKey:    getEnv("ENCRYPTION_BLIND_INDEX_KEY", ""),
+			KeystoreFile:     getEnv("ENCRYPTION_KEYSTORE_FILE", ".keystore/dev.json"),
+			GenerateKeystore: getEnv("ENV", "production") == "development",
+		},
+		Storage: StorageConfig{
+			Driver:        getEnv("STORAGE_DRIVER", "local"),
+			LocalRoot:     getEnv("STORAGE_LOCAL_ROOT", "./data/blobs"),
+			S3Endpoint:    getEnv("STORAGE_S3_ENDPOINT", ""),
+			S3Region:      getEnv("STORAGE_S3_REGION", ""),
+			S3Bucket:      getEnv("STORAGE_S3_BUCKET", ""),
+			S3AccessKey:   getEnv("STORAGE_S3_ACCESS_KEY", ""),
+			S3SecretKey:   getEnv("STORAGE_S3_SECRET_KEY", ""),
+			S3UseSSL:      storageS3UseSSL,
+			PhotoMaxBytes: photoMaxBytes,
+			ThumbnailSize: thumbnailSize,
+
+			AttachmentMaxBytes: attachmentMaxBytes,
+		},
+		I18N: I18NConfig{
+			DefaultLanguage: getEnv("I18N_DEFAULT_LANGUAGE", "en"),
+			CatalogDir:      getEnv("I18N_CATALOG_DIR", ""),
+		},
 	}
 
 	return config, nil
@@ -110,3 +340,13 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
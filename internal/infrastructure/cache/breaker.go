@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("cache circuit breaker is open")
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// breaker stops talking to Redis after a run of consecutive failures, so an
+// outage costs one fast local check per request instead of a network timeout.
+// After the cooldown a single probe is let through to test recovery.
+type breaker struct {
+	mu          sync.Mutex
+	state       string
+	failures    int
+	threshold   int
+	cooldown    time.Duration
+	openedAt    time.Time
+	probeActive bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{state: BreakerClosed, threshold: threshold, cooldown: cooldown}
+}
+
+func (b *breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probeActive = true
+		return true
+	case BreakerHalfOpen:
+		if b.probeActive {
+			return false
+		}
+		b.probeActive = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = BreakerClosed
+	b.failures = 0
+	b.probeActive = false
+}
+
+func (b *breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probeActive = false
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// Abort ends a call that was allowed through without telling anything about
+// Redis, such as a cancelled request. A half-open breaker lets the next call
+// probe instead.
+func (b *breaker) Abort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probeActive = false
+}
+
+func (b *breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// expire moves the breaker's cooldown into the past.
+func expire(b *breaker) {
+	b.mu.Lock()
+	b.openedAt = time.Now().Add(-b.cooldown)
+	b.mu.Unlock()
+}
+
+func TestBreakerCycle(t *testing.T) {
+	b := newBreaker(2, time.Minute)
+	assert.True(t, b.Allow())
+
+	b.Failure()
+	assert.Equal(t, BreakerClosed, b.State())
+	b.Failure()
+	assert.Equal(t, BreakerOpen, b.State())
+	assert.False(t, b.Allow(), "open breaker lets calls through before the cooldown")
+
+	expire(b)
+	assert.True(t, b.Allow(), "the first call after the cooldown probes")
+	assert.Equal(t, BreakerHalfOpen, b.State())
+	assert.False(t, b.Allow(), "only one probe at a time")
+
+	b.Failure()
+	assert.Equal(t, BreakerOpen, b.State(), "a failed probe reopens")
+	assert.False(t, b.Allow())
+
+	expire(b)
+	assert.True(t, b.Allow())
+	b.Success()
+	assert.Equal(t, BreakerClosed, b.State())
+	assert.True(t, b.Allow())
+	assert.True(t, b.Allow())
+}
+
+func TestBreakerAbortedProbe(t *testing.T) {
+	b := newBreaker(1, time.Minute)
+	b.Failure()
+	expire(b)
+
+	assert.True(t, b.Allow())
+	b.Abort()
+	assert.Equal(t, BreakerHalfOpen, b.State())
+	assert.True(t, b.Allow(), "an aborted probe must not hold the breaker half-open")
+
+	b.Success()
+	assert.Equal(t, BreakerClosed, b.State())
+}
@@ -0,0 +1,39 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"sinibeli/internal/config"
+)
+
+const (
+	DriverRedis  = "redis"
+	DriverMemory = "memory"
+)
+
+var ErrCacheMiss = errors.New("cache miss")
+
+// Cache is the contract services depend on. Values are stored as JSON, and Get
+// returns ErrCacheMiss when the key is absent or expired.
+type Cache interface {
+	Get(ctx context.Context, key string, dest interface{}) error
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
+	Delete(ctx context.Context, key string) error
+	DeletePattern(ctx context.Context, pattern string) error
+	Exists(ctx context.Context, key string) (bool, error)
+	GetMultiple(ctx context.Context, keys []string) (map[string]string, error)
+	SetMultiple(ctx context.Context, data map[string]interface{}, expiration time.Duration) error
+	GetOrSet(ctx context.Context, key string, dest interface{}, ttl time.Duration, fetchFn func(context.Context) (interface{}, error)) error
+	Ping(ctx context.Context) error
+	Close() error
+	Stats() Stats
+}
+
+func New(cfg config.CacheConfig) Cache {
+	if cfg.Driver == DriverMemory {
+		return NewMemoryCache(cfg.MemorySize)
+	}
+	return NewRedisCache(cfg)
+}
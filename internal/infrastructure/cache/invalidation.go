@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	logger "sinibeli/internal/pkg/logging"
+)
+
+type Event string
+
+const (
+	EventProductChanged     Event = "product.changed"
+	EventCompanyChanged     Event = "company.changed"
+	EventCustomerChanged    Event = "customer.changed"
+	EventTransactionChanged Event = "transaction.changed"
+	EventAttachmentChanged  Event = "attachment.changed"
+)
+
+// invalidationRules lists, per event, the keys and key patterns whose cached
+// value may no longer match the database once the event has happened.
+var invalidationRules = map[Event]func(id string) []string{
+	EventProductChanged: func(id string) []string {
+		return []string{fmt.Sprintf(ProductKey, id), fmt.Sprintf(ProductListKey, "*"), ReportKeyPattern}
+	},
+	EventCompanyChanged: func(id string) []string {
+		return []string{fmt.Sprintf(CompanyKey, id), fmt.Sprintf(CompanyListKey, "*"), ReportKeyPattern}
+	},
+	EventCustomerChanged: func(id string) []string {
+		return []string{ReportKeyPattern}
+	},
+	EventTransactionChanged: func(id string) []string {
+		return []string{ReportKeyPattern}
+	},
+	// Attachment events carry the transaction ID: the per-transaction list and
+	// checksum lookups are what change when a file is added or removed.
+	EventAttachmentChanged: func(id string) []string {
+		return []string{fmt.Sprintf(UserFileListKey, id), fmt.Sprintf(FileExistsKey, id+":*")}
+	},
+}
+
+type Invalidator struct {
+	cache Cache
+}
+
+func NewInvalidator(cache Cache) *Invalidator {
+	return &Invalidator{cache: cache}
+}
+
+// Publish drops every cached entry affected by the event. Failures are only
+// logged: the write that triggered the event has already been committed.
+func (i *Invalidator) Publish(ctx context.Context, event Event, id int64) {
+	rule, ok := invalidationRules[event]
+	if !ok {
+		return
+	}
+
+	for _, key := range rule(fmt.Sprint(id)) {
+		var err error
+		if strings.ContainsAny(key, "*?[") {
+			err = i.cache.DeletePattern(ctx, key)
+		} else {
+			err = i.cache.Delete(ctx, key)
+		}
+		if err != nil {
+			logger.WarnCtx(ctx, "Cache invalidation failed", "event", event, "key", key, "error", err)
+		}
+	}
+}
+
+// HashKey derives a stable cache key suffix from a filter value so that
+// requests with the same filters share one cache entry.
+func HashKey(filter interface{}) string {
+	data, err := json.Marshal(filter)
+	if err != nil {
+		return "invalid"
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:12])
+}
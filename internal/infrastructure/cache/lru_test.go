@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUEviction(t *testing.T) {
+	cases := []struct {
+		name  string
+		ops   []string // "set:k" or "get:k"
+		keep  []string
+		evict []string
+	}{
+		{"oldest goes first", []string{"set:a", "set:b", "set:c", "set:d"}, []string{"b", "c", "d"}, []string{"a"}},
+		{"get refreshes", []string{"set:a", "set:b", "set:c", "get:a", "set:d"}, []string{"a", "c", "d"}, []string{"b"}},
+		{"set refreshes", []string{"set:a", "set:b", "set:c", "set:a", "set:d"}, []string{"a", "c", "d"}, []string{"b"}},
+		{"miss does not refresh", []string{"set:a", "set:b", "get:x", "set:c", "set:d"}, []string{"b", "c", "d"}, []string{"a"}},
+		{"several evicted in order", []string{"set:a", "set:b", "set:c", "get:a", "set:d", "set:e"}, []string{"a", "d", "e"}, []string{"b", "c"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			l := newLRU(3, time.Minute)
+			for _, op := range tc.ops {
+				key := op[4:]
+				if op[:3] == "set" {
+					l.Set(key, []byte(key), 0)
+				} else {
+					l.Get(key)
+				}
+			}
+			assert.Equal(t, len(tc.keep), l.Len())
+			for _, key := range tc.keep {
+				_, ok := l.Get(key)
+				assert.True(t, ok, "%s should be kept", key)
+			}
+			for _, key := range tc.evict {
+				_, ok := l.Get(key)
+				assert.False(t, ok, "%s should be evicted", key)
+			}
+		})
+	}
+}
+
+func TestLRUTTL(t *testing.T) {
+	cases := []struct {
+		name    string
+		lruTTL  time.Duration
+		ttl     time.Duration
+		age     time.Duration
+		present bool
+	}{
+		{"fresh", time.Minute, 0, 30 * time.Second, true},
+		{"past lru ttl", time.Minute, 0, 61 * time.Second, false},
+		{"shorter entry ttl wins", time.Minute, 10 * time.Second, 11 * time.Second, false},
+		{"longer entry ttl is capped", time.Minute, time.Hour, 61 * time.Second, false},
+		{"within entry ttl", time.Minute, 10 * time.Second, 9 * time.Second, true},
+		{"negative ttl uses lru ttl", time.Minute, -time.Second, 30 * time.Second, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			l := newLRU(3, tc.lruTTL)
+			l.Set("k", []byte("v"), tc.ttl)
+
+			// Age the entry rather than sleeping.
+			entry := l.items["k"].Value.(*lruEntry)
+			entry.expiresAt = entry.expiresAt.Add(-tc.age)
+
+			v, ok := l.Get("k")
+			assert.Equal(t, tc.present, ok)
+			if tc.present {
+				assert.Equal(t, []byte("v"), v)
+			} else {
+				assert.Zero(t, l.Len(), "expired entry should be dropped on read")
+			}
+		})
+	}
+}
+
+func TestLRUDelete(t *testing.T) {
+	l := newLRU(10, time.Minute)
+	for _, key := range []string{"customer:1", "customer:2", "customers:all", "product:1"} {
+		l.Set(key, []byte(key), 0)
+	}
+
+	l.Delete("product:1")
+	l.DeletePattern("customer:*")
+	assert.Equal(t, 1, l.Len())
+	_, ok := l.Get("customers:all")
+	assert.True(t, ok)
+
+	disabled := newLRU(0, time.Minute)
+	disabled.Set("k", []byte("v"), 0)
+	assert.Zero(t, disabled.Len())
+}
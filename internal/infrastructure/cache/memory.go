@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	logger "sinibeli/internal/pkg/logging"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// noExpiry stands in for a zero TTL, which means "keep forever" in Redis.
+const noExpiry = 100 * 365 * 24 * time.Hour
+
+var _ Cache = (*MemoryCache)(nil)
+
+// MemoryCache keeps everything in process. It is meant for local development
+// and tests; entries are not shared between instances.
+type MemoryCache struct {
+	store *lru
+	group singleflight.Group
+	stats counters
+}
+
+func NewMemoryCache(size int) *MemoryCache {
+	if size <= 0 {
+		size = 10000
+	}
+	logger.Info("Using in-memory cache", "size", size)
+	return &MemoryCache{store: newLRU(size, noExpiry)}
+}
+
+func (c *MemoryCache) Get(ctx context.Context, key string, dest interface{}) error {
+	data, ok := c.store.Get(key)
+	if !ok {
+		c.stats.misses.Add(1)
+		logger.DebugCtx(ctx, "Memory cache miss", "key", key)
+		return ErrCacheMiss
+	}
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		c.stats.errors.Add(1)
+		logger.ErrorCtx(ctx, "Memory GET unmarshal failed", "key", key, "error", err)
+		return err
+	}
+
+	c.stats.hits.Add(1)
+	logger.DebugCtx(ctx, "Memory cache hit", "key", key)
+	return nil
+}
+
+func (c *MemoryCache) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		logger.ErrorCtx(ctx, "Memory SET marshal failed", "key", key, "error", err)
+		return err
+	}
+	c.store.Set(key, data, expiration)
+	return nil
+}
+
+func (c *MemoryCache) Delete(ctx context.Context, key string) error {
+	c.store.Delete(key)
+	return nil
+}
+
+func (c *MemoryCache) DeletePattern(ctx context.Context, pattern string) error {
+	c.store.DeletePattern(pattern)
+	return nil
+}
+
+func (c *MemoryCache) Exists(ctx context.Context, key string) (bool, error) {
+	_, ok := c.store.Get(key)
+	return ok, nil
+}
+
+func (c *MemoryCache) GetMultiple(ctx context.Context, keys []string) (map[string]string, error) {
+	data := make(map[string]string)
+	for _, key := range keys {
+		if value, ok := c.store.Get(key); ok {
+			data[key] = string(value)
+		}
+	}
+
+	c.stats.hits.Add(int64(len(data)))
+	c.stats.misses.Add(int64(len(keys) - len(data)))
+	return data, nil
+}
+
+func (c *MemoryCache) SetMultiple(ctx context.Context, data map[string]interface{}, expiration time.Duration) error {
+	for key, value := range data {
+		if err := c.Set(ctx, key, value, expiration); err != nil {
+			continue
+		}
+	}
+	return nil
+}
+
+// GetOrSet coalesces concurrent misses on key into one fetchFn call. Like
+// RedisCache.GetOrSet, fetchFn gets the caller's values without its
+// cancellation, because the result is shared with every coalesced caller.
+func (c *MemoryCache) GetOrSet(ctx context.Context, key string, dest interface{}, ttl time.Duration, fetchFn func(context.Context) (interface{}, error)) error {
+	if data, ok := c.store.Get(key); ok {
+		c.stats.hits.Add(1)
+		return json.Unmarshal(data, dest)
+	}
+	c.stats.misses.Add(1)
+
+	result, err, shared := c.group.Do(key, func() (interface{}, error) {
+		ctx := context.WithoutCancel(ctx)
+		data, err := fetchFn(ctx)
+		if err != nil {
+			logger.ErrorCtx(ctx, "Memory GET OR SET - fetch failed", "key", key, "error", err)
+			return nil, err
+		}
+		value, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		c.store.Set(key, value, ttl)
+		return value, nil
+	})
+	if err != nil {
+		return err
+	}
+	if shared {
+		c.stats.coalesced.Add(1)
+	}
+
+	return json.Unmarshal(result.([]byte), dest)
+}
+
+func (c *MemoryCache) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (c *MemoryCache) Close() error {
+	return nil
+}
+
+func (c *MemoryCache) Stats() Stats {
+	s := c.stats.snapshot()
+	s.LocalEntries = c.store.Len()
+	s.BreakerState = BreakerClosed
+	return s
+}
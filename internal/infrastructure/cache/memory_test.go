@@ -0,0 +1,31 @@
+package cache
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	logger "sinibeli/internal/pkg/logging"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type ctxKey struct{}
+
+func TestMemoryGetOrSetIgnoresCallerCancellation(t *testing.T) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	c := NewMemoryCache(10)
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "req-1"))
+	cancel()
+
+	var got string
+	err := c.GetOrSet(ctx, "k", &got, time.Minute, func(ctx context.Context) (interface{}, error) {
+		assert.Equal(t, "req-1", ctx.Value(ctxKey{}))
+		return "v", ctx.Err()
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "v", got)
+}
@@ -3,23 +3,38 @@ package cache
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	logger "sinibeli/internal/pkg/logging"
+	"strings"
 	"time"
 
 	"sinibeli/internal/config"
 
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
 )
 
+var _ Cache = (*RedisCache)(nil)
+
 type RedisCache struct {
-	client *redis.Client
+	client  *redis.Client
+	pubsub  *redis.PubSub
+	local   *lru
+	breaker *breaker
+	group   singleflight.Group
+	stats   counters
 }
 
 type CacheConfig struct {
-	Addr     string
-	Password string
-	DB       int
+	Addr             string
+	Password         string
+	DB               int
+	LocalSize        int
+	LocalTTL         time.Duration
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
 }
 
 const (
@@ -29,6 +44,13 @@ const (
 	ProductListKey  = "products:list:%s"
 	ProductKey      = "product:%s"
 	UserProfileKey  = "user:profile:%s"
+	CompanyListKey  = "companies:list:%s"
+	CompanyKey      = "company:%s"
+
+	TransactionSummaryKey = "reports:summary:%s"
+	CustomerActivityKey   = "reports:activity:%s"
+	TimeSeriesKey         = "reports:timeseries:%s"
+	ReportKeyPattern      = "reports:*"
 )
 
 const (
@@ -38,44 +60,95 @@ const (
 	ProductListTTL  = 10 * time.Minute
 	ProductTTL      = 30 * time.Minute
 	UserProfileTTL  = 15 * time.Minute
+	CompanyListTTL  = 10 * time.Minute
+	CompanyTTL      = 30 * time.Minute
+	ReportTTL       = 5 * time.Minute
+)
+
+const (
+	invalidationChannel = "cache:invalidate"
+	earlyRefreshBeta    = 1.0
 )
 
 func NewRedisCache(config config.CacheConfig) *RedisCache {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", config.Host, config.Port),
-		Password: config.Password,
-		DB:       config.DB,
+	return NewRedisCacheFromConfig(CacheConfig{
+		Addr:             fmt.Sprintf("%s:%d", config.Host, config.Port),
+		Password:         config.Password,
+		DB:               config.DB,
+		LocalSize:        config.LocalSize,
+		LocalTTL:         config.LocalTTL,
+		BreakerThreshold: config.BreakerThreshold,
+		BreakerCooldown:  config.BreakerCooldown,
 	})
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := rdb.Ping(ctx).Err(); err != nil {
-		logger.Error("Redis connection failed", "error", err, "addr", fmt.Sprintf("%s:%d", config.Host, config.Port))
-	} else {
-		logger.Info("Redis connected successfully", "addr", fmt.Sprintf("%s:%d", config.Host, config.Port), "db", config.DB)
-	}
-
-	return &RedisCache{client: rdb}
 }
 
 func NewRedisCacheFromConfig(config CacheConfig) *RedisCache {
 	rdb := redis.NewClient(&redis.Options{
-		Addr:     config.Addr,
-		Password: config.Password,
-		DB:       config.DB,
+		Addr:         config.Addr,
+		Password:     config.Password,
+		DB:           config.DB,
+		DialTimeout:  2 * time.Second,
+		ReadTimeout:  500 * time.Millisecond,
+		WriteTimeout: 500 * time.Millisecond,
 	})
 
+	// Command spans carry the command name only; values are JSON-encoded
+	// entities and must not end up in the tracing backend.
+	if err := redisotel.InstrumentTracing(rdb, redisotel.WithDBStatement(false)); err != nil {
+		logger.Warn("Redis tracing disabled", "error", err)
+	}
+
+	if config.BreakerThreshold <= 0 {
+		config.BreakerThreshold = 5
+	}
+	if config.BreakerCooldown <= 0 {
+		config.BreakerCooldown = 30 * time.Second
+	}
+	if config.LocalTTL <= 0 {
+		config.LocalTTL = 30 * time.Second
+	}
+
+	c := &RedisCache{
+		client:  rdb,
+		local:   newLRU(config.LocalSize, config.LocalTTL),
+		breaker: newBreaker(config.BreakerThreshold, config.BreakerCooldown),
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := rdb.Ping(ctx).Err(); err != nil {
+		c.breaker.Failure()
 		logger.Error("Redis connection failed", "error", err, "addr", config.Addr)
 	} else {
 		logger.Info("Redis connected successfully", "addr", config.Addr, "db", config.DB)
 	}
 
-	return &RedisCache{client: rdb}
+	c.pubsub = rdb.Subscribe(context.Background(), invalidationChannel)
+	go c.listenInvalidations()
+
+	return c
+}
+
+// guard runs a Redis call through the circuit breaker. A miss is a healthy
+// answer, and a cancelled request says nothing about Redis, so neither counts
+// as a failure.
+func (c *RedisCache) guard(fn func() error) error {
+	if !c.breaker.Allow() {
+		c.stats.bypassed.Add(1)
+		return ErrCircuitOpen
+	}
+
+	err := fn()
+	switch {
+	case err == nil || err == redis.Nil:
+		c.breaker.Success()
+	case errors.Is(err, context.Canceled):
+		c.breaker.Abort()
+	default:
+		c.breaker.Failure()
+	}
+	return err
 }
 
 func (c *RedisCache) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
@@ -85,8 +158,13 @@ func (c *RedisCache) Set(ctx context.Context, key string, value interface{}, exp
 		return err
 	}
 
-	err = c.client.Set(ctx, key, jsonData, expiration).Err()
-	if err != nil {
+	c.local.Delete(key)
+	err = c.guard(func() error {
+		return c.client.Set(ctx, key, jsonData, expiration).Err()
+	})
+	if err == ErrCircuitOpen {
+		logger.DebugCtx(ctx, "Redis SET bypassed", "key", key)
+	} else if err != nil {
 		logger.ErrorCtx(ctx, "Redis SET failed", "key", key, "error", err)
 	} else {
 		logger.DebugCtx(ctx, "Redis SET success", "key", key, "ttl", expiration)
@@ -95,11 +173,21 @@ func (c *RedisCache) Set(ctx context.Context, key string, value interface{}, exp
 }
 
 func (c *RedisCache) Get(ctx context.Context, key string, dest interface{}) error {
-	result, err := c.client.Get(ctx, key).Result()
+	var result string
+	err := c.guard(func() error {
+		var err error
+		result, err = c.client.Get(ctx, key).Result()
+		return err
+	})
 	if err != nil {
 		if err == redis.Nil {
+			c.stats.misses.Add(1)
 			logger.DebugCtx(ctx, "Redis cache miss", "key", key)
+			return ErrCacheMiss
+		} else if err == ErrCircuitOpen {
+			logger.DebugCtx(ctx, "Redis GET bypassed", "key", key)
 		} else {
+			c.stats.errors.Add(1)
 			logger.ErrorCtx(ctx, "Redis GET failed", "key", key, "error", err)
 		}
 		return err
@@ -107,26 +195,64 @@ func (c *RedisCache) Get(ctx context.Context, key string, dest interface{}) erro
 
 	err = json.Unmarshal([]byte(result), dest)
 	if err != nil {
+		c.stats.errors.Add(1)
 		logger.ErrorCtx(ctx, "Redis GET unmarshal failed", "key", key, "error", err)
 		return err
 	}
 
+	c.stats.hits.Add(1)
 	logger.DebugCtx(ctx, "Redis cache hit", "key", key)
 	return nil
 }
 
 func (c *RedisCache) Delete(ctx context.Context, key string) error {
-	err := c.client.Del(ctx, key).Err()
+	c.local.Delete(key)
+	err := c.guard(func() error {
+		return c.client.Del(ctx, key).Err()
+	})
 	if err != nil {
 		logger.ErrorCtx(ctx, "Redis DELETE failed", "key", key, "error", err)
-	} else {
-		logger.DebugCtx(ctx, "Redis DELETE success", "key", key)
+		return err
 	}
-	return err
+
+	c.broadcastInvalidation(ctx, key)
+	logger.DebugCtx(ctx, "Redis DELETE success", "key", key)
+	return nil
+}
+
+// DeletePattern removes every key matching a glob pattern. It walks the
+// keyspace with SCAN so it never blocks Redis the way KEYS would.
+func (c *RedisCache) DeletePattern(ctx context.Context, pattern string) error {
+	c.local.DeletePattern(pattern)
+
+	var deleted int64
+	err := c.guard(func() error {
+		iter := c.client.Scan(ctx, 0, pattern, 100).Iterator()
+		for iter.Next(ctx) {
+			if err := c.client.Del(ctx, iter.Val()).Err(); err != nil {
+				return err
+			}
+			deleted++
+		}
+		return iter.Err()
+	})
+	if err != nil {
+		logger.ErrorCtx(ctx, "Redis DELETE PATTERN failed", "pattern", pattern, "error", err)
+		return err
+	}
+
+	c.broadcastInvalidation(ctx, pattern)
+	logger.DebugCtx(ctx, "Redis DELETE PATTERN success", "pattern", pattern, "deleted", deleted)
+	return nil
 }
 
 func (c *RedisCache) Exists(ctx context.Context, key string) (bool, error) {
-	result, err := c.client.Exists(ctx, key).Result()
+	var result int64
+	err := c.guard(func() error {
+		var err error
+		result, err = c.client.Exists(ctx, key).Result()
+		return err
+	})
 	if err != nil {
 		logger.ErrorCtx(ctx, "Redis EXISTS failed", "key", key, "error", err)
 		return false, err
@@ -147,6 +273,9 @@ func (c *RedisCache) Ping(ctx context.Context) error {
 
 func (c *RedisCache) Close() error {
 	logger.Info("Closing Redis connection")
+	if c.pubsub != nil {
+		c.pubsub.Close()
+	}
 	return c.client.Close()
 }
 
@@ -159,10 +288,14 @@ func (c *RedisCache) SetMultiple(ctx context.Context, data map[string]interface{
 			logger.ErrorCtx(ctx, "Redis SET MULTIPLE marshal failed", "key", key, "error", err)
 			continue
 		}
+		c.local.Delete(key)
 		pipe.Set(ctx, key, jsonData, expiration)
 	}
 
-	_, err := pipe.Exec(ctx)
+	err := c.guard(func() error {
+		_, err := pipe.Exec(ctx)
+		return err
+	})
 	if err != nil {
 		logger.ErrorCtx(ctx, "Redis SET MULTIPLE failed", "error", err, "count", len(data))
 	} else {
@@ -176,8 +309,14 @@ func (c *RedisCache) GetMultiple(ctx context.Context, keys []string) (map[string
 		return make(map[string]string), nil
 	}
 
-	results, err := c.client.MGet(ctx, keys...).Result()
+	var results []interface{}
+	err := c.guard(func() error {
+		var err error
+		results, err = c.client.MGet(ctx, keys...).Result()
+		return err
+	})
 	if err != nil {
+		c.stats.errors.Add(1)
 		logger.ErrorCtx(ctx, "Redis GET MULTIPLE failed", "error", err, "keys", keys)
 		return nil, err
 	}
@@ -194,33 +333,109 @@ func (c *RedisCache) GetMultiple(ctx context.Context, keys []string) (map[string
 		}
 	}
 
+	c.stats.hits.Add(int64(hitCount))
+	c.stats.misses.Add(int64(len(keys) - hitCount))
+
 	logger.DebugCtx(ctx, "Redis GET MULTIPLE completed",
 		"total", len(keys), "hits", hitCount, "misses", len(keys)-hitCount)
 
 	return data, nil
 }
 
-func (c *RedisCache) GetOrSet(ctx context.Context, key string, dest interface{}, ttl time.Duration, fetchFn func() (interface{}, error)) error {
+// GetOrSet serves key from the in-process tier, then Redis, and only then
+// calls fetchFn. Concurrent misses on the same key are coalesced into a single
+// fetch, and entries close to expiry are refreshed early by one caller so a
+// popular key does not expire for everyone at once. fetchFn gets a context
+// that keeps the caller's values but not its cancellation, since the result is
+// shared with every coalesced caller.
+func (c *RedisCache) GetOrSet(ctx context.Context, key string, dest interface{}, ttl time.Duration, fetchFn func(context.Context) (interface{}, error)) error {
+	if data, ok := c.local.Get(key); ok {
+		c.stats.localHits.Add(1)
+		return json.Unmarshal(data, dest)
+	}
 
-	err := c.Get(ctx, key, dest)
-	if err == nil {
-		return nil
+	result, err, shared := c.group.Do(key, func() (interface{}, error) {
+		return c.load(context.WithoutCancel(ctx), key, ttl, fetchFn)
+	})
+	if err != nil {
+		return err
+	}
+	if shared {
+		c.stats.coalesced.Add(1)
 	}
 
-	if err != redis.Nil {
-		logger.ErrorCtx(ctx, "Redis GET OR SET - cache error", "key", key, "error", err)
+	return json.Unmarshal(result.([]byte), dest)
+}
+
+func (c *RedisCache) load(ctx context.Context, key string, ttl time.Duration, fetchFn func(context.Context) (interface{}, error)) ([]byte, error) {
+	var env envelope
+	err := c.Get(ctx, key, &env)
+	if err == nil && env.Value == nil {
+		err = ErrCacheMiss
+	}
+
+	now := time.Now()
+	switch {
+	case err == nil && !env.shouldRefresh(now, earlyRefreshBeta):
+		c.local.Set(key, env.Value, env.expiresAt().Sub(now))
+		return env.Value, nil
+	case err == nil:
+		c.stats.earlyRefreshes.Add(1)
+		logger.DebugCtx(ctx, "Redis GET OR SET - early refresh", "key", key)
+	case err != ErrCacheMiss:
+		logger.WarnCtx(ctx, "Redis GET OR SET - cache unavailable, using source", "key", key, "error", err)
+	}
+
+	start := time.Now()
+	data, fetchErr := fetchFn(ctx)
+	if fetchErr != nil {
+		if env.Value != nil {
+			logger.WarnCtx(ctx, "Redis GET OR SET - refresh failed, serving cached value", "key", key, "error", fetchErr)
+			return env.Value, nil
+		}
+		logger.ErrorCtx(ctx, "Redis GET OR SET - fetch failed", "key", key, "error", fetchErr)
+		return nil, fetchErr
 	}
+	delta := time.Since(start)
 
-	data, err := fetchFn()
+	value, err := json.Marshal(data)
 	if err != nil {
-		logger.ErrorCtx(ctx, "Redis GET OR SET - fetch failed", "key", key, "error", err)
-		return err
+		return nil, err
 	}
 
-	if setErr := c.Set(ctx, key, data, ttl); setErr != nil {
+	fresh := envelope{Value: value, Delta: delta.Milliseconds(), ExpiresAt: time.Now().Add(ttl).UnixMilli()}
+	if setErr := c.Set(ctx, key, fresh, ttl); setErr != nil {
 		logger.WarnCtx(ctx, "Redis GET OR SET - cache set failed", "key", key, "error", setErr)
 	}
+	c.local.Set(key, value, ttl)
+
+	return value, nil
+}
+
+// broadcastInvalidation tells other instances to drop their in-process copy
+// of a key or pattern that was just deleted from Redis.
+func (c *RedisCache) broadcastInvalidation(ctx context.Context, keyOrPattern string) {
+	err := c.guard(func() error {
+		return c.client.Publish(ctx, invalidationChannel, keyOrPattern).Err()
+	})
+	if err != nil {
+		logger.WarnCtx(ctx, "Redis invalidation broadcast failed", "key", keyOrPattern, "error", err)
+	}
+}
+
+func (c *RedisCache) listenInvalidations() {
+	for msg := range c.pubsub.Channel() {
+		if strings.ContainsAny(msg.Payload, "*?[") {
+			c.local.DeletePattern(msg.Payload)
+		} else {
+			c.local.Delete(msg.Payload)
+		}
+	}
+}
 
-	jsonData, _ := json.Marshal(data)
-	return json.Unmarshal(jsonData, dest)
+func (c *RedisCache) Stats() Stats {
+	s := c.stats.snapshot()
+	s.LocalEntries = c.local.Len()
+	s.BreakerState = c.breaker.State()
+	return s
 }
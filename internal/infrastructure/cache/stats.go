@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+)
+
+type Stats struct {
+	Hits           int64   `json:"hits"`
+	LocalHits      int64   `json:"local_hits"`
+	Misses         int64   `json:"misses"`
+	Errors         int64   `json:"errors"`
+	Bypassed       int64   `json:"bypassed"`
+	Coalesced      int64   `json:"coalesced"`
+	EarlyRefreshes int64   `json:"early_refreshes"`
+	HitRatio       float64 `json:"hit_ratio"`
+	LocalEntries   int     `json:"local_entries"`
+	BreakerState   string  `json:"breaker_state"`
+}
+
+type counters struct {
+	hits           atomic.Int64
+	localHits      atomic.Int64
+	misses         atomic.Int64
+	errors         atomic.Int64
+	bypassed       atomic.Int64
+	coalesced      atomic.Int64
+	earlyRefreshes atomic.Int64
+}
+
+func (c *counters) snapshot() Stats {
+	s := Stats{
+		Hits:           c.hits.Load(),
+		LocalHits:      c.localHits.Load(),
+		Misses:         c.misses.Load(),
+		Errors:         c.errors.Load(),
+		Bypassed:       c.bypassed.Load(),
+		Coalesced:      c.coalesced.Load(),
+		EarlyRefreshes: c.earlyRefreshes.Load(),
+	}
+	if lookups := s.Hits + s.LocalHits + s.Misses; lookups > 0 {
+		s.HitRatio = float64(s.Hits+s.LocalHits) / float64(lookups)
+	}
+	return s
+}
+
+// envelope is what GetOrSet stores in Redis: the value plus how long it took
+// to compute and when it expires, which drives probabilistic early refresh.
+type envelope struct {
+	Value     json.RawMessage `json:"v"`
+	Delta     int64           `json:"d"`
+	ExpiresAt int64           `json:"e"`
+}
+
+func (e envelope) expiresAt() time.Time {
+	return time.UnixMilli(e.ExpiresAt)
+}
+
+// shouldRefresh implements the XFetch rule: recompute when
+// now - delta*beta*ln(rand) >= expiry. Expensive values start refreshing
+// earlier, and the randomness spreads refreshes across callers.
+func (e envelope) shouldRefresh(now time.Time, beta float64) bool {
+	return e.refreshDue(now, beta, rand.Float64())
+}
+
+// refreshDue is shouldRefresh for a given draw u from [0, 1).
+func (e envelope) refreshDue(now time.Time, beta, u float64) bool {
+	gap := float64(e.Delta) * beta * -math.Log(1-u)
+	return now.Add(time.Duration(gap) * time.Millisecond).After(e.expiresAt())
+}
@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshDue(t *testing.T) {
+	now := time.UnixMilli(1_700_000_000_000)
+	at := func(d time.Duration) int64 { return now.Add(d).UnixMilli() }
+
+	cases := []struct {
+		name string
+		env  envelope
+		beta float64
+		u    float64
+		want bool
+	}{
+		{"expired always refreshes", envelope{Delta: 100, ExpiresAt: at(-time.Millisecond)}, 1, 0, true},
+		{"at expiry without a gap", envelope{Delta: 100, ExpiresAt: at(0)}, 1, 0, false},
+		{"at expiry with any gap", envelope{Delta: 100, ExpiresAt: at(0)}, 1, 0.5, true},
+		{"free values never refresh early", envelope{Delta: 0, ExpiresAt: at(time.Millisecond)}, 1, 0.999999, false},
+		{"beta zero never refreshes early", envelope{Delta: 100, ExpiresAt: at(time.Millisecond)}, 0, 0.999999, false},
+		{"smallest draw never refreshes early", envelope{Delta: 1000, ExpiresAt: at(time.Millisecond)}, 1, 0, false},
+		// Refresh iff u > 1 - exp(-remaining/(delta*beta)); for 100ms left
+		// with delta 100ms that is 1 - 1/e, about 0.632.
+		{"just below threshold", envelope{Delta: 100, ExpiresAt: at(100 * time.Millisecond)}, 1, 0.63, false},
+		{"just above threshold", envelope{Delta: 100, ExpiresAt: at(100 * time.Millisecond)}, 1, 0.64, true},
+		{"larger beta refreshes earlier", envelope{Delta: 100, ExpiresAt: at(100 * time.Millisecond)}, 2, 0.5, true},
+		{"far from expiry", envelope{Delta: 100, ExpiresAt: at(time.Hour)}, 1, 0.999999, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.env.refreshDue(now, tc.beta, tc.u))
+		})
+	}
+}
+
+// TestShouldRefreshProbability checks the sampled rate against the XFetch
+// probability exp(-remaining/(delta*beta)).
+func TestShouldRefreshProbability(t *testing.T) {
+	now := time.UnixMilli(1_700_000_000_000)
+	cases := []struct {
+		remaining, delta int64
+	}{
+		{0, 100},
+		{50, 100},
+		{100, 100},
+		{300, 100},
+	}
+	const draws = 20000
+	for _, tc := range cases {
+		env := envelope{Delta: tc.delta, ExpiresAt: now.UnixMilli() + tc.remaining}
+		refreshed := 0
+		for i := 0; i < draws; i++ {
+			if env.shouldRefresh(now, 1) {
+				refreshed++
+			}
+		}
+		want := math.Exp(-float64(tc.remaining) / float64(tc.delta))
+		assert.InDelta(t, want, float64(refreshed)/draws, 0.02, "remaining %dms, delta %dms", tc.remaining, tc.delta)
+	}
+}
@@ -3,10 +3,11 @@ package database
 import (
 	"database/sql"
 	"fmt"
-	"log"
 
 	"sinibeli/internal/config"
+	logger "sinibeli/internal/pkg/logging"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/lib/pq"
 )
 
@@ -19,7 +20,7 @@ func NewDB(cfg *config.DatabaseConfig) (*DB, error) {
 	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
 		cfg.Host, cfg.Port, cfg.Username, cfg.Password, cfg.Database, cfg.SSLMode)
 
-	db, err := sql.Open("postgres", connStr)
+	db, err := otelsql.Open("postgres", connStr, tracingOptions()...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -28,6 +29,6 @@ func NewDB(cfg *config.DatabaseConfig) (*DB, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	log.Println("Database connected successfully")
+	logger.Info("Database connected successfully")
 	return &DB{db}, nil
 }
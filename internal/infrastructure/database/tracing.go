@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"regexp"
+	"strings"
+
+	"github.com/XSAM/otelsql"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+var (
+	stringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	numericLiteral = regexp.MustCompile(`(^|[^$\w.])\d+(?:\.\d+)?`)
+)
+
+// tracingOptions records one span per statement. The driver's raw query text is
+// replaced with a sanitized copy so literals inlined by hand never reach the
+// tracing backend; bound arguments are never recorded.
+func tracingOptions() []otelsql.Option {
+	return []otelsql.Option{
+		otelsql.WithAttributes(semconv.DBSystemNamePostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableQuery:         true,
+			DisableErrSkip:       true,
+			OmitConnResetSession: true,
+			OmitConnPrepare:      true,
+			OmitRows:             true,
+		}),
+		otelsql.WithSpanNameFormatter(func(_ context.Context, method otelsql.Method, query string) string {
+			if op := operation(query); op != "" {
+				return op
+			}
+			return string(method)
+		}),
+		otelsql.WithAttributesGetter(func(_ context.Context, _ otelsql.Method, query string, _ []driver.NamedValue) []attribute.KeyValue {
+			if query == "" {
+				return nil
+			}
+			return []attribute.KeyValue{semconv.DBQueryText(SanitizeQuery(query))}
+		}),
+	}
+}
+
+// SanitizeQuery collapses whitespace and masks string and numeric literals,
+// leaving $n placeholders intact.
+func SanitizeQuery(query string) string {
+	query = strings.Join(strings.Fields(query), " ")
+	query = stringLiteral.ReplaceAllString(query, "'?'")
+	return numericLiteral.ReplaceAllString(query, "${1}?")
+}
+
+func operation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(fields[0])
+}
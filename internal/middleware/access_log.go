@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	logger "sinibeli/internal/pkg/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessLogMiddleware writes one structured line per request after the
+// handler has run. Server errors are logged at error level and client errors
+// at warn, so production (warn and above) still sees failed requests.
+func AccessLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		status := c.Writer.Status()
+		args := []interface{}{
+			"method", c.Request.Method,
+			"route", c.FullPath(),
+			"path", c.Request.URL.Path,
+			"status", status,
+			"latency_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"bytes", max(c.Writer.Size(), 0),
+			"client_ip", c.ClientIP(),
+		}
+		if userID, ok := c.Get("user_id"); ok {
+			args = append(args, "user_id", userID)
+		}
+		if companyID, ok := c.Get("company_id"); ok {
+			args = append(args, "company_id", companyID)
+		}
+		if len(c.Errors) > 0 {
+			args = append(args, "errors", c.Errors.String())
+		}
+
+		ctx := c.Request.Context()
+		switch {
+		case status >= http.StatusInternalServerError:
+			logger.ErrorCtx(ctx, "HTTP request", args...)
+		case status >= http.StatusBadRequest:
+			logger.WarnCtx(ctx, "HTTP request", args...)
+		default:
+			logger.InfoCtx(ctx, "HTTP request", args...)
+		}
+	}
+}
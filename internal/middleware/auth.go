@@ -1,41 +1,92 @@
 package middleware
 
 import (
-	"net/http"
 	"strings"
 
+	"sinibeli/internal/pkg/apperr"
 	"sinibeli/internal/pkg/jwt"
 
 	"github.com/gin-gonic/gin"
 )
 
+var (
+	errMissingAuthorization = apperr.New(apperr.Unauthorized, "missing_authorization_header", "Authorization header is required")
+	errInvalidAuthorization = apperr.New(apperr.Unauthorized, "invalid_authorization_header", "Authorization header must start with 'Bearer '")
+	errInvalidToken         = apperr.New(apperr.Unauthorized, "invalid_token", "Invalid or expired token")
+	errRoleRequired         = apperr.New(apperr.Forbidden, "role_required", "token role is not allowed to use this endpoint")
+)
+
 func AuthMiddleware(jwtService *jwt.JWTService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "missing_authorization_header", "message": "Authorization header is required"})
+			c.Error(errMissingAuthorization)
 			c.Abort()
 			return
 		}
 
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_authorization_header", "message": "Authorization header must start with 'Bearer '"})
-			c.Abort()
+		if !authenticate(c, jwtService, authHeader) {
 			return
 		}
 
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		c.Next()
+	}
+}
 
-		claims, err := jwtService.ValidateToken(tokenString)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_token", "message": "Invalid or expired token"})
-			c.Abort()
-			return
+// RequireRole lets through callers whose token carries one of roles. It goes
+// after AuthMiddleware, which puts the role in the context.
+func RequireRole(roles []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		for _, r := range roles {
+			if role != "" && role == r {
+				c.Next()
+				return
+			}
 		}
+		c.Error(errRoleRequired)
+		c.Abort()
+	}
+}
 
-		c.Set("user_id", claims.UserID)
+// OptionalAuthMiddleware identifies the caller when a bearer token is sent
+// but lets anonymous requests through. A token that is present but invalid is
+// still rejected.
+func OptionalAuthMiddleware(jwtService *jwt.JWTService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		if authHeader != "" && !authenticate(c, jwtService, authHeader) {
+			return
+		}
 
 		c.Next()
 	}
 }
+
+func authenticate(c *gin.Context, jwtService *jwt.JWTService, authHeader string) bool {
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		c.Error(errInvalidAuthorization)
+		c.Abort()
+		return false
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+
+	claims, err := jwtService.ValidateToken(tokenString)
+	if err != nil {
+		c.Error(errInvalidToken)
+		c.Abort()
+		return false
+	}
+
+	c.Request = c.Request.WithContext(jwt.WithClaims(c.Request.Context(), claims))
+	c.Set("user_id", claims.UserID)
+	if claims.CompanyID != 0 {
+		c.Set("company_id", claims.CompanyID)
+	}
+	if claims.Role != "" {
+		c.Set("role", claims.Role)
+	}
+	return true
+}
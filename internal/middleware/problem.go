@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"sinibeli/internal/pkg/apperr"
+	"sinibeli/internal/pkg/i18n"
+	"sinibeli/internal/pkg/problem"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errRouteNotFound = apperr.New(apperr.NotFound, "route_not_found", "no such route")
+	errPanic         = apperr.New(apperr.Internal, "internal_error", "handler panicked")
+)
+
+// ErrorMiddleware writes the response for requests that ended in c.Error
+// without writing one themselves. The last error wins and is sent as
+// application/problem+json with the request ID, so handlers only decide
+// which error to report. The raw error stays in c.Errors for the access log.
+// Messages are translated into the language picked from Accept-Language.
+func ErrorMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		err := c.Errors.Last().Err
+		p := problem.From(err)
+		p.Instance = c.Request.URL.Path
+		p.RequestID = c.GetString("request_id")
+
+		lang := i18n.Negotiate(c.GetHeader("Accept-Language"))
+		i18n.Localize(&p, err, lang)
+
+		c.Header("Content-Type", problem.ContentType)
+		c.Header("Content-Language", lang)
+		c.Writer.Header().Add("Vary", "Accept-Language")
+		c.JSON(p.Status, p)
+	}
+}
+
+// RecoveryMiddleware turns a panic into a 500 problem. It must run inside
+// ErrorMiddleware so the response is written on the way out.
+func RecoveryMiddleware() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, recovered any) {
+		c.Error(errPanic)
+		c.Abort()
+	})
+}
+
+// NoRoute answers unknown paths with a problem rather than gin's plain text.
+func NoRoute(c *gin.Context) {
+	c.Error(errRouteNotFound)
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	logger "sinibeli/internal/pkg/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+
+	maxRequestIDLength = 128
+)
+
+// RequestIDMiddleware reuses the caller's X-Request-ID when it looks sane,
+// otherwise generates one, and puts it on the request context so every *Ctx
+// log line further down carries it. The ID is echoed back in the response.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		if id := c.GetHeader(RequestIDHeader); validRequestID(id) {
+			ctx = logger.SetRequestID(ctx, id)
+		} else {
+			ctx = logger.WithRequestID(ctx)
+		}
+
+		requestID := logger.GetRequestID(ctx)
+		c.Request = c.Request.WithContext(ctx)
+		c.Set("request_id", requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		c.Next()
+	}
+}
+
+// validRequestID rejects IDs that are empty, oversized or contain anything
+// beyond visible ASCII, so a client cannot inject log or header content.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+// Package apperr defines the typed errors services and handlers return. An
+// Error carries a kind, which decides how it is reported, and a stable code
+// that clients can switch on, so nothing outside this package needs to match
+// on message text.
+package apperr
+
+type Kind int
+
+const (
+	Internal Kind = iota
+	Invalid
+	Unauthorized
+	Forbidden
+	NotFound
+	Conflict
+	PreconditionFailed
+	TooLarge
+	UnsupportedMediaType
+	Unprocessable
+	PreconditionRequired
+)
+
+// FieldError points at the member of the request that was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	Fields  []FieldError
+
+	extensions map[string]interface{}
+	err        error
+}
+
+// New returns an error of the given kind, usually to be kept as a sentinel.
+func New(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+// Wrap classifies an existing error. Its text becomes the message and it
+// stays reachable through errors.Is and errors.As.
+func Wrap(kind Kind, code string, err error) *Error {
+	return &Error{Kind: kind, Code: code, err: err}
+}
+
+// InvalidParam reports a query or path parameter that could not be parsed.
+func InvalidParam(name, message string) *Error {
+	return &Error{
+		Kind:    Invalid,
+		Code:    "invalid_parameter",
+		Message: message,
+		Fields:  []FieldError{{Field: name, Code: "invalid", Message: message}},
+	}
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	if e.err != nil {
+		return e.err.Error()
+	}
+	return e.Code
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// Is matches on the code, so copies made by With and WithFields still match
+// the sentinel they came from.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// With returns a copy that adds a member to the error response.
+func (e *Error) With(key string, value interface{}) *Error {
+	c := *e
+	c.extensions = make(map[string]interface{}, len(e.extensions)+1)
+	for k, v := range e.extensions {
+		c.extensions[k] = v
+	}
+	c.extensions[key] = value
+	return &c
+}
+
+// WithFields returns a copy that names the fields at fault.
+func (e *Error) WithFields(fields ...FieldError) *Error {
+	c := *e
+	c.Fields = append(append([]FieldError(nil), e.Fields...), fields...)
+	return &c
+}
+
+// WithCause returns a copy that keeps err as the underlying cause without
+// changing the message.
+func (e *Error) WithCause(err error) *Error {
+	c := *e
+	c.err = err
+	return &c
+}
+
+// Extensions returns the extra members for the error response.
+func (e *Error) Extensions() map[string]interface{} {
+	return e.extensions
+}
+
+// Extender is implemented by errors that add members to the error response,
+// such as the reference counts of a refused purge.
+type Extender interface {
+	Extensions() map[string]interface{}
+}
@@ -0,0 +1,99 @@
+// Package etag implements the conditional requests used for optimistic
+// concurrency control on versioned records: the record's version is its
+// ETag, writes must carry a matching If-Match, and reads honour
+// If-None-Match.
+package etag
+
+import (
+	"strconv"
+	"strings"
+
+	"sinibeli/internal/pkg/apperr"
+)
+
+var (
+	ErrPreconditionRequired = apperr.New(apperr.PreconditionRequired, "precondition_required", "If-Match header is required")
+	ErrPreconditionFailed   = apperr.New(apperr.PreconditionFailed, "precondition_failed", "record has been modified since it was read")
+)
+
+// Format returns the ETag for a record version.
+func Format(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// Precondition is a parsed If-Match header.
+type Precondition struct {
+	any      bool
+	versions []int64
+}
+
+// ParseIfMatch parses an If-Match header, which is required on writes. Tags
+// that are weak or were never issued by Format are kept out of the set, so
+// they fail the match rather than the request.
+func ParseIfMatch(header string) (Precondition, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return Precondition{}, ErrPreconditionRequired
+	}
+	if header == "*" {
+		return Precondition{any: true}, nil
+	}
+
+	var p Precondition
+	for _, tag := range strings.Split(header, ",") {
+		if version, ok := parse(strings.TrimSpace(tag)); ok {
+			p.versions = append(p.versions, version)
+		}
+	}
+	return p, nil
+}
+
+// Version is the precondition held by a write that follows one of its own:
+// the version it just read or wrote, and no other.
+func Version(version int64) Precondition {
+	return Precondition{versions: []int64{version}}
+}
+
+// Matches reports whether the precondition holds for the current version.
+func (p Precondition) Matches(version int64) bool {
+	if p.any {
+		return true
+	}
+	for _, v := range p.versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// NoneMatch reports whether an If-None-Match header matches the current
+// version, in which case a read answers 304. Comparison is weak, as RFC 9110
+// asks for If-None-Match.
+func NoneMatch(header string, version int64) bool {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return false
+	}
+	if header == "*" {
+		return true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if v, ok := parse(tag); ok && v == version {
+			return true
+		}
+	}
+	return false
+}
+
+func parse(tag string) (int64, bool) {
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return version, true
+}
@@ -0,0 +1,87 @@
+package etag
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, `"1"`, Format(1))
+	assert.Equal(t, `"9223372036854775807"`, Format(9223372036854775807))
+}
+
+func TestIfMatch(t *testing.T) {
+	cases := []struct {
+		header  string
+		version int64
+		want    bool
+	}{
+		{`*`, 1, true},
+		{` * `, 42, true},
+		{`"3"`, 3, true},
+		{`"3"`, 4, false},
+		{`"2", "3"`, 3, true},
+		{`"2","3"`, 2, true},
+		{`"2", "3"`, 4, false},
+		// Strong comparison: a weak tag never matches, even when its
+		// version is right, but it does not spoil the rest of the list.
+		{`W/"3"`, 3, false},
+		{`W/"3", "3"`, 3, true},
+		// Tags Format never issues are ignored.
+		{`3`, 3, false},
+		{`"abc"`, 3, false},
+		{`""`, 0, false},
+		{`"`, 0, false},
+		{`"abc", "3"`, 3, true},
+		{`"3`, 3, false},
+		// "*" only means any inside a list when it is the whole header.
+		{`*, "3"`, 4, false},
+	}
+	for _, tc := range cases {
+		p, err := ParseIfMatch(tc.header)
+		require.NoError(t, err, tc.header)
+		assert.Equal(t, tc.want, p.Matches(tc.version), "If-Match: %s against %d", tc.header, tc.version)
+	}
+}
+
+func TestIfMatchRequired(t *testing.T) {
+	for _, header := range []string{"", "   "} {
+		_, err := ParseIfMatch(header)
+		assert.Equal(t, ErrPreconditionRequired, err)
+	}
+	// The zero Precondition matches nothing.
+	assert.False(t, Precondition{}.Matches(0))
+}
+
+func TestVersion(t *testing.T) {
+	assert.True(t, Version(3).Matches(3))
+	assert.False(t, Version(3).Matches(4))
+}
+
+func TestIfNoneMatch(t *testing.T) {
+	cases := []struct {
+		header  string
+		version int64
+		want    bool
+	}{
+		{``, 1, false},
+		{`  `, 1, false},
+		{`*`, 1, true},
+		{`"3"`, 3, true},
+		{`"3"`, 4, false},
+		// Weak comparison: W/ is ignored.
+		{`W/"3"`, 3, true},
+		{`W/"3"`, 4, false},
+		{`"2", W/"3"`, 3, true},
+		{`"1","2"`, 2, true},
+		{`"1", "2"`, 3, false},
+		{`"abc", "3"`, 3, true},
+		{`3`, 3, false},
+		{`w/"3"`, 3, false},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, NoneMatch(tc.header, tc.version), "If-None-Match: %s against %d", tc.header, tc.version)
+	}
+}
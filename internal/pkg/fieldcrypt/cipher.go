@@ -0,0 +1,154 @@
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// prefix marks sealed values. Anything without it is treated as legacy
+// plaintext, so rows written before encryption was enabled stay readable
+// until the rotation command rewrites them.
+const prefix = "enc:v1:"
+
+var (
+	ErrUnknownKey = errors.New("value sealed with a key that is not in the keyring")
+	ErrMalformed  = errors.New("malformed encrypted value")
+)
+
+// Cipher seals column values with envelope encryption: every value gets a
+// fresh data key, the data key is wrapped with the active key-encryption key,
+// and both ciphertexts are bound to the column and row through the AAD so a
+// value cannot be copied to another row or column.
+type Cipher struct {
+	ring *Keyring
+}
+
+func NewCipher(ring *Keyring) *Cipher {
+	return &Cipher{ring: ring}
+}
+
+func (c *Cipher) ActiveKeyID() string {
+	return c.ring.active
+}
+
+// Encrypt returns "enc:v1:<key id>:<wrapped data key>:<ciphertext>". Empty
+// values stay empty so NULL handling in the repositories is unchanged.
+func (c *Cipher) Encrypt(plaintext, aad string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	wrapped, err := seal(c.ring.keys[c.ring.active], dataKey, aad)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(dataKey, []byte(plaintext), aad)
+	if err != nil {
+		return "", err
+	}
+
+	return prefix + c.ring.active + ":" +
+		base64.RawStdEncoding.EncodeToString(wrapped) + ":" +
+		base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value produced by Encrypt with any key still in the keyring.
+func (c *Cipher) Decrypt(value, aad string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", ErrMalformed
+	}
+
+	kek, ok := c.ring.keys[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKey, parts[0])
+	}
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrMalformed
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrMalformed
+	}
+
+	dataKey, err := open(kek, wrapped, aad)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dataKey, sealed, aad)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// BlindIndex is a keyed hash of the normalized value. Equal inputs give equal
+// indexes, which is what lets a unique constraint and equality lookups work
+// on a column whose ciphertext differs on every write.
+func (c *Cipher) BlindIndex(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, c.ring.indexKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+func seal(key, plaintext []byte, aad string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, []byte(aad)), nil
+}
+
+func open(key, sealed []byte, aad string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(aad))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
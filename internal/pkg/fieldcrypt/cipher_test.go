@@ -0,0 +1,179 @@
+package fieldcrypt_test
+
+import (
+	"encoding/base64"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sinibeli/internal/config"
+	"sinibeli/internal/pkg/fieldcrypt"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func key(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), 32)))
+}
+
+func newCipher(t *testing.T, active string, keys ...string) *fieldcrypt.Cipher {
+	var entries []string
+	for _, id := range keys {
+		entries = append(entries, id+":"+key(id[len(id)-1]))
+	}
+	ring, err := fieldcrypt.LoadKeyring(config.EncryptionConfig{
+		Keys:          strings.Join(entries, ","),
+		ActiveKey:     active,
+		BlindIndexKey: key('x'),
+	})
+	require.NoError(t, err)
+	return fieldcrypt.NewCipher(ring)
+}
+
+func TestRoundTrip(t *testing.T) {
+	c := newCipher(t, "k1", "k1")
+
+	for _, plaintext := range []string{"casey.pandey@home.pl", "+6281234567890", "Jl. Sudirman No. 1, Jakarta 🇮🇩"} {
+		sealed, err := c.Encrypt(plaintext, "customer.email:7")
+		require.NoError(t, err)
+		assert.True(t, fieldcrypt.IsEncrypted(sealed))
+		assert.True(t, strings.HasPrefix(sealed, "enc:v1:k1:"))
+		assert.NotContains(t, sealed, plaintext)
+
+		again, err := c.Encrypt(plaintext, "customer.email:7")
+		require.NoError(t, err)
+		assert.NotEqual(t, sealed, again, "every write gets a fresh data key and nonce")
+
+		opened, err := c.Decrypt(sealed, "customer.email:7")
+		require.NoError(t, err)
+		assert.Equal(t, plaintext, opened)
+	}
+
+	empty, err := c.Encrypt("", "customer.email:7")
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+
+	legacy, err := c.Decrypt("plain@example.com", "customer.email:7")
+	require.NoError(t, err)
+	assert.Equal(t, "plain@example.com", legacy, "values without the prefix are legacy plaintext")
+}
+
+func TestTamperingIsDetected(t *testing.T) {
+	c := newCipher(t, "k1", "k1")
+	sealed, err := c.Encrypt("casey.pandey@home.pl", "customer.email:7")
+	require.NoError(t, err)
+
+	parts := strings.Split(sealed, ":")
+	flip := func(part int) string {
+		raw, err := base64.RawStdEncoding.DecodeString(parts[part])
+		require.NoError(t, err)
+		raw[len(raw)-1] ^= 0x01
+		tampered := append([]string(nil), parts...)
+		tampered[part] = base64.RawStdEncoding.EncodeToString(raw)
+		return strings.Join(tampered, ":")
+	}
+
+	cases := []struct {
+		name  string
+		value string
+		aad   string
+	}{
+		{"other row", sealed, "customer.email:8"},
+		{"other column", sealed, "customer.phone_number:7"},
+		{"flipped ciphertext byte", flip(4), "customer.email:7"},
+		{"flipped wrapped key byte", flip(3), "customer.email:7"},
+		{"truncated", sealed[:len(sealed)-4], "customer.email:7"},
+		{"missing part", strings.Join(parts[:4], ":"), "customer.email:7"},
+		{"not base64", "enc:v1:k1:!!!:!!!", "customer.email:7"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opened, err := c.Decrypt(tc.value, tc.aad)
+			assert.Error(t, err)
+			assert.Empty(t, opened)
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old := newCipher(t, "k1", "k1")
+	sealed, err := old.Encrypt("casey.pandey@home.pl", "customer.email:7")
+	require.NoError(t, err)
+
+	// Mid-rotation both keys are loaded and new values use k2.
+	rotating := newCipher(t, "k2", "k1", "k2")
+	opened, err := rotating.Decrypt(sealed, "customer.email:7")
+	require.NoError(t, err)
+	assert.Equal(t, "casey.pandey@home.pl", opened)
+	resealed, err := rotating.Encrypt(opened, "customer.email:7")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(resealed, "enc:v1:k2:"))
+
+	// Once k1 is retired, what it sealed can no longer be read.
+	retired := newCipher(t, "k2", "k2")
+	_, err = retired.Decrypt(sealed, "customer.email:7")
+	assert.ErrorIs(t, err, fieldcrypt.ErrUnknownKey)
+	opened, err = retired.Decrypt(resealed, "customer.email:7")
+	require.NoError(t, err)
+	assert.Equal(t, "casey.pandey@home.pl", opened)
+}
+
+func TestBlindIndexIsStable(t *testing.T) {
+	c := newCipher(t, "k1", "k1")
+	rotated := newCipher(t, "k2", "k2")
+
+	idx := c.BlindIndex("casey.pandey@home.pl")
+	assert.Len(t, idx, 64)
+	assert.Equal(t, idx, c.BlindIndex("casey.pandey@home.pl"))
+	assert.Equal(t, idx, c.BlindIndex("  Casey.Pandey@HOME.pl "), "the index normalizes case and spaces")
+	assert.Equal(t, idx, rotated.BlindIndex("casey.pandey@home.pl"), "rotating encryption keys keeps indexes")
+	assert.NotEqual(t, idx, c.BlindIndex("casey.pandey@home.com"))
+	assert.Empty(t, c.BlindIndex("   "))
+
+	ring, err := fieldcrypt.LoadKeyring(config.EncryptionConfig{Keys: "k1:" + key('1'), ActiveKey: "k1", BlindIndexKey: key('y')})
+	require.NoError(t, err)
+	assert.NotEqual(t, idx, fieldcrypt.NewCipher(ring).BlindIndex("casey.pandey@home.pl"), "the index is keyed")
+}
+
+func TestKeystoreFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "keystore.json")
+
+	_, err := fieldcrypt.LoadKeyring(config.EncryptionConfig{KeystoreFile: path})
+	require.Error(t, err, "a missing keystore is only generated in development")
+	assert.NoFileExists(t, path)
+
+	first, err := fieldcrypt.LoadKeyring(config.EncryptionConfig{KeystoreFile: path, GenerateKeystore: true})
+	require.NoError(t, err)
+	second, err := fieldcrypt.LoadKeyring(config.EncryptionConfig{KeystoreFile: path})
+	require.NoError(t, err)
+
+	assert.Equal(t, first.ActiveKeyID(), second.ActiveKeyID())
+	a, b := fieldcrypt.NewCipher(first), fieldcrypt.NewCipher(second)
+	assert.Equal(t, a.BlindIndex("casey"), b.BlindIndex("casey"))
+
+	sealed, err := a.Encrypt("casey", "customer.email:7")
+	require.NoError(t, err)
+	opened, err := b.Decrypt(sealed, "customer.email:7")
+	require.NoError(t, err)
+	assert.Equal(t, "casey", opened)
+}
+
+func TestLoadKeyringRejectsBadConfig(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  config.EncryptionConfig
+	}{
+		{"nothing configured", config.EncryptionConfig{}},
+		{"entry without id", config.EncryptionConfig{Keys: key('1'), ActiveKey: "k1", BlindIndexKey: key('x')}},
+		{"short key", config.EncryptionConfig{Keys: "k1:" + base64.StdEncoding.EncodeToString([]byte("short")), ActiveKey: "k1", BlindIndexKey: key('x')}},
+		{"active key missing", config.EncryptionConfig{Keys: "k1:" + key('1'), ActiveKey: "k2", BlindIndexKey: key('x')}},
+		{"no blind index key", config.EncryptionConfig{Keys: "k1:" + key('1'), ActiveKey: "k1"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := fieldcrypt.LoadKeyring(tc.cfg)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package fieldcrypt
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sinibeli/internal/config"
+)
+
+const keySize = 32
+
+// Keyring holds the key-encryption keys by ID, which one new values are sealed
+// with, and the separate HMAC key used for blind indexes. The blind index key
+// never rotates: changing it would invalidate every stored index.
+type Keyring struct {
+	active   string
+	keys     map[string][]byte
+	indexKey []byte
+}
+
+type keystoreFile struct {
+	Active        string            `json:"active"`
+	Keys          map[string]string `json:"keys"`
+	BlindIndexKey string            `json:"blind_index_key"`
+}
+
+// LoadKeyring reads keys from config when ENCRYPTION_KEYS is set, otherwise
+// from the keystore file. The file is meant for local development only, and
+// is generated on first use only when cfg.GenerateKeystore is set.
+func LoadKeyring(cfg config.EncryptionConfig) (*Keyring, error) {
+	if cfg.Keys != "" {
+		return keyringFromConfig(cfg)
+	}
+	if cfg.KeystoreFile == "" {
+		return nil, errors.New("no encryption keys configured: set ENCRYPTION_KEYS or ENCRYPTION_KEYSTORE_FILE")
+	}
+	return keyringFromFile(cfg.KeystoreFile, cfg.GenerateKeystore)
+}
+
+func keyringFromConfig(cfg config.EncryptionConfig) (*Keyring, error) {
+	file := keystoreFile{Active: cfg.ActiveKey, Keys: map[string]string{}, BlindIndexKey: cfg.BlindIndexKey}
+	for _, entry := range strings.Split(cfg.Keys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, key, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, errors.New("invalid ENCRYPTION_KEYS entry, want id:base64key")
+		}
+		file.Keys[id] = key
+	}
+	return file.keyring()
+}
+
+func keyringFromFile(path string, generate bool) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if !generate {
+			return nil, fmt.Errorf("keystore %s does not exist: set ENCRYPTION_KEYS, or ENV=development to generate one", path)
+		}
+		return generateKeystore(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore: %w", err)
+	}
+
+	var file keystoreFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse keystore: %w", err)
+	}
+	return file.keyring()
+}
+
+func generateKeystore(path string) (*Keyring, error) {
+	file := keystoreFile{
+		Active:        "dev-1",
+		Keys:          map[string]string{"dev-1": newKey()},
+		BlindIndexKey: newKey(),
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create keystore directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write keystore: %w", err)
+	}
+	return file.keyring()
+}
+
+func (f keystoreFile) keyring() (*Keyring, error) {
+	ring := &Keyring{active: f.Active, keys: make(map[string][]byte, len(f.Keys))}
+
+	for id, encoded := range f.Keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid encryption key id %q", id)
+		}
+		key, err := decodeKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q: %w", id, err)
+		}
+		ring.keys[id] = key
+	}
+	if _, ok := ring.keys[ring.active]; !ok {
+		return nil, fmt.Errorf("active encryption key %q is not in the keyring", ring.active)
+	}
+
+	indexKey, err := decodeKey(f.BlindIndexKey)
+	if err != nil {
+		return nil, fmt.Errorf("blind index key: %w", err)
+	}
+	ring.indexKey = indexKey
+
+	return ring, nil
+}
+
+func (k *Keyring) ActiveKeyID() string {
+	return k.active
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("not valid base64: %w", err)
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("must be %d bytes, got %d", keySize, len(key))
+	}
+	return key, nil
+}
+
+func newKey() string {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
@@ -0,0 +1,233 @@
+// Package i18n translates error responses into the language a client asks
+// for with Accept-Language. English is the source language: anything without
+// a translation is sent as the error was written. Validation messages in
+// other languages come from the validator's own translations, which the
+// catalogues can override.
+//
+// The built-in catalogues are embedded. Files named <lang>.json in the
+// configured catalogue directory are merged over them at startup, so wording
+// can be changed or completed without a rebuild.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sinibeli/internal/config"
+	"sinibeli/internal/pkg/apperr"
+	"sinibeli/internal/pkg/problem"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/id"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	id_translations "github.com/go-playground/validator/v10/translations/id"
+)
+
+// Catalog holds the texts of one language. Texts may use {0}: the field
+// names for errors and fields, and for validation {0} is the field and {1}
+// the tag's parameter.
+type Catalog struct {
+	// Titles are keyed by HTTP status code.
+	Titles map[string]string `json:"titles"`
+	// Errors are keyed by apperr code and replace the problem detail.
+	Errors map[string]string `json:"errors"`
+	// Fields are keyed by field error code.
+	Fields map[string]string `json:"fields"`
+	// Validation is keyed by validator tag.
+	Validation map[string]string `json:"validation"`
+}
+
+//go:embed catalog/*.json
+var builtin embed.FS
+
+var (
+	universal       *ut.UniversalTranslator
+	validate        *validator.Validate
+	defaultLanguage = "en"
+)
+
+func init() {
+	universal = ut.New(en.New(), en.New(), id.New())
+
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		panic("i18n: gin validator is not go-playground/validator")
+	}
+	validate = v
+
+	trans, _ := universal.GetTranslator("id")
+	if err := id_translations.RegisterDefaultTranslations(validate, trans); err != nil {
+		panic(fmt.Sprintf("i18n: register validation messages: %v", err))
+	}
+
+	if err := loadDir(builtin, "catalog"); err != nil {
+		panic(err)
+	}
+}
+
+// Init sets the default language and merges the catalogues in cfg.CatalogDir
+// over the built-in ones. It must run before the server starts, as the
+// validator's translations are not safe to change while it is in use.
+func Init(cfg config.I18NConfig) error {
+	lang := strings.ToLower(cfg.DefaultLanguage)
+	if _, ok := universal.GetTranslator(lang); !ok {
+		return fmt.Errorf("unsupported default language %q", cfg.DefaultLanguage)
+	}
+	defaultLanguage = lang
+
+	if cfg.CatalogDir == "" {
+		return nil
+	}
+	return loadDir(os.DirFS(cfg.CatalogDir), ".")
+}
+
+func loadDir(fsys fs.FS, dir string) error {
+	paths, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, name := range paths {
+		lang := strings.TrimSuffix(path.Base(name), ".json")
+		body, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return fmt.Errorf("failed to read catalogue %s: %w", name, err)
+		}
+		var c Catalog
+		if err := json.Unmarshal(body, &c); err != nil {
+			return fmt.Errorf("failed to parse catalogue %s: %w", name, err)
+		}
+		if err := Add(lang, c); err != nil {
+			return fmt.Errorf("catalogue %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Add merges c into the catalogue of lang, replacing texts it already has.
+func Add(lang string, c Catalog) error {
+	trans, ok := universal.GetTranslator(strings.ToLower(lang))
+	if !ok {
+		return fmt.Errorf("unsupported language %q", lang)
+	}
+
+	sections := []struct {
+		prefix  string
+		texts   map[string]string
+		maxArgs int
+	}{
+		{"title:", c.Titles, 0},
+		{"error:", c.Errors, 1},
+		{"field:", c.Fields, 1},
+	}
+	for _, s := range sections {
+		for key, text := range s.texts {
+			if err := addText(trans, s.prefix+key, text, s.maxArgs); err != nil {
+				return err
+			}
+		}
+	}
+
+	for tag, text := range c.Validation {
+		tag, text := tag, text
+		err := validate.RegisterTranslation(tag, trans,
+			func(t ut.Translator) error { return addText(t, tag, text, 2) },
+			func(t ut.Translator, fe validator.FieldError) string {
+				s, _ := t.T(fe.Tag(), fe.Field(), fe.Param())
+				return s
+			})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addText rejects placeholders that T would have no argument for.
+func addText(trans ut.Translator, key, text string, maxArgs int) error {
+	if n := strings.Count(text, "{"); n > maxArgs {
+		return fmt.Errorf("%s: text uses %d placeholders, at most %d allowed", key, n, maxArgs)
+	}
+	return trans.Add(key, text, true)
+}
+
+// Negotiate picks the supported language the Accept-Language header ranks
+// highest, or the default language when it names none of them.
+func Negotiate(header string) string {
+	type choice struct {
+		lang string
+		q    float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		base, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if _, ok := universal.GetTranslator(base); ok && q > 0 {
+			choices = append(choices, choice{base, q})
+		}
+	}
+	if len(choices) == 0 {
+		return defaultLanguage
+	}
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].q > choices[j].q })
+	return choices[0].lang
+}
+
+// Localize rewrites the title, detail and field messages of p in lang. err
+// is the error p was made from; validation failures are translated from the
+// validator's field errors it wraps.
+func Localize(p *problem.Problem, err error, lang string) {
+	trans, ok := universal.GetTranslator(lang)
+	if !ok {
+		return
+	}
+
+	if s, err := trans.T("title:" + strconv.Itoa(p.Status)); err == nil {
+		p.Title = s
+	}
+
+	names := make([]string, len(p.Errors))
+	for i, fe := range p.Errors {
+		names[i] = fe.Field
+	}
+	if s, err := trans.T("error:"+p.Code, strings.Join(names, ", ")); err == nil {
+		p.Detail = s
+	}
+
+	if len(p.Errors) == 0 {
+		return
+	}
+	var validationErrs validator.ValidationErrors
+	errors.As(err, &validationErrs)
+
+	// The field errors of a sentinel are shared, so translate a copy.
+	fields := make([]apperr.FieldError, len(p.Errors))
+	for i, fe := range p.Errors {
+		if i < len(validationErrs) && validationErrs[i].Tag() == fe.Code {
+			if s := validationErrs[i].Translate(trans); s != validationErrs[i].Error() {
+				fe.Message = s
+			}
+		} else if s, err := trans.T("field:"+fe.Code, fe.Field); err == nil {
+			fe.Message = s
+		}
+		fields[i] = fe
+	}
+	p.Errors = fields
+}
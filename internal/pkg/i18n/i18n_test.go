@@ -0,0 +1,101 @@
+package i18n
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sinibeli/internal/config"
+	"sinibeli/internal/pkg/apperr"
+	"sinibeli/internal/pkg/problem"
+	"sinibeli/internal/pkg/request"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate(t *testing.T) {
+	cases := map[string]string{
+		"":                        "en",
+		"id":                      "id",
+		"id-ID,id;q=0.9,en;q=0.8": "id",
+		"en-US,id;q=0.5":          "en",
+		"fr-FR, id;q=0.3":         "id",
+		"en;q=0.2, ID;q=0.7":      "id",
+		"de, fr":                  "en",
+		"id;q=0, en;q=0.1":        "en",
+		"id;q=bogus":              "en",
+	}
+	for header, want := range cases {
+		assert.Equal(t, want, Negotiate(header), header)
+	}
+}
+
+type customerReq struct {
+	Name  string `json:"name" binding:"required"`
+	Email string `json:"email" binding:"required,max=5"`
+}
+
+func TestLocalizeValidation(t *testing.T) {
+	err := request.Validate(customerReq{Email: "toolong"})
+	require.Error(t, err)
+
+	p := problem.From(err)
+	Localize(&p, err, "id")
+	assert.Equal(t, "Permintaan Tidak Valid", p.Title)
+	assert.Equal(t, "isi permintaan tidak lolos validasi", p.Detail)
+	require.Len(t, p.Errors, 2)
+	assert.Equal(t, "name wajib diisi", p.Errors[0].Message)
+	assert.Contains(t, p.Errors[1].Message, "email")
+	assert.Contains(t, p.Errors[1].Message, "5 karakter")
+
+	en := problem.From(err)
+	Localize(&en, err, "en")
+	assert.Equal(t, "Bad Request", en.Title)
+	assert.Equal(t, "request body failed validation", en.Detail)
+	assert.Equal(t, "is required", en.Errors[0].Message)
+}
+
+func TestLocalizeLeavesSentinelAlone(t *testing.T) {
+	sentinel := apperr.InvalidParam("id", "invalid customer ID")
+	err := fmt.Errorf("get: %w", sentinel)
+
+	p := problem.From(err)
+	Localize(&p, err, "id")
+	assert.Equal(t, "parameter id tidak valid", p.Detail)
+	assert.Equal(t, "nilai id tidak valid", p.Errors[0].Message)
+	assert.Equal(t, "invalid customer ID", sentinel.Fields[0].Message)
+
+	unknown := errors.New("boom")
+	p = problem.From(unknown)
+	Localize(&p, unknown, "id")
+	assert.Equal(t, "terjadi kesalahan yang tidak terduga", p.Detail)
+}
+
+func TestInitLoadsCatalogueDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "en.json"), []byte(`{
+		"errors": {"widget_gone": "the widget has left"},
+		"validation": {"required": "{0} cannot be blank"}
+	}`), 0o644))
+	t.Cleanup(func() { defaultLanguage = "en" })
+
+	require.NoError(t, Init(config.I18NConfig{DefaultLanguage: "id", CatalogDir: dir}))
+	assert.Equal(t, "id", Negotiate("fr"))
+
+	err := fmt.Errorf("wrapped: %w", apperr.New(apperr.NotFound, "widget_gone", "widget gone"))
+	p := problem.From(err)
+	Localize(&p, err, "en")
+	assert.Equal(t, "the widget has left", p.Detail)
+
+	err = request.Validate(customerReq{Email: "a"})
+	p = problem.From(err)
+	Localize(&p, err, "en")
+	assert.Equal(t, "name cannot be blank", p.Errors[0].Message)
+
+	assert.Error(t, Init(config.I18NConfig{DefaultLanguage: "fr"}))
+	assert.Error(t, Add("en", Catalog{Errors: map[string]string{"x": "{0} {1}"}}))
+	assert.Error(t, Add("fr", Catalog{}))
+}
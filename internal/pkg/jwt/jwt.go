@@ -1,21 +1,26 @@
 package jwt
 
 import (
+	"context"
 	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+type claimsKey struct{}
+
 type JWTService struct {
 	secretKey string
 	issuer    string
 }
 
 type JWTClaims struct {
-	UserID   string `json:"user_id"`
-	Email    string `json:"email"`
-	Username string `json:"username"`
+	UserID    string `json:"user_id"`
+	Email     string `json:"email"`
+	Username  string `json:"username"`
+	CompanyID int64  `json:"company_id,omitempty"`
+	Role      string `json:"role,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -59,3 +64,16 @@ func (j *JWTService) ValidateToken(tokenString string) (*JWTClaims, error) {
 
 	return nil, fmt.Errorf("invalid token")
 }
+
+// WithClaims stores the authenticated caller's claims on the request context,
+// for code below the handlers that needs to know who is acting.
+func WithClaims(ctx context.Context, claims *JWTClaims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims stored by WithClaims, or nil for an
+// anonymous request.
+func ClaimsFromContext(ctx context.Context) *JWTClaims {
+	claims, _ := ctx.Value(claimsKey{}).(*JWTClaims)
+	return claims
+}
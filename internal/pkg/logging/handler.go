@@ -0,0 +1,128 @@
+package logger
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// levelHandler applies the level table in front of the format handler.
+type levelHandler struct {
+	inner slog.Handler
+}
+
+func (h *levelHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= levels.minimum()
+}
+
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < levels.forPC(r.PC) {
+		return nil
+	}
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{inner: h.inner.WithAttrs(attrs)}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{inner: h.inner.WithGroup(name)}
+}
+
+// simpleHandler writes one human-readable line per record:
+//
+//	2006-01-02 15:04:05.000 INFO  message key=value other="quoted value"
+type simpleHandler struct {
+	mu      *sync.Mutex
+	w       io.Writer
+	replace func([]string, slog.Attr) slog.Attr
+	attrs   []byte
+	prefix  string
+}
+
+func newSimpleHandler(w io.Writer, replace func([]string, slog.Attr) slog.Attr) *simpleHandler {
+	return &simpleHandler{mu: &sync.Mutex{}, w: w, replace: replace}
+}
+
+func (h *simpleHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *simpleHandler) Handle(_ context.Context, r slog.Record) error {
+	buf := make([]byte, 0, 256)
+	buf = r.Time.AppendFormat(buf, "2006-01-02 15:04:05.000")
+	buf = append(buf, ' ')
+	level := r.Level.String()
+	buf = append(buf, level...)
+	buf = append(buf, strings.Repeat(" ", max(5-len(level), 0))...)
+	buf = append(buf, ' ')
+	buf = append(buf, h.replace(nil, slog.String(slog.MessageKey, r.Message)).Value.String()...)
+	buf = append(buf, h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		buf = h.appendAttr(buf, h.prefix, a)
+		return true
+	})
+	buf = append(buf, '\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(buf)
+	return err
+}
+
+func (h *simpleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append([]byte(nil), h.attrs...)
+	for _, a := range attrs {
+		clone.attrs = h.appendAttr(clone.attrs, h.prefix, a)
+	}
+	return &clone
+}
+
+func (h *simpleHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
+
+func (h *simpleHandler) appendAttr(buf []byte, prefix string, a slog.Attr) []byte {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			buf = h.appendAttr(buf, prefix, ga)
+		}
+		return buf
+	}
+
+	a = h.replace(nil, a)
+	if a.Equal(slog.Attr{}) {
+		return buf
+	}
+
+	buf = append(buf, ' ')
+	buf = append(buf, prefix...)
+	buf = append(buf, a.Key...)
+	buf = append(buf, '=')
+
+	var value string
+	if a.Value.Kind() == slog.KindTime {
+		value = a.Value.Time().Format(time.RFC3339Nano)
+	} else {
+		value = a.Value.String()
+	}
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		return strconv.AppendQuote(buf, value)
+	}
+	return append(buf, value...)
+}
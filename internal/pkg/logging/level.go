@@ -0,0 +1,175 @@
+package logger
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// levelTable holds the global level plus per-package overrides. Packages are
+// matched on their import path, either in full or by trailing segments, so
+// "cache" and "infrastructure/cache" both match
+// sinibeli/internal/infrastructure/cache.
+type levelTable struct {
+	mu       sync.RWMutex
+	global   slog.Level
+	packages map[string]slog.Level
+	floor    slog.Level
+
+	callers sync.Map // pc -> package import path
+}
+
+type LevelSettings struct {
+	Level    string            `json:"level"`
+	Packages map[string]string `json:"packages"`
+}
+
+var levels = &levelTable{global: slog.LevelInfo, floor: slog.LevelInfo, packages: map[string]slog.Level{}}
+
+func SetLevel(level string) error {
+	l, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+	levels.global = l
+	levels.recomputeFloor()
+	return nil
+}
+
+// SetPackageLevel overrides the level for one package. An empty level removes
+// the override so the package follows the global level again.
+func SetPackageLevel(pkg, level string) error {
+	pkg = strings.Trim(pkg, "/")
+	if pkg == "" {
+		return fmt.Errorf("package must not be empty")
+	}
+
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+
+	if level == "" {
+		delete(levels.packages, pkg)
+	} else {
+		l, err := ParseLevel(level)
+		if err != nil {
+			return err
+		}
+		levels.packages[pkg] = l
+	}
+	levels.recomputeFloor()
+	return nil
+}
+
+func Levels() LevelSettings {
+	levels.mu.RLock()
+	defer levels.mu.RUnlock()
+
+	settings := LevelSettings{Level: levelName(levels.global), Packages: make(map[string]string, len(levels.packages))}
+	for pkg, l := range levels.packages {
+		settings.Packages[pkg] = levelName(l)
+	}
+	return settings
+}
+
+func ParseLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.ToUpper(strings.TrimSpace(level)))); err != nil {
+		return 0, fmt.Errorf("invalid log level %q, want debug, info, warn or error", level)
+	}
+	return l, nil
+}
+
+// parsePackageLevels reads "cache=warn,transaction=debug".
+func parsePackageLevels(spec string) (map[string]slog.Level, error) {
+	result := make(map[string]slog.Level)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pkg, level, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(pkg) == "" {
+			return nil, fmt.Errorf("invalid package level %q, want package=level", entry)
+		}
+		l, err := ParseLevel(level)
+		if err != nil {
+			return nil, err
+		}
+		result[strings.Trim(strings.TrimSpace(pkg), "/")] = l
+	}
+	return result, nil
+}
+
+func (t *levelTable) reset(global slog.Level, packages map[string]slog.Level) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.global = global
+	t.packages = packages
+	t.recomputeFloor()
+}
+
+// recomputeFloor caches the most verbose level in effect anywhere, which is
+// all Enabled can check before the caller's package is known.
+func (t *levelTable) recomputeFloor() {
+	t.floor = t.global
+	for _, l := range t.packages {
+		if l < t.floor {
+			t.floor = l
+		}
+	}
+}
+
+func (t *levelTable) minimum() slog.Level {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.floor
+}
+
+// forPC returns the level for the package that logged at pc. The longest
+// matching override wins.
+func (t *levelTable) forPC(pc uintptr) slog.Level {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if len(t.packages) == 0 || pc == 0 {
+		return t.global
+	}
+
+	pkg := t.packageOf(pc)
+	level, matched := t.global, ""
+	for key, l := range t.packages {
+		if (pkg == key || strings.HasSuffix(pkg, "/"+key)) && len(key) > len(matched) {
+			level, matched = l, key
+		}
+	}
+	return level
+}
+
+func (t *levelTable) packageOf(pc uintptr) string {
+	if pkg, ok := t.callers.Load(pc); ok {
+		return pkg.(string)
+	}
+
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	pkg := packagePath(frame.Function)
+	t.callers.Store(pc, pkg)
+	return pkg
+}
+
+// packagePath strips the receiver and function from a qualified name such as
+// "sinibeli/internal/infrastructure/cache.(*RedisCache).Get".
+func packagePath(function string) string {
+	slash := strings.LastIndex(function, "/")
+	if dot := strings.Index(function[slash+1:], "."); dot >= 0 {
+		return function[:slash+1+dot]
+	}
+	return function
+}
+
+func levelName(l slog.Level) string {
+	return strings.ToLower(l.String())
+}
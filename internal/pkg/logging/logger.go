@@ -2,10 +2,22 @@ package logger
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"log/slog"
+	"math"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"sinibeli/internal/config"
+	"sinibeli/internal/pkg/redact"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 type contextKey string
@@ -14,28 +26,94 @@ const RequestIDKey contextKey = "request_id"
 
 var Logger *slog.Logger
 
-func Init() {
-	var handler slog.Handler
+const (
+	FormatSimple = "simple"
+	FormatLogfmt = "logfmt"
+	FormatJSON   = "json"
+)
 
-	opts := &slog.HandlerOptions{
-		Level: getLogLevel(),
+// Init builds the process logger from LoggerConfig and installs it as the
+// slog default, so stray log.Printf calls end up in the same sink and format.
+func Init(cfg config.LoggerConfig) error {
+	w, err := newOutput(cfg)
+	if err != nil {
+		return err
 	}
 
-	if os.Getenv("ENV") == "production" {
-		handler = slog.NewJSONHandler(os.Stdout, opts)
-	} else {
-		handler = slog.NewTextHandler(os.Stdout, opts)
+	l, err := newLogger(cfg, w)
+	if err != nil {
+		return err
 	}
 
-	Logger = slog.New(handler)
+	Logger = l
+	slog.SetDefault(Logger)
+	return nil
 }
 
-func getLogLevel() slog.Level {
-	env := os.Getenv("ENV")
-	if env == "production" {
-		return slog.LevelWarn
+// newLogger applies the levels from cfg and builds the handler chain. Every
+// format runs attributes and messages through redact.ReplaceAttr so customer
+// PII never reaches the sink.
+func newLogger(cfg config.LoggerConfig, w io.Writer) (*slog.Logger, error) {
+	global, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	packages, err := parsePackageLevels(cfg.PackageLevels)
+	if err != nil {
+		return nil, err
+	}
+
+	// Level filtering happens in levelHandler; the format handlers accept
+	// everything they are given.
+	opts := &slog.HandlerOptions{Level: slog.Level(math.MinInt), ReplaceAttr: redact.ReplaceAttr}
+
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Type) {
+	case "", FormatSimple, "text":
+		handler = newSimpleHandler(w, redact.ReplaceAttr)
+	case FormatLogfmt:
+		handler = slog.NewTextHandler(w, opts)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log type %q, want simple, logfmt or json", cfg.Type)
 	}
-	return slog.LevelDebug
+
+	levels.reset(global, packages)
+	return slog.New(&levelHandler{inner: handler}), nil
+}
+
+func newOutput(cfg config.LoggerConfig) (io.Writer, error) {
+	switch cfg.Output {
+	case "", "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cfg.Output), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	return &lumberjack.Logger{
+		Filename:   cfg.Output,
+		MaxSize:    cfg.MaxSizeMB,
+		MaxBackups: cfg.MaxBackups,
+		MaxAge:     cfg.MaxAgeDays,
+		Compress:   cfg.Compress,
+	}, nil
+}
+
+// log records the caller of the exported helper as the source, which is what
+// per-package levels are matched against.
+func log(ctx context.Context, level slog.Level, msg string, args []interface{}) {
+	if !Logger.Enabled(ctx, level) {
+		return
+	}
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	r.Add(args...)
+	_ = Logger.Handler().Handle(ctx, r)
 }
 
 func WithRequestID(ctx context.Context) context.Context {
@@ -43,6 +121,12 @@ func WithRequestID(ctx context.Context) context.Context {
 	return context.WithValue(ctx, RequestIDKey, requestID)
 }
 
+// SetRequestID stores an ID supplied by the caller, such as an inbound
+// X-Request-ID header, instead of generating a new one.
+func SetRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, RequestIDKey, requestID)
+}
+
 func GetRequestID(ctx context.Context) string {
 	if id, ok := ctx.Value(RequestIDKey).(string); ok {
 		return id
@@ -50,44 +134,46 @@ func GetRequestID(ctx context.Context) string {
 	return "unknown"
 }
 
+// contextArgs prefixes args with the request ID and, when the request is
+// traced, the trace and span IDs so log lines can be joined with traces.
+func contextArgs(ctx context.Context, args []interface{}) []interface{} {
+	allArgs := []interface{}{"request_id", GetRequestID(ctx)}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		allArgs = append(allArgs, "trace_id", sc.TraceID().String(), "span_id", sc.SpanID().String())
+	}
+	return append(allArgs, args...)
+}
+
 func InfoCtx(ctx context.Context, msg string, args ...interface{}) {
-	requestID := GetRequestID(ctx)
-	allArgs := append([]interface{}{"request_id", requestID}, args...)
-	Logger.Info(msg, allArgs...)
+	log(ctx, slog.LevelInfo, msg, contextArgs(ctx, args))
 }
 
 func ErrorCtx(ctx context.Context, msg string, args ...interface{}) {
-	requestID := GetRequestID(ctx)
-	allArgs := append([]interface{}{"request_id", requestID}, args...)
-	Logger.Error(msg, allArgs...)
+	log(ctx, slog.LevelError, msg, contextArgs(ctx, args))
 }
 
 func DebugCtx(ctx context.Context, msg string, args ...interface{}) {
-	requestID := GetRequestID(ctx)
-	allArgs := append([]interface{}{"request_id", requestID}, args...)
-	Logger.Debug(msg, allArgs...)
+	log(ctx, slog.LevelDebug, msg, contextArgs(ctx, args))
 }
 
 func WarnCtx(ctx context.Context, msg string, args ...interface{}) {
-	requestID := GetRequestID(ctx)
-	allArgs := append([]interface{}{"request_id", requestID}, args...)
-	Logger.Warn(msg, allArgs...)
+	log(ctx, slog.LevelWarn, msg, contextArgs(ctx, args))
 }
 
 func Info(msg string, args ...interface{}) {
-	Logger.Info(msg, args...)
+	log(context.Background(), slog.LevelInfo, msg, args)
 }
 
 func Error(msg string, args ...interface{}) {
-	Logger.Error(msg, args...)
+	log(context.Background(), slog.LevelError, msg, args)
 }
 
 func Debug(msg string, args ...interface{}) {
-	Logger.Debug(msg, args...)
+	log(context.Background(), slog.LevelDebug, msg, args)
 }
 
 func Warn(msg string, args ...interface{}) {
-	Logger.Warn(msg, args...)
+	log(context.Background(), slog.LevelWarn, msg, args)
 }
 
 func With(args ...interface{}) *slog.Logger {
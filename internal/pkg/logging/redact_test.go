@@ -0,0 +1,80 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"sinibeli/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var rawPII = []string{
+	"casey.pandey@home.pl",
+	"997-474-3385",
+	"+62 812-3456-7890",
+	"Jl. Sudirman No. 1",
+	"1990-04-12",
+	"data:image/png;base64,iVBORw0KGgo",
+}
+
+type customerLike struct {
+	Email string
+	Phone string
+}
+
+func (c customerLike) String() string {
+	return fmt.Sprintf("customer %s %s", c.Email, c.Phone)
+}
+
+func logEverything(t *testing.T, l *slog.Logger) {
+	t.Helper()
+
+	previous := Logger
+	Logger = l
+	t.Cleanup(func() { Logger = previous })
+
+	ctx := SetRequestID(context.Background(), "req-1")
+
+	InfoCtx(ctx, "Customer created",
+		"email", "casey.pandey@home.pl",
+		"phone_number", "997-474-3385",
+		"address", "Jl. Sudirman No. 1",
+		"birth_date", "1990-04-12",
+		"photo", "data:image/png;base64,iVBORw0KGgo",
+	)
+	ErrorCtx(ctx, "Redis SET failed",
+		"key", "user:profile:casey.pandey@home.pl",
+		"error", errors.New(`pq: duplicate key value: Key (email)=(casey.pandey@home.pl) already exists`),
+	)
+	WarnCtx(ctx, "Callback requested by +62 812-3456-7890")
+	Info("Imported row", "row", customerLike{Email: "casey.pandey@home.pl", Phone: "997-474-3385"})
+	Logger.With("email", "casey.pandey@home.pl").Info("bound attrs")
+	Logger.WithGroup("customer").Info("grouped", "email", "casey.pandey@home.pl", "phone", "+62 812-3456-7890")
+}
+
+func TestNoRawPIIInLogOutput(t *testing.T) {
+	for _, format := range []string{FormatSimple, FormatLogfmt, FormatJSON} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			l, err := newLogger(config.LoggerConfig{Level: "debug", Type: format}, &buf)
+			require.NoError(t, err)
+
+			logEverything(t, l)
+
+			out := buf.String()
+			require.NotEmpty(t, out)
+			for _, raw := range rawPII {
+				assert.NotContains(t, out, raw)
+			}
+			assert.Contains(t, out, "c****@home.pl")
+			assert.Contains(t, out, "***-***-3385")
+			assert.Contains(t, out, "req-1")
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "sinibeli"
+
+var (
+	HTTPRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests handled, by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency, by method, route template and status code.",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_in_flight",
+		Help:      "HTTP requests currently being served.",
+	})
+
+	TransactionsCreated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "transactions",
+		Name:      "created_total",
+		Help:      "Transactions created, by transaction type and payment status.",
+	}, []string{"type", "status"})
+
+	TransactionAmount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "transactions",
+		Name:      "amount_total",
+		Help:      "Sum of created transaction amounts, by company.",
+	}, []string{"company_id"})
+
+	RefundsRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "transactions",
+		Name:      "refunds_rejected_total",
+		Help:      "Refund requests rejected by business rules, by reason.",
+	}, []string{"reason"})
+)
+
+const (
+	RefundReasonNoHistory     = "no_purchase_history"
+	RefundReasonNoPurchase    = "no_purchase"
+	RefundReasonExceeds       = "exceeds_available"
+	RefundReasonInvalidAmount = "invalid_amount"
+	RefundReasonExpired       = "period_expired"
+)
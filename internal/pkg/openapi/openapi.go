@@ -0,0 +1,197 @@
+// Package openapi builds OpenAPI 3.1 documents from Go types and serves them.
+// Schemas are derived from the json and binding tags the handlers already
+// bind with, so the document and the validation cannot drift apart; paths are
+// written the way gin registers them and converted here.
+package openapi
+
+import (
+	"embed"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"sinibeli/internal/pkg/problem"
+
+	"github.com/gin-gonic/gin"
+)
+
+const Version = "3.1.0"
+
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Tags       []Tag               `json:"tags,omitempty"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+
+	// names remembers the component each Go type was registered under.
+	names map[reflect.Type]string
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem holds the operations of a path by lower-case method.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	Tags        []string              `json:"tags,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Description string               `json:"description,omitempty"`
+	Required    bool                 `json:"required,omitempty"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Response is either a reference to a shared response or a response of its
+// own.
+type Response struct {
+	Ref         string               `json:"$ref,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	Responses       map[string]Response       `json:"responses,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+func New(info Info) *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   make(map[string]PathItem),
+		Components: Components{
+			Schemas:         make(map[string]*Schema),
+			Responses:       make(map[string]Response),
+			SecuritySchemes: make(map[string]SecurityScheme),
+		},
+		names: make(map[reflect.Type]string),
+	}
+}
+
+var ginParam = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// Path converts a gin route path to OpenAPI's template syntax.
+func Path(ginPath string) string {
+	return ginParam.ReplaceAllString(ginPath, "{$1}")
+}
+
+// Add documents the route registered with gin as method and path. Path
+// parameters the operation does not describe are added as strings.
+func (d *Document) Add(method, path string, op *Operation) {
+	for _, m := range ginParam.FindAllStringSubmatch(path, -1) {
+		if !op.hasParameter(m[1], "path") {
+			op.Parameters = append(op.Parameters, Parameter{Name: m[1], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+	}
+
+	path = Path(path)
+	item, ok := d.Paths[path]
+	if !ok {
+		item = make(PathItem)
+		d.Paths[path] = item
+	}
+	item[strings.ToLower(method)] = op
+}
+
+// Has reports whether the gin route method and path is documented.
+func (d *Document) Has(method, path string) bool {
+	_, ok := d.Paths[Path(path)][strings.ToLower(method)]
+	return ok
+}
+
+func (op *Operation) hasParameter(name, in string) bool {
+	for _, p := range op.Parameters {
+		if p.Name == name && p.In == in {
+			return true
+		}
+	}
+	return false
+}
+
+// JSON returns a request body or response content of application/json.
+func (d *Document) JSON(v interface{}) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: d.SchemaOf(v)}}
+}
+
+// Problem returns the shared response for an error status, described by the
+// problem details the error middleware writes.
+func (d *Document) Problem(status int) Response {
+	name := strings.ReplaceAll(http.StatusText(status), " ", "")
+	if _, ok := d.Components.Responses[name]; !ok {
+		d.Components.Responses[name] = Response{
+			Description: http.StatusText(status),
+			Content:     map[string]MediaType{problem.ContentType: {Schema: d.SchemaOf(problem.Problem{})}},
+		}
+	}
+	return Response{Ref: "#/components/responses/" + name}
+}
+
+//go:embed docs.html
+var assets embed.FS
+
+// Register serves the document at /openapi.json and a browsable reference
+// at /docs. The document is encoded once, here.
+func Register(router gin.IRoutes, d *Document) error {
+	body, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	page, err := assets.ReadFile("docs.html")
+	if err != nil {
+		return err
+	}
+
+	router.GET("/openapi.json", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", body)
+	})
+	router.GET("/docs", func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", page)
+	})
+	return nil
+}
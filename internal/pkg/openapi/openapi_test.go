@@ -0,0 +1,104 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type Pagination struct {
+	Page int64 `json:"page"`
+}
+
+type widgetReq struct {
+	Name     string     `json:"name" binding:"required,max=25"`
+	Kind     string     `json:"kind,omitempty" binding:"omitempty,oneof=small large"`
+	Count    int64      `json:"count" binding:"required,min=1"`
+	Tags     []string   `json:"tags" binding:"max=3"`
+	Due      *time.Time `json:"due,omitempty"`
+	Internal string     `json:"-"`
+	Page     Pagination `json:"pagination"`
+}
+
+type embedded struct {
+	widgetReq
+	Score float64 `json:"score"`
+}
+
+func TestSchemaFromBindingTags(t *testing.T) {
+	d := New(Info{Title: "test", Version: "1"})
+	ref := d.SchemaOf(widgetReq{})
+	assert.Equal(t, "#/components/schemas/widgetReq", ref.Ref)
+
+	s := d.Components.Schemas["widgetReq"]
+	require.NotNil(t, s)
+	assert.Equal(t, []string{"name", "count"}, s.Required)
+	assert.Equal(t, int64(25), *s.Properties["name"].MaxLength)
+	assert.Equal(t, []interface{}{"small", "large"}, s.Properties["kind"].Enum)
+	assert.Equal(t, 1.0, *s.Properties["count"].Minimum)
+	assert.Equal(t, int64(3), *s.Properties["tags"].MaxItems)
+	assert.Equal(t, []interface{}{"string", "null"}, s.Properties["due"].Type)
+	assert.Equal(t, "date-time", s.Properties["due"].Format)
+	assert.NotContains(t, s.Properties, "Internal")
+	assert.Equal(t, "#/components/schemas/Pagination", s.Properties["pagination"].Ref)
+
+	partial := d.Partial(widgetReq{})
+	assert.Empty(t, partial.Required)
+	assert.Contains(t, partial.Properties, "name")
+
+	d.SchemaOf(embedded{})
+	flat := d.Components.Schemas["embedded"]
+	assert.Contains(t, flat.Properties, "name")
+	assert.Contains(t, flat.Properties, "score")
+}
+
+func TestComponentNamesDoNotCollide(t *testing.T) {
+	type Pagination struct {
+		Cursor string `json:"cursor"`
+	}
+	d := New(Info{Title: "test", Version: "1"})
+	d.SchemaOf(widgetReq{})
+	assert.Equal(t, "#/components/schemas/OpenapiPagination", d.SchemaOf(Pagination{}).Ref)
+	assert.Equal(t, "#/components/schemas/Pagination", d.SchemaOf(widgetReq{}.Page).Ref)
+}
+
+func TestAddAndRegister(t *testing.T) {
+	d := New(Info{Title: "test", Version: "1"})
+	d.Add(http.MethodGet, "/widgets/:id/parts/:part", &Operation{
+		OperationID: "getPart",
+		Parameters:  []Parameter{{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "integer"}}},
+		Responses:   map[string]Response{"200": {Description: "OK"}, "404": d.Problem(http.StatusNotFound)},
+	})
+	assert.True(t, d.Has(http.MethodGet, "/widgets/:id/parts/:part"))
+	assert.False(t, d.Has(http.MethodDelete, "/widgets/:id/parts/:part"))
+
+	op := d.Paths["/widgets/{id}/parts/{part}"]["get"]
+	require.Len(t, op.Parameters, 2)
+	assert.Equal(t, "integer", op.Parameters[0].Schema.Type)
+	assert.Equal(t, "part", op.Parameters[1].Name)
+	assert.Contains(t, d.Components.Responses, "NotFound")
+	assert.Contains(t, d.Components.Schemas, "Problem")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	require.NoError(t, Register(router, d))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	assert.Equal(t, "3.1.0", doc["openapi"])
+	assert.Contains(t, doc["paths"], "/widgets/{id}/parts/{part}")
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `spec-url="openapi.json"`)
+}
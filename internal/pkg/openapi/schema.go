@@ -0,0 +1,265 @@
+package openapi
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Schema is the JSON Schema subset the documents use.
+type Schema struct {
+	Ref              string             `json:"$ref,omitempty"`
+	Type             interface{}        `json:"type,omitempty"`
+	Format           string             `json:"format,omitempty"`
+	Description      string             `json:"description,omitempty"`
+	Properties       map[string]*Schema `json:"properties,omitempty"`
+	Required         []string           `json:"required,omitempty"`
+	Items            *Schema            `json:"items,omitempty"`
+	AdditionalProps  *Schema            `json:"additionalProperties,omitempty"`
+	AllOf            []*Schema          `json:"allOf,omitempty"`
+	AnyOf            []*Schema          `json:"anyOf,omitempty"`
+	Enum             []interface{}      `json:"enum,omitempty"`
+	MinLength        *int64             `json:"minLength,omitempty"`
+	MaxLength        *int64             `json:"maxLength,omitempty"`
+	MinItems         *int64             `json:"minItems,omitempty"`
+	MaxItems         *int64             `json:"maxItems,omitempty"`
+	Minimum          *float64           `json:"minimum,omitempty"`
+	Maximum          *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum *float64           `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum *float64           `json:"exclusiveMaximum,omitempty"`
+	Example          interface{}        `json:"example,omitempty"`
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// SchemaOf returns the schema of v's type. Named structs are added to the
+// components and referenced, so each is described once.
+func (d *Document) SchemaOf(v interface{}) *Schema {
+	return d.schema(reflect.TypeOf(v))
+}
+
+// Partial returns the schema of v's type with nothing required, which is
+// what a JSON Merge Patch of that type looks like.
+func (d *Document) Partial(v interface{}) *Schema {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	s := d.object(t)
+	s.Required = nil
+	return s
+}
+
+func (d *Document) schema(t reflect.Type) *Schema {
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := d.schema(t.Elem())
+		if s.Ref != "" {
+			return &Schema{AnyOf: []*Schema{s, {Type: "null"}}}
+		}
+		s.Type = []interface{}{s.Type, "null"}
+		return s
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int32, reflect.Int16, reflect.Int8, reflect.Uint32, reflect.Uint16, reflect.Uint8:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: d.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProps: d.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.object(t)
+		}
+		return d.ref(t)
+	}
+	// Interfaces and anything else accept any value.
+	return &Schema{}
+}
+
+func (d *Document) ref(t reflect.Type) *Schema {
+	name, ok := d.names[t]
+	if !ok {
+		name = d.componentName(t)
+		d.names[t] = name
+		// Reserve the name first so a type that refers to itself ends.
+		d.Components.Schemas[name] = &Schema{}
+		d.Components.Schemas[name] = d.object(t)
+	}
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// componentName is the type's name, qualified with its package when another
+// package already has a type of that name, such as the Pagination of both
+// customers and transactions.
+func (d *Document) componentName(t reflect.Type) string {
+	name := t.Name()
+	if _, taken := d.Components.Schemas[name]; !taken {
+		return name
+	}
+	pkg := t.PkgPath()
+	pkg = pkg[strings.LastIndex(pkg, "/")+1:]
+	runes := []rune(pkg)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes) + name
+}
+
+func (d *Document) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	d.addFields(s, t)
+	return s
+}
+
+// addFields follows encoding/json: embedded structs without a name of their
+// own are flattened into the parent, and "-" fields are left out.
+func (d *Document) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			d.addFields(s, ft)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		field := d.schema(f.Type)
+		if applyBinding(field, f.Tag.Get("binding")) {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = field
+	}
+}
+
+// applyBinding turns the validator rules of a binding tag into schema
+// keywords and reports whether the field is required. Rules without a JSON
+// Schema counterpart are left to the prose.
+func applyBinding(s *Schema, tag string) (required bool) {
+	if tag == "" {
+		return false
+	}
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+		case "oneof":
+			for _, v := range strings.Fields(param) {
+				s.Enum = append(s.Enum, enumValue(s, v))
+			}
+		case "max", "lte":
+			limit(s, param, false, false)
+		case "min", "gte":
+			limit(s, param, true, false)
+		case "lt":
+			limit(s, param, false, true)
+		case "gt":
+			limit(s, param, true, true)
+		}
+	}
+	return required
+}
+
+// limit applies a bound: a length for strings, a count for arrays and a
+// value for numbers, as the validator reads min and max.
+func limit(s *Schema, param string, lower, exclusive bool) {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return
+	}
+	count := int64(n)
+	if exclusive {
+		if lower {
+			count++
+		} else {
+			count--
+		}
+	}
+
+	switch s.Type {
+	case "string":
+		if lower {
+			s.MinLength = &count
+		} else {
+			s.MaxLength = &count
+		}
+	case "array":
+		if lower {
+			s.MinItems = &count
+		} else {
+			s.MaxItems = &count
+		}
+	case "integer", "number":
+		switch {
+		case lower && exclusive:
+			s.ExclusiveMinimum = &n
+		case lower:
+			s.Minimum = &n
+		case exclusive:
+			s.ExclusiveMaximum = &n
+		default:
+			s.Maximum = &n
+		}
+	}
+}
+
+func enumValue(s *Schema, v string) interface{} {
+	switch s.Type {
+	case "integer":
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n
+		}
+	case "number":
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			return n
+		}
+	}
+	return v
+}
+
+// JSONPatch is the schema of an RFC 6902 JSON Patch document.
+func JSONPatch() *Schema {
+	return &Schema{
+		Type: "array",
+		Items: &Schema{
+			Type: "object",
+			Properties: map[string]*Schema{
+				"op":    {Type: "string", Enum: []interface{}{"add", "remove", "replace", "move", "copy", "test"}},
+				"path":  {Type: "string", Description: "JSON Pointer to the member the operation targets"},
+				"from":  {Type: "string", Description: "JSON Pointer to the source of move and copy"},
+				"value": {Description: "value for add, replace and test"},
+			},
+			Required: []string{"op", "path"},
+		},
+	}
+}
@@ -0,0 +1,460 @@
+// Package patch applies partial updates sent with PATCH: JSON Merge Patch
+// (RFC 7396), where a member set to null removes it and an absent member is
+// left alone, and JSON Patch (RFC 6902) for callers that need its explicit
+// operations.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"sinibeli/internal/pkg/apperr"
+)
+
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+var (
+	ErrUnsupportedMediaType = apperr.New(apperr.UnsupportedMediaType, "unsupported_patch_type", "PATCH body must be "+MergePatchType+" or "+JSONPatchType)
+	ErrInvalidPatch         = apperr.New(apperr.Invalid, "invalid_patch", "invalid patch")
+	ErrTestFailed           = apperr.New(apperr.Conflict, "patch_test_failed", "patch test operation failed")
+)
+
+// Document is a parsed patch of either kind.
+type Document struct {
+	merge interface{}
+	ops   []operation
+	isOps bool
+}
+
+type operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Parse reads a patch by its content type. Plain application/json is taken
+// as a merge patch, which is what clients sending a partial object expect.
+func Parse(contentType string, body []byte) (Document, error) {
+	switch contentType {
+	case MergePatchType, "application/json":
+		var merge interface{}
+		if err := decode(body, &merge); err != nil {
+			return Document{}, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		return Document{merge: merge}, nil
+	case JSONPatchType:
+		var ops []operation
+		if err := json.Unmarshal(body, &ops); err != nil {
+			return Document{}, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		for _, op := range ops {
+			if err := op.validate(); err != nil {
+				return Document{}, err
+			}
+		}
+		return Document{ops: ops, isOps: true}, nil
+	default:
+		return Document{}, ErrUnsupportedMediaType
+	}
+}
+
+func (op operation) validate() error {
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return fmt.Errorf("%w: %s operation needs a value", ErrInvalidPatch, op.Op)
+		}
+	case "move", "copy":
+		if _, err := pointer(op.From); err != nil {
+			return err
+		}
+	case "remove":
+	default:
+		return fmt.Errorf("%w: unknown operation %q", ErrInvalidPatch, op.Op)
+	}
+	_, err := pointer(op.Path)
+	return err
+}
+
+// Reads returns the top-level members whose current values the patch looks
+// at, which only JSON Patch's test, copy and move can do. Callers use it to
+// keep a patch from probing fields the caller may not see.
+func (d Document) Reads() []string {
+	var members []string
+	for _, op := range d.ops {
+		var from string
+		switch op.Op {
+		case "test":
+			from = op.Path
+		case "copy", "move":
+			from = op.From
+		default:
+			continue
+		}
+		tokens, _ := pointer(from)
+		if len(tokens) == 0 {
+			members = append(members, "")
+		} else {
+			members = append(members, tokens[0])
+		}
+	}
+	return members
+}
+
+// Apply patches a JSON document and returns the result.
+func (d Document) Apply(target []byte) ([]byte, error) {
+	var doc interface{}
+	if err := decode(target, &doc); err != nil {
+		return nil, err
+	}
+
+	if !d.isOps {
+		return json.Marshal(mergePatch(doc, d.merge))
+	}
+
+	for _, op := range d.ops {
+		var err error
+		if doc, err = op.apply(doc); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// ApplyTo patches the JSON form of v, which must be a pointer to a struct,
+// and decodes the result back into it. Members the struct does not have are
+// rejected, so a patch cannot reach fields that are not editable.
+func (d Document) ApplyTo(v interface{}) error {
+	current, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	patched, err := d.Apply(current)
+	if err != nil {
+		return err
+	}
+
+	target := reflect.ValueOf(v).Elem()
+	target.Set(reflect.Zero(target.Type()))
+
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	return nil
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	members, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	doc, ok := target.(map[string]interface{})
+	if !ok {
+		doc = make(map[string]interface{})
+	}
+	for name, value := range members {
+		if value == nil {
+			delete(doc, name)
+			continue
+		}
+		doc[name] = mergePatch(doc[name], value)
+	}
+	return doc
+}
+
+func (op operation) apply(doc interface{}) (interface{}, error) {
+	path, _ := pointer(op.Path)
+
+	switch op.Op {
+	case "add":
+		value, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	case "remove":
+		doc, _, err := remove(doc, path)
+		return doc, err
+	case "replace":
+		value, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		if doc, _, err = remove(doc, path); err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	case "move":
+		from, _ := pointer(op.From)
+		if op.Path != op.From && strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, fmt.Errorf("%w: cannot move %s into itself", ErrInvalidPatch, op.From)
+		}
+		doc, value, err := remove(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	case "copy":
+		from, _ := pointer(op.From)
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, clone(value))
+	case "test":
+		want, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		got, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(got, want) {
+			return nil, fmt.Errorf("%w: %s", ErrTestFailed, op.Path)
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("%w: unknown operation %q", ErrInvalidPatch, op.Op)
+}
+
+func (op operation) value() (interface{}, error) {
+	var value interface{}
+	if err := decode(op.Value, &value); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	return value, nil
+}
+
+// pointer splits a JSON Pointer (RFC 6901) into its unescaped tokens.
+func pointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if p[0] != '/' {
+		return nil, fmt.Errorf("%w: path %q must start with /", ErrInvalidPatch, p)
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func add(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token, rest := path[0], path[1:]
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		if len(rest) == 0 {
+			node[token] = value
+			return node, nil
+		}
+		child, ok := node[token]
+		if !ok {
+			return nil, missing(token)
+		}
+		updated, err := add(child, rest, value)
+		if err != nil {
+			return nil, err
+		}
+		node[token] = updated
+		return node, nil
+	case []interface{}:
+		if len(rest) == 0 {
+			if token == "-" {
+				return append(node, value), nil
+			}
+			i, err := index(token, len(node)+1)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		}
+		i, err := index(token, len(node))
+		if err != nil {
+			return nil, err
+		}
+		updated, err := add(node[i], rest, value)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = updated
+		return node, nil
+	}
+	return nil, missing(token)
+}
+
+func remove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("%w: cannot remove the whole document", ErrInvalidPatch)
+	}
+	token, rest := path[0], path[1:]
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[token]
+		if !ok {
+			return nil, nil, missing(token)
+		}
+		if len(rest) == 0 {
+			delete(node, token)
+			return node, child, nil
+		}
+		updated, removed, err := remove(child, rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		node[token] = updated
+		return node, removed, nil
+	case []interface{}:
+		i, err := index(token, len(node))
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(rest) == 0 {
+			removed := node[i]
+			return append(node[:i], node[i+1:]...), removed, nil
+		}
+		updated, removed, err := remove(node[i], rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		node[i] = updated
+		return node, removed, nil
+	}
+	return nil, nil, missing(token)
+}
+
+func get(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			child, ok := node[token]
+			if !ok {
+				return nil, missing(token)
+			}
+			doc = child
+		case []interface{}:
+			i, err := index(token, len(node))
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, missing(token)
+		}
+	}
+	return doc, nil
+}
+
+// index parses an array index, which must be below limit.
+func index(token string, limit int) (int, error) {
+	i := 0
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrInvalidPatch, token)
+	}
+	for _, r := range token {
+		if r < '0' || r > '9' {
+			return 0, fmt.Errorf("%w: invalid array index %q", ErrInvalidPatch, token)
+		}
+		i = i*10 + int(r-'0')
+		if i >= limit {
+			return 0, fmt.Errorf("%w: array index %s out of range", ErrInvalidPatch, token)
+		}
+	}
+	return i, nil
+}
+
+func missing(token string) error {
+	return fmt.Errorf("%w: path member %q does not exist", ErrInvalidPatch, token)
+}
+
+func decode(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("unexpected data after the JSON document")
+	}
+	return nil
+}
+
+func clone(v interface{}) interface{} {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(node))
+		for k, child := range node {
+			c[k] = clone(child)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(node))
+		for i, child := range node {
+			c[i] = clone(child)
+		}
+		return c
+	}
+	return v
+}
+
+// equal compares decoded JSON values, numbers by value so 1 and 1.0 match.
+func equal(a, b interface{}) bool {
+	if x, ok := a.(json.Number); ok {
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		fx, errX := x.Float64()
+		fy, errY := y.Float64()
+		if errX != nil || errY != nil {
+			return x == y
+		}
+		return fx == fy
+	}
+
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			w, ok := y[k]
+			if !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
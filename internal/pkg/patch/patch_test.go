@@ -0,0 +1,109 @@
+package patch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Cases from RFC 7396 appendix A.
+func TestMergePatch(t *testing.T) {
+	cases := []struct{ target, patch, want string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tc := range cases {
+		doc, err := Parse(MergePatchType, []byte(tc.patch))
+		require.NoError(t, err)
+		got, err := doc.Apply([]byte(tc.target))
+		require.NoError(t, err)
+		assert.JSONEq(t, tc.want, string(got), tc.patch)
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	cases := []struct{ target, patch, want string }{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"foo":"bar","baz":"qux"}`},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":"baz"}]`, `{"foo":["bar","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{`{"baz":"qux"}`, `[{"op":"replace","path":"/baz","value":null}]`, `{"baz":null}`},
+		{`{"foo":{"bar":"baz","waldo":"fred"},"qux":{}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"thud":"fred"}}`},
+		{`{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`},
+		{`{"a/b":1,"m~n":2}`, `[{"op":"test","path":"/a~1b","value":1.0},{"op":"remove","path":"/m~0n"}]`, `{"a/b":1}`},
+	}
+	for _, tc := range cases {
+		doc, err := Parse(JSONPatchType, []byte(tc.patch))
+		require.NoError(t, err)
+		got, err := doc.Apply([]byte(tc.target))
+		require.NoError(t, err, tc.patch)
+		assert.JSONEq(t, tc.want, string(got), tc.patch)
+	}
+}
+
+func TestJSONPatchErrors(t *testing.T) {
+	_, err := Parse(JSONPatchType, []byte(`[{"op":"jump","path":"/a"}]`))
+	assert.ErrorIs(t, err, ErrInvalidPatch)
+
+	_, err = Parse(JSONPatchType, []byte(`[{"op":"add","path":"/a"}]`))
+	assert.ErrorIs(t, err, ErrInvalidPatch)
+
+	_, err = Parse("text/plain", []byte(`{}`))
+	assert.ErrorIs(t, err, ErrUnsupportedMediaType)
+
+	doc, err := Parse(JSONPatchType, []byte(`[{"op":"test","path":"/a","value":"x"}]`))
+	require.NoError(t, err)
+	_, err = doc.Apply([]byte(`{"a":"y"}`))
+	assert.ErrorIs(t, err, ErrTestFailed)
+
+	doc, err = Parse(JSONPatchType, []byte(`[{"op":"remove","path":"/missing"}]`))
+	require.NoError(t, err)
+	_, err = doc.Apply([]byte(`{"a":"y"}`))
+	assert.ErrorIs(t, err, ErrInvalidPatch)
+
+	doc, err = Parse(JSONPatchType, []byte(`[{"op":"add","path":"/a/5","value":1}]`))
+	require.NoError(t, err)
+	_, err = doc.Apply([]byte(`{"a":[0]}`))
+	assert.ErrorIs(t, err, ErrInvalidPatch)
+}
+
+func TestApplyTo(t *testing.T) {
+	type fields struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+		Age   int    `json:"age"`
+	}
+
+	f := fields{Name: "Casey", Email: "casey@home.pl", Age: 30}
+	doc, err := Parse(MergePatchType, []byte(`{"email":null,"age":31}`))
+	require.NoError(t, err)
+	require.NoError(t, doc.ApplyTo(&f))
+	assert.Equal(t, fields{Name: "Casey", Age: 31}, f)
+
+	doc, err = Parse(MergePatchType, []byte(`{"id":7}`))
+	require.NoError(t, err)
+	assert.ErrorIs(t, doc.ApplyTo(&f), ErrInvalidPatch)
+}
+
+func TestReads(t *testing.T) {
+	doc, err := Parse(JSONPatchType, []byte(`[
+		{"op":"test","path":"/email","value":"x"},
+		{"op":"copy","from":"/address/0","path":"/first_name"},
+		{"op":"replace","path":"/last_name","value":"y"}]`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"email", "address"}, doc.Reads())
+
+	doc, err = Parse(MergePatchType, []byte(`{"email":"x"}`))
+	require.NoError(t, err)
+	assert.Empty(t, doc.Reads())
+}
@@ -0,0 +1,169 @@
+// Package problem renders errors as RFC 7807 problem details. Typed errors
+// from apperr keep their code and fields, Postgres constraint violations are
+// reported as the client mistakes they are, and anything else becomes a bare
+// 500 so internal messages never reach the client.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"sinibeli/internal/pkg/apperr"
+
+	"github.com/lib/pq"
+)
+
+const ContentType = "application/problem+json"
+
+type Problem struct {
+	Type      string              `json:"type"`
+	Title     string              `json:"title"`
+	Status    int                 `json:"status"`
+	Detail    string              `json:"detail,omitempty"`
+	Instance  string              `json:"instance,omitempty"`
+	Code      string              `json:"code"`
+	RequestID string              `json:"request_id,omitempty"`
+	Errors    []apperr.FieldError `json:"errors,omitempty"`
+
+	// Extensions are extra members such as the reference counts of a
+	// refused purge. They cannot override the members above.
+	Extensions map[string]interface{} `json:"-"`
+}
+
+// New returns a problem of type about:blank, whose title is the status text.
+func New(status int, code, detail string) Problem {
+	return Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+var statuses = map[apperr.Kind]int{
+	apperr.Invalid:              http.StatusBadRequest,
+	apperr.Unauthorized:         http.StatusUnauthorized,
+	apperr.Forbidden:            http.StatusForbidden,
+	apperr.NotFound:             http.StatusNotFound,
+	apperr.Conflict:             http.StatusConflict,
+	apperr.PreconditionFailed:   http.StatusPreconditionFailed,
+	apperr.TooLarge:             http.StatusRequestEntityTooLarge,
+	apperr.UnsupportedMediaType: http.StatusUnsupportedMediaType,
+	apperr.Unprocessable:        http.StatusUnprocessableEntity,
+	apperr.PreconditionRequired: http.StatusPreconditionRequired,
+}
+
+// From maps an error to the problem the client sees.
+func From(err error) Problem {
+	var appErr *apperr.Error
+	if errors.As(err, &appErr) {
+		status, ok := statuses[appErr.Kind]
+		if !ok {
+			return internal()
+		}
+		p := New(status, appErr.Code, err.Error())
+		p.Errors = appErr.Fields
+		var ext apperr.Extender
+		if errors.As(err, &ext) {
+			p.Extensions = ext.Extensions()
+		}
+		return p
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		if p, ok := fromPostgres(pqErr); ok {
+			return p
+		}
+	}
+	return internal()
+}
+
+func internal() Problem {
+	return New(http.StatusInternalServerError, "internal_error", "an unexpected error occurred")
+}
+
+var (
+	keyPattern   = regexp.MustCompile(`Key \(([^)]*)\)=`)
+	tablePattern = regexp.MustCompile(`table "([^"]+)"`)
+)
+
+// columnFields renames columns whose request field has a different name.
+// customer.company predates the _id naming used everywhere else.
+var columnFields = map[string]string{"company": "company_id"}
+
+// fromPostgres reports unique and foreign key violations. Only column and
+// table names are taken from the message; the key values are left out, as
+// they can be personal data or its blind index.
+func fromPostgres(e *pq.Error) (Problem, bool) {
+	fields := keyFields(e.Detail)
+	table := ""
+	if m := tablePattern.FindStringSubmatch(e.Detail); m != nil {
+		table = m[1]
+	}
+
+	switch e.Code {
+	case "23505": // unique_violation
+		p := New(http.StatusConflict, "duplicate", fmt.Sprintf("a record with the same %s already exists", strings.Join(fields, ", ")))
+		for _, f := range fields {
+			p.Errors = append(p.Errors, apperr.FieldError{Field: f, Code: "unique", Message: "is already taken"})
+		}
+		return p, true
+	case "23503": // foreign_key_violation
+		if strings.Contains(e.Detail, "is still referenced") {
+			return New(http.StatusConflict, "still_referenced", fmt.Sprintf("record is still referenced from %s", table)), true
+		}
+		p := New(http.StatusUnprocessableEntity, "invalid_reference", fmt.Sprintf("referenced %s does not exist", table))
+		for _, f := range fields {
+			p.Errors = append(p.Errors, apperr.FieldError{Field: f, Code: "exists", Message: fmt.Sprintf("refers to a %s that does not exist", table)})
+		}
+		return p, true
+	}
+	return Problem{}, false
+}
+
+func keyFields(detail string) []string {
+	m := keyPattern.FindStringSubmatch(detail)
+	if m == nil {
+		return nil
+	}
+	var fields []string
+	for _, column := range strings.Split(m[1], ",") {
+		column = strings.TrimSpace(column)
+		if field, ok := columnFields[column]; ok {
+			column = field
+		}
+		fields = append(fields, strings.TrimSuffix(column, "_bidx"))
+	}
+	return fields
+}
+
+// MarshalJSON writes the extension members alongside the standard ones.
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type plain Problem
+	body, err := json.Marshal(plain(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return body, err
+	}
+
+	members := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(body, &members); err != nil {
+		return nil, err
+	}
+	for k, v := range p.Extensions {
+		if _, taken := members[k]; taken {
+			continue
+		}
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		members[k] = raw
+	}
+	return json.Marshal(members)
+}
@@ -0,0 +1,127 @@
+package problem_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"sinibeli/internal/middleware"
+	"sinibeli/internal/pkg/apperr"
+	logger "sinibeli/internal/pkg/logging"
+	"sinibeli/internal/pkg/problem"
+	"sinibeli/internal/pkg/request"
+	"sinibeli/internal/pkg/softdelete"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errNotFound = apperr.New(apperr.NotFound, "widget_not_found", "widget not found")
+
+func TestFromTypedError(t *testing.T) {
+	p := problem.From(fmt.Errorf("loading: %w", errNotFound))
+	assert.Equal(t, http.StatusNotFound, p.Status)
+	assert.Equal(t, "widget_not_found", p.Code)
+	assert.Equal(t, "Not Found", p.Title)
+	assert.Equal(t, "loading: widget not found", p.Detail)
+
+	wrapped := apperr.Wrap(apperr.Invalid, "invalid_email", errors.New("invalid email address"))
+	p = problem.From(wrapped)
+	assert.Equal(t, http.StatusBadRequest, p.Status)
+	assert.Equal(t, "invalid email address", p.Detail)
+}
+
+func TestFromReferencedError(t *testing.T) {
+	err := fmt.Errorf("purge: %w", &softdelete.ReferencedError{Entity: "company", References: map[string]int64{"customers": 2}})
+	assert.ErrorIs(t, err, softdelete.ErrReferenced)
+
+	p := problem.From(err)
+	assert.Equal(t, http.StatusConflict, p.Status)
+	assert.Equal(t, "still_referenced", p.Code)
+
+	body, err := json.Marshal(p)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"about:blank","title":"Conflict","status":409,"code":"still_referenced",
+		"detail":"purge: company is still referenced and cannot be purged","references":{"customers":2}}`, string(body))
+}
+
+func TestFromPostgres(t *testing.T) {
+	dup := fmt.Errorf("failed to create customer: %w", &pq.Error{Code: "23505",
+		Detail: `Key (email_bidx)=(3f1a9c) already exists.`})
+	p := problem.From(dup)
+	assert.Equal(t, http.StatusConflict, p.Status)
+	assert.Equal(t, "duplicate", p.Code)
+	assert.Equal(t, []apperr.FieldError{{Field: "email", Code: "unique", Message: "is already taken"}}, p.Errors)
+	assert.NotContains(t, p.Detail, "3f1a9c")
+
+	missing := &pq.Error{Code: "23503", Detail: `Key (company)=(99) is not present in table "company".`}
+	p = problem.From(missing)
+	assert.Equal(t, http.StatusUnprocessableEntity, p.Status)
+	assert.Equal(t, "invalid_reference", p.Code)
+	assert.Equal(t, "company_id", p.Errors[0].Field)
+
+	referenced := &pq.Error{Code: "23503", Detail: `Key (id)=(7) is still referenced from table "transaction".`}
+	p = problem.From(referenced)
+	assert.Equal(t, http.StatusConflict, p.Status)
+	assert.Equal(t, "still_referenced", p.Code)
+}
+
+func TestFromUnknownErrorHidesMessage(t *testing.T) {
+	p := problem.From(errors.New(`pq: relation "secret_table" does not exist`))
+	assert.Equal(t, http.StatusInternalServerError, p.Status)
+	assert.Equal(t, "internal_error", p.Code)
+	assert.NotContains(t, p.Detail, "secret_table")
+}
+
+func TestErrorMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	type widgetReq struct {
+		Name  string `json:"name" binding:"required,max=5"`
+		Color string `json:"color" binding:"required,oneof=red blue"`
+	}
+
+	router := gin.New()
+	router.Use(middleware.RequestIDMiddleware(), middleware.ErrorMiddleware(), middleware.RecoveryMiddleware())
+	router.NoRoute(middleware.NoRoute)
+	router.POST("/widgets", func(c *gin.Context) {
+		if _, ok := request.BindJSON[widgetReq](c); ok {
+			c.Status(http.StatusCreated)
+		}
+	})
+	router.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+	req := httptest.NewRequest(http.MethodPost, "/widgets", strings.NewReader(`{"name":"toolong","color":"green"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(middleware.RequestIDHeader, "req-123")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, problem.ContentType, rec.Header().Get("Content-Type"))
+	var p problem.Problem
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	assert.Equal(t, "validation_failed", p.Code)
+	assert.Equal(t, "req-123", p.RequestID)
+	assert.Equal(t, "/widgets", p.Instance)
+	assert.Equal(t, []apperr.FieldError{
+		{Field: "name", Code: "max", Message: "must be at most 5 characters"},
+		{Field: "color", Code: "oneof", Message: "must be one of: red, blue"},
+	}, p.Errors)
+
+	for path, want := range map[string]int{"/panic": http.StatusInternalServerError, "/nowhere": http.StatusNotFound} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, want, rec.Code, path)
+		assert.Equal(t, problem.ContentType, rec.Header().Get("Content-Type"), path)
+	}
+}
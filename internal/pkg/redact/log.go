@@ -0,0 +1,68 @@
+package redact
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// sensitiveKeys are attribute keys whose values are PII regardless of
+// content. Matching is case-insensitive on the last path segment.
+var sensitiveKeys = map[string]func(string) string{
+	"email":         Email,
+	"phone":         Phone,
+	"phone_number":  Phone,
+	"address":       func(string) string { return Mask },
+	"birth_date":    func(string) string { return Mask },
+	"photo":         func(string) string { return Mask },
+	"password":      func(string) string { return Mask },
+	"authorization": func(string) string { return Mask },
+	"token":         func(string) string { return Mask },
+}
+
+// passthroughKeys are never rewritten; they are generated by us and would
+// otherwise be at risk of matching the phone pattern.
+var passthroughKeys = map[string]bool{
+	slog.TimeKey:   true,
+	slog.LevelKey:  true,
+	slog.SourceKey: true,
+	"request_id":   true,
+	"trace_id":     true,
+	"span_id":      true,
+}
+
+// ReplaceAttr is a slog.HandlerOptions.ReplaceAttr that masks PII by key and
+// scrubs emails and phone numbers out of any other string or error value,
+// including the message itself.
+func ReplaceAttr(_ []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	if passthroughKeys[key] {
+		return a
+	}
+
+	if mask, ok := sensitiveKeys[key]; ok {
+		return slog.String(a.Key, mask(valueString(a.Value)))
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, String(a.Value.String()))
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case error:
+			return slog.String(a.Key, String(v.Error()))
+		case []byte:
+			return slog.String(a.Key, String(string(v)))
+		case fmt.Stringer:
+			return slog.String(a.Key, String(v.String()))
+		}
+	}
+	return a
+}
+
+func valueString(v slog.Value) string {
+	if err, ok := v.Any().(error); ok && v.Kind() == slog.KindAny {
+		return err.Error()
+	}
+	return v.String()
+}
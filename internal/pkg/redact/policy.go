@@ -0,0 +1,22 @@
+package redact
+
+// Policy decides which callers may see unmasked PII in API responses.
+type Policy struct {
+	privileged map[string]bool
+}
+
+func NewPolicy(privilegedRoles []string) *Policy {
+	p := &Policy{privileged: make(map[string]bool, len(privilegedRoles))}
+	for _, role := range privilegedRoles {
+		if role != "" {
+			p.privileged[role] = true
+		}
+	}
+	return p
+}
+
+// CanViewPII reports whether role sees raw PII. Anonymous callers (empty
+// role) never do.
+func (p *Policy) CanViewPII(role string) bool {
+	return role != "" && p.privileged[role]
+}
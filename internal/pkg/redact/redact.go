@@ -0,0 +1,69 @@
+package redact
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const Mask = "[REDACTED]"
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+	// Phone numbers as they appear in our data: international (+62 812 ...),
+	// Indonesian national (0812-3456-7890) and the NANP style used by the
+	// seed data (997-474-3385). Bare digit runs are left alone so IDs,
+	// amounts and dates survive.
+	phonePattern = regexp.MustCompile(`\+\d[\d\s\-()]{7,17}\d|\b0\d{2,3}[\s\-]?\d{3,4}[\s\-]?\d{3,5}\b|\b\d{3}[\-.]\d{3}[\-.]\d{4}\b`)
+)
+
+// Email keeps the first character of the local part and the domain:
+// casey@home.pl becomes c****@home.pl.
+func Email(email string) string {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" {
+		return Mask
+	}
+	first := []rune(local)[0]
+	return string(first) + "****@" + domain
+}
+
+// Phone masks every digit except the last four and keeps separators, so
+// 997-474-3385 becomes ***-***-3385.
+func Phone(phone string) string {
+	digits := 0
+	for _, r := range phone {
+		if unicode.IsDigit(r) {
+			digits++
+		}
+	}
+	if digits == 0 {
+		return Mask
+	}
+
+	keep := min(4, digits/2)
+	var b strings.Builder
+	seen := 0
+	for _, r := range phone {
+		if unicode.IsDigit(r) {
+			seen++
+			if seen <= digits-keep {
+				b.WriteByte('*')
+				continue
+			}
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// String masks emails and phone numbers embedded in free text such as error
+// messages or cache keys.
+func String(s string) string {
+	if s == "" {
+		return s
+	}
+	s = emailPattern.ReplaceAllStringFunc(s, Email)
+	return phonePattern.ReplaceAllStringFunc(s, Phone)
+}
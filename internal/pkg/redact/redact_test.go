@@ -0,0 +1,65 @@
+package redact
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmail(t *testing.T) {
+	cases := map[string]string{
+		"casey@home.pl":       "c****@home.pl",
+		"a@b.co":              "a****@b.co",
+		"ünal@example.com":    "ü****@example.com",
+		"not-an-email":        Mask,
+		"@missing-local.test": Mask,
+	}
+	for in, want := range cases {
+		assert.Equal(t, want, Email(in), in)
+	}
+}
+
+func TestPhone(t *testing.T) {
+	cases := map[string]string{
+		"997-474-3385":    "***-***-3385",
+		"+62 812 3456 78": "+** *** **56 78",
+		"081234567890":    "********7890",
+		"12":              "*2",
+		"n/a":             Mask,
+	}
+	for in, want := range cases {
+		assert.Equal(t, want, Phone(in), in)
+	}
+}
+
+func TestStringMasksEmbeddedPII(t *testing.T) {
+	in := `pq: duplicate key value violates unique constraint "customer_email_key": Key (email)=(casey@home.pl) already exists, phone 997-474-3385 / +62 812-3456-7890 / 0812 3456 7890`
+	out := String(in)
+
+	for _, raw := range []string{"casey@home.pl", "997-474-3385", "+62 812-3456-7890", "0812 3456 7890"} {
+		assert.NotContains(t, out, raw)
+	}
+	assert.Contains(t, out, "c****@home.pl")
+	assert.Contains(t, out, "***-***-3385")
+}
+
+func TestStringLeavesNonPIIAlone(t *testing.T) {
+	for _, in := range []string{
+		"2024-03-01 10:15:00",
+		"amount 1000000.00 exceeds limit",
+		"transaction 1234567890123 not found",
+		"reports:summary:9f86d081884c7d659a2feaa0c55ad015",
+		"550e8400-e29b-41d4-a716-446655440000",
+	} {
+		assert.Equal(t, in, String(in))
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	p := NewPolicy([]string{"admin", "support", ""})
+
+	assert.True(t, p.CanViewPII("admin"))
+	assert.True(t, p.CanViewPII("support"))
+	assert.False(t, p.CanViewPII("cashier"))
+	assert.False(t, p.CanViewPII(""))
+}
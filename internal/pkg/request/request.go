@@ -0,0 +1,125 @@
+// Package request binds and validates request bodies. Every call decodes
+// into a value of its own, so concurrent requests never share state and
+// nothing from one request is left over in the next.
+package request
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"sinibeli/internal/pkg/apperr"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+var (
+	ErrUnreadableBody   = apperr.New(apperr.Invalid, "unreadable_body", "request body could not be read")
+	ErrMalformedBody    = apperr.New(apperr.Invalid, "malformed_body", "request body is not valid JSON")
+	ErrInvalidBody      = apperr.New(apperr.Invalid, "invalid_body", "request body has fields of the wrong type")
+	ErrValidationFailed = apperr.New(apperr.Invalid, "validation_failed", "request body failed validation")
+)
+
+func init() {
+	// Report fields by their JSON names, which is what clients sent.
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(jsonName)
+	}
+}
+
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return f.Name
+	}
+	return name
+}
+
+// Bind decodes the JSON body into a new T and checks its binding tags.
+// Failures are apperr.Invalid errors naming the fields at fault.
+func Bind[T any](c *gin.Context) (T, error) {
+	var req T
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return req, bindError(err)
+	}
+	return req, nil
+}
+
+// BindJSON is Bind for handlers without anything to add to the error: a
+// request that does not bind is reported through c.Error and ok is false.
+func BindJSON[T any](c *gin.Context) (req T, ok bool) {
+	req, err := Bind[T](c)
+	if err != nil {
+		c.Error(err)
+		return req, false
+	}
+	return req, true
+}
+
+// Validate checks the binding tags of a struct that was not bound from the
+// body, such as the result of applying a patch.
+func Validate(v interface{}) error {
+	if err := binding.Validator.ValidateStruct(v); err != nil {
+		return bindError(err)
+	}
+	return nil
+}
+
+func bindError(err error) error {
+	var (
+		validationErrs validator.ValidationErrors
+		typeErr        *json.UnmarshalTypeError
+		syntaxErr      *json.SyntaxError
+	)
+	switch {
+	case errors.As(err, &validationErrs):
+		fields := make([]apperr.FieldError, len(validationErrs))
+		for i, fe := range validationErrs {
+			fields[i] = apperr.FieldError{Field: fieldPath(fe), Code: fe.Tag(), Message: message(fe)}
+		}
+		return ErrValidationFailed.WithFields(fields...).WithCause(err)
+	case errors.As(err, &typeErr):
+		return ErrInvalidBody.WithFields(apperr.FieldError{
+			Field:   typeErr.Field,
+			Code:    "type",
+			Message: "must be " + typeErr.Type.String(),
+		}).WithCause(err)
+	case errors.As(err, &syntaxErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrMalformedBody.WithCause(err)
+	}
+	return apperr.Wrap(apperr.Invalid, ErrInvalidBody.Code, err)
+}
+
+// fieldPath drops the struct name the validator puts in front of the path.
+func fieldPath(fe validator.FieldError) string {
+	if _, path, ok := strings.Cut(fe.Namespace(), "."); ok {
+		return path
+	}
+	return fe.Field()
+}
+
+func message(fe validator.FieldError) string {
+	unit := ""
+	if fe.Kind() == reflect.String {
+		unit = " characters"
+	}
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "max", "lte":
+		return fmt.Sprintf("must be at most %s%s", fe.Param(), unit)
+	case "min", "gte":
+		return fmt.Sprintf("must be at least %s%s", fe.Param(), unit)
+	case "oneof":
+		return "must be one of: " + strings.Join(strings.Fields(fe.Param()), ", ")
+	}
+	return fmt.Sprintf("failed the %s check", fe.Tag())
+}
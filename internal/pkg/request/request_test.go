@@ -0,0 +1,200 @@
+package request_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"sinibeli/internal/app/audit"
+	"sinibeli/internal/app/company"
+	"sinibeli/internal/app/product"
+	"sinibeli/internal/infrastructure/cache"
+	logger "sinibeli/internal/pkg/logging"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConcurrentCreatesAreIsolated fires creates at the real handlers from
+// many goroutines, each with its own payload, and checks that every response
+// and every INSERT carries exactly what that request sent. Run it with -race:
+// binding into shared request structs shows up there even when the payloads
+// happen not to get mixed.
+func TestConcurrentCreatesAreIsolated(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	db := newFakeDB(t)
+
+	appCache := cache.NewMemoryCache(1000)
+	invalidator := cache.NewInvalidator(appCache)
+	recorder := audit.NewRecorder(audit.NewAuditRepo(db.DB))
+
+	router := gin.New()
+	router.POST("/companies", company.NewCompanyHandler(company.NewCompanyService(company.NewCompanyRepo(db.DB), appCache, invalidator, recorder)).Create)
+	router.POST("/products", product.NewProductHandler(product.NewProductService(product.NewProductRepo(db.DB, nil), appCache, invalidator, recorder)).Create)
+
+	const workers, perWorker = 32, 25
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				id := int64(w*perWorker + i + 1)
+				if i%2 == 0 {
+					createCompany(t, router, id)
+				} else {
+					createProduct(t, router, id)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for id, args := range db.inserted("company") {
+		assert.Equal(t, fmt.Sprintf("company-%d", id), args[1], "company %d", id)
+		assert.Equal(t, fmt.Sprintf("city-%d", id), args[4], "company %d", id)
+	}
+	for id, args := range db.inserted("product") {
+		assert.Equal(t, fmt.Sprintf("product-%d", id), args[1], "product %d", id)
+		assert.Equal(t, float64(id)+0.5, args[2], "product %d", id)
+	}
+	assert.Len(t, db.inserted("company"), workers*((perWorker+1)/2))
+	assert.Len(t, db.inserted("product"), workers*(perWorker/2))
+}
+
+func createCompany(t *testing.T, router http.Handler, id int64) {
+	body := fmt.Sprintf(`{"id":%d,"name":"company-%d","type":"corp","address":"street %d","city":"city-%d"}`, id, id, id, id)
+	var got company.Company
+	post(t, router, "/companies", body, &got)
+	assert.Equal(t, company.Company{ID: id, Name: fmt.Sprintf("company-%d", id), Type: "corp",
+		Address: fmt.Sprintf("street %d", id), City: fmt.Sprintf("city-%d", id), Version: 1}, got)
+}
+
+func createProduct(t *testing.T, router http.Handler, id int64) {
+	body := fmt.Sprintf(`{"id":%d,"product_name":"product-%d","service_fee":"%d.5","service_fee_percentage":true}`, id, id, id)
+	var got product.Product
+	post(t, router, "/products", body, &got)
+	assert.Equal(t, product.Product{ID: id, ProductName: fmt.Sprintf("product-%d", id),
+		ServiceFee: float64(id) + 0.5, ServiceFeePercentage: true, Version: 1}, got)
+}
+
+func post(t *testing.T, router http.Handler, path, body string, out interface{}) {
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if assert.Equal(t, http.StatusCreated, rec.Code, rec.Body.String()) {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), out))
+	}
+}
+
+// fakeDB is a database/sql driver that remembers the arguments of company
+// and product INSERTs by ID and answers every RETURNING with 1, which is all
+// the create paths, including the audit log, need.
+type fakeDB struct {
+	DB *sql.DB
+
+	mu      sync.Mutex
+	inserts map[string]map[int64][]driver.Value
+}
+
+var registerFake sync.Once
+
+func newFakeDB(t *testing.T) *fakeDB {
+	d := &fakeDB{inserts: make(map[string]map[int64][]driver.Value)}
+	registerFake.Do(func() { sql.Register("request-fake", fakeDriver{}) })
+	fakeDBs.Store(t.Name(), d)
+
+	db, err := sql.Open("request-fake", t.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	d.DB = db
+	return d
+}
+
+func (d *fakeDB) inserted(table string) map[int64][]driver.Value {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.inserts[table]
+}
+
+var fakeDBs sync.Map
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	d, ok := fakeDBs.Load(name)
+	if !ok {
+		return nil, fmt.Errorf("no fake database %q", name)
+	}
+	return &fakeConn{db: d.(*fakeDB)}, nil
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *fakeConn) Commit() error             { return nil }
+func (c *fakeConn) Rollback() error           { return nil }
+
+func (c *fakeConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	for _, table := range []string{"company", "product"} {
+		if !strings.Contains(query, "INSERT INTO "+table+" ") {
+			continue
+		}
+		values := make([]driver.Value, len(args))
+		for i, a := range args {
+			values[i] = a.Value
+		}
+
+		c.db.mu.Lock()
+		if c.db.inserts[table] == nil {
+			c.db.inserts[table] = make(map[int64][]driver.Value)
+		}
+		c.db.inserts[table][values[0].(int64)] = values
+		c.db.mu.Unlock()
+	}
+
+	if strings.Contains(query, "RETURNING") {
+		return &fakeRows{row: []driver.Value{int64(1)}}, nil
+	}
+	return &fakeRows{}, nil
+}
+
+type fakeRows struct {
+	row  []driver.Value
+	done bool
+}
+
+func (r *fakeRows) Columns() []string { return []string{"value"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done || r.row == nil {
+		return io.EOF
+	}
+	r.done = true
+	copy(dest, r.row)
+	return nil
+}
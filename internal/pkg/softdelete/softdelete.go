@@ -0,0 +1,56 @@
+// Package softdelete holds what the soft-deletable entities (companies,
+// customers and products) share: deleting only stamps deleted_at, and a hard
+// purge is refused while other rows still reference the record.
+package softdelete
+
+import (
+	"errors"
+	"fmt"
+
+	"sinibeli/internal/pkg/apperr"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrNotDeleted = apperr.New(apperr.Conflict, "not_deleted", "record is not deleted")
+	ErrReferenced = apperr.New(apperr.Conflict, "still_referenced", "record is still referenced")
+)
+
+// ReferencedError reports why a purge was refused, with the number of rows
+// of each kind that still point at the record.
+type ReferencedError struct {
+	Entity     string
+	References map[string]int64
+}
+
+func (e *ReferencedError) Error() string {
+	return fmt.Sprintf("%s is still referenced and cannot be purged", e.Entity)
+}
+
+func (e *ReferencedError) Unwrap() error {
+	return ErrReferenced
+}
+
+// Extensions reports the reference counts alongside the error.
+func (e *ReferencedError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"references": e.References}
+}
+
+// Check returns a ReferencedError when any of the counts is non-zero.
+func Check(entity string, references map[string]int64) error {
+	for _, n := range references {
+		if n > 0 {
+			return &ReferencedError{Entity: entity, References: references}
+		}
+	}
+	return nil
+}
+
+// IsForeignKeyViolation reports whether err is Postgres refusing a delete
+// because a row still references it, which is how a reference added between
+// the check and the purge shows up.
+func IsForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
@@ -0,0 +1,47 @@
+CREATE TABLE IF NOT EXISTS transaction_daily_rollup (
+    day DATE NOT NULL,
+    company_id BIGINT NOT NULL REFERENCES company(id),
+    product_id BIGINT NOT NULL REFERENCES product(id),
+    transaction_type VARCHAR(20) NOT NULL,
+    payment_status VARCHAR(20) NOT NULL,
+    trx_count BIGINT NOT NULL DEFAULT 0,
+    amount NUMERIC(18, 2) NOT NULL DEFAULT 0,
+    tax_amount NUMERIC(18, 2) NOT NULL DEFAULT 0,
+    fee_amount NUMERIC(18, 2) NOT NULL DEFAULT 0,
+    first_trx_on TIMESTAMP NOT NULL,
+    id_first_trx BIGINT NOT NULL,
+    last_trx_on TIMESTAMP NOT NULL,
+    id_last_trx BIGINT NOT NULL,
+    refreshed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (day, company_id, product_id, transaction_type, payment_status)
+);
+
+CREATE INDEX IF NOT EXISTS idx_rollup_company_product_day ON transaction_daily_rollup (company_id, product_id, day);
+CREATE INDEX IF NOT EXISTS idx_transaction_datetime ON transaction (transaction_datetime);
+
+-- Days are calendar days in REPORT_TIMEZONE (Asia/Jakarta by default). If the
+-- application runs with a different zone, rebuild with `go run ./cmd/rollup`.
+INSERT INTO transaction_daily_rollup (
+    day, company_id, product_id, transaction_type, payment_status,
+    trx_count, amount, tax_amount, fee_amount,
+    first_trx_on, id_first_trx, last_trx_on, id_last_trx
+)
+SELECT
+    ((t.transaction_datetime AT TIME ZONE 'UTC') AT TIME ZONE 'Asia/Jakarta')::date,
+    cu.company,
+    p.id,
+    t.transaction_type,
+    t.payment_status,
+    COUNT(t.id),
+    SUM(t.amount),
+    SUM(t.tax_amount),
+    SUM(CASE WHEN p.service_fee_percentage THEN t.amount * p.service_fee / 100 ELSE p.service_fee END),
+    MIN(t.transaction_datetime),
+    (array_agg(t.id ORDER BY t.transaction_datetime ASC, t.id ASC))[1],
+    MAX(t.transaction_datetime),
+    (array_agg(t.id ORDER BY t.transaction_datetime DESC, t.id DESC))[1]
+FROM transaction t
+    INNER JOIN customer cu ON cu.id = t.customer_id
+    INNER JOIN product p ON p.id = t.product_id
+GROUP BY 1, 2, 3, 4, 5
+ON CONFLICT DO NOTHING;
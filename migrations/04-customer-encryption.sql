@@ -0,0 +1,21 @@
+-- Customer PII (email, phone_number, address, photo) is encrypted by the
+-- application. Ciphertexts are longer than the original VARCHAR limits, email
+-- uniqueness moves to a blind index, and pii_key_id records which key sealed
+-- the row so key rotation can find what is left to re-encrypt.
+-- Rows that predate this migration stay readable as plaintext until
+-- `go run ./cmd/rotatekeys` encrypts them and fills email_bidx. The index is
+-- keyed by the application, so it cannot be backfilled here; the API refuses
+-- to start while any email is still unindexed.
+
+ALTER TABLE customer
+    ALTER COLUMN email TYPE TEXT,
+    ALTER COLUMN phone_number TYPE TEXT,
+    ALTER COLUMN address TYPE TEXT;
+
+ALTER TABLE customer DROP CONSTRAINT IF EXISTS customer_email_key;
+
+ALTER TABLE customer ADD COLUMN IF NOT EXISTS email_bidx CHAR(64);
+ALTER TABLE customer ADD COLUMN IF NOT EXISTS pii_key_id VARCHAR(64);
+
+CREATE UNIQUE INDEX IF NOT EXISTS customer_email_bidx_key ON customer (email_bidx);
+CREATE INDEX IF NOT EXISTS idx_customer_pii_key_id ON customer (pii_key_id);
@@ -0,0 +1,7 @@
+-- Customer photos move from inline data URIs in customer.photo to blob
+-- storage. photo_key and photo_thumb_key hold the object keys of the image
+-- and its generated thumbnail. customer.photo is kept only for rows not yet
+-- migrated; `go run ./cmd/migratephotos` moves them and clears the column.
+
+ALTER TABLE customer ADD COLUMN IF NOT EXISTS photo_key VARCHAR(255);
+ALTER TABLE customer ADD COLUMN IF NOT EXISTS photo_thumb_key VARCHAR(255);
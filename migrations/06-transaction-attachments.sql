@@ -0,0 +1,23 @@
+-- Files attached to transactions (receipts, payment proofs, dispute
+-- evidence). The content lives in blob storage under
+-- transactions/<transaction_id>/attachments/<id>; company_id is copied from
+-- the transaction's customer so listings can be scoped without a join.
+
+CREATE TABLE IF NOT EXISTS transaction_attachment (
+    id UUID PRIMARY KEY,
+    transaction_id BIGINT NOT NULL REFERENCES transaction(id),
+    company_id BIGINT NOT NULL REFERENCES company(id),
+    kind VARCHAR(32) NOT NULL,
+    file_name VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    sha256 CHAR(64) NOT NULL,
+    uploaded_by VARCHAR(100) NOT NULL,
+    scan_status VARCHAR(20) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS transaction_attachment_checksum_key
+    ON transaction_attachment (transaction_id, sha256);
+CREATE INDEX IF NOT EXISTS idx_transaction_attachment_company
+    ON transaction_attachment (company_id);
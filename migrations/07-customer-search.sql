@@ -0,0 +1,21 @@
+-- Customer search. Names are matched fuzzily through trigram and prefix
+-- full-text indexes on generated columns. Email and phone are encrypted, so
+-- they are matched exactly through blind indexes: email_bidx already exists,
+-- phone_bidx indexes the phone's digits and phone_suffix_bidx its last four.
+-- Existing rows get the phone indexes from `go run ./cmd/rotatekeys`.
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE customer ADD COLUMN IF NOT EXISTS phone_bidx CHAR(64);
+ALTER TABLE customer ADD COLUMN IF NOT EXISTS phone_suffix_bidx CHAR(64);
+
+ALTER TABLE customer ADD COLUMN IF NOT EXISTS search_name TEXT
+    GENERATED ALWAYS AS (lower(first_name || ' ' || last_name)) STORED;
+ALTER TABLE customer ADD COLUMN IF NOT EXISTS search_tsv TSVECTOR
+    GENERATED ALWAYS AS (to_tsvector('simple', first_name || ' ' || last_name)) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_customer_search_name_trgm ON customer USING GIN (search_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_customer_search_tsv ON customer USING GIN (search_tsv);
+CREATE INDEX IF NOT EXISTS idx_customer_phone_bidx ON customer (phone_bidx);
+CREATE INDEX IF NOT EXISTS idx_customer_phone_suffix_bidx ON customer (phone_suffix_bidx);
+CREATE INDEX IF NOT EXISTS idx_customer_company ON customer (company);
@@ -0,0 +1,6 @@
+-- Phone numbers are kept as entered in phone_number and, when they parse, in
+-- E.164 form in phone_e164 (encrypted like the other PII columns). The phone
+-- blind indexes are derived from the E.164 form. Existing rows are filled by
+-- `go run ./cmd/backfillphones`, which also reports numbers that do not parse.
+
+ALTER TABLE customer ADD COLUMN IF NOT EXISTS phone_e164 TEXT;
@@ -0,0 +1,23 @@
+-- A merged customer keeps its row, pointing at the survivor through
+-- merged_into, so the merge can be undone. customer_merge is the audit trail:
+-- one row per merge, with the transactions it moved.
+
+ALTER TABLE customer ADD COLUMN IF NOT EXISTS merged_into BIGINT REFERENCES customer(id);
+ALTER TABLE customer ADD COLUMN IF NOT EXISTS merged_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_customer_birth_date ON customer (birth_date);
+CREATE INDEX IF NOT EXISTS idx_transaction_customer ON transaction (customer_id);
+
+CREATE TABLE IF NOT EXISTS customer_merge (
+    id BIGSERIAL PRIMARY KEY,
+    survivor_id BIGINT NOT NULL REFERENCES customer(id),
+    duplicate_id BIGINT NOT NULL REFERENCES customer(id),
+    transaction_ids BIGINT[] NOT NULL DEFAULT '{}',
+    merged_by VARCHAR(100) NOT NULL,
+    merged_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    undone_by VARCHAR(100),
+    undone_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_customer_merge_survivor ON customer_merge (survivor_id);
+CREATE INDEX IF NOT EXISTS idx_customer_merge_duplicate ON customer_merge (duplicate_id);
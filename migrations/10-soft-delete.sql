@@ -0,0 +1,10 @@
+-- Companies, customers and products are soft-deleted: deleted_at is stamped
+-- and reads skip the row unless asked for deleted records, so the
+-- transactions that reference them keep their history. A hard purge is
+-- only allowed once nothing references the row anymore.
+
+ALTER TABLE company ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE customer ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE product ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_transaction_product ON transaction (product_id);
@@ -0,0 +1,29 @@
+-- Every write to a company, customer or product bumps its version, which the
+-- API exposes as the ETag for optimistic concurrency control. The trigger
+-- covers writes that do not go through the update endpoints too (merges,
+-- photos, key rotation), so an ETag never outlives a change to the row.
+ALTER TABLE company ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE customer ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE product ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+
+CREATE OR REPLACE FUNCTION bump_row_version() RETURNS trigger AS $$
+BEGIN
+    NEW.version := OLD.version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS company_bump_version ON company;
+CREATE TRIGGER company_bump_version
+    BEFORE UPDATE ON company
+    FOR EACH ROW EXECUTE FUNCTION bump_row_version();
+
+DROP TRIGGER IF EXISTS customer_bump_version ON customer;
+CREATE TRIGGER customer_bump_version
+    BEFORE UPDATE ON customer
+    FOR EACH ROW EXECUTE FUNCTION bump_row_version();
+
+DROP TRIGGER IF EXISTS product_bump_version ON product;
+CREATE TRIGGER product_bump_version
+    BEFORE UPDATE ON product
+    FOR EACH ROW EXECUTE FUNCTION bump_row_version();
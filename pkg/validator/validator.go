@@ -1 +1,97 @@
 package validator
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"github.com/nyaruka/phonenumbers"
+)
+
+// DefaultRegion is assumed for numbers written without a country code, such
+// as "0812-3456-7890".
+const DefaultRegion = "ID"
+
+const maxEmailLength = 254
+
+var (
+	ErrInvalidPhone = errors.New("invalid phone number")
+	ErrInvalidEmail = errors.New("invalid email address")
+)
+
+// Phone parses a phone number as people type it and returns it in E.164 form,
+// e.g. "+6281234567890". Numbers without a country code are read as
+// Indonesian; "+", "00" and "62" prefixes are all understood.
+func Phone(raw string) (string, error) {
+	return PhoneInRegion(raw, DefaultRegion)
+}
+
+// PhoneInRegion is Phone with a different default region, given as an
+// ISO 3166-1 alpha-2 code.
+func PhoneInRegion(raw, region string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", fmt.Errorf("%w: empty", ErrInvalidPhone)
+	}
+
+	num, err := phonenumbers.Parse(raw, region)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidPhone, err)
+	}
+
+	// A leading "62" without "+" parses as a national number starting with
+	// 62, and "00" is not Indonesia's international prefix; retry both as a
+	// country code before giving up.
+	if !phonenumbers.IsValidNumber(num) && !strings.HasPrefix(raw, "+") {
+		var intl string
+		switch d := digits(raw); {
+		case strings.HasPrefix(d, "00"):
+			intl = "+" + d[2:]
+		case strings.HasPrefix(d, "62"):
+			intl = "+" + d
+		}
+		if intl != "" {
+			if alt, err := phonenumbers.Parse(intl, region); err == nil && phonenumbers.IsValidNumber(alt) {
+				num = alt
+			}
+		}
+	}
+	if !phonenumbers.IsValidNumber(num) {
+		return "", fmt.Errorf("%w: not a valid number for its region", ErrInvalidPhone)
+	}
+
+	return phonenumbers.Format(num, phonenumbers.E164), nil
+}
+
+// Email checks that s is a bare address ("name@example.com", no display name)
+// with a dotted domain, and returns it trimmed with the domain lowercased.
+// The local part keeps its case, which some mail servers honour.
+func Email(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || len(s) > maxEmailLength {
+		return "", ErrInvalidEmail
+	}
+
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Name != "" || addr.Address != s {
+		return "", ErrInvalidEmail
+	}
+
+	at := strings.LastIndex(s, "@")
+	local, domain := s[:at], strings.ToLower(s[at+1:])
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") ||
+		strings.Contains(domain, "..") {
+		return "", ErrInvalidEmail
+	}
+	return local + "@" + domain, nil
+}
+
+func digits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
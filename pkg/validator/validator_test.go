@@ -0,0 +1,83 @@
+package validator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPhoneInRegion(t *testing.T) {
+	cases := []struct {
+		raw, region, want string
+	}{
+		{"0812-3456-7890", "ID", "+6281234567890"},
+		{" 0812 3456 7890 ", "ID", "+6281234567890"},
+		{"+62 812 3456 7890", "ID", "+6281234567890"},
+		// "62..." without "+" is retried as a country code.
+		{"6281234567890", "ID", "+6281234567890"},
+		{"62 812-3456-7890", "ID", "+6281234567890"},
+		// "00" is retried as the international prefix, for any country.
+		{"006281234567890", "ID", "+6281234567890"},
+		{"00 44 20 7946 0958", "ID", "+442079460958"},
+		{"0044 20 7946 0958", "US", "+442079460958"},
+		// The region decides how national numbers are read.
+		{"020 7946 0958", "GB", "+442079460958"},
+		{"(202) 555-0143", "US", "+12025550143"},
+		// A "62" number that is valid in the region is not retried.
+		{"620-555-0143", "US", "+16205550143"},
+	}
+	for _, tc := range cases {
+		got, err := PhoneInRegion(tc.raw, tc.region)
+		if tc.want == "" {
+			assert.ErrorIs(t, err, ErrInvalidPhone, tc.raw)
+			continue
+		}
+		if assert.NoError(t, err, tc.raw) {
+			assert.Equal(t, tc.want, got, tc.raw)
+		}
+	}
+}
+
+func TestPhoneRejects(t *testing.T) {
+	for _, raw := range []string{"", "   ", "not a phone", "12", "+62 12", "997-474-3385", "00", "62", "+0044 20 7946 0958"} {
+		_, err := Phone(raw)
+		assert.ErrorIs(t, err, ErrInvalidPhone, raw)
+	}
+}
+
+func TestEmail(t *testing.T) {
+	cases := []struct {
+		raw, want string
+	}{
+		{"casey@example.com", "casey@example.com"},
+		{"  casey@example.com ", "casey@example.com"},
+		// The domain is lowercased; the local part keeps its case.
+		{"Casey.Pandey@Example.COM", "Casey.Pandey@example.com"},
+		{"casey+orders@mail.example.co.id", "casey+orders@mail.example.co.id"},
+		// Display names and angle brackets are not bare addresses.
+		{"Casey <casey@example.com>", ""},
+		{"<casey@example.com>", ""},
+		{`"Casey" <casey@example.com>`, ""},
+		{"casey@example.com (Casey)", ""},
+		// The domain must be dotted, without empty labels at either end.
+		{"casey@localhost", ""},
+		{"casey@.example.com", ""},
+		{"casey@example.com.", ""},
+		{"casey@example..com", ""},
+		{"casey", ""},
+		{"@example.com", ""},
+		{"", ""},
+		{"a@" + strings.Repeat("x", 250) + ".com", ""},
+	}
+	for _, tc := range cases {
+		got, err := Email(tc.raw)
+		if tc.want == "" {
+			assert.ErrorIs(t, err, ErrInvalidEmail, tc.raw)
+			continue
+		}
+		if assert.NoError(t, err, tc.raw) {
+			assert.Equal(t, tc.want, got, tc.raw)
+		}
+	}
+}
@@ -1,9 +1,12 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
 CREATE TABLE IF NOT EXISTS company (
     id BIGINT PRIMARY KEY,
   	name VARCHAR(25) NOT NULL,
 	type VARCHAR(25) NOT NULL,
 	address VARCHAR(255) NOT NULL,
-	city VARCHAR(100) NOT NULL
+	city VARCHAR(100) NOT NULL,
+	deleted_at TIMESTAMPTZ
 );
 
 CREATE TABLE IF NOT EXISTS customer (
@@ -11,19 +14,41 @@ CREATE TABLE IF NOT EXISTS customer (
     first_name VARCHAR(50) NOT NULL,
     last_name VARCHAR(50) NOT NULL,
     birth_date DATE,
-    email VARCHAR(100) UNIQUE,
-    phone_number VARCHAR(20),
-    address VARCHAR(255),
+    email TEXT,
+    phone_number TEXT,
+    phone_e164 TEXT,
+    address TEXT,
     gender VARCHAR(25),
     company BIGINT NOT NULL REFERENCES company(id),
-    photo TEXT
+    photo TEXT,
+    photo_key VARCHAR(255),
+    photo_thumb_key VARCHAR(255),
+    email_bidx CHAR(64),
+    phone_bidx CHAR(64),
+    phone_suffix_bidx CHAR(64),
+    pii_key_id VARCHAR(64),
+    merged_into BIGINT REFERENCES customer(id),
+    merged_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    search_name TEXT GENERATED ALWAYS AS (lower(first_name || ' ' || last_name)) STORED,
+    search_tsv TSVECTOR GENERATED ALWAYS AS (to_tsvector('simple', first_name || ' ' || last_name)) STORED
 );
 
+CREATE UNIQUE INDEX IF NOT EXISTS customer_email_bidx_key ON customer (email_bidx);
+CREATE INDEX IF NOT EXISTS idx_customer_pii_key_id ON customer (pii_key_id);
+CREATE INDEX IF NOT EXISTS idx_customer_search_name_trgm ON customer USING GIN (search_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_customer_search_tsv ON customer USING GIN (search_tsv);
+CREATE INDEX IF NOT EXISTS idx_customer_phone_bidx ON customer (phone_bidx);
+CREATE INDEX IF NOT EXISTS idx_customer_phone_suffix_bidx ON customer (phone_suffix_bidx);
+CREATE INDEX IF NOT EXISTS idx_customer_company ON customer (company);
+CREATE INDEX IF NOT EXISTS idx_customer_birth_date ON customer (birth_date);
+
 CREATE TABLE IF NOT EXISTS product (
     id BIGINT PRIMARY KEY,
     product_name VARCHAR(100) NOT NULL,
     service_fee NUMERIC(15, 2) NOT NULL ,
-    service_fee_percentage BOOL NOT NULL 
+    service_fee_percentage BOOL NOT NULL,
+    deleted_at TIMESTAMPTZ
 );
 
 CREATE TABLE IF NOT EXISTS transaction (
@@ -38,3 +63,117 @@ CREATE TABLE IF NOT EXISTS transaction (
     product_id BIGINT NOT NULL REFERENCES product(id)
 );
 
+CREATE TABLE IF NOT EXISTS transaction_daily_rollup (
+    day DATE NOT NULL,
+    company_id BIGINT NOT NULL REFERENCES company(id),
+    product_id BIGINT NOT NULL REFERENCES product(id),
+    transaction_type VARCHAR(20) NOT NULL,
+    payment_status VARCHAR(20) NOT NULL,
+    trx_count BIGINT NOT NULL DEFAULT 0,
+    amount NUMERIC(18, 2) NOT NULL DEFAULT 0,
+    tax_amount NUMERIC(18, 2) NOT NULL DEFAULT 0,
+    fee_amount NUMERIC(18, 2) NOT NULL DEFAULT 0,
+    first_trx_on TIMESTAMP NOT NULL,
+    id_first_trx BIGINT NOT NULL,
+    last_trx_on TIMESTAMP NOT NULL,
+    id_last_trx BIGINT NOT NULL,
+    refreshed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (day, company_id, product_id, transaction_type, payment_status)
+);
+
+CREATE INDEX IF NOT EXISTS idx_rollup_company_product_day ON transaction_daily_rollup (company_id, product_id, day);
+CREATE INDEX IF NOT EXISTS idx_transaction_datetime ON transaction (transaction_datetime);
+CREATE INDEX IF NOT EXISTS idx_transaction_customer ON transaction (customer_id);
+CREATE INDEX IF NOT EXISTS idx_transaction_product ON transaction (product_id);
+
+CREATE TABLE IF NOT EXISTS transaction_attachment (
+    id UUID PRIMARY KEY,
+    transaction_id BIGINT NOT NULL REFERENCES transaction(id),
+    company_id BIGINT NOT NULL REFERENCES company(id),
+    kind VARCHAR(32) NOT NULL,
+    file_name VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    sha256 CHAR(64) NOT NULL,
+    uploaded_by VARCHAR(100) NOT NULL,
+    scan_status VARCHAR(20) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS transaction_attachment_checksum_key ON transaction_attachment (transaction_id, sha256);
+CREATE INDEX IF NOT EXISTS idx_transaction_attachment_company ON transaction_attachment (company_id);
+
+CREATE TABLE IF NOT EXISTS customer_merge (
+    id BIGSERIAL PRIMARY KEY,
+    survivor_id BIGINT NOT NULL REFERENCES customer(id),
+    duplicate_id BIGINT NOT NULL REFERENCES customer(id),
+    transaction_ids BIGINT[] NOT NULL DEFAULT '{}',
+    merged_by VARCHAR(100) NOT NULL,
+    merged_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    undone_by VARCHAR(100),
+    undone_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_customer_merge_survivor ON customer_merge (survivor_id);
+CREATE INDEX IF NOT EXISTS idx_customer_merge_duplicate ON customer_merge (duplicate_id);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    entity VARCHAR(50) NOT NULL,
+    entity_id VARCHAR(64) NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    actor VARCHAR(100) NOT NULL,
+    actor_role VARCHAR(50),
+    request_id VARCHAR(128),
+    diff JSON NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    prev_hash CHAR(64) NOT NULL,
+    hash CHAR(64) NOT NULL UNIQUE
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log (entity, entity_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log (actor);
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log (created_at);
+
+-- The log is append-only for the application; the hash chain covers anyone
+-- who gets around this.
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+-- Every write to a company, customer or product bumps its version, which the
+-- API exposes as the ETag for optimistic concurrency control. The trigger
+-- covers writes that do not go through the update endpoints too (merges,
+-- photos, key rotation), so an ETag never outlives a change to the row.
+ALTER TABLE company ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE customer ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE product ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+
+CREATE OR REPLACE FUNCTION bump_row_version() RETURNS trigger AS $$
+BEGIN
+    NEW.version := OLD.version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS company_bump_version ON company;
+CREATE TRIGGER company_bump_version
+    BEFORE UPDATE ON company
+    FOR EACH ROW EXECUTE FUNCTION bump_row_version();
+
+DROP TRIGGER IF EXISTS customer_bump_version ON customer;
+CREATE TRIGGER customer_bump_version
+    BEFORE UPDATE ON customer
+    FOR EACH ROW EXECUTE FUNCTION bump_row_version();
+
+DROP TRIGGER IF EXISTS product_bump_version ON product;
+CREATE TRIGGER product_bump_version
+    BEFORE UPDATE ON product
+    FOR EACH ROW EXECUTE FUNCTION bump_row_version();